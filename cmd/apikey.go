@@ -0,0 +1,57 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/eterrni/payments-api/internal/app"
+	"github.com/eterrni/payments-api/internal/config"
+	service "github.com/eterrni/payments-api/internal/services"
+)
+
+var errAPIKeyUsage = errors.New("usage: payments-api apikey issue -merchant ID -scopes read,write,refund,admin [-name NAME]")
+
+// runAPIKey implements the apikey subcommand, which issues keys straight
+// into the database. It is how the first key is issued when the admin API
+// is not enabled.
+func runAPIKey(cfg *config.Config, args []string) error {
+	if len(args) == 0 || args[0] != "issue" {
+		return errAPIKeyUsage
+	}
+	fs := flag.NewFlagSet("apikey issue", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	merchantID := fs.String("merchant", "", `merchant the key belongs to, "" for the default merchant`)
+	scopes := fs.String("scopes", "", "comma-separated scopes of the key")
+	name := fs.String("name", "", "name of the key")
+	if err := fs.Parse(args[1:]); err != nil || fs.NArg() != 0 {
+		return errAPIKeyUsage
+	}
+	if cfg.DB.Driver == config.DriverMemory {
+		return errors.New("apikey issue needs a database, the memory driver keeps no keys")
+	}
+
+	storage, err := app.OpenStorage(cfg.DB)
+	if err != nil {
+		return err
+	}
+	defer storage.Close()
+	req := service.IssueKeyRequest{MerchantID: merchantID, Name: *name}
+	if *scopes != "" {
+		req.Scopes = strings.Split(*scopes, ",")
+	}
+	keys := service.NewAPIKeyService(storage.APIKeys)
+	issued, err := keys.IssueKey(context.Background(), req)
+	if err != nil {
+		return err
+	}
+	// The secret cannot be retrieved again, so it goes to stdout alone
+	// while the details go to stderr.
+	fmt.Fprintf(os.Stderr, "Issued API key %d for merchant %q\n", issued.APIKey.ID, issued.APIKey.MerchantID)
+	fmt.Println(issued.Key)
+	return nil
+}
@@ -1,57 +1,89 @@
 package main
 
 import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
 	"log"
-	"net/http"
+	"log/slog"
 	"os"
-	"strings"
-	"time"
-
-	"github.com/eterrni/payments-api/internal/handlers"
-	"github.com/eterrni/payments-api/internal/repository"
-	service "github.com/eterrni/payments-api/internal/services"
-	"github.com/eterrni/payments-api/pkg/middleware"
-	"github.com/gorilla/mux"
-	"github.com/jinzhu/gorm"
-	_ "github.com/jinzhu/gorm/dialects/postgres"
-)
+	"os/signal"
+	"syscall"
 
-var db *gorm.DB
+	"github.com/eterrni/payments-api/internal/app"
+	"github.com/eterrni/payments-api/internal/config"
+)
 
-func init() {
+func main() {
 	log.SetFlags(log.LstdFlags | log.Lshortfile)
 
-	var err error
-	dsn := os.Getenv("DB_DSN")
-	if dsn != "" && !strings.Contains(dsn, "sslmode=") {
-		dsn = strings.TrimSpace(dsn) + " sslmode=disable"
+	cfg, args, err := config.Load(os.Args[1:], os.Getenv)
+	if errors.Is(err, flag.ErrHelp) {
+		fmt.Fprintln(os.Stderr, "usage: payments-api [flags] [migrate up|down|status|to N | config print | apikey issue]")
+		config.Usage(os.Stderr)
+		return
 	}
-	db, err = gorm.Open("postgres", dsn)
 	if err != nil {
-		log.Fatalf("Could not connect to the database: %v", err)
+		log.Fatalf("Invalid configuration: %v", err)
 	}
+	slog.SetDefault(slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: cfg.Log.SlogLevel()})))
 
-	db.AutoMigrate(&repository.Payment{})
-}
+	if len(args) > 0 {
+		if err := runCommand(cfg, args); err != nil {
+			fatal(args[0], err)
+		}
+		return
+	}
 
-func main() {
-	r := mux.NewRouter()
+	a, err := app.New(cfg)
+	if err != nil {
+		fatal("Could not connect to the database", err)
+	}
 
-	r.Use(middleware.LoggingMiddleware)
-	r.Use(middleware.RecoveryMiddleware)
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+	// A second signal while draining kills the process immediately.
+	a.OnShutdown(stop)
 
-	paymentSvc := service.NewPaymentService(repository.NewPaymentRepository(db))
-	ph := handlers.NewPaymentHandler(&paymentSvc)
-	r.HandleFunc("/payments", ph.CreatePayment).Methods("POST")
-	r.HandleFunc("/payments/{id}", ph.GetPayment).Methods("GET")
-	r.HandleFunc("/payments/{id}", ph.UpdatePayment).Methods("PUT")
-	r.HandleFunc("/payments/{id}", ph.DeletePayment).Methods("DELETE")
+	if err := a.Start(); err != nil {
+		a.Stop()
+		fatal("Could not start server", err)
+	}
+	select {
+	case <-ctx.Done():
+	case <-a.Done():
+	}
+	if err := a.Stop(); err != nil {
+		fatal("Server stopped", err)
+	}
+	slog.Info("Server stopped")
+}
+
+// fatal logs err and exits. Before the configuration is loaded log.Fatalf
+// is used instead, since the log level is not known yet.
+func fatal(msg string, err error) {
+	slog.Error(msg, "error", err)
+	os.Exit(1)
+}
 
-	srv := &http.Server{
-		Handler:      r,
-		Addr:         ":8080",
-		WriteTimeout: 15 * time.Second,
-		ReadTimeout:  15 * time.Second,
+// runCommand runs a subcommand instead of the server.
+func runCommand(cfg *config.Config, args []string) error {
+	switch args[0] {
+	case "config":
+		if len(args) != 2 || args[1] != "print" {
+			return errors.New("usage: payments-api config print")
+		}
+		return cfg.Print(os.Stdout)
+	case "migrate":
+		db, err := app.OpenDB(cfg.DB)
+		if err != nil {
+			return err
+		}
+		defer db.Close()
+		return runMigrate(db, args[1:])
+	case "apikey":
+		return runAPIKey(cfg, args[1:])
 	}
-	log.Fatal(srv.ListenAndServe())
+	return fmt.Errorf("unknown command %q", args[0])
 }
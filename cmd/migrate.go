@@ -0,0 +1,60 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"text/tabwriter"
+
+	"github.com/eterrni/payments-api/internal/migrations"
+	"github.com/jinzhu/gorm"
+)
+
+var errMigrateUsage = errors.New("usage: payments-api migrate up|down|status|to N")
+
+// runMigrate implements the migrate subcommand so that deploys can migrate
+// the schema as a separate step before rolling out new replicas.
+func runMigrate(db *gorm.DB, args []string) error {
+	if len(args) == 0 {
+		return errMigrateUsage
+	}
+	m, err := migrations.New(db.DB(), db.Dialect().GetName())
+	if err != nil {
+		return err
+	}
+	ctx := context.Background()
+
+	switch args[0] {
+	case "up":
+		return m.Up(ctx)
+	case "down":
+		return m.Down(ctx)
+	case "to":
+		if len(args) != 2 {
+			return errMigrateUsage
+		}
+		version, err := strconv.Atoi(args[1])
+		if err != nil {
+			return fmt.Errorf("invalid version %q", args[1])
+		}
+		return m.To(ctx, version)
+	case "status":
+		statuses, err := m.Status(ctx)
+		if err != nil {
+			return err
+		}
+		tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(tw, "VERSION\tNAME\tAPPLIED AT")
+		for _, s := range statuses {
+			applied := "pending"
+			if s.AppliedAt != nil {
+				applied = s.AppliedAt.Format("2006-01-02 15:04:05 MST")
+			}
+			fmt.Fprintf(tw, "%d\t%s\t%s\n", s.Version, s.Name, applied)
+		}
+		return tw.Flush()
+	}
+	return errMigrateUsage
+}
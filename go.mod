@@ -5,9 +5,9 @@ go 1.25.6
 require (
 	github.com/gorilla/mux v1.8.1
 	github.com/jinzhu/gorm v1.9.16
+	github.com/lib/pq v1.1.1
+	github.com/mattn/go-sqlite3 v1.14.52
+	gopkg.in/yaml.v3 v3.0.1
 )
 
-require (
-	github.com/jinzhu/inflection v1.0.0 // indirect
-	github.com/lib/pq v1.1.1 // indirect
-)
+require github.com/jinzhu/inflection v1.0.0 // indirect
@@ -0,0 +1,82 @@
+// Package apikey generates and checks API keys. A key has the form
+// "pay_<prefix>_<secret>": the prefix is public and identifies the key, the
+// secret is only shown once when the key is issued. Only a hash of the
+// secret is stored.
+package apikey
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"slices"
+	"strings"
+)
+
+// Scopes limit what a key may do. ScopeAdmin includes every other scope.
+const (
+	ScopeRead   = "read"
+	ScopeWrite  = "write"
+	ScopeRefund = "refund"
+	ScopeAdmin  = "admin"
+)
+
+// Scopes lists every scope.
+var Scopes = []string{ScopeRead, ScopeWrite, ScopeRefund, ScopeAdmin}
+
+const (
+	tag          = "pay_"
+	prefixBytes  = 6
+	secretBytes  = 32
+	prefixLength = 2 * prefixBytes
+)
+
+// Generate returns a new key, its prefix and the hash of its secret.
+func Generate() (key, prefix, hash string, err error) {
+	b := make([]byte, prefixBytes+secretBytes)
+	if _, err := rand.Read(b); err != nil {
+		return "", "", "", err
+	}
+	prefix = hex.EncodeToString(b[:prefixBytes])
+	secret := hex.EncodeToString(b[prefixBytes:])
+	return tag + prefix + "_" + secret, prefix, Hash(secret), nil
+}
+
+// Parse splits key into its prefix and secret. ok is false if key is not
+// shaped like an API key.
+func Parse(key string) (prefix, secret string, ok bool) {
+	rest, found := strings.CutPrefix(key, tag)
+	if !found {
+		return "", "", false
+	}
+	prefix, secret, found = strings.Cut(rest, "_")
+	if !found || len(prefix) != prefixLength || len(secret) != 2*secretBytes {
+		return "", "", false
+	}
+	return prefix, secret, true
+}
+
+// Hash returns the hash stored for secret. The secrets are random, so a
+// plain SHA-256 is enough to keep a leaked table from revealing them.
+func Hash(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
+
+// Matches reports whether secret hashes to hash, in constant time.
+func Matches(secret, hash string) bool {
+	return subtle.ConstantTimeCompare([]byte(Hash(secret)), []byte(hash)) == 1
+}
+
+// ValidScope reports whether scope is one of Scopes.
+func ValidScope(scope string) bool {
+	return slices.Contains(Scopes, scope)
+}
+
+// Expand returns scopes with every scope ScopeAdmin includes added.
+func Expand(scopes []string) []string {
+	if slices.Contains(scopes, ScopeAdmin) {
+		return slices.Clone(Scopes)
+	}
+	return slices.Clone(scopes)
+}
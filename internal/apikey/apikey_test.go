@@ -0,0 +1,57 @@
+package apikey
+
+import (
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestGenerate(t *testing.T) {
+	key, prefix, hash, err := Generate()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	gotPrefix, secret, ok := Parse(key)
+	if !ok || gotPrefix != prefix {
+		t.Fatalf("Parse(%q) = %q, %v, want prefix %q", key, gotPrefix, ok, prefix)
+	}
+	if !Matches(secret, hash) {
+		t.Error("secret does not match its hash")
+	}
+	if Matches(strings.Repeat("0", len(secret)), hash) {
+		t.Error("another secret matches the hash")
+	}
+	if strings.Contains(hash, secret) {
+		t.Error("hash contains the secret")
+	}
+
+	other, _, _, _ := Generate()
+	if other == key {
+		t.Error("two keys are the same")
+	}
+}
+
+func TestParse(t *testing.T) {
+	secret := strings.Repeat("a", 64)
+	for _, key := range []string{
+		"",
+		"acme-secret-token",
+		"pay_0123456789ab" + secret,
+		"pay_0123456789a_" + secret,
+		"pay_0123456789ab_" + secret[1:],
+		"key_0123456789ab_" + secret,
+	} {
+		if _, _, ok := Parse(key); ok {
+			t.Errorf("Parse(%q) succeeded", key)
+		}
+	}
+}
+
+func TestExpand(t *testing.T) {
+	if got := Expand([]string{ScopeRead}); !slices.Equal(got, []string{ScopeRead}) {
+		t.Errorf("got %v", got)
+	}
+	if got := Expand([]string{ScopeAdmin}); !slices.Equal(got, Scopes) {
+		t.Errorf("got %v, want every scope", got)
+	}
+}
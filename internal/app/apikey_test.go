@@ -0,0 +1,200 @@
+package app
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/eterrni/payments-api/internal/config"
+)
+
+const adminToken = "admin-secret-token"
+
+func apiKeyConfig() *config.Config {
+	cfg := testConfig()
+	cfg.Admin.Token = adminToken
+	cfg.Features.APIKeys = true
+	cfg.Features.Unauthenticated = false
+	return cfg
+}
+
+// TestApp_APIKeys issues keys through the admin API and uses them on the
+// merchant API.
+func TestApp_APIKeys(t *testing.T) {
+	t.Run("memory", func(t *testing.T) {
+		testAPIKeys(t, NewWithStorage(apiKeyConfig(), MemoryStorage()))
+	})
+	t.Run("sqlite", func(t *testing.T) {
+		cfg := apiKeyConfig()
+		cfg.DB.Driver = config.DriverSQLite
+		cfg.DB.DSN = filepath.Join(t.TempDir(), "payments.db")
+		a, err := New(cfg)
+		if err != nil {
+			t.Fatalf("new: %v", err)
+		}
+		defer a.Stop()
+		testAPIKeys(t, a)
+	})
+}
+
+type issuedKey struct {
+	ID         uint     `json:"id"`
+	MerchantID string   `json:"merchant_id"`
+	Prefix     string   `json:"prefix"`
+	Scopes     []string `json:"scopes"`
+	LastUsedAt *string  `json:"last_used_at"`
+	Key        string   `json:"key"`
+}
+
+func testAPIKeys(t *testing.T, a *App) {
+	admin := as(a, adminToken)
+	issue := func(client merchantClient, path, body string) issuedKey {
+		t.Helper()
+		w := client(http.MethodPost, path, body)
+		var k issuedKey
+		if err := json.NewDecoder(w.Body).Decode(&k); err != nil || w.Code != http.StatusCreated {
+			t.Fatalf("issue %s: got status %d, error %v", body, w.Code, err)
+		}
+		return k
+	}
+	status := func(client merchantClient, method, path, body string) int {
+		return client(method, path, body).Code
+	}
+
+	acmeAdmin := issue(admin, "/admin/api-keys", `{"merchant_id": "acme", "name": "dashboard", "scopes": ["admin"]}`)
+	reader := issue(admin, "/admin/api-keys", `{"merchant_id": "acme", "scopes": ["read"]}`)
+	writer := issue(admin, "/admin/api-keys", `{"merchant_id": "acme", "scopes": ["read", "write"]}`)
+	globex := issue(admin, "/admin/api-keys", `{"merchant_id": "globex", "scopes": ["read", "write", "refund"]}`)
+	if acmeAdmin.MerchantID != "acme" || !strings.HasPrefix(acmeAdmin.Key, "pay_"+acmeAdmin.Prefix+"_") {
+		t.Fatalf("got key %+v", acmeAdmin)
+	}
+
+	t.Run("credentials", func(t *testing.T) {
+		for _, token := range []string{"", "guess", adminToken, "pay_" + acmeAdmin.Prefix + "_" + strings.Repeat("0", 64)} {
+			if got := status(as(a, token), http.MethodGet, "/payments", ""); got != http.StatusUnauthorized {
+				t.Errorf("token %q: got status %d, want %d", token, got, http.StatusUnauthorized)
+			}
+		}
+		if got := status(as(a, acmeAdmin.Key), http.MethodGet, "/admin/api-keys", ""); got != http.StatusUnauthorized {
+			t.Errorf("admin API with an API key: got status %d, want %d", got, http.StatusUnauthorized)
+		}
+	})
+
+	t.Run("admin names the merchant", func(t *testing.T) {
+		w := admin(http.MethodPost, "/admin/api-keys", `{"scopes": ["read"]}`)
+		if w.Code != http.StatusUnprocessableEntity || !strings.Contains(w.Body.String(), `"field":"merchant_id"`) {
+			t.Errorf("without merchant_id: got status %d: %s", w.Code, w.Body)
+		}
+		if k := issue(admin, "/admin/api-keys", `{"merchant_id": "", "scopes": ["read"]}`); k.MerchantID != "" {
+			t.Errorf("got key of merchant %q, want the default merchant", k.MerchantID)
+		}
+	})
+
+	t.Run("scopes", func(t *testing.T) {
+		payment := `{"amount_minor": 1000, "currency": "USD"}`
+		tests := []struct {
+			key          string
+			method, path string
+			body         string
+			want         int
+		}{
+			{reader.Key, http.MethodGet, "/payments", "", http.StatusOK},
+			{reader.Key, http.MethodGet, "/ledger/entries", "", http.StatusOK},
+			{reader.Key, http.MethodPost, "/payments", payment, http.StatusForbidden},
+			{reader.Key, http.MethodPost, "/customers", `{}`, http.StatusForbidden},
+			{writer.Key, http.MethodPost, "/payments", payment, http.StatusCreated},
+			{writer.Key, http.MethodPost, "/payments/1/refunds", `{"amount_minor": 1}`, http.StatusForbidden},
+			{writer.Key, http.MethodGet, "/api-keys", "", http.StatusForbidden},
+			{acmeAdmin.Key, http.MethodPost, "/payments", payment, http.StatusCreated},
+			{acmeAdmin.Key, http.MethodGet, "/payments/1/refunds", "", http.StatusOK},
+		}
+		for _, tt := range tests {
+			if got := status(as(a, tt.key), tt.method, tt.path, tt.body); got != tt.want {
+				t.Errorf("%s %s with %s: got status %d, want %d", tt.method, tt.path, tt.key[:16], got, tt.want)
+			}
+		}
+	})
+
+	t.Run("merchants manage their own keys", func(t *testing.T) {
+		own := as(a, acmeAdmin.Key)
+		k := issue(own, "/api-keys", `{"name": "ci", "scopes": ["read"]}`)
+		if k.MerchantID != "acme" {
+			t.Errorf("got key of merchant %q, want acme", k.MerchantID)
+		}
+		w := own(http.MethodPost, "/api-keys", `{"merchant_id": "globex", "scopes": ["read"]}`)
+		if w.Code != http.StatusUnprocessableEntity {
+			t.Errorf("key for another merchant: got status %d, want %d", w.Code, http.StatusUnprocessableEntity)
+		}
+		w = own(http.MethodGet, "/api-keys", "")
+		if w.Code != http.StatusOK || strings.Contains(w.Body.String(), globex.Prefix) || !strings.Contains(w.Body.String(), reader.Prefix) {
+			t.Errorf("got status %d: %s", w.Code, w.Body)
+		}
+		if strings.Contains(w.Body.String(), "secret_hash") || strings.Contains(w.Body.String(), `"key"`) {
+			t.Errorf("list shows secrets: %s", w.Body)
+		}
+		for _, req := range [][2]string{
+			{http.MethodGet, "/api-keys/" + fmt.Sprint(globex.ID)},
+			{http.MethodDelete, "/api-keys/" + fmt.Sprint(globex.ID)},
+			{http.MethodPost, "/api-keys/" + fmt.Sprint(globex.ID) + "/rotate"},
+		} {
+			if got := status(own, req[0], req[1], ""); got != http.StatusNotFound {
+				t.Errorf("%s %s: got status %d, want %d", req[0], req[1], got, http.StatusNotFound)
+			}
+		}
+	})
+
+	t.Run("last use", func(t *testing.T) {
+		w := admin(http.MethodGet, "/admin/api-keys/"+fmt.Sprint(reader.ID), "")
+		var k issuedKey
+		if err := json.NewDecoder(w.Body).Decode(&k); err != nil || w.Code != http.StatusOK {
+			t.Fatalf("get: got status %d, error %v", w.Code, err)
+		}
+		if k.LastUsedAt == nil {
+			t.Error("last use not recorded")
+		}
+	})
+
+	t.Run("rotation", func(t *testing.T) {
+		w := admin(http.MethodPost, "/admin/api-keys/"+fmt.Sprint(reader.ID)+"/rotate", `{"overlap": "1h"}`)
+		var replacement issuedKey
+		if err := json.NewDecoder(w.Body).Decode(&replacement); err != nil || w.Code != http.StatusCreated {
+			t.Fatalf("rotate: got status %d, error %v", w.Code, err)
+		}
+		if replacement.MerchantID != "acme" || len(replacement.Scopes) != 1 || replacement.Scopes[0] != "read" {
+			t.Errorf("got replacement %+v", replacement)
+		}
+		for _, key := range []string{reader.Key, replacement.Key} {
+			if got := status(as(a, key), http.MethodGet, "/payments", ""); got != http.StatusOK {
+				t.Errorf("during the overlap: got status %d, want %d", got, http.StatusOK)
+			}
+		}
+
+		w = as(a, acmeAdmin.Key)(http.MethodPost, "/api-keys/"+fmt.Sprint(replacement.ID)+"/rotate", `{"overlap": "0s"}`)
+		if w.Code != http.StatusCreated {
+			t.Fatalf("rotate without overlap: got status %d: %s", w.Code, w.Body)
+		}
+		if got := status(as(a, replacement.Key), http.MethodGet, "/payments", ""); got != http.StatusUnauthorized {
+			t.Errorf("key rotated without overlap: got status %d, want %d", got, http.StatusUnauthorized)
+		}
+		if got := status(admin, http.MethodPost, "/admin/api-keys/"+fmt.Sprint(replacement.ID)+"/rotate", ""); got != http.StatusConflict {
+			t.Errorf("rotate an expired key: got status %d, want %d", got, http.StatusConflict)
+		}
+	})
+
+	t.Run("revocation", func(t *testing.T) {
+		if got := status(admin, http.MethodDelete, "/admin/api-keys/"+fmt.Sprint(writer.ID), ""); got != http.StatusOK {
+			t.Fatalf("revoke: got status %d", got)
+		}
+		if got := status(as(a, writer.Key), http.MethodGet, "/payments", ""); got != http.StatusUnauthorized {
+			t.Errorf("revoked key: got status %d, want %d", got, http.StatusUnauthorized)
+		}
+	})
+
+	t.Run("merchant isolation", func(t *testing.T) {
+		full := issue(admin, "/admin/api-keys", `{"merchant_id": "acme", "scopes": ["read", "write", "refund"]}`)
+		testMerchantIsolation(t, a, full.Key, globex.Key)
+	})
+}
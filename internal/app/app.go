@@ -0,0 +1,297 @@
+// Package app wires the configuration, storage, services and HTTP routes
+// into a runnable application.
+package app
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net"
+	"net/http"
+	"sync"
+
+	"github.com/eterrni/payments-api/internal/apikey"
+	"github.com/eterrni/payments-api/internal/config"
+	"github.com/eterrni/payments-api/internal/handlers"
+	"github.com/eterrni/payments-api/internal/health"
+	"github.com/eterrni/payments-api/internal/idempotency"
+	"github.com/eterrni/payments-api/internal/merchant"
+	"github.com/eterrni/payments-api/internal/server"
+	service "github.com/eterrni/payments-api/internal/services"
+	"github.com/eterrni/payments-api/pkg/middleware"
+	"github.com/gorilla/mux"
+)
+
+type App struct {
+	cfg      *config.Config
+	storage  *Storage
+	payments *service.PaymentService
+	handler  http.Handler
+	health   *health.Health
+	server   *server.Server
+
+	mu       sync.Mutex
+	addr     net.Addr
+	cancel   context.CancelFunc
+	done     chan struct{}
+	serveErr error
+	stopped  bool
+	// stopWorkers stop the background workers started by Start.
+	stopWorkers []func(context.Context) error
+}
+
+// New opens the storage configured in cfg and builds the app on it.
+func New(cfg *config.Config) (*App, error) {
+	storage, err := OpenStorage(cfg.DB)
+	if err != nil {
+		return nil, err
+	}
+	return NewWithStorage(cfg, storage), nil
+}
+
+// NewWithStorage builds the app on the given storage. The app owns the
+// storage from now on and closes it when stopped.
+func NewWithStorage(cfg *config.Config, storage *Storage) *App {
+	a := &App{
+		cfg:     cfg,
+		storage: storage,
+		health:  health.New(cfg.HTTP.HealthCheckTimeout),
+	}
+	for name, check := range storage.Checks {
+		a.health.Register(name, check)
+	}
+	payments := service.NewPaymentService(storage.Payments, service.PaymentOptions{
+		AuthorizationTTL: cfg.Payments.AuthorizationTTL,
+		FeeBasisPoints:   int64(cfg.Payments.FeeBasisPoints),
+	})
+	a.payments = &payments
+	a.handler = a.routes()
+
+	a.server = server.New(a.handler, cfg.HTTP)
+	a.server.OnShutdown(a.health.Shutdown)
+	a.server.OnStop(func(context.Context) error { return a.closeStorage() })
+	// Registered last, so that it runs before the storage is closed.
+	a.server.OnStop(func(ctx context.Context) error {
+		a.mu.Lock()
+		workers := a.stopWorkers
+		a.mu.Unlock()
+		var errs []error
+		for _, stop := range workers {
+			errs = append(errs, stop(ctx))
+		}
+		return errors.Join(errs...)
+	})
+	return a
+}
+
+func (a *App) routes() http.Handler {
+	cfg := a.cfg
+	r := mux.NewRouter()
+
+	if cfg.Log.SlogLevel() <= slog.LevelInfo {
+		r.Use(middleware.LoggingMiddleware)
+	}
+	r.Use(middleware.RecoveryMiddleware)
+
+	r.HandleFunc("/healthz", a.health.Liveness).Methods("GET")
+	r.HandleFunc("/readyz", a.health.Readiness).Methods("GET")
+
+	ch := handlers.NewCurrencyHandler()
+	r.HandleFunc("/currencies", ch.ListCurrencies).Methods("GET")
+
+	keySvc := service.NewAPIKeyService(a.storage.APIKeys)
+	kh := handlers.NewAPIKeyHandler(&keySvc)
+
+	if token := cfg.Admin.Token; token != "" {
+		admin := r.PathPrefix("/admin").Subrouter()
+		admin.Use(middleware.AdminAuth(token))
+		ah := handlers.NewAdminHandler(a.payments)
+		admin.HandleFunc("/payments/{id}", ah.PurgePayment).Methods("DELETE")
+		admin.HandleFunc("/api-keys", kh.IssueKey).Methods("POST")
+		admin.HandleFunc("/api-keys", kh.ListKeys).Methods("GET")
+		admin.HandleFunc("/api-keys/{id}", kh.GetKey).Methods("GET")
+		admin.HandleFunc("/api-keys/{id}", kh.RevokeKey).Methods("DELETE")
+		admin.HandleFunc("/api-keys/{id}/rotate", kh.RotateKey).Methods("POST")
+	}
+
+	// Everything else is the data of one merchant. Only when explicitly
+	// configured as unauthenticated does the API serve a single merchant
+	// without credentials; tokens that do not parse let nobody in. API
+	// keys also limit each route to the keys with its scope.
+	api := r
+	requires := func(string) func(http.Handler) http.Handler {
+		return func(h http.Handler) http.Handler { return h }
+	}
+	switch {
+	case cfg.Features.APIKeys:
+		api = r.NewRoute().Subrouter()
+		api.Use(middleware.APIKeyAuth(keyVerifier{&keySvc}), merchant.KeyMiddleware)
+		requires = middleware.RequireScope
+	case cfg.Merchants.Tokens != "":
+		tokens, _ := cfg.Merchants.TokenMap()
+		api = r.NewRoute().Subrouter()
+		api.Use(merchant.Middleware(tokens))
+	case cfg.Features.Unauthenticated:
+		slog.Warn("Merchant API accepts requests without credentials")
+	}
+	if cfg.Features.APIKeys && cfg.Admin.Token == "" {
+		slog.Info("Admin API is disabled, issue the first API key with \"apikey issue\"")
+	}
+	read, write := requires(apikey.ScopeRead), requires(apikey.ScopeWrite)
+
+	idempotent := func(h http.Handler) http.Handler { return h }
+	if cfg.Features.Idempotency {
+		idempotent = idempotency.Middleware(a.storage.Idempotency, cfg.Idempotency.KeyTTL, int64(cfg.Idempotency.MaxBodySize))
+	}
+
+	ph := handlers.NewPaymentHandler(a.payments)
+	api.Handle("/payments", write(idempotent(http.HandlerFunc(ph.CreatePayment)))).Methods("POST")
+	api.Handle("/payments", read(http.HandlerFunc(ph.ListPayments))).Methods("GET")
+	api.Handle("/payments/{id}", read(http.HandlerFunc(ph.GetPayment))).Methods("GET")
+	api.Handle("/payments/{id}", write(http.HandlerFunc(ph.UpdatePayment))).Methods("PUT")
+	api.Handle("/payments/{id}", write(http.HandlerFunc(ph.PatchPayment))).Methods("PATCH")
+	api.Handle("/payments/{id}", write(http.HandlerFunc(ph.DeletePayment))).Methods("DELETE")
+	api.Handle("/payments/{id}/authorize", write(http.HandlerFunc(ph.AuthorizePayment))).Methods("POST")
+	api.Handle("/payments/{id}/capture", write(http.HandlerFunc(ph.CapturePayment))).Methods("POST")
+	api.Handle("/payments/{id}/void", write(http.HandlerFunc(ph.VoidPayment))).Methods("POST")
+	api.Handle("/payments/{id}/settle", write(http.HandlerFunc(ph.SettlePayment))).Methods("POST")
+	api.Handle("/payments/{id}/cancel", write(http.HandlerFunc(ph.CancelPayment))).Methods("POST")
+	api.Handle("/payments/{id}/fail", write(http.HandlerFunc(ph.FailPayment))).Methods("POST")
+	api.Handle("/payments/{id}/transitions", read(http.HandlerFunc(ph.ListTransitions))).Methods("GET")
+
+	if cfg.Features.Refunds {
+		refundSvc := service.NewRefundService(a.storage.Payments, a.storage.Refunds)
+		rh := handlers.NewRefundHandler(&refundSvc)
+		refund := requires(apikey.ScopeRefund)
+		api.Handle("/payments/{id}/refunds", refund(idempotent(http.HandlerFunc(rh.CreateRefund)))).Methods("POST")
+		api.Handle("/payments/{id}/refunds", read(http.HandlerFunc(rh.ListRefunds))).Methods("GET")
+	}
+
+	customerSvc := service.NewCustomerService(a.storage.Customers, a.storage.Payments)
+	cuh := handlers.NewCustomerHandler(&customerSvc)
+	api.Handle("/customers", write(idempotent(http.HandlerFunc(cuh.CreateCustomer)))).Methods("POST")
+	api.Handle("/customers", read(http.HandlerFunc(cuh.ListCustomers))).Methods("GET")
+	api.Handle("/customers/{id}", read(http.HandlerFunc(cuh.GetCustomer))).Methods("GET")
+	api.Handle("/customers/{id}", write(http.HandlerFunc(cuh.UpdateCustomer))).Methods("PUT")
+	api.Handle("/customers/{id}", write(http.HandlerFunc(cuh.DeleteCustomer))).Methods("DELETE")
+	api.Handle("/customers/{id}/payments", read(http.HandlerFunc(cuh.ListPayments))).Methods("GET")
+
+	ledgerSvc := service.NewLedgerService(a.storage.Ledger)
+	lh := handlers.NewLedgerHandler(&ledgerSvc)
+	api.Handle("/ledger/accounts", read(http.HandlerFunc(lh.ListAccounts))).Methods("GET")
+	api.Handle("/ledger/accounts/{code}", read(http.HandlerFunc(lh.GetAccount))).Methods("GET")
+	api.Handle("/ledger/entries", read(http.HandlerFunc(lh.ListEntries))).Methods("GET")
+
+	// Merchants manage their own keys only when keys are what they sign
+	// in with.
+	if cfg.Features.APIKeys {
+		admin := requires(apikey.ScopeAdmin)
+		api.Handle("/api-keys", admin(http.HandlerFunc(kh.IssueKey))).Methods("POST")
+		api.Handle("/api-keys", admin(http.HandlerFunc(kh.ListKeys))).Methods("GET")
+		api.Handle("/api-keys/{id}", admin(http.HandlerFunc(kh.GetKey))).Methods("GET")
+		api.Handle("/api-keys/{id}", admin(http.HandlerFunc(kh.RevokeKey))).Methods("DELETE")
+		api.Handle("/api-keys/{id}/rotate", admin(http.HandlerFunc(kh.RotateKey))).Methods("POST")
+	}
+
+	return r
+}
+
+// Handler serves the whole API, e.g. for httptest.
+func (a *App) Handler() http.Handler {
+	return a.handler
+}
+
+// Health is the readiness probe, for registering additional checks.
+func (a *App) Health() *health.Health {
+	return a.health
+}
+
+// OnShutdown registers fn to run when Stop begins.
+func (a *App) OnShutdown(fn func()) {
+	a.server.OnShutdown(fn)
+}
+
+// Start listens on the configured address and serves in the background.
+func (a *App) Start() error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.done != nil || a.stopped {
+		return errors.New("app already started")
+	}
+
+	ln, err := net.Listen("tcp", a.cfg.HTTP.Addr)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	a.addr, a.cancel, a.done = ln.Addr(), cancel, make(chan struct{})
+	if a.storage.Payments != nil {
+		a.stopWorkers = append(a.stopWorkers, a.startExpiry(a.cfg.Payments.ExpiryInterval))
+	}
+	if a.storage.Idempotency != nil && a.cfg.Features.Idempotency {
+		a.stopWorkers = append(a.stopWorkers, a.startIdempotencyPurge(a.cfg.Idempotency.PurgeInterval))
+	}
+	go func() {
+		a.serveErr = a.server.Serve(ctx, ln)
+		close(a.done)
+	}()
+	slog.Info("Listening", "addr", a.addr.String())
+	return nil
+}
+
+// Addr is the address the app listens on once started.
+func (a *App) Addr() net.Addr {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.addr
+}
+
+// Done is closed when the server has stopped, either through Stop or on its
+// own because serving failed. It is nil before Start.
+func (a *App) Done() <-chan struct{} {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.done
+}
+
+// Stop shuts the app down gracefully and closes the storage. It is safe to
+// call without Start and more than once.
+func (a *App) Stop() error {
+	a.mu.Lock()
+	if a.stopped {
+		a.mu.Unlock()
+		return nil
+	}
+	a.stopped = true
+	cancel, done := a.cancel, a.done
+	a.mu.Unlock()
+
+	if done == nil {
+		return a.closeStorage()
+	}
+	cancel()
+	<-done
+	return a.serveErr
+}
+
+func (a *App) closeStorage() error {
+	if a.storage.Close == nil {
+		return nil
+	}
+	return a.storage.Close()
+}
+
+// keyVerifier checks the API keys of requests for middleware.APIKeyAuth.
+type keyVerifier struct {
+	keys *service.APIKeyService
+}
+
+func (v keyVerifier) VerifyKey(ctx context.Context, key string) (*middleware.Key, error) {
+	found, err := v.keys.VerifyKey(ctx, key)
+	if errors.Is(err, service.ErrInvalidKey) {
+		return nil, middleware.ErrInvalidKey
+	} else if err != nil {
+		return nil, err
+	}
+	return &middleware.Key{ID: found.ID, MerchantID: found.MerchantID, Scopes: apikey.Expand(found.Scopes)}, nil
+}
@@ -0,0 +1,387 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/eterrni/payments-api/internal/config"
+	"github.com/eterrni/payments-api/internal/health"
+	"github.com/eterrni/payments-api/internal/idempotency"
+)
+
+func testConfig() *config.Config {
+	cfg := config.Default()
+	cfg.HTTP.Addr = "127.0.0.1:0"
+	cfg.HTTP.ShutdownTimeout = time.Second
+	cfg.Log.Level = "error"
+	// Most tests exercise the routes, not the credentials.
+	cfg.Features.APIKeys = false
+	cfg.Features.Unauthenticated = true
+	return cfg
+}
+
+func serve(a *App, method, path string, header http.Header) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest(method, path, nil)
+	for k, v := range header {
+		r.Header[k] = v
+	}
+	a.Handler().ServeHTTP(w, r)
+	return w
+}
+
+func TestApp_Handler(t *testing.T) {
+	t.Run("routes", func(t *testing.T) {
+		a := NewWithStorage(testConfig(), MemoryStorage())
+
+		tests := []struct {
+			method, path string
+			want         int
+		}{
+			{http.MethodGet, "/healthz", http.StatusOK},
+			{http.MethodGet, "/readyz", http.StatusOK},
+			{http.MethodGet, "/currencies", http.StatusOK},
+			{http.MethodGet, "/payments/7", http.StatusNotFound},
+			{http.MethodGet, "/payments/7/refunds", http.StatusNotFound},
+			{http.MethodGet, "/payments/abc", http.StatusBadRequest},
+			{http.MethodPatch, "/currencies", http.StatusMethodNotAllowed},
+		}
+		for _, tt := range tests {
+			if w := serve(a, tt.method, tt.path, nil); w.Code != tt.want {
+				t.Errorf("%s %s: got status %d, want %d", tt.method, tt.path, w.Code, tt.want)
+			}
+		}
+	})
+
+	t.Run("readiness uses storage checks", func(t *testing.T) {
+		a := NewWithStorage(testConfig(), &Storage{Checks: map[string]health.Check{
+			"database": func(context.Context) error { return errors.New("down") },
+		}})
+
+		if w := serve(a, http.MethodGet, "/readyz", nil); w.Code != http.StatusServiceUnavailable {
+			t.Errorf("got status %d, want %d", w.Code, http.StatusServiceUnavailable)
+		}
+	})
+
+	t.Run("admin routes need a token", func(t *testing.T) {
+		a := NewWithStorage(testConfig(), &Storage{})
+		if w := serve(a, http.MethodDelete, "/admin/payments/1", nil); w.Code != http.StatusNotFound {
+			t.Errorf("without admin token: got status %d, want %d", w.Code, http.StatusNotFound)
+		}
+
+		cfg := testConfig()
+		cfg.Admin.Token = "secret"
+		a = NewWithStorage(cfg, &Storage{})
+		if w := serve(a, http.MethodDelete, "/admin/payments/1", nil); w.Code != http.StatusUnauthorized {
+			t.Errorf("with admin token: got status %d, want %d", w.Code, http.StatusUnauthorized)
+		}
+	})
+
+	t.Run("refunds can be disabled", func(t *testing.T) {
+		cfg := testConfig()
+		cfg.Features.Refunds = false
+		a := NewWithStorage(cfg, MemoryStorage())
+
+		if w := serve(a, http.MethodGet, "/payments/7/refunds", nil); w.Code != http.StatusNotFound {
+			t.Errorf("got status %d, want %d", w.Code, http.StatusNotFound)
+		}
+		if w := serve(a, http.MethodPost, "/payments/7/refunds", nil); w.Code != http.StatusNotFound {
+			t.Errorf("got status %d, want %d", w.Code, http.StatusNotFound)
+		}
+	})
+}
+
+func TestApp_EndToEnd(t *testing.T) {
+	t.Run("memory", func(t *testing.T) {
+		testEndToEnd(t, NewWithStorage(testConfig(), MemoryStorage()))
+	})
+	t.Run("sqlite", func(t *testing.T) {
+		cfg := testConfig()
+		cfg.DB.Driver = config.DriverSQLite
+		cfg.DB.DSN = filepath.Join(t.TempDir(), "payments.db")
+		a, err := New(cfg)
+		if err != nil {
+			t.Fatalf("new: %v", err)
+		}
+		defer a.Stop()
+		if w := serve(a, http.MethodGet, "/readyz", nil); w.Code != http.StatusOK {
+			t.Fatalf("readyz: got status %d: %s", w.Code, w.Body)
+		}
+		testEndToEnd(t, a)
+	})
+}
+
+func testEndToEnd(t *testing.T, a *App) {
+	do := func(method, path, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(method, path, strings.NewReader(body))
+		r.Header.Set("Content-Type", "application/json")
+		a.Handler().ServeHTTP(w, r)
+		return w
+	}
+
+	w := do(http.MethodPost, "/payments", `{"amount_minor": 1000, "currency": "USD"}`)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("create: got status %d, want %d: %s", w.Code, http.StatusCreated, w.Body)
+	}
+	location := w.Header().Get("Location")
+	patch := func(body, etag string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(http.MethodPatch, location, strings.NewReader(body))
+		r.Header.Set("Content-Type", "application/merge-patch+json")
+		r.Header.Set("If-Match", etag)
+		a.Handler().ServeHTTP(w, r)
+		return w
+	}
+	w = patch(`{"amount_minor": 1200, "description": "order 7", "metadata": {"order": "7"}}`, w.Header().Get("ETag"))
+	if w.Code != http.StatusOK {
+		t.Fatalf("patch: got status %d: %s", w.Code, w.Body)
+	}
+	if w := do(http.MethodPost, location+"/authorize", ""); w.Code != http.StatusOK {
+		t.Fatalf("authorize: got status %d: %s", w.Code, w.Body)
+	}
+	if w := do(http.MethodPost, location+"/capture", `{"amount_minor": 1000}`); w.Code != http.StatusOK {
+		t.Fatalf("capture: got status %d: %s", w.Code, w.Body)
+	}
+	if w := do(http.MethodPost, location+"/refunds", `{"amount_minor": 400}`); w.Code != http.StatusCreated {
+		t.Fatalf("refund: got status %d: %s", w.Code, w.Body)
+	}
+	if w := do(http.MethodPost, location+"/refunds", `{"amount_minor": 700}`); w.Code != http.StatusUnprocessableEntity {
+		t.Errorf("refund beyond the captured amount: got status %d: %s", w.Code, w.Body)
+	}
+
+	w = do(http.MethodGet, location, "")
+	if w := patch(`{"amount_minor": 500}`, w.Header().Get("ETag")); w.Code != http.StatusUnprocessableEntity {
+		t.Errorf("patch amount after capture: got status %d: %s", w.Code, w.Body)
+	}
+	var p struct {
+		Status        string            `json:"status"`
+		AmountMinor   int64             `json:"amount_minor"`
+		RefundedMinor int64             `json:"refunded_minor"`
+		CapturedMinor int64             `json:"captured_minor"`
+		Description   string            `json:"description"`
+		Metadata      map[string]string `json:"metadata"`
+	}
+	if err := json.NewDecoder(w.Body).Decode(&p); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if p.Status != "partially_refunded" || p.AmountMinor != 1200 || p.RefundedMinor != 400 || p.CapturedMinor != 1000 ||
+		p.Description != "order 7" || p.Metadata["order"] != "7" {
+		t.Errorf("got %+v", p)
+	}
+
+	w = do(http.MethodGet, "/payments?status=partially_refunded", "")
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"has_more":false`) {
+		t.Errorf("list: got status %d: %s", w.Code, w.Body)
+	}
+
+	w = do(http.MethodGet, "/ledger/entries?payment_id="+strings.TrimPrefix(location, "/payments/"), "")
+	var entries struct {
+		Data []struct {
+			Kind string `json:"kind"`
+		} `json:"data"`
+	}
+	if err := json.NewDecoder(w.Body).Decode(&entries); err != nil {
+		t.Fatalf("decode entries: %v", err)
+	}
+	var kinds []string
+	for _, e := range entries.Data {
+		kinds = append(kinds, e.Kind)
+	}
+	if got := strings.Join(kinds, " "); got != "payment_created payment_amended payment_captured refund" {
+		t.Errorf("got entries %s", got)
+	}
+	w = do(http.MethodGet, "/ledger/accounts/cash", "")
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"balance_minor":600`) {
+		t.Errorf("cash account: got status %d: %s", w.Code, w.Body)
+	}
+
+	w = do(http.MethodPost, "/customers", `{"external_ref": "cus-1", "name": "Alice", "email": "alice@example.com"}`)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("create customer: got status %d: %s", w.Code, w.Body)
+	}
+	customer := w.Header().Get("Location")
+	if w := do(http.MethodPost, "/customers", `{"external_ref": "cus-1"}`); w.Code != http.StatusConflict {
+		t.Errorf("duplicate customer: got status %d: %s", w.Code, w.Body)
+	}
+	customerID := strings.TrimPrefix(customer, "/customers/")
+	w = do(http.MethodPost, "/payments", `{"amount_minor": 500, "currency": "USD", "customer_id": `+customerID+`}`)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("create payment for customer: got status %d: %s", w.Code, w.Body)
+	}
+	w = do(http.MethodGet, customer+"/payments", "")
+	if w.Code != http.StatusOK || strings.Count(w.Body.String(), `"customer_id":`+customerID) != 1 {
+		t.Errorf("customer payments: got status %d: %s", w.Code, w.Body)
+	}
+	if w := do(http.MethodDelete, customer, ""); w.Code != http.StatusOK {
+		t.Fatalf("delete customer: got status %d: %s", w.Code, w.Body)
+	}
+	w = do(http.MethodPost, "/payments", `{"amount_minor": 500, "currency": "USD", "customer_id": `+customerID+`}`)
+	if w.Code != http.StatusUnprocessableEntity {
+		t.Errorf("payment for deleted customer: got status %d: %s", w.Code, w.Body)
+	}
+}
+
+func TestApp_Lifecycle(t *testing.T) {
+	t.Run("start and stop", func(t *testing.T) {
+		closed := 0
+		a := NewWithStorage(testConfig(), &Storage{Close: func() error { closed++; return nil }})
+
+		if err := a.Start(); err != nil {
+			t.Fatalf("start: %v", err)
+		}
+		res, err := http.Get(fmt.Sprintf("http://%s/healthz", a.Addr()))
+		if err != nil {
+			t.Fatalf("request: %v", err)
+		}
+		res.Body.Close()
+		if res.StatusCode != http.StatusOK {
+			t.Errorf("got status %d, want %d", res.StatusCode, http.StatusOK)
+		}
+
+		if err := a.Stop(); err != nil {
+			t.Fatalf("stop: %v", err)
+		}
+		if err := a.Stop(); err != nil {
+			t.Fatalf("second stop: %v", err)
+		}
+		if closed != 1 {
+			t.Errorf("storage closed %d times, want 1", closed)
+		}
+		select {
+		case <-a.Done():
+		default:
+			t.Error("Done not closed after Stop")
+		}
+		if _, err := http.Get(fmt.Sprintf("http://%s/healthz", a.Addr())); err == nil {
+			t.Error("server still serving after Stop")
+		}
+	})
+
+	t.Run("stop without start closes storage", func(t *testing.T) {
+		closed := false
+		a := NewWithStorage(testConfig(), &Storage{Close: func() error { closed = true; return nil }})
+
+		if err := a.Stop(); err != nil {
+			t.Fatalf("stop: %v", err)
+		}
+		if !closed {
+			t.Error("storage not closed")
+		}
+		if err := a.Start(); err == nil {
+			t.Error("expected error starting a stopped app")
+		}
+	})
+
+	t.Run("expires authorizations", func(t *testing.T) {
+		cfg := testConfig()
+		cfg.Payments.AuthorizationTTL = time.Millisecond
+		cfg.Payments.ExpiryInterval = 10 * time.Millisecond
+		a := NewWithStorage(cfg, MemoryStorage())
+		if err := a.Start(); err != nil {
+			t.Fatalf("start: %v", err)
+		}
+		defer a.Stop()
+
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(http.MethodPost, "/payments", strings.NewReader(`{"amount_minor": 1000, "currency": "USD"}`))
+		a.Handler().ServeHTTP(w, r)
+		if w.Code != http.StatusCreated {
+			t.Fatalf("create: got status %d: %s", w.Code, w.Body)
+		}
+		location := w.Header().Get("Location")
+		if w := serve(a, http.MethodPost, location+"/authorize", nil); w.Code != http.StatusOK {
+			t.Fatalf("authorize: got status %d: %s", w.Code, w.Body)
+		}
+
+		deadline := time.Now().Add(5 * time.Second)
+		for {
+			w := serve(a, http.MethodGet, location, nil)
+			if strings.Contains(w.Body.String(), `"status":"expired"`) {
+				break
+			}
+			if time.Now().After(deadline) {
+				t.Fatalf("authorization not expired: %s", w.Body)
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+		if err := a.Stop(); err != nil {
+			t.Fatalf("stop: %v", err)
+		}
+	})
+
+	t.Run("purges expired idempotency keys", func(t *testing.T) {
+		cfg := testConfig()
+		cfg.Idempotency.PurgeInterval = 10 * time.Millisecond
+		storage := MemoryStorage()
+		store := purgeRecorder{Store: storage.Idempotency, purged: make(chan int64, 1)}
+		storage.Idempotency = store
+		now := time.Now()
+		for key, expires := range map[string]time.Time{"old": now.Add(-time.Minute), "fresh": now.Add(time.Hour)} {
+			if _, err := store.Reserve(t.Context(), &idempotency.Record{Key: key, ExpiresAt: expires}); err != nil {
+				t.Fatal(err)
+			}
+		}
+		a := NewWithStorage(cfg, storage)
+		if err := a.Start(); err != nil {
+			t.Fatalf("start: %v", err)
+		}
+		defer a.Stop()
+
+		select {
+		case n := <-store.purged:
+			if n != 1 {
+				t.Errorf("purged %d keys, want 1", n)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("expired key not purged")
+		}
+		if err := a.Stop(); err != nil {
+			t.Fatalf("stop: %v", err)
+		}
+		if n, err := store.Store.Purge(t.Context(), now); err != nil || n != 0 {
+			t.Errorf("got %d expired keys left after the sweep, error %v", n, err)
+		}
+		if existing, _ := store.Reserve(t.Context(), &idempotency.Record{Key: "fresh", ExpiresAt: now.Add(time.Hour)}); existing == nil {
+			t.Error("unexpired key was purged")
+		}
+	})
+
+	t.Run("two instances side by side", func(t *testing.T) {
+		a, b := NewWithStorage(testConfig(), &Storage{}), NewWithStorage(testConfig(), &Storage{})
+		if err := a.Start(); err != nil {
+			t.Fatal(err)
+		}
+		defer a.Stop()
+		if err := b.Start(); err != nil {
+			t.Fatal(err)
+		}
+		defer b.Stop()
+
+		if a.Addr().String() == b.Addr().String() {
+			t.Error("instances share an address")
+		}
+	})
+}
+
+// purgeRecorder reports every purge that deleted records.
+type purgeRecorder struct {
+	idempotency.Store
+	purged chan int64
+}
+
+func (p purgeRecorder) Purge(ctx context.Context, now time.Time) (int64, error) {
+	n, err := p.Store.Purge(ctx, now)
+	if n > 0 {
+		p.purged <- n
+	}
+	return n, err
+}
@@ -0,0 +1,198 @@
+package app
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/eterrni/payments-api/internal/config"
+)
+
+const (
+	acmeToken   = "acme-secret-token"
+	globexToken = "globex-secret-token"
+)
+
+func merchantConfig() *config.Config {
+	cfg := testConfig()
+	cfg.Merchants.Tokens = "acme:" + acmeToken + ",globex:" + globexToken
+	cfg.Features.Unauthenticated = false
+	return cfg
+}
+
+// TestApp_MerchantIsolation has one merchant try to read and change the data
+// of another through every endpoint.
+func TestApp_MerchantIsolation(t *testing.T) {
+	t.Run("memory", func(t *testing.T) {
+		testMerchantIsolation(t, NewWithStorage(merchantConfig(), MemoryStorage()), acmeToken, globexToken)
+	})
+	t.Run("sqlite", func(t *testing.T) {
+		cfg := merchantConfig()
+		cfg.DB.Driver = config.DriverSQLite
+		cfg.DB.DSN = filepath.Join(t.TempDir(), "payments.db")
+		a, err := New(cfg)
+		if err != nil {
+			t.Fatalf("new: %v", err)
+		}
+		defer a.Stop()
+		testMerchantIsolation(t, a, acmeToken, globexToken)
+	})
+}
+
+type merchantClient func(method, path, body string, header ...string) *httptest.ResponseRecorder
+
+// as returns a client that authenticates with token. header holds
+// additional name, value pairs.
+func as(a *App, token string) merchantClient {
+	return func(method, path, body string, header ...string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(method, path, strings.NewReader(body))
+		r.Header.Set("Content-Type", "application/json")
+		if token != "" {
+			r.Header.Set("Authorization", "Bearer "+token)
+		}
+		for i := 0; i+1 < len(header); i += 2 {
+			r.Header.Set(header[i], header[i+1])
+		}
+		a.Handler().ServeHTTP(w, r)
+		return w
+	}
+}
+
+// testMerchantIsolation runs as two merchants, with the credentials of
+// each.
+func testMerchantIsolation(t *testing.T, a *App, acmeToken, globexToken string) {
+	acme, globex := as(a, acmeToken), as(a, globexToken)
+	created := func(w *httptest.ResponseRecorder) string {
+		t.Helper()
+		if w.Code != http.StatusCreated {
+			t.Fatalf("setup: got status %d: %s", w.Code, w.Body)
+		}
+		return w.Header().Get("Location")
+	}
+
+	customer := created(acme(http.MethodPost, "/customers", `{"external_ref": "cus-1", "name": "Alice"}`))
+	customerID := strings.TrimPrefix(customer, "/customers/")
+	captured := created(acme(http.MethodPost, "/payments", `{"amount_minor": 1000, "currency": "USD", "customer_id": `+customerID+`}`))
+	for _, step := range []string{"/authorize", "/capture"} {
+		if w := acme(http.MethodPost, captured+step, ""); w.Code != http.StatusOK {
+			t.Fatalf("setup %s: got status %d: %s", step, w.Code, w.Body)
+		}
+	}
+	created(acme(http.MethodPost, captured+"/refunds", `{"amount_minor": 100}`))
+	pending := created(acme(http.MethodPost, "/payments", `{"amount_minor": 500, "currency": "USD"}`))
+
+	t.Run("credentials", func(t *testing.T) {
+		for _, token := range []string{"", "guess"} {
+			if w := as(a, token)(http.MethodGet, "/payments", ""); w.Code != http.StatusUnauthorized {
+				t.Errorf("token %q: got status %d, want %d", token, w.Code, http.StatusUnauthorized)
+			}
+		}
+		for _, path := range []string{"/healthz", "/currencies"} {
+			if w := as(a, "")(http.MethodGet, path, ""); w.Code != http.StatusOK {
+				t.Errorf("%s without credentials: got status %d, want %d", path, w.Code, http.StatusOK)
+			}
+		}
+	})
+
+	t.Run("records of another merchant are not found", func(t *testing.T) {
+		requests := []struct {
+			method, path, body string
+			header             []string
+		}{
+			{http.MethodGet, captured, "", nil},
+			{http.MethodPut, pending, `{"amount_minor": 1, "currency": "USD"}`, []string{"If-Match", "*"}},
+			{http.MethodPatch, pending, `{"description": "mine"}`, []string{"If-Match", "*"}},
+			{http.MethodDelete, pending, "", nil},
+			{http.MethodPost, pending + "/authorize", "", nil},
+			{http.MethodPost, pending + "/capture", "", nil},
+			{http.MethodPost, pending + "/void", "", nil},
+			{http.MethodPost, pending + "/settle", "", nil},
+			{http.MethodPost, pending + "/cancel", "", nil},
+			{http.MethodPost, pending + "/fail", "", nil},
+			{http.MethodGet, captured + "/transitions", "", nil},
+			{http.MethodPost, captured + "/refunds", `{"amount_minor": 100}`, nil},
+			{http.MethodGet, captured + "/refunds", "", nil},
+			{http.MethodGet, customer, "", nil},
+			{http.MethodPut, customer, `{"name": "Mallory"}`, nil},
+			{http.MethodDelete, customer, "", nil},
+			{http.MethodGet, customer + "/payments", "", nil},
+		}
+		for _, req := range requests {
+			if w := globex(req.method, req.path, req.body, req.header...); w.Code != http.StatusNotFound {
+				t.Errorf("%s %s: got status %d, want %d: %s", req.method, req.path, w.Code, http.StatusNotFound, w.Body)
+			}
+		}
+	})
+
+	t.Run("lists leave out records of another merchant", func(t *testing.T) {
+		for _, path := range []string{
+			"/payments",
+			"/payments?customer_id=" + customerID,
+			"/customers",
+			"/customers?external_ref=cus-1",
+			"/ledger/entries",
+			"/ledger/entries?payment_id=" + strings.TrimPrefix(captured, "/payments/"),
+		} {
+			w := globex(http.MethodGet, path, "")
+			var list struct {
+				Data []json.RawMessage `json:"data"`
+			}
+			if err := json.NewDecoder(w.Body).Decode(&list); err != nil || w.Code != http.StatusOK {
+				t.Fatalf("%s: got status %d, error %v", path, w.Code, err)
+			}
+			if len(list.Data) != 0 {
+				t.Errorf("%s: got %d records of another merchant", path, len(list.Data))
+			}
+		}
+		for _, path := range []string{"/ledger/accounts", "/ledger/accounts/cash"} {
+			w := globex(http.MethodGet, path, "")
+			if w.Code != http.StatusOK || strings.Contains(w.Body.String(), `"currency"`) {
+				t.Errorf("%s: got status %d, want no balances: %s", path, w.Code, w.Body)
+			}
+		}
+	})
+
+	t.Run("customers of another merchant cannot be paid for", func(t *testing.T) {
+		w := globex(http.MethodPost, "/payments", `{"amount_minor": 500, "currency": "USD", "customer_id": `+customerID+`}`)
+		if w.Code != http.StatusUnprocessableEntity {
+			t.Errorf("got status %d, want %d: %s", w.Code, http.StatusUnprocessableEntity, w.Body)
+		}
+	})
+
+	t.Run("idempotency keys are per merchant", func(t *testing.T) {
+		body := `{"amount_minor": 700, "currency": "USD"}`
+		first := created(acme(http.MethodPost, "/payments", body, "Idempotency-Key", "order-1"))
+		w := globex(http.MethodPost, "/payments", body, "Idempotency-Key", "order-1")
+		if w.Code != http.StatusCreated || w.Header().Get("Idempotent-Replayed") != "" || w.Header().Get("Location") == first {
+			t.Errorf("got status %d, Location %q: the response of another merchant was replayed", w.Code, w.Header().Get("Location"))
+		}
+	})
+
+	t.Run("records are left untouched", func(t *testing.T) {
+		w := acme(http.MethodGet, pending, "")
+		var p struct {
+			Status      string `json:"status"`
+			Version     int64  `json:"version"`
+			Description string `json:"description"`
+			MerchantID  string `json:"merchant_id"`
+		}
+		if err := json.NewDecoder(w.Body).Decode(&p); err != nil || w.Code != http.StatusOK {
+			t.Fatalf("get: got status %d, error %v", w.Code, err)
+		}
+		if p.Status != "pending" || p.Version != 1 || p.Description != "" || p.MerchantID != "acme" {
+			t.Errorf("got %+v", p)
+		}
+		w = acme(http.MethodGet, customer, "")
+		if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"name":"Alice"`) {
+			t.Errorf("customer: got status %d: %s", w.Code, w.Body)
+		}
+		w = acme(http.MethodGet, captured+"/refunds", "")
+		if w.Code != http.StatusOK || strings.Count(w.Body.String(), `"payment_id"`) != 1 {
+			t.Errorf("refunds: got status %d: %s", w.Code, w.Body)
+		}
+	})
+}
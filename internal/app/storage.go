@@ -0,0 +1,118 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+
+	"github.com/eterrni/payments-api/internal/config"
+	"github.com/eterrni/payments-api/internal/health"
+	"github.com/eterrni/payments-api/internal/idempotency"
+	"github.com/eterrni/payments-api/internal/migrations"
+	"github.com/eterrni/payments-api/internal/repository"
+	"github.com/eterrni/payments-api/internal/repository/memory"
+	"github.com/jinzhu/gorm"
+	_ "github.com/jinzhu/gorm/dialects/postgres"
+	_ "github.com/jinzhu/gorm/dialects/sqlite"
+)
+
+// Storage is everything the app persists data through. Any implementation
+// of the repositories can be plugged in, e.g. in tests.
+type Storage struct {
+	Payments    repository.PaymentRepository
+	Refunds     repository.RefundRepository
+	Ledger      repository.LedgerRepository
+	Customers   repository.CustomerRepository
+	APIKeys     repository.APIKeyRepository
+	Idempotency idempotency.Store
+	// Checks are added to the readiness probe.
+	Checks map[string]health.Check
+	// Close releases the storage once the app has stopped. It may be nil.
+	Close func() error
+}
+
+// OpenDB connects to the SQL database described by cfg.
+func OpenDB(cfg config.DB) (*gorm.DB, error) {
+	var (
+		db  *gorm.DB
+		err error
+	)
+	switch cfg.Driver {
+	case config.DriverPostgres:
+		db, err = gorm.Open("postgres", cfg.PostgresDSN())
+	case config.DriverSQLite:
+		db, err = gorm.Open("sqlite3", cfg.SQLiteDSN())
+	default:
+		return nil, fmt.Errorf("driver %q has no SQL database", cfg.Driver)
+	}
+	if err != nil {
+		return nil, err
+	}
+	db.DB().SetMaxOpenConns(cfg.MaxOpenConns)
+	db.DB().SetMaxIdleConns(cfg.MaxIdleConns)
+	db.DB().SetConnMaxLifetime(cfg.ConnMaxLifetime)
+	return db, nil
+}
+
+// MemoryStorage keeps all data in memory; it is lost when the process exits.
+func MemoryStorage() *Storage {
+	store := memory.NewStore()
+	return &Storage{
+		Payments:    store.Payments(),
+		Refunds:     store.Refunds(),
+		Ledger:      store.Ledger(),
+		Customers:   store.Customers(),
+		APIKeys:     store.APIKeys(),
+		Idempotency: idempotency.NewMemoryStore(),
+	}
+}
+
+// OpenStorage returns the storage selected by cfg.Driver.
+func OpenStorage(cfg config.DB) (*Storage, error) {
+	if cfg.Driver == config.DriverMemory {
+		slog.Warn("Using in-memory storage, data is lost on exit")
+		return MemoryStorage(), nil
+	}
+	return openGormStorage(cfg)
+}
+
+func openGormStorage(cfg config.DB) (*Storage, error) {
+	db, err := OpenDB(cfg)
+	if err != nil {
+		return nil, err
+	}
+	migrator, err := migrations.New(db.DB(), db.Dialect().GetName())
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	// A Postgres schema is migrated by the deploy, not by every replica; a
+	// schema behind the binary is only reported here and by the readiness
+	// probe. A SQLite file belongs to this one process, so it is migrated
+	// right away.
+	if cfg.Driver == config.DriverSQLite {
+		if err := migrator.Up(context.Background()); err != nil {
+			db.Close()
+			return nil, fmt.Errorf("migrate %s: %w", cfg.DSN, err)
+		}
+	} else if pending, err := migrator.Pending(context.Background()); err != nil {
+		slog.Warn("Could not check migration status", "error", err)
+	} else if len(pending) > 0 {
+		slog.Warn("Database schema has pending migrations, run \"migrate up\"", "pending", len(pending))
+	}
+
+	conn := repository.NewConn(db, cfg.QueryTimeout)
+	return &Storage{
+		Payments:    repository.NewPaymentRepository(conn),
+		Refunds:     repository.NewRefundRepository(conn),
+		Ledger:      repository.NewLedgerRepository(conn),
+		Customers:   repository.NewCustomerRepository(conn),
+		APIKeys:     repository.NewAPIKeyRepository(conn),
+		Idempotency: idempotency.NewStore(conn),
+		Checks: map[string]health.Check{
+			"database":   health.Database(db),
+			"migrations": health.Migrations(migrator),
+		},
+		Close: db.Close,
+	}, nil
+}
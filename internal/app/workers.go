@@ -0,0 +1,67 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+)
+
+// startExpiry releases expired authorizations now and then every interval
+// in the background.
+func (a *App) startExpiry(interval time.Duration) func(context.Context) error {
+	return every(interval, "authorization expiry", func(ctx context.Context) {
+		n, err := a.payments.ExpireAuthorizations(ctx, time.Now())
+		switch {
+		case err != nil && ctx.Err() == nil:
+			slog.Error("Could not expire authorizations", "error", err)
+		case n > 0:
+			slog.Info("Expired authorizations", "count", n)
+		}
+	})
+}
+
+// startIdempotencyPurge deletes expired idempotency keys now and then every
+// interval in the background.
+func (a *App) startIdempotencyPurge(interval time.Duration) func(context.Context) error {
+	return every(interval, "idempotency key purge", func(ctx context.Context) {
+		n, err := a.storage.Idempotency.Purge(ctx, time.Now())
+		switch {
+		case err != nil && ctx.Err() == nil:
+			slog.Error("Could not purge idempotency keys", "error", err)
+		case n > 0:
+			slog.Info("Purged expired idempotency keys", "count", n)
+		}
+	})
+}
+
+// every runs pass now and then every interval in the background. The
+// returned function stops it and waits, up to the deadline of its context,
+// for a pass in progress to finish.
+func every(interval time.Duration, name string, pass func(ctx context.Context)) func(context.Context) error {
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			pass(ctx)
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+
+	return func(stopCtx context.Context) error {
+		cancel()
+		select {
+		case <-done:
+			return nil
+		case <-stopCtx.Done():
+			return fmt.Errorf("stop %s: %w", name, stopCtx.Err())
+		}
+	}
+}
@@ -0,0 +1,476 @@
+// Package config loads the service configuration. Every setting has a
+// default that can be overridden, in increasing order of precedence, by a
+// YAML file, an environment variable and a command-line flag.
+package config
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/eterrni/payments-api/internal/merchantid"
+	"gopkg.in/yaml.v3"
+)
+
+type Config struct {
+	HTTP        HTTP        `yaml:"http"`
+	DB          DB          `yaml:"db"`
+	Log         Log         `yaml:"log"`
+	Admin       Admin       `yaml:"admin"`
+	Merchants   Merchants   `yaml:"merchants"`
+	Idempotency Idempotency `yaml:"idempotency"`
+	Payments    Payments    `yaml:"payments"`
+	Features    Features    `yaml:"features"`
+}
+
+type HTTP struct {
+	Addr         string        `yaml:"addr"`
+	ReadTimeout  time.Duration `yaml:"read_timeout"`
+	WriteTimeout time.Duration `yaml:"write_timeout"`
+	IdleTimeout  time.Duration `yaml:"idle_timeout"`
+	// ShutdownTimeout bounds how long in-flight requests are drained on
+	// shutdown before their connections are closed.
+	ShutdownTimeout time.Duration `yaml:"shutdown_timeout"`
+	// ShutdownDelay keeps serving after readiness has turned false, giving
+	// load balancers time to stop sending new requests.
+	ShutdownDelay time.Duration `yaml:"shutdown_delay"`
+	// HealthCheckTimeout bounds each readiness check.
+	HealthCheckTimeout time.Duration `yaml:"health_check_timeout"`
+}
+
+type DB struct {
+	// Driver selects the storage: "postgres", "sqlite" with DSN naming the
+	// database file, or "memory" for data that lives only as long as the
+	// process.
+	Driver string `yaml:"driver"`
+	DSN    string `yaml:"dsn"`
+	// SSLMode is appended to DSNs that do not set sslmode themselves.
+	SSLMode         string        `yaml:"sslmode"`
+	MaxOpenConns    int           `yaml:"max_open_conns"`
+	MaxIdleConns    int           `yaml:"max_idle_conns"`
+	ConnMaxLifetime time.Duration `yaml:"conn_max_lifetime"`
+	// QueryTimeout bounds every database operation, including the
+	// statements of a transaction, in addition to the request's deadline.
+	QueryTimeout time.Duration `yaml:"query_timeout"`
+}
+
+type Log struct {
+	Level string `yaml:"level"`
+}
+
+// SlogLevel returns Level as a log/slog level; requests are logged at info.
+func (l Log) SlogLevel() slog.Level {
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(l.Level)); err != nil {
+		return slog.LevelInfo
+	}
+	return level
+}
+
+type Admin struct {
+	// Token enables the /admin endpoints; they are not mounted without it.
+	Token string `yaml:"token"`
+}
+
+type Merchants struct {
+	// Tokens lists the bearer token of each merchant as comma-separated
+	// "merchant:token" pairs. Without tokens the API serves a single
+	// merchant and needs no credentials.
+	Tokens string `yaml:"tokens"`
+}
+
+const minTokenLength = 16
+
+// TokenMap parses Tokens into the token of each merchant ID.
+func (m Merchants) TokenMap() (map[string]string, error) {
+	tokens := map[string]string{}
+	if strings.TrimSpace(m.Tokens) == "" {
+		return tokens, nil
+	}
+	seen := map[string]bool{}
+	for _, pair := range strings.Split(m.Tokens, ",") {
+		id, token, ok := strings.Cut(strings.TrimSpace(pair), ":")
+		switch {
+		case !ok || !merchantid.Valid(id):
+			return nil, fmt.Errorf("merchants.tokens: want merchant:token pairs with merchant IDs of lowercase letters, digits, _ and -")
+		case len(token) < minTokenLength:
+			return nil, fmt.Errorf("merchants.tokens: token of %s must be at least %d characters", id, minTokenLength)
+		case tokens[id] != "":
+			return nil, fmt.Errorf("merchants.tokens: merchant %s is listed twice", id)
+		case seen[token]:
+			return nil, fmt.Errorf("merchants.tokens: token of %s is shared with another merchant", id)
+		}
+		tokens[id] = token
+		seen[token] = true
+	}
+	return tokens, nil
+}
+
+type Idempotency struct {
+	KeyTTL time.Duration `yaml:"key_ttl"`
+	// PurgeInterval is how often keys older than KeyTTL are deleted.
+	PurgeInterval time.Duration `yaml:"purge_interval"`
+	// MaxBodySize limits, in bytes, the body of requests with a key, which
+	// is held in memory to fingerprint it.
+	MaxBodySize int `yaml:"max_body_size"`
+}
+
+type Payments struct {
+	// AuthorizationTTL is how long an authorization can be captured before
+	// it expires; 0 keeps new authorizations valid until they are captured
+	// or voided.
+	AuthorizationTTL time.Duration `yaml:"authorization_ttl"`
+	// ExpiryInterval is how often expired authorizations are looked for.
+	ExpiryInterval time.Duration `yaml:"expiry_interval"`
+	// FeeBasisPoints is the fee charged to merchants on captured amounts,
+	// in hundredths of a percent.
+	FeeBasisPoints int `yaml:"fee_basis_points"`
+}
+
+// Features switches optional parts of the API on and off.
+type Features struct {
+	Idempotency bool `yaml:"idempotency"`
+	Refunds     bool `yaml:"refunds"`
+	// APIKeys requires every request to the merchant API to carry an API
+	// key issued through the key management endpoints or the apikey
+	// command. It is on by default.
+	APIKeys bool `yaml:"api_keys"`
+	// Unauthenticated serves the merchant API to anyone as a single
+	// merchant. It has to be set explicitly, together with turning API
+	// keys off, since the service refuses to start without credentials.
+	Unauthenticated bool `yaml:"unauthenticated"`
+}
+
+const (
+	DriverPostgres = "postgres"
+	DriverSQLite   = "sqlite"
+	DriverMemory   = "memory"
+)
+
+var (
+	Drivers   = []string{DriverPostgres, DriverSQLite, DriverMemory}
+	LogLevels = []string{"debug", "info", "warn", "error"}
+)
+
+func Default() *Config {
+	return &Config{
+		HTTP: HTTP{
+			Addr:               ":8080",
+			ReadTimeout:        15 * time.Second,
+			WriteTimeout:       15 * time.Second,
+			IdleTimeout:        60 * time.Second,
+			ShutdownTimeout:    30 * time.Second,
+			HealthCheckTimeout: 2 * time.Second,
+		},
+		DB: DB{
+			Driver:          DriverPostgres,
+			SSLMode:         "disable",
+			MaxOpenConns:    25,
+			MaxIdleConns:    5,
+			ConnMaxLifetime: 30 * time.Minute,
+			QueryTimeout:    5 * time.Second,
+		},
+		Log:         Log{Level: "info"},
+		Idempotency: Idempotency{KeyTTL: 24 * time.Hour, PurgeInterval: time.Hour, MaxBodySize: 1 << 20},
+		Payments:    Payments{AuthorizationTTL: 7 * 24 * time.Hour, ExpiryInterval: time.Minute},
+		Features:    Features{Idempotency: true, Refunds: true, APIKeys: true},
+	}
+}
+
+// setting binds one field of Config to its environment variable and flag.
+// The flag is named after the YAML path of the field.
+type setting struct {
+	name   string
+	env    string
+	usage  string
+	secret bool
+	field  func(c *Config) interface{}
+}
+
+var settings = []setting{
+	{"http.addr", "HTTP_ADDR", "address the HTTP server listens on", false, func(c *Config) interface{} { return &c.HTTP.Addr }},
+	{"http.read_timeout", "HTTP_READ_TIMEOUT", "maximum duration for reading a request", false, func(c *Config) interface{} { return &c.HTTP.ReadTimeout }},
+	{"http.write_timeout", "HTTP_WRITE_TIMEOUT", "maximum duration for writing a response", false, func(c *Config) interface{} { return &c.HTTP.WriteTimeout }},
+	{"http.idle_timeout", "HTTP_IDLE_TIMEOUT", "how long idle keep-alive connections are kept", false, func(c *Config) interface{} { return &c.HTTP.IdleTimeout }},
+	{"http.shutdown_timeout", "HTTP_SHUTDOWN_TIMEOUT", "how long in-flight requests are drained on shutdown", false, func(c *Config) interface{} { return &c.HTTP.ShutdownTimeout }},
+	{"http.shutdown_delay", "HTTP_SHUTDOWN_DELAY", "how long to keep serving after readiness turns false on shutdown", false, func(c *Config) interface{} { return &c.HTTP.ShutdownDelay }},
+	{"http.health_check_timeout", "HTTP_HEALTH_CHECK_TIMEOUT", "timeout of each readiness check", false, func(c *Config) interface{} { return &c.HTTP.HealthCheckTimeout }},
+	{"db.driver", "DB_DRIVER", "storage driver: " + strings.Join(Drivers, ", "), false, func(c *Config) interface{} { return &c.DB.Driver }},
+	{"db.dsn", "DB_DSN", "PostgreSQL connection string or SQLite database file", true, func(c *Config) interface{} { return &c.DB.DSN }},
+	{"db.sslmode", "DB_SSLMODE", "sslmode used when the DSN does not set one", false, func(c *Config) interface{} { return &c.DB.SSLMode }},
+	{"db.max_open_conns", "DB_MAX_OPEN_CONNS", "maximum open database connections, 0 for unlimited", false, func(c *Config) interface{} { return &c.DB.MaxOpenConns }},
+	{"db.max_idle_conns", "DB_MAX_IDLE_CONNS", "maximum idle database connections", false, func(c *Config) interface{} { return &c.DB.MaxIdleConns }},
+	{"db.conn_max_lifetime", "DB_CONN_MAX_LIFETIME", "maximum lifetime of a database connection, 0 for unlimited", false, func(c *Config) interface{} { return &c.DB.ConnMaxLifetime }},
+	{"db.query_timeout", "DB_QUERY_TIMEOUT", "maximum duration of a database operation", false, func(c *Config) interface{} { return &c.DB.QueryTimeout }},
+	{"log.level", "LOG_LEVEL", "log level: " + strings.Join(LogLevels, ", "), false, func(c *Config) interface{} { return &c.Log.Level }},
+	{"admin.token", "ADMIN_TOKEN", "bearer token for the /admin endpoints, empty disables them", true, func(c *Config) interface{} { return &c.Admin.Token }},
+	// Tokens are redacted by Redacted itself, keeping the merchant IDs.
+	{"merchants.tokens", "MERCHANT_TOKENS", "comma-separated merchant:token pairs, empty for a single merchant without credentials", false, func(c *Config) interface{} { return &c.Merchants.Tokens }},
+	{"idempotency.key_ttl", "IDEMPOTENCY_KEY_TTL", "how long Idempotency-Key responses are kept", false, func(c *Config) interface{} { return &c.Idempotency.KeyTTL }},
+	{"idempotency.purge_interval", "IDEMPOTENCY_PURGE_INTERVAL", "how often expired Idempotency-Key responses are deleted", false, func(c *Config) interface{} { return &c.Idempotency.PurgeInterval }},
+	{"idempotency.max_body_size", "IDEMPOTENCY_MAX_BODY_SIZE", "largest body in bytes of a request with an Idempotency-Key", false, func(c *Config) interface{} { return &c.Idempotency.MaxBodySize }},
+	{"payments.authorization_ttl", "PAYMENTS_AUTHORIZATION_TTL", "how long an authorization can be captured, 0 for no expiry", false, func(c *Config) interface{} { return &c.Payments.AuthorizationTTL }},
+	{"payments.expiry_interval", "PAYMENTS_EXPIRY_INTERVAL", "how often expired authorizations are released", false, func(c *Config) interface{} { return &c.Payments.ExpiryInterval }},
+	{"payments.fee_basis_points", "PAYMENTS_FEE_BASIS_POINTS", "fee on captured amounts in hundredths of a percent", false, func(c *Config) interface{} { return &c.Payments.FeeBasisPoints }},
+	{"features.idempotency", "FEATURE_IDEMPOTENCY", "honour the Idempotency-Key header", false, func(c *Config) interface{} { return &c.Features.Idempotency }},
+	{"features.refunds", "FEATURE_REFUNDS", "expose the refund endpoints", false, func(c *Config) interface{} { return &c.Features.Refunds }},
+	{"features.api_keys", "FEATURE_API_KEYS", "require API keys on the merchant API", false, func(c *Config) interface{} { return &c.Features.APIKeys }},
+	{"features.unauthenticated", "FEATURE_UNAUTHENTICATED", "serve the merchant API without credentials when neither API keys nor merchant tokens are used", false, func(c *Config) interface{} { return &c.Features.Unauthenticated }},
+}
+
+// Load builds the configuration from defaults, the YAML file named by the
+// -config flag or CONFIG_FILE, the environment and the flags in args. It
+// returns the arguments left after the flags, i.e. the command to run.
+func Load(args []string, getenv func(string) string) (*Config, []string, error) {
+	fs := flag.NewFlagSet("payments-api", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	file := fs.String("config", getenv("CONFIG_FILE"), "path to a YAML configuration file")
+	flags := map[string]*string{}
+	for _, s := range settings {
+		flags[s.name] = fs.String(s.name, "", s.usage+" (env "+s.env+")")
+	}
+	if err := fs.Parse(args); err != nil {
+		return nil, nil, err
+	}
+
+	c := Default()
+	if *file != "" {
+		data, err := os.ReadFile(*file)
+		if err != nil {
+			return nil, nil, fmt.Errorf("read config file: %w", err)
+		}
+		dec := yaml.NewDecoder(bytes.NewReader(data))
+		dec.KnownFields(true)
+		if err := dec.Decode(c); err != nil && !errors.Is(err, io.EOF) {
+			return nil, nil, fmt.Errorf("parse config file %s: %w", *file, err)
+		}
+	}
+
+	var errs []error
+	for _, s := range settings {
+		if v := getenv(s.env); v != "" {
+			if err := set(s.field(c), v); err != nil {
+				errs = append(errs, fmt.Errorf("%s: %w", s.env, err))
+			}
+		}
+	}
+	fs.Visit(func(f *flag.Flag) {
+		if p, ok := flags[f.Name]; ok {
+			if err := set(settingByName(f.Name).field(c), *p); err != nil {
+				errs = append(errs, fmt.Errorf("-%s: %w", f.Name, err))
+			}
+		}
+	})
+	if len(errs) > 0 {
+		return nil, nil, errors.Join(errs...)
+	}
+	if err := c.Validate(); err != nil {
+		return nil, nil, err
+	}
+	return c, fs.Args(), nil
+}
+
+// Usage describes every setting with its flag, environment variable and
+// default value.
+func Usage(w io.Writer) {
+	def := Default()
+	fmt.Fprintln(w, "  -config string\n    \tpath to a YAML configuration file (env CONFIG_FILE)")
+	for _, s := range settings {
+		fmt.Fprintf(w, "  -%s\n    \t%s (env %s, default %v)\n", s.name, s.usage, s.env, format(s.field(def)))
+	}
+}
+
+func settingByName(name string) setting {
+	for _, s := range settings {
+		if s.name == name {
+			return s
+		}
+	}
+	panic("config: unknown setting " + name)
+}
+
+func set(field interface{}, v string) error {
+	switch p := field.(type) {
+	case *string:
+		*p = v
+	case *int:
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			return fmt.Errorf("invalid integer %q", v)
+		}
+		*p = n
+	case *bool:
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			return fmt.Errorf("invalid boolean %q", v)
+		}
+		*p = b
+	case *time.Duration:
+		d, err := time.ParseDuration(v)
+		if err != nil {
+			return fmt.Errorf("invalid duration %q", v)
+		}
+		*p = d
+	default:
+		panic(fmt.Sprintf("config: unsupported field type %T", field))
+	}
+	return nil
+}
+
+func format(field interface{}) string {
+	switch p := field.(type) {
+	case *string:
+		return strconv.Quote(*p)
+	case *int:
+		return strconv.Itoa(*p)
+	case *bool:
+		return strconv.FormatBool(*p)
+	case *time.Duration:
+		return p.String()
+	}
+	return ""
+}
+
+// Validate reports every invalid setting at once.
+func (c *Config) Validate() error {
+	var errs []error
+	check := func(ok bool, format string, args ...interface{}) {
+		if !ok {
+			errs = append(errs, fmt.Errorf(format, args...))
+		}
+	}
+
+	check(c.HTTP.Addr != "", "http.addr must not be empty")
+	check(c.HTTP.ReadTimeout > 0, "http.read_timeout must be positive")
+	check(c.HTTP.WriteTimeout > 0, "http.write_timeout must be positive")
+	check(c.HTTP.IdleTimeout >= 0, "http.idle_timeout must not be negative")
+	check(c.HTTP.ShutdownTimeout > 0, "http.shutdown_timeout must be positive")
+	check(c.HTTP.ShutdownDelay >= 0, "http.shutdown_delay must not be negative")
+	check(c.HTTP.HealthCheckTimeout > 0, "http.health_check_timeout must be positive")
+	check(contains(Drivers, c.DB.Driver), "db.driver must be one of %s", strings.Join(Drivers, ", "))
+	check(c.DB.Driver == DriverMemory || c.DB.DSN != "", "db.dsn is required (set DB_DSN)")
+	check(c.DB.MaxOpenConns >= 0, "db.max_open_conns must not be negative")
+	check(c.DB.MaxIdleConns >= 0, "db.max_idle_conns must not be negative")
+	check(c.DB.MaxOpenConns == 0 || c.DB.MaxIdleConns <= c.DB.MaxOpenConns, "db.max_idle_conns must not exceed db.max_open_conns")
+	check(c.DB.ConnMaxLifetime >= 0, "db.conn_max_lifetime must not be negative")
+	check(c.DB.QueryTimeout > 0, "db.query_timeout must be positive")
+	check(contains(LogLevels, c.Log.Level), "log.level must be one of %s", strings.Join(LogLevels, ", "))
+	if _, err := c.Merchants.TokenMap(); err != nil {
+		errs = append(errs, err)
+	}
+	check(c.Merchants.Tokens == "" || !c.Features.APIKeys, "merchants.tokens cannot be combined with features.api_keys (set features.api_keys to false)")
+	authenticated := c.Features.APIKeys || c.Merchants.Tokens != ""
+	check(authenticated || c.Features.Unauthenticated, "the merchant API needs credentials: enable features.api_keys, set merchants.tokens or opt out with features.unauthenticated")
+	check(!authenticated || !c.Features.Unauthenticated, "features.unauthenticated cannot be combined with features.api_keys or merchants.tokens")
+	check(!c.Features.APIKeys || c.DB.Driver != DriverMemory || c.Admin.Token != "", "features.api_keys with db.driver memory needs admin.token to issue keys")
+	check(c.Idempotency.KeyTTL > 0, "idempotency.key_ttl must be positive")
+	check(c.Idempotency.PurgeInterval > 0, "idempotency.purge_interval must be positive")
+	check(c.Idempotency.MaxBodySize > 0, "idempotency.max_body_size must be positive")
+	check(c.Payments.AuthorizationTTL >= 0, "payments.authorization_ttl must not be negative")
+	check(c.Payments.ExpiryInterval > 0, "payments.expiry_interval must be positive")
+	check(c.Payments.FeeBasisPoints >= 0 && c.Payments.FeeBasisPoints <= 10000, "payments.fee_basis_points must be between 0 and 10000")
+	return errors.Join(errs...)
+}
+
+// PostgresDSN is the DSN with the default sslmode applied.
+func (d DB) PostgresDSN() string {
+	dsn := strings.TrimSpace(d.DSN)
+	if d.SSLMode != "" && !strings.Contains(dsn, "sslmode=") {
+		dsn += " sslmode=" + d.SSLMode
+	}
+	return dsn
+}
+
+// SQLiteDSN is the DSN with the connection options the repositories rely on.
+// Transactions take the write lock when they begin, so that two of them
+// never both read a row and then deadlock upgrading to write it, and a
+// locked database is waited for instead of failing at once.
+func (d DB) SQLiteDSN() string {
+	dsn := strings.TrimSpace(d.DSN)
+	sep := "?"
+	if strings.Contains(dsn, "?") {
+		sep = "&"
+	}
+	return dsn + sep + "_txlock=immediate&_busy_timeout=5000&_journal_mode=WAL"
+}
+
+// Redacted returns a copy of c that is safe to print or log. Only the
+// password of the DSN is hidden; other secrets are replaced entirely.
+func (c Config) Redacted() Config {
+	for _, s := range settings {
+		if !s.secret {
+			continue
+		}
+		p, ok := s.field(&c).(*string)
+		switch {
+		case !ok || *p == "":
+		case p == &c.DB.DSN:
+			*p = redactDSN(*p)
+		default:
+			*p = redacted
+		}
+	}
+	c.Merchants.Tokens = redactTokens(c.Merchants.Tokens)
+	return c
+}
+
+// redactTokens hides the tokens of merchant:token pairs.
+func redactTokens(v string) string {
+	if v == "" {
+		return v
+	}
+	pairs := strings.Split(v, ",")
+	for i, pair := range pairs {
+		id, _, _ := strings.Cut(strings.TrimSpace(pair), ":")
+		pairs[i] = id + ":" + redacted
+	}
+	return strings.Join(pairs, ",")
+}
+
+const redacted = "REDACTED"
+
+var (
+	dsnPassword = regexp.MustCompile(`(password=)('[^']*'|\S+)`)
+	urlPassword = regexp.MustCompile(`^([a-z]+://[^:/@]*:)[^@]*@`)
+)
+
+// redactDSN hides the password of a key=value or URL DSN. Anything else
+// that does not look like a DSN is replaced entirely.
+func redactDSN(v string) string {
+	switch {
+	case dsnPassword.MatchString(v):
+		return dsnPassword.ReplaceAllString(v, "${1}"+redacted)
+	case urlPassword.MatchString(v):
+		return urlPassword.ReplaceAllString(v, "${1}"+redacted+"@")
+	case strings.Contains(v, "="), strings.Contains(v, "://"):
+		return v
+	}
+	return redacted
+}
+
+// Print writes c as YAML with secrets redacted.
+func (c Config) Print(w io.Writer) error {
+	enc := yaml.NewEncoder(w)
+	enc.SetIndent(2)
+	if err := enc.Encode(c.Redacted()); err != nil {
+		return err
+	}
+	return enc.Close()
+}
+
+func contains(list []string, v string) bool {
+	for _, s := range list {
+		if s == v {
+			return true
+		}
+	}
+	return false
+}
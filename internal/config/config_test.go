@@ -0,0 +1,297 @@
+package config
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func env(vars map[string]string) func(string) string {
+	return func(k string) string { return vars[k] }
+}
+
+func TestLoad(t *testing.T) {
+	t.Run("defaults", func(t *testing.T) {
+		c, rest, err := Load(nil, env(map[string]string{"DB_DSN": "host=db"}))
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if c.HTTP.Addr != ":8080" || c.HTTP.ReadTimeout != 15*time.Second || c.Idempotency.KeyTTL != 24*time.Hour {
+			t.Errorf("got %+v", c)
+		}
+		if !c.Features.Idempotency || !c.Features.Refunds || !c.Features.APIKeys {
+			t.Errorf("features should be enabled by default: %+v", c.Features)
+		}
+		if len(rest) != 0 {
+			t.Errorf("got remaining args %v", rest)
+		}
+	})
+
+	t.Run("precedence", func(t *testing.T) {
+		file := filepath.Join(t.TempDir(), "config.yaml")
+		yml := "http:\n  addr: \":7000\"\n  read_timeout: 5s\ndb:\n  dsn: host=file\n  max_open_conns: 10\nlog:\n  level: warn\n"
+		if err := os.WriteFile(file, []byte(yml), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		vars := map[string]string{
+			"CONFIG_FILE":       file,
+			"HTTP_ADDR":         ":7001",
+			"DB_MAX_OPEN_CONNS": "20",
+		}
+
+		c, rest, err := Load([]string{"-http.addr", ":7002", "migrate", "up"}, env(vars))
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if c.HTTP.Addr != ":7002" {
+			t.Errorf("flag should win: got addr %q", c.HTTP.Addr)
+		}
+		if c.DB.MaxOpenConns != 20 {
+			t.Errorf("env should win over file: got %d", c.DB.MaxOpenConns)
+		}
+		if c.HTTP.ReadTimeout != 5*time.Second || c.DB.DSN != "host=file" || c.Log.Level != "warn" {
+			t.Errorf("file values not applied: %+v", c)
+		}
+		if c.HTTP.WriteTimeout != 15*time.Second {
+			t.Errorf("default not kept: got %s", c.HTTP.WriteTimeout)
+		}
+		if strings.Join(rest, " ") != "migrate up" {
+			t.Errorf("got remaining args %v", rest)
+		}
+	})
+
+	t.Run("config flag", func(t *testing.T) {
+		file := filepath.Join(t.TempDir(), "config.yaml")
+		os.WriteFile(file, []byte("db:\n  dsn: host=flagfile\n"), 0o600)
+
+		c, _, err := Load([]string{"-config", file}, env(nil))
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if c.DB.DSN != "host=flagfile" {
+			t.Errorf("got dsn %q", c.DB.DSN)
+		}
+	})
+
+	t.Run("unknown file key", func(t *testing.T) {
+		file := filepath.Join(t.TempDir(), "config.yaml")
+		os.WriteFile(file, []byte("http:\n  adr: \":1\"\n"), 0o600)
+
+		if _, _, err := Load([]string{"-config", file}, env(map[string]string{"DB_DSN": "x"})); err == nil {
+			t.Fatal("expected error for misspelled key")
+		}
+	})
+
+	t.Run("invalid env value", func(t *testing.T) {
+		_, _, err := Load(nil, env(map[string]string{"DB_DSN": "x", "HTTP_READ_TIMEOUT": "soon"}))
+		if err == nil || !strings.Contains(err.Error(), "HTTP_READ_TIMEOUT") {
+			t.Fatalf("got error %v, want one naming HTTP_READ_TIMEOUT", err)
+		}
+	})
+
+	t.Run("help", func(t *testing.T) {
+		if _, _, err := Load([]string{"-h"}, env(nil)); !errors.Is(err, flag.ErrHelp) {
+			t.Fatalf("got error %v, want flag.ErrHelp", err)
+		}
+	})
+}
+
+func TestValidate(t *testing.T) {
+	c := Default()
+	c.HTTP.ReadTimeout = 0
+	c.DB.MaxOpenConns = 2
+	c.DB.MaxIdleConns = 5
+	c.Log.Level = "verbose"
+	c.Payments.ExpiryInterval = 0
+	c.Payments.FeeBasisPoints = 10001
+	c.Merchants.Tokens = "acme:short"
+	c.Features.APIKeys = true
+
+	err := c.Validate()
+	if err == nil {
+		t.Fatal("expected validation error")
+	}
+	for _, want := range []string{"http.read_timeout", "db.dsn", "db.max_idle_conns", "log.level", "payments.expiry_interval", "payments.fee_basis_points", "merchants.tokens", "features.api_keys"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("error %q does not mention %s", err, want)
+		}
+	}
+}
+
+func TestValidateAuth(t *testing.T) {
+	tests := []struct {
+		name string
+		set  func(c *Config)
+		want string
+	}{
+		{"api keys", func(c *Config) {}, ""},
+		{"merchant tokens", func(c *Config) {
+			c.Features.APIKeys = false
+			c.Merchants.Tokens = "acme:acme-secret-token"
+		}, ""},
+		{"explicitly unauthenticated", func(c *Config) {
+			c.Features.APIKeys = false
+			c.Features.Unauthenticated = true
+		}, ""},
+		{"no credentials", func(c *Config) { c.Features.APIKeys = false }, "features.unauthenticated"},
+		{"unauthenticated with api keys", func(c *Config) { c.Features.Unauthenticated = true }, "cannot be combined"},
+		{"api keys in memory without admin token", func(c *Config) {
+			c.DB.Driver = DriverMemory
+			c.Admin.Token = ""
+		}, "admin.token"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := Default()
+			c.DB.DSN = "host=db"
+			c.Admin.Token = "admin-secret-token"
+			tt.set(c)
+			err := c.Validate()
+			switch {
+			case tt.want == "" && err != nil:
+				t.Errorf("unexpected error: %v", err)
+			case tt.want != "" && (err == nil || !strings.Contains(err.Error(), tt.want)):
+				t.Errorf("got error %v, want one mentioning %s", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestMerchantTokens(t *testing.T) {
+	tokens, err := Merchants{Tokens: "acme:acme-secret-token, globex:globex-secret-token"}.TokenMap()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(tokens) != 2 || tokens["acme"] != "acme-secret-token" || tokens["globex"] != "globex-secret-token" {
+		t.Errorf("got %v", tokens)
+	}
+	if tokens, err := (Merchants{}).TokenMap(); err != nil || len(tokens) != 0 {
+		t.Errorf("got %v, %v, want no tokens", tokens, err)
+	}
+
+	for _, v := range []string{
+		"acme",
+		"Acme:acme-secret-token",
+		"a/b:acme-secret-token",
+		"acme:short",
+		"acme:acme-secret-token,acme:other-secret-token",
+		"acme:shared-secret-token,globex:shared-secret-token",
+	} {
+		if _, err := (Merchants{Tokens: v}).TokenMap(); err == nil {
+			t.Errorf("%q: expected error", v)
+		}
+	}
+}
+
+func TestLogSlogLevel(t *testing.T) {
+	tests := map[string]slog.Level{
+		"debug": slog.LevelDebug,
+		"info":  slog.LevelInfo,
+		"warn":  slog.LevelWarn,
+		"error": slog.LevelError,
+	}
+	for _, level := range LogLevels {
+		if got := (Log{Level: level}).SlogLevel(); got != tests[level] {
+			t.Errorf("level %q: got %v, want %v", level, got, tests[level])
+		}
+	}
+}
+
+func TestPostgresDSN(t *testing.T) {
+	tests := []struct {
+		db   DB
+		want string
+	}{
+		{DB{DSN: "host=db", SSLMode: "disable"}, "host=db sslmode=disable"},
+		{DB{DSN: "host=db sslmode=require", SSLMode: "disable"}, "host=db sslmode=require"},
+		{DB{DSN: "host=db"}, "host=db"},
+	}
+	for _, tt := range tests {
+		if got := tt.db.PostgresDSN(); got != tt.want {
+			t.Errorf("PostgresDSN(%+v) = %q, want %q", tt.db, got, tt.want)
+		}
+	}
+}
+
+func TestSQLiteDSN(t *testing.T) {
+	tests := []struct {
+		dsn  string
+		want string
+	}{
+		{"payments.db", "payments.db?_txlock=immediate&_busy_timeout=5000&_journal_mode=WAL"},
+		{"file:payments.db?cache=shared", "file:payments.db?cache=shared&_txlock=immediate&_busy_timeout=5000&_journal_mode=WAL"},
+	}
+	for _, tt := range tests {
+		if got := (DB{DSN: tt.dsn}).SQLiteDSN(); got != tt.want {
+			t.Errorf("SQLiteDSN(%q) = %q, want %q", tt.dsn, got, tt.want)
+		}
+	}
+}
+
+func TestPrint(t *testing.T) {
+	c := Default()
+	c.DB.DSN = "host=db user=app password=s3cret dbname=payments"
+	c.Admin.Token = "admin-token"
+	c.Merchants.Tokens = "acme:acme-secret-token,globex:globex=secret=token"
+
+	var buf bytes.Buffer
+	if err := c.Print(&buf); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	out := buf.String()
+	for _, secret := range []string{"s3cret", "admin-token", "acme-secret-token", "globex=secret=token"} {
+		if strings.Contains(out, secret) {
+			t.Errorf("output leaks %q:\n%s", secret, out)
+		}
+	}
+	for _, want := range []string{"password=REDACTED", "read_timeout: 15s", "addr: :8080", "acme:REDACTED,globex:REDACTED"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("output misses %q:\n%s", want, out)
+		}
+	}
+	if c.DB.DSN != "host=db user=app password=s3cret dbname=payments" {
+		t.Error("Print must not modify the config")
+	}
+}
+
+func TestRedacted(t *testing.T) {
+	c := Default()
+	c.DB.DSN = "postgres://app:s3cret@db:5432/payments"
+	// Base64 tokens end in "=", which must not pass them off as a DSN.
+	c.Admin.Token = "c2VjcmV0dG9rZW4xMjM0NTY="
+	c.Merchants.Tokens = "acme:YWNtZS1zZWNyZXQ=,globex:https://token"
+
+	r := c.Redacted()
+	if r.Admin.Token != "REDACTED" {
+		t.Errorf("got admin token %q, want REDACTED", r.Admin.Token)
+	}
+	if r.Merchants.Tokens != "acme:REDACTED,globex:REDACTED" {
+		t.Errorf("got merchant tokens %q", r.Merchants.Tokens)
+	}
+	if r.DB.DSN != "postgres://app:REDACTED@db:5432/payments" {
+		t.Errorf("got DSN %q", r.DB.DSN)
+	}
+	if c.Admin.Token != "c2VjcmV0dG9rZW4xMjM0NTY=" {
+		t.Error("Redacted must not modify the config")
+	}
+}
+
+func TestRedactDSN(t *testing.T) {
+	tests := map[string]string{
+		"postgres://app:s3cret@db:5432/payments": "postgres://app:REDACTED@db:5432/payments",
+		"host=db password='a b' user=app":        "host=db password=REDACTED user=app",
+		"host=db user=app":                       "host=db user=app",
+		"token":                                  "REDACTED",
+	}
+	for in, want := range tests {
+		if got := redactDSN(in); got != want {
+			t.Errorf("redactDSN(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
@@ -0,0 +1,86 @@
+package currency
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+)
+
+var (
+	ErrInvalidCode = errors.New("currency must be a three-letter upper-case ISO 4217 code")
+	ErrUnknown     = errors.New("unsupported currency")
+	ErrWithdrawn   = errors.New("currency has been withdrawn")
+)
+
+type Currency struct {
+	Code     string `json:"code"`
+	Numeric  string `json:"numeric"`
+	Exponent int    `json:"exponent"`
+	Name     string `json:"name"`
+	Active   bool   `json:"active"`
+}
+
+var registry = map[string]Currency{}
+
+func init() {
+	for _, c := range active {
+		c.Active = true
+		registry[c.Code] = c
+	}
+	for _, c := range withdrawn {
+		registry[c.Code] = c
+	}
+}
+
+func Lookup(code string) (Currency, bool) {
+	c, ok := registry[code]
+	return c, ok
+}
+
+// All returns every known currency, including withdrawn ones, ordered by code.
+func All() []Currency {
+	list := make([]Currency, 0, len(registry))
+	for _, c := range registry {
+		list = append(list, c)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Code < list[j].Code })
+	return list
+}
+
+// Active returns the currencies that payments can currently be made in.
+func Active() []Currency {
+	var list []Currency
+	for _, c := range All() {
+		if c.Active {
+			list = append(list, c)
+		}
+	}
+	return list
+}
+
+// Validate reports whether new payments may be made in code.
+func Validate(code string) error {
+	if !isCode(code) {
+		return ErrInvalidCode
+	}
+	c, ok := registry[code]
+	if !ok {
+		return fmt.Errorf("%w %q", ErrUnknown, code)
+	}
+	if !c.Active {
+		return fmt.Errorf("%w: %s", ErrWithdrawn, code)
+	}
+	return nil
+}
+
+func isCode(code string) bool {
+	if len(code) != 3 {
+		return false
+	}
+	for _, r := range code {
+		if r < 'A' || r > 'Z' {
+			return false
+		}
+	}
+	return true
+}
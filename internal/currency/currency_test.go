@@ -0,0 +1,72 @@
+package currency
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestLookup(t *testing.T) {
+	tests := []struct {
+		code     string
+		exponent int
+		numeric  string
+	}{
+		{"USD", 2, "840"},
+		{"JPY", 0, "392"},
+		{"KWD", 3, "414"},
+		{"ALL", 2, "008"},
+	}
+	for _, tt := range tests {
+		c, ok := Lookup(tt.code)
+		if !ok {
+			t.Fatalf("%s not found", tt.code)
+		}
+		if c.Exponent != tt.exponent || c.Numeric != tt.numeric || !c.Active {
+			t.Errorf("got %+v, want exponent %d numeric %s", c, tt.exponent, tt.numeric)
+		}
+	}
+
+	if _, ok := Lookup("XYZ"); ok {
+		t.Error("XYZ should not be registered")
+	}
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		code string
+		want error
+	}{
+		{"USD", nil},
+		{"", ErrInvalidCode},
+		{"usd", ErrInvalidCode},
+		{"US", ErrInvalidCode},
+		{"XYZ", ErrUnknown},
+		{"HRK", ErrWithdrawn},
+	}
+	for _, tt := range tests {
+		err := Validate(tt.code)
+		if tt.want == nil && err != nil {
+			t.Errorf("%q: unexpected error %v", tt.code, err)
+		}
+		if tt.want != nil && !errors.Is(err, tt.want) {
+			t.Errorf("%q: got error %v, want %v", tt.code, err, tt.want)
+		}
+	}
+}
+
+func TestActive(t *testing.T) {
+	all, act := All(), Active()
+	if len(act) == 0 || len(act) >= len(all) {
+		t.Fatalf("got %d active of %d currencies", len(act), len(all))
+	}
+	for i := 1; i < len(all); i++ {
+		if all[i-1].Code >= all[i].Code {
+			t.Fatalf("All is not sorted at %s", all[i].Code)
+		}
+	}
+	for _, c := range act {
+		if !c.Active {
+			t.Errorf("%s is withdrawn but listed as active", c.Code)
+		}
+	}
+}
@@ -0,0 +1,176 @@
+package currency
+
+// active lists the ISO 4217 currencies in circulation. Funds, precious metals
+// and testing codes are left out on purpose.
+var active = []Currency{
+	{Code: "AED", Numeric: "784", Exponent: 2, Name: "UAE Dirham"},
+	{Code: "AFN", Numeric: "971", Exponent: 2, Name: "Afghani"},
+	{Code: "ALL", Numeric: "008", Exponent: 2, Name: "Lek"},
+	{Code: "AMD", Numeric: "051", Exponent: 2, Name: "Armenian Dram"},
+	{Code: "AOA", Numeric: "973", Exponent: 2, Name: "Kwanza"},
+	{Code: "ARS", Numeric: "032", Exponent: 2, Name: "Argentine Peso"},
+	{Code: "AUD", Numeric: "036", Exponent: 2, Name: "Australian Dollar"},
+	{Code: "AWG", Numeric: "533", Exponent: 2, Name: "Aruban Florin"},
+	{Code: "AZN", Numeric: "944", Exponent: 2, Name: "Azerbaijan Manat"},
+	{Code: "BAM", Numeric: "977", Exponent: 2, Name: "Convertible Mark"},
+	{Code: "BBD", Numeric: "052", Exponent: 2, Name: "Barbados Dollar"},
+	{Code: "BDT", Numeric: "050", Exponent: 2, Name: "Taka"},
+	{Code: "BHD", Numeric: "048", Exponent: 3, Name: "Bahraini Dinar"},
+	{Code: "BIF", Numeric: "108", Exponent: 0, Name: "Burundi Franc"},
+	{Code: "BMD", Numeric: "060", Exponent: 2, Name: "Bermudian Dollar"},
+	{Code: "BND", Numeric: "096", Exponent: 2, Name: "Brunei Dollar"},
+	{Code: "BOB", Numeric: "068", Exponent: 2, Name: "Boliviano"},
+	{Code: "BRL", Numeric: "986", Exponent: 2, Name: "Brazilian Real"},
+	{Code: "BSD", Numeric: "044", Exponent: 2, Name: "Bahamian Dollar"},
+	{Code: "BTN", Numeric: "064", Exponent: 2, Name: "Ngultrum"},
+	{Code: "BWP", Numeric: "072", Exponent: 2, Name: "Pula"},
+	{Code: "BYN", Numeric: "933", Exponent: 2, Name: "Belarusian Ruble"},
+	{Code: "BZD", Numeric: "084", Exponent: 2, Name: "Belize Dollar"},
+	{Code: "CAD", Numeric: "124", Exponent: 2, Name: "Canadian Dollar"},
+	{Code: "CDF", Numeric: "976", Exponent: 2, Name: "Congolese Franc"},
+	{Code: "CHF", Numeric: "756", Exponent: 2, Name: "Swiss Franc"},
+	{Code: "CLP", Numeric: "152", Exponent: 0, Name: "Chilean Peso"},
+	{Code: "CNY", Numeric: "156", Exponent: 2, Name: "Yuan Renminbi"},
+	{Code: "COP", Numeric: "170", Exponent: 2, Name: "Colombian Peso"},
+	{Code: "CRC", Numeric: "188", Exponent: 2, Name: "Costa Rican Colon"},
+	{Code: "CUP", Numeric: "192", Exponent: 2, Name: "Cuban Peso"},
+	{Code: "CVE", Numeric: "132", Exponent: 2, Name: "Cabo Verde Escudo"},
+	{Code: "CZK", Numeric: "203", Exponent: 2, Name: "Czech Koruna"},
+	{Code: "DJF", Numeric: "262", Exponent: 0, Name: "Djibouti Franc"},
+	{Code: "DKK", Numeric: "208", Exponent: 2, Name: "Danish Krone"},
+	{Code: "DOP", Numeric: "214", Exponent: 2, Name: "Dominican Peso"},
+	{Code: "DZD", Numeric: "012", Exponent: 2, Name: "Algerian Dinar"},
+	{Code: "EGP", Numeric: "818", Exponent: 2, Name: "Egyptian Pound"},
+	{Code: "ERN", Numeric: "232", Exponent: 2, Name: "Nakfa"},
+	{Code: "ETB", Numeric: "230", Exponent: 2, Name: "Ethiopian Birr"},
+	{Code: "EUR", Numeric: "978", Exponent: 2, Name: "Euro"},
+	{Code: "FJD", Numeric: "242", Exponent: 2, Name: "Fiji Dollar"},
+	{Code: "FKP", Numeric: "238", Exponent: 2, Name: "Falkland Islands Pound"},
+	{Code: "GBP", Numeric: "826", Exponent: 2, Name: "Pound Sterling"},
+	{Code: "GEL", Numeric: "981", Exponent: 2, Name: "Lari"},
+	{Code: "GHS", Numeric: "936", Exponent: 2, Name: "Ghana Cedi"},
+	{Code: "GIP", Numeric: "292", Exponent: 2, Name: "Gibraltar Pound"},
+	{Code: "GMD", Numeric: "270", Exponent: 2, Name: "Dalasi"},
+	{Code: "GNF", Numeric: "324", Exponent: 0, Name: "Guinean Franc"},
+	{Code: "GTQ", Numeric: "320", Exponent: 2, Name: "Quetzal"},
+	{Code: "GYD", Numeric: "328", Exponent: 2, Name: "Guyana Dollar"},
+	{Code: "HKD", Numeric: "344", Exponent: 2, Name: "Hong Kong Dollar"},
+	{Code: "HNL", Numeric: "340", Exponent: 2, Name: "Lempira"},
+	{Code: "HTG", Numeric: "332", Exponent: 2, Name: "Gourde"},
+	{Code: "HUF", Numeric: "348", Exponent: 2, Name: "Forint"},
+	{Code: "IDR", Numeric: "360", Exponent: 2, Name: "Rupiah"},
+	{Code: "ILS", Numeric: "376", Exponent: 2, Name: "New Israeli Sheqel"},
+	{Code: "INR", Numeric: "356", Exponent: 2, Name: "Indian Rupee"},
+	{Code: "IQD", Numeric: "368", Exponent: 3, Name: "Iraqi Dinar"},
+	{Code: "IRR", Numeric: "364", Exponent: 2, Name: "Iranian Rial"},
+	{Code: "ISK", Numeric: "352", Exponent: 0, Name: "Iceland Krona"},
+	{Code: "JMD", Numeric: "388", Exponent: 2, Name: "Jamaican Dollar"},
+	{Code: "JOD", Numeric: "400", Exponent: 3, Name: "Jordanian Dinar"},
+	{Code: "JPY", Numeric: "392", Exponent: 0, Name: "Yen"},
+	{Code: "KES", Numeric: "404", Exponent: 2, Name: "Kenyan Shilling"},
+	{Code: "KGS", Numeric: "417", Exponent: 2, Name: "Som"},
+	{Code: "KHR", Numeric: "116", Exponent: 2, Name: "Riel"},
+	{Code: "KMF", Numeric: "174", Exponent: 0, Name: "Comorian Franc"},
+	{Code: "KPW", Numeric: "408", Exponent: 2, Name: "North Korean Won"},
+	{Code: "KRW", Numeric: "410", Exponent: 0, Name: "Won"},
+	{Code: "KWD", Numeric: "414", Exponent: 3, Name: "Kuwaiti Dinar"},
+	{Code: "KYD", Numeric: "136", Exponent: 2, Name: "Cayman Islands Dollar"},
+	{Code: "KZT", Numeric: "398", Exponent: 2, Name: "Tenge"},
+	{Code: "LAK", Numeric: "418", Exponent: 2, Name: "Lao Kip"},
+	{Code: "LBP", Numeric: "422", Exponent: 2, Name: "Lebanese Pound"},
+	{Code: "LKR", Numeric: "144", Exponent: 2, Name: "Sri Lanka Rupee"},
+	{Code: "LRD", Numeric: "430", Exponent: 2, Name: "Liberian Dollar"},
+	{Code: "LSL", Numeric: "426", Exponent: 2, Name: "Loti"},
+	{Code: "LYD", Numeric: "434", Exponent: 3, Name: "Libyan Dinar"},
+	{Code: "MAD", Numeric: "504", Exponent: 2, Name: "Moroccan Dirham"},
+	{Code: "MDL", Numeric: "498", Exponent: 2, Name: "Moldovan Leu"},
+	{Code: "MGA", Numeric: "969", Exponent: 2, Name: "Malagasy Ariary"},
+	{Code: "MKD", Numeric: "807", Exponent: 2, Name: "Denar"},
+	{Code: "MMK", Numeric: "104", Exponent: 2, Name: "Kyat"},
+	{Code: "MNT", Numeric: "496", Exponent: 2, Name: "Tugrik"},
+	{Code: "MOP", Numeric: "446", Exponent: 2, Name: "Pataca"},
+	{Code: "MRU", Numeric: "929", Exponent: 2, Name: "Ouguiya"},
+	{Code: "MUR", Numeric: "480", Exponent: 2, Name: "Mauritius Rupee"},
+	{Code: "MVR", Numeric: "462", Exponent: 2, Name: "Rufiyaa"},
+	{Code: "MWK", Numeric: "454", Exponent: 2, Name: "Malawi Kwacha"},
+	{Code: "MXN", Numeric: "484", Exponent: 2, Name: "Mexican Peso"},
+	{Code: "MYR", Numeric: "458", Exponent: 2, Name: "Malaysian Ringgit"},
+	{Code: "MZN", Numeric: "943", Exponent: 2, Name: "Mozambique Metical"},
+	{Code: "NAD", Numeric: "516", Exponent: 2, Name: "Namibia Dollar"},
+	{Code: "NGN", Numeric: "566", Exponent: 2, Name: "Naira"},
+	{Code: "NIO", Numeric: "558", Exponent: 2, Name: "Cordoba Oro"},
+	{Code: "NOK", Numeric: "578", Exponent: 2, Name: "Norwegian Krone"},
+	{Code: "NPR", Numeric: "524", Exponent: 2, Name: "Nepalese Rupee"},
+	{Code: "NZD", Numeric: "554", Exponent: 2, Name: "New Zealand Dollar"},
+	{Code: "OMR", Numeric: "512", Exponent: 3, Name: "Rial Omani"},
+	{Code: "PAB", Numeric: "590", Exponent: 2, Name: "Balboa"},
+	{Code: "PEN", Numeric: "604", Exponent: 2, Name: "Sol"},
+	{Code: "PGK", Numeric: "598", Exponent: 2, Name: "Kina"},
+	{Code: "PHP", Numeric: "608", Exponent: 2, Name: "Philippine Peso"},
+	{Code: "PKR", Numeric: "586", Exponent: 2, Name: "Pakistan Rupee"},
+	{Code: "PLN", Numeric: "985", Exponent: 2, Name: "Zloty"},
+	{Code: "PYG", Numeric: "600", Exponent: 0, Name: "Guarani"},
+	{Code: "QAR", Numeric: "634", Exponent: 2, Name: "Qatari Rial"},
+	{Code: "RON", Numeric: "946", Exponent: 2, Name: "Romanian Leu"},
+	{Code: "RSD", Numeric: "941", Exponent: 2, Name: "Serbian Dinar"},
+	{Code: "RUB", Numeric: "643", Exponent: 2, Name: "Russian Ruble"},
+	{Code: "RWF", Numeric: "646", Exponent: 0, Name: "Rwanda Franc"},
+	{Code: "SAR", Numeric: "682", Exponent: 2, Name: "Saudi Riyal"},
+	{Code: "SBD", Numeric: "090", Exponent: 2, Name: "Solomon Islands Dollar"},
+	{Code: "SCR", Numeric: "690", Exponent: 2, Name: "Seychelles Rupee"},
+	{Code: "SDG", Numeric: "938", Exponent: 2, Name: "Sudanese Pound"},
+	{Code: "SEK", Numeric: "752", Exponent: 2, Name: "Swedish Krona"},
+	{Code: "SGD", Numeric: "702", Exponent: 2, Name: "Singapore Dollar"},
+	{Code: "SHP", Numeric: "654", Exponent: 2, Name: "Saint Helena Pound"},
+	{Code: "SLE", Numeric: "925", Exponent: 2, Name: "Leone"},
+	{Code: "SOS", Numeric: "706", Exponent: 2, Name: "Somali Shilling"},
+	{Code: "SRD", Numeric: "968", Exponent: 2, Name: "Surinam Dollar"},
+	{Code: "SSP", Numeric: "728", Exponent: 2, Name: "South Sudanese Pound"},
+	{Code: "STN", Numeric: "930", Exponent: 2, Name: "Dobra"},
+	{Code: "SVC", Numeric: "222", Exponent: 2, Name: "El Salvador Colon"},
+	{Code: "SYP", Numeric: "760", Exponent: 2, Name: "Syrian Pound"},
+	{Code: "SZL", Numeric: "748", Exponent: 2, Name: "Lilangeni"},
+	{Code: "THB", Numeric: "764", Exponent: 2, Name: "Baht"},
+	{Code: "TJS", Numeric: "972", Exponent: 2, Name: "Somoni"},
+	{Code: "TMT", Numeric: "934", Exponent: 2, Name: "Turkmenistan New Manat"},
+	{Code: "TND", Numeric: "788", Exponent: 3, Name: "Tunisian Dinar"},
+	{Code: "TOP", Numeric: "776", Exponent: 2, Name: "Pa'anga"},
+	{Code: "TRY", Numeric: "949", Exponent: 2, Name: "Turkish Lira"},
+	{Code: "TTD", Numeric: "780", Exponent: 2, Name: "Trinidad and Tobago Dollar"},
+	{Code: "TWD", Numeric: "901", Exponent: 2, Name: "New Taiwan Dollar"},
+	{Code: "TZS", Numeric: "834", Exponent: 2, Name: "Tanzanian Shilling"},
+	{Code: "UAH", Numeric: "980", Exponent: 2, Name: "Hryvnia"},
+	{Code: "UGX", Numeric: "800", Exponent: 0, Name: "Uganda Shilling"},
+	{Code: "USD", Numeric: "840", Exponent: 2, Name: "US Dollar"},
+	{Code: "UYU", Numeric: "858", Exponent: 2, Name: "Peso Uruguayo"},
+	{Code: "UZS", Numeric: "860", Exponent: 2, Name: "Uzbekistan Sum"},
+	{Code: "VES", Numeric: "928", Exponent: 2, Name: "Bolivar Soberano"},
+	{Code: "VND", Numeric: "704", Exponent: 0, Name: "Dong"},
+	{Code: "VUV", Numeric: "548", Exponent: 0, Name: "Vatu"},
+	{Code: "WST", Numeric: "882", Exponent: 2, Name: "Tala"},
+	{Code: "XAF", Numeric: "950", Exponent: 0, Name: "CFA Franc BEAC"},
+	{Code: "XCD", Numeric: "951", Exponent: 2, Name: "East Caribbean Dollar"},
+	{Code: "XCG", Numeric: "532", Exponent: 2, Name: "Caribbean Guilder"},
+	{Code: "XOF", Numeric: "952", Exponent: 0, Name: "CFA Franc BCEAO"},
+	{Code: "XPF", Numeric: "953", Exponent: 0, Name: "CFP Franc"},
+	{Code: "YER", Numeric: "886", Exponent: 2, Name: "Yemeni Rial"},
+	{Code: "ZAR", Numeric: "710", Exponent: 2, Name: "Rand"},
+	{Code: "ZMW", Numeric: "967", Exponent: 2, Name: "Zambian Kwacha"},
+	{Code: "ZWG", Numeric: "924", Exponent: 2, Name: "Zimbabwe Gold"},
+}
+
+// withdrawn lists replaced currencies that may still appear on historical
+// payments but cannot be used for new ones.
+var withdrawn = []Currency{
+	{Code: "ANG", Numeric: "532", Exponent: 2, Name: "Netherlands Antillean Guilder"},
+	{Code: "BGN", Numeric: "975", Exponent: 2, Name: "Bulgarian Lev"},
+	{Code: "CUC", Numeric: "931", Exponent: 2, Name: "Peso Convertible"},
+	{Code: "EEK", Numeric: "233", Exponent: 2, Name: "Kroon"},
+	{Code: "HRK", Numeric: "191", Exponent: 2, Name: "Kuna"},
+	{Code: "LTL", Numeric: "440", Exponent: 2, Name: "Lithuanian Litas"},
+	{Code: "LVL", Numeric: "428", Exponent: 2, Name: "Latvian Lats"},
+	{Code: "MRO", Numeric: "478", Exponent: 2, Name: "Ouguiya"},
+	{Code: "SLL", Numeric: "694", Exponent: 2, Name: "Leone"},
+	{Code: "VEF", Numeric: "937", Exponent: 2, Name: "Bolivar"},
+	{Code: "ZWL", Numeric: "932", Exponent: 2, Name: "Zimbabwe Dollar"},
+}
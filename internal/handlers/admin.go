@@ -0,0 +1,38 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/eterrni/payments-api/pkg/problem"
+	"github.com/eterrni/payments-api/pkg/utils"
+)
+
+type adminService interface {
+	PurgePayment(context.Context, uint) error
+}
+
+// AdminHandler serves operations that are never part of the public API and
+// must only be mounted behind administrator authentication.
+type AdminHandler struct {
+	service adminService
+}
+
+func NewAdminHandler(svc adminService) *AdminHandler {
+	return &AdminHandler{service: svc}
+}
+
+func (h *AdminHandler) PurgePayment(w http.ResponseWriter, r *http.Request) {
+	id, err := getIDFromRequest(r)
+	if err != nil {
+		problem.Respond(w, r, problem.InvalidParameter, "Invalid payment ID")
+		return
+	}
+
+	if err := h.service.PurgePayment(r.Context(), id); err != nil {
+		respondWithServiceError(w, r, err, "Could not purge payment")
+		return
+	}
+
+	utils.RespondWithJSON(w, http.StatusOK, map[string]string{"status": "Payment purged"})
+}
@@ -0,0 +1,63 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	service "github.com/eterrni/payments-api/internal/services"
+	"github.com/gorilla/mux"
+)
+
+type mockAdminService struct {
+	purgeErr error
+	purged   uint
+}
+
+func (m *mockAdminService) PurgePayment(ctx context.Context, id uint) error {
+	m.purged = id
+	return m.purgeErr
+}
+
+func TestAdminHandler_PurgePayment(t *testing.T) {
+	t.Run("success", func(t *testing.T) {
+		mock := &mockAdminService{}
+		h := NewAdminHandler(mock)
+		req := mux.SetURLVars(httptest.NewRequest(http.MethodDelete, "/admin/payments/7", nil), map[string]string{"id": "7"})
+		w := httptest.NewRecorder()
+
+		h.PurgePayment(w, req)
+
+		if w.Code != http.StatusOK {
+			t.Errorf("got status %d, want %d", w.Code, http.StatusOK)
+		}
+		if mock.purged != 7 {
+			t.Errorf("purged payment %d, want 7", mock.purged)
+		}
+	})
+
+	t.Run("invalid id", func(t *testing.T) {
+		h := NewAdminHandler(&mockAdminService{})
+		req := mux.SetURLVars(httptest.NewRequest(http.MethodDelete, "/admin/payments/x", nil), map[string]string{"id": "x"})
+		w := httptest.NewRecorder()
+
+		h.PurgePayment(w, req)
+
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("got status %d, want %d", w.Code, http.StatusBadRequest)
+		}
+	})
+
+	t.Run("not deleted", func(t *testing.T) {
+		h := NewAdminHandler(&mockAdminService{purgeErr: service.ErrNotFound})
+		req := mux.SetURLVars(httptest.NewRequest(http.MethodDelete, "/admin/payments/7", nil), map[string]string{"id": "7"})
+		w := httptest.NewRecorder()
+
+		h.PurgePayment(w, req)
+
+		if w.Code != http.StatusNotFound {
+			t.Errorf("got status %d, want %d", w.Code, http.StatusNotFound)
+		}
+	})
+}
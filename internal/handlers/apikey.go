@@ -0,0 +1,149 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"path"
+	"time"
+
+	"github.com/eterrni/payments-api/internal/repository"
+	service "github.com/eterrni/payments-api/internal/services"
+	"github.com/eterrni/payments-api/pkg/problem"
+	"github.com/eterrni/payments-api/pkg/utils"
+)
+
+type apiKeyService interface {
+	IssueKey(context.Context, service.IssueKeyRequest) (*service.IssuedKey, error)
+	GetKey(context.Context, uint) (*repository.APIKey, error)
+	ListKeys(context.Context, string) ([]repository.APIKey, error)
+	RevokeKey(context.Context, uint) (*repository.APIKey, error)
+	RotateKey(context.Context, uint, service.RotateKeyRequest) (*service.IssuedKey, error)
+}
+
+// APIKeyHandler manages API keys. It is mounted both for administrators,
+// who manage the keys of every merchant, and for merchants, who manage
+// their own.
+type APIKeyHandler struct {
+	service apiKeyService
+}
+
+func NewAPIKeyHandler(svc apiKeyService) *APIKeyHandler {
+	return &APIKeyHandler{service: svc}
+}
+
+type issueKeyRequestBody struct {
+	MerchantID *string    `json:"merchant_id"`
+	Name       string     `json:"name"`
+	Scopes     []string   `json:"scopes"`
+	ExpiresAt  *time.Time `json:"expires_at"`
+}
+
+type rotateKeyRequestBody struct {
+	Overlap   *string    `json:"overlap"`
+	ExpiresAt *time.Time `json:"expires_at"`
+}
+
+// issuedKeyResponse is the only response that contains the key itself.
+type issuedKeyResponse struct {
+	*repository.APIKey
+	Key string `json:"key"`
+}
+
+func (h *APIKeyHandler) IssueKey(w http.ResponseWriter, r *http.Request) {
+	var body issueKeyRequestBody
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		problem.Respond(w, r, problem.InvalidBody, errInvalidBody.Error())
+		return
+	}
+
+	issued, err := h.service.IssueKey(r.Context(), service.IssueKeyRequest(body))
+	if err != nil {
+		respondWithServiceError(w, r, err, "Could not issue API key")
+		return
+	}
+
+	w.Header().Set("Location", path.Join(r.URL.Path, fmt.Sprint(issued.APIKey.ID)))
+	utils.RespondWithJSON(w, http.StatusCreated, issuedKeyResponse{issued.APIKey, issued.Key})
+}
+
+func (h *APIKeyHandler) GetKey(w http.ResponseWriter, r *http.Request) {
+	id, err := getIDFromRequest(r)
+	if err != nil {
+		problem.Respond(w, r, problem.InvalidParameter, "Invalid API key ID")
+		return
+	}
+
+	key, err := h.service.GetKey(r.Context(), id)
+	if err != nil {
+		respondWithServiceError(w, r, err, "Could not get API key")
+		return
+	}
+
+	utils.RespondWithJSON(w, http.StatusOK, key)
+}
+
+func (h *APIKeyHandler) ListKeys(w http.ResponseWriter, r *http.Request) {
+	keys, err := h.service.ListKeys(r.Context(), r.URL.Query().Get("merchant_id"))
+	if err != nil {
+		respondWithServiceError(w, r, err, "Could not list API keys")
+		return
+	}
+
+	utils.RespondWithList(w, keys, "", false)
+}
+
+// RevokeKey stops the key from working at once. Use RotateKey to replace a
+// key without downtime.
+func (h *APIKeyHandler) RevokeKey(w http.ResponseWriter, r *http.Request) {
+	id, err := getIDFromRequest(r)
+	if err != nil {
+		problem.Respond(w, r, problem.InvalidParameter, "Invalid API key ID")
+		return
+	}
+
+	key, err := h.service.RevokeKey(r.Context(), id)
+	if err != nil {
+		respondWithServiceError(w, r, err, "Could not revoke API key")
+		return
+	}
+
+	utils.RespondWithJSON(w, http.StatusOK, key)
+}
+
+// RotateKey issues a replacement for the key. The old key keeps working for
+// the overlap given in the body, a duration such as "1h".
+func (h *APIKeyHandler) RotateKey(w http.ResponseWriter, r *http.Request) {
+	id, err := getIDFromRequest(r)
+	if err != nil {
+		problem.Respond(w, r, problem.InvalidParameter, "Invalid API key ID")
+		return
+	}
+
+	var body rotateKeyRequestBody
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil && err != io.EOF {
+		problem.Respond(w, r, problem.InvalidBody, errInvalidBody.Error())
+		return
+	}
+	req := service.RotateKeyRequest{ExpiresAt: body.ExpiresAt}
+	if body.Overlap != nil {
+		overlap, err := time.ParseDuration(*body.Overlap)
+		if err != nil {
+			problem.Respond(w, r, problem.InvalidBody, fmt.Sprintf("Invalid overlap %q", *body.Overlap))
+			return
+		}
+		req.Overlap = &overlap
+	}
+
+	issued, err := h.service.RotateKey(r.Context(), id, req)
+	if err != nil {
+		respondWithServiceError(w, r, err, "Could not rotate API key")
+		return
+	}
+
+	// Rotation is served at <keys>/{id}/rotate.
+	w.Header().Set("Location", path.Join(path.Dir(path.Dir(r.URL.Path)), fmt.Sprint(issued.APIKey.ID)))
+	utils.RespondWithJSON(w, http.StatusCreated, issuedKeyResponse{issued.APIKey, issued.Key})
+}
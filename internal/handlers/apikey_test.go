@@ -0,0 +1,189 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/eterrni/payments-api/internal/repository"
+	service "github.com/eterrni/payments-api/internal/services"
+)
+
+type mockAPIKeyService struct {
+	keys      map[uint]*repository.APIKey
+	issueReq  service.IssueKeyRequest
+	issueErr  error
+	listReq   string
+	rotateReq service.RotateKeyRequest
+}
+
+func (m *mockAPIKeyService) IssueKey(ctx context.Context, req service.IssueKeyRequest) (*service.IssuedKey, error) {
+	m.issueReq = req
+	if m.issueErr != nil {
+		return nil, m.issueErr
+	}
+	return &service.IssuedKey{APIKey: &repository.APIKey{ID: 5, Prefix: "0123456789ab", SecretHash: "hash", Scopes: req.Scopes}, Key: "pay_0123456789ab_secret"}, nil
+}
+
+func (m *mockAPIKeyService) GetKey(ctx context.Context, id uint) (*repository.APIKey, error) {
+	if k, ok := m.keys[id]; ok {
+		return k, nil
+	}
+	return nil, fmt.Errorf("API key %d %w", id, service.ErrNotFound)
+}
+
+func (m *mockAPIKeyService) ListKeys(ctx context.Context, merchantID string) ([]repository.APIKey, error) {
+	m.listReq = merchantID
+	keys := []repository.APIKey{}
+	for _, k := range m.keys {
+		keys = append(keys, *k)
+	}
+	return keys, nil
+}
+
+func (m *mockAPIKeyService) RevokeKey(ctx context.Context, id uint) (*repository.APIKey, error) {
+	k, ok := m.keys[id]
+	if !ok {
+		return nil, fmt.Errorf("API key %d %w", id, service.ErrNotFound)
+	}
+	now := time.Now()
+	k.RevokedAt = &now
+	return k, nil
+}
+
+func (m *mockAPIKeyService) RotateKey(ctx context.Context, id uint, req service.RotateKeyRequest) (*service.IssuedKey, error) {
+	m.rotateReq = req
+	if _, ok := m.keys[id]; !ok {
+		return nil, fmt.Errorf("API key %d %w", id, service.ErrNotFound)
+	}
+	return &service.IssuedKey{APIKey: &repository.APIKey{ID: 6, Prefix: "ba9876543210"}, Key: "pay_ba9876543210_secret"}, nil
+}
+
+func TestAPIKeyHandler_IssueKey(t *testing.T) {
+	t.Run("issued", func(t *testing.T) {
+		mock := &mockAPIKeyService{}
+		h := NewAPIKeyHandler(mock)
+		body := `{"merchant_id":"acme","name":"backend","scopes":["read","write"],"expires_at":"2030-01-01T00:00:00Z"}`
+		w := httptest.NewRecorder()
+		h.IssueKey(w, httptest.NewRequest(http.MethodPost, "/admin/api-keys", strings.NewReader(body)))
+
+		if w.Code != http.StatusCreated {
+			t.Fatalf("got status %d, want %d", w.Code, http.StatusCreated)
+		}
+		if got := w.Header().Get("Location"); got != "/admin/api-keys/5" {
+			t.Errorf("got Location %q, want /admin/api-keys/5", got)
+		}
+		if mock.issueReq.MerchantID == nil || *mock.issueReq.MerchantID != "acme" || len(mock.issueReq.Scopes) != 2 || mock.issueReq.ExpiresAt == nil {
+			t.Errorf("unexpected request %+v", mock.issueReq)
+		}
+		if !strings.Contains(w.Body.String(), `"key":"pay_0123456789ab_secret"`) || strings.Contains(w.Body.String(), "hash") {
+			t.Errorf("got body %s", w.Body)
+		}
+	})
+
+	t.Run("merchant_id", func(t *testing.T) {
+		for body, want := range map[string]*string{`{"scopes":["read"]}`: nil, `{"merchant_id":"","scopes":["read"]}`: new(string)} {
+			mock := &mockAPIKeyService{}
+			NewAPIKeyHandler(mock).IssueKey(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/admin/api-keys", strings.NewReader(body)))
+			if got := mock.issueReq.MerchantID; (got == nil) != (want == nil) || got != nil && *got != *want {
+				t.Errorf("%s: got merchant_id %v, want %v", body, got, want)
+			}
+		}
+	})
+
+	for name, tc := range map[string]struct {
+		body   string
+		err    error
+		status int
+	}{
+		"invalid body": {body: `{"scopes":`, status: http.StatusBadRequest},
+		"invalid time": {body: `{"expires_at":"tomorrow"}`, status: http.StatusBadRequest},
+		"validation":   {body: `{}`, err: &service.ValidationError{Fields: []service.FieldError{{Field: "scopes", Message: "at least one scope is required"}}}, status: http.StatusUnprocessableEntity},
+	} {
+		t.Run(name, func(t *testing.T) {
+			h := NewAPIKeyHandler(&mockAPIKeyService{issueErr: tc.err})
+			w := httptest.NewRecorder()
+			h.IssueKey(w, httptest.NewRequest(http.MethodPost, "/api-keys", strings.NewReader(tc.body)))
+
+			if w.Code != tc.status {
+				t.Errorf("got status %d, want %d", w.Code, tc.status)
+			}
+		})
+	}
+}
+
+func TestAPIKeyHandler(t *testing.T) {
+	mock := &mockAPIKeyService{keys: map[uint]*repository.APIKey{1: {ID: 1, Prefix: "0123456789ab", SecretHash: "hash"}}}
+	h := NewAPIKeyHandler(mock)
+
+	t.Run("get", func(t *testing.T) {
+		for id, status := range map[string]int{"1": http.StatusOK, "2": http.StatusNotFound, "x": http.StatusBadRequest} {
+			w := httptest.NewRecorder()
+			h.GetKey(w, withID(httptest.NewRequest(http.MethodGet, "/api-keys/"+id, nil), id))
+			if w.Code != status {
+				t.Errorf("key %s: got status %d, want %d", id, w.Code, status)
+			}
+			if strings.Contains(w.Body.String(), "hash") {
+				t.Errorf("body %s shows the secret hash", w.Body)
+			}
+		}
+	})
+
+	t.Run("list", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		h.ListKeys(w, httptest.NewRequest(http.MethodGet, "/admin/api-keys?merchant_id=acme", nil))
+		if w.Code != http.StatusOK {
+			t.Fatalf("got status %d, want %d", w.Code, http.StatusOK)
+		}
+		if mock.listReq != "acme" {
+			t.Errorf("got merchant filter %q, want acme", mock.listReq)
+		}
+		if !strings.Contains(w.Body.String(), `"prefix":"0123456789ab"`) {
+			t.Errorf("body %s does not list the key", w.Body)
+		}
+	})
+
+	t.Run("rotate", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodPost, "/api-keys/1/rotate", strings.NewReader(`{"overlap":"1h"}`))
+		h.RotateKey(w, withID(req, "1"))
+		if w.Code != http.StatusCreated {
+			t.Fatalf("got status %d, want %d", w.Code, http.StatusCreated)
+		}
+		if got := w.Header().Get("Location"); got != "/api-keys/6" {
+			t.Errorf("got Location %q, want /api-keys/6", got)
+		}
+		if mock.rotateReq.Overlap == nil || *mock.rotateReq.Overlap != time.Hour {
+			t.Errorf("unexpected request %+v", mock.rotateReq)
+		}
+
+		w = httptest.NewRecorder()
+		h.RotateKey(w, withID(httptest.NewRequest(http.MethodPost, "/api-keys/1/rotate", nil), "1"))
+		if w.Code != http.StatusCreated || mock.rotateReq.Overlap != nil {
+			t.Errorf("without body: got status %d, request %+v", w.Code, mock.rotateReq)
+		}
+
+		w = httptest.NewRecorder()
+		h.RotateKey(w, withID(httptest.NewRequest(http.MethodPost, "/api-keys/1/rotate", strings.NewReader(`{"overlap":"a day"}`)), "1"))
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("got status %d, want %d", w.Code, http.StatusBadRequest)
+		}
+	})
+
+	t.Run("revoke", func(t *testing.T) {
+		for id, status := range map[string]int{"1": http.StatusOK, "2": http.StatusNotFound} {
+			w := httptest.NewRecorder()
+			h.RevokeKey(w, withID(httptest.NewRequest(http.MethodDelete, "/api-keys/"+id, nil), id))
+			if w.Code != status {
+				t.Errorf("key %s: got status %d, want %d", id, w.Code, status)
+			}
+		}
+		if mock.keys[1].RevokedAt == nil {
+			t.Error("key not revoked")
+		}
+	})
+}
@@ -0,0 +1,24 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/eterrni/payments-api/internal/currency"
+	"github.com/eterrni/payments-api/pkg/utils"
+)
+
+type CurrencyHandler struct{}
+
+func NewCurrencyHandler() *CurrencyHandler {
+	return &CurrencyHandler{}
+}
+
+// ListCurrencies returns the currencies new payments can be made in.
+// Withdrawn currencies are included with ?include_withdrawn=true.
+func (h *CurrencyHandler) ListCurrencies(w http.ResponseWriter, r *http.Request) {
+	list := currency.Active()
+	if r.URL.Query().Get("include_withdrawn") == "true" {
+		list = currency.All()
+	}
+	utils.RespondWithList(w, list, "", false)
+}
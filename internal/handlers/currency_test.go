@@ -0,0 +1,56 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/eterrni/payments-api/internal/currency"
+)
+
+func TestCurrencyHandler_ListCurrencies(t *testing.T) {
+	decode := func(t *testing.T, w *httptest.ResponseRecorder) []currency.Currency {
+		t.Helper()
+		var body struct {
+			Data []currency.Currency `json:"data"`
+		}
+		if err := json.NewDecoder(w.Body).Decode(&body); err != nil {
+			t.Fatalf("decode body: %v", err)
+		}
+		return body.Data
+	}
+
+	t.Run("active only", func(t *testing.T) {
+		h := NewCurrencyHandler()
+		req := httptest.NewRequest(http.MethodGet, "/currencies", nil)
+		w := httptest.NewRecorder()
+
+		h.ListCurrencies(w, req)
+
+		if w.Code != http.StatusOK {
+			t.Fatalf("got status %d, want %d", w.Code, http.StatusOK)
+		}
+		list := decode(t, w)
+		if len(list) != len(currency.Active()) {
+			t.Errorf("got %d currencies, want %d", len(list), len(currency.Active()))
+		}
+		for _, c := range list {
+			if !c.Active {
+				t.Errorf("withdrawn currency %s listed", c.Code)
+			}
+		}
+	})
+
+	t.Run("include withdrawn", func(t *testing.T) {
+		h := NewCurrencyHandler()
+		req := httptest.NewRequest(http.MethodGet, "/currencies?include_withdrawn=true", nil)
+		w := httptest.NewRecorder()
+
+		h.ListCurrencies(w, req)
+
+		if list := decode(t, w); len(list) != len(currency.All()) {
+			t.Errorf("got %d currencies, want %d", len(list), len(currency.All()))
+		}
+	})
+}
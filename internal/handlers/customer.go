@@ -0,0 +1,174 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"github.com/eterrni/payments-api/internal/repository"
+	service "github.com/eterrni/payments-api/internal/services"
+	"github.com/eterrni/payments-api/pkg/problem"
+	"github.com/eterrni/payments-api/pkg/utils"
+)
+
+type customerService interface {
+	CreateCustomer(context.Context, service.CustomerRequest) (*repository.Customer, error)
+	GetCustomer(context.Context, uint) (*repository.Customer, error)
+	UpdateCustomer(context.Context, uint, service.CustomerRequest) (*repository.Customer, error)
+	DeleteCustomer(context.Context, uint) error
+	ListCustomers(context.Context, service.ListCustomersRequest) (*service.CustomerPage, error)
+	ListPayments(context.Context, uint, service.ListPaymentsRequest) (*service.PaymentPage, error)
+}
+
+type CustomerHandler struct {
+	service customerService
+}
+
+func NewCustomerHandler(svc customerService) *CustomerHandler {
+	return &CustomerHandler{service: svc}
+}
+
+type customerRequestBody struct {
+	ExternalRef string              `json:"external_ref"`
+	Name        string              `json:"name"`
+	Email       string              `json:"email"`
+	Metadata    repository.Metadata `json:"metadata"`
+}
+
+func decodeCustomerRequest(r io.Reader) (service.CustomerRequest, error) {
+	var body customerRequestBody
+	if err := json.NewDecoder(r).Decode(&body); err != nil && err != io.EOF {
+		return service.CustomerRequest{}, errInvalidBody
+	}
+	return service.CustomerRequest(body), nil
+}
+
+func (h *CustomerHandler) CreateCustomer(w http.ResponseWriter, r *http.Request) {
+	req, err := decodeCustomerRequest(r.Body)
+	if err != nil {
+		problem.Respond(w, r, problem.InvalidBody, err.Error())
+		return
+	}
+
+	created, err := h.service.CreateCustomer(r.Context(), req)
+	if err != nil {
+		respondWithServiceError(w, r, err, "Could not create customer")
+		return
+	}
+
+	w.Header().Set("Location", fmt.Sprintf("/customers/%d", created.ID))
+	utils.RespondWithJSON(w, http.StatusCreated, created)
+}
+
+func (h *CustomerHandler) GetCustomer(w http.ResponseWriter, r *http.Request) {
+	id, err := getIDFromRequest(r)
+	if err != nil {
+		problem.Respond(w, r, problem.InvalidParameter, "Invalid customer ID")
+		return
+	}
+
+	customer, err := h.service.GetCustomer(r.Context(), id)
+	if err != nil {
+		respondWithServiceError(w, r, err, "Could not get customer")
+		return
+	}
+
+	utils.RespondWithJSON(w, http.StatusOK, customer)
+}
+
+func (h *CustomerHandler) ListCustomers(w http.ResponseWriter, r *http.Request) {
+	req, err := parseListCustomersRequest(r.URL.Query())
+	if err != nil {
+		problem.Respond(w, r, problem.InvalidParameter, err.Error())
+		return
+	}
+
+	page, err := h.service.ListCustomers(r.Context(), req)
+	if err != nil {
+		respondWithServiceError(w, r, err, "Could not list customers")
+		return
+	}
+
+	utils.RespondWithList(w, page.Customers, page.NextCursor, page.HasMore)
+}
+
+// UpdateCustomer replaces the customer; fields left out of the body are
+// cleared.
+func (h *CustomerHandler) UpdateCustomer(w http.ResponseWriter, r *http.Request) {
+	id, err := getIDFromRequest(r)
+	if err != nil {
+		problem.Respond(w, r, problem.InvalidParameter, "Invalid customer ID")
+		return
+	}
+
+	req, err := decodeCustomerRequest(r.Body)
+	if err != nil {
+		problem.Respond(w, r, problem.InvalidBody, err.Error())
+		return
+	}
+
+	updated, err := h.service.UpdateCustomer(r.Context(), id, req)
+	if err != nil {
+		respondWithServiceError(w, r, err, "Could not update customer")
+		return
+	}
+
+	utils.RespondWithJSON(w, http.StatusOK, updated)
+}
+
+func (h *CustomerHandler) DeleteCustomer(w http.ResponseWriter, r *http.Request) {
+	id, err := getIDFromRequest(r)
+	if err != nil {
+		problem.Respond(w, r, problem.InvalidParameter, "Invalid customer ID")
+		return
+	}
+
+	if err := h.service.DeleteCustomer(r.Context(), id); err != nil {
+		respondWithServiceError(w, r, err, "Could not delete customer")
+		return
+	}
+
+	utils.RespondWithJSON(w, http.StatusOK, map[string]string{"status": "Customer deleted"})
+}
+
+// ListPayments lists the payments of the customer and accepts the query
+// parameters of GET /payments.
+func (h *CustomerHandler) ListPayments(w http.ResponseWriter, r *http.Request) {
+	id, err := getIDFromRequest(r)
+	if err != nil {
+		problem.Respond(w, r, problem.InvalidParameter, "Invalid customer ID")
+		return
+	}
+
+	req, err := parseListPaymentsRequest(r.URL.Query())
+	if err != nil {
+		problem.Respond(w, r, problem.InvalidParameter, err.Error())
+		return
+	}
+
+	page, err := h.service.ListPayments(r.Context(), id, req)
+	if err != nil {
+		respondWithServiceError(w, r, err, "Could not list payments")
+		return
+	}
+
+	utils.RespondWithList(w, page.Payments, page.NextCursor, page.HasMore)
+}
+
+func parseListCustomersRequest(q url.Values) (service.ListCustomersRequest, error) {
+	req := service.ListCustomersRequest{
+		ExternalRef: q.Get("external_ref"),
+		Cursor:      q.Get("cursor"),
+	}
+	if v := q.Get("limit"); v != "" {
+		var err error
+		if req.Limit, err = strconv.Atoi(v); err != nil {
+			return req, fmt.Errorf("Invalid limit %q", v)
+		}
+	}
+	return req, nil
+}
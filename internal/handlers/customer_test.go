@@ -0,0 +1,190 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/eterrni/payments-api/internal/repository"
+	service "github.com/eterrni/payments-api/internal/services"
+	"github.com/gorilla/mux"
+)
+
+type mockCustomerService struct {
+	customers   map[uint]*repository.Customer
+	createReq   service.CustomerRequest
+	createErr   error
+	listReq     service.ListCustomersRequest
+	paymentsReq service.ListPaymentsRequest
+}
+
+func (m *mockCustomerService) CreateCustomer(ctx context.Context, req service.CustomerRequest) (*repository.Customer, error) {
+	m.createReq = req
+	if m.createErr != nil {
+		return nil, m.createErr
+	}
+	return &repository.Customer{ID: 5, Name: req.Name}, nil
+}
+
+func (m *mockCustomerService) GetCustomer(ctx context.Context, id uint) (*repository.Customer, error) {
+	if c, ok := m.customers[id]; ok {
+		return c, nil
+	}
+	return nil, fmt.Errorf("customer %d %w", id, service.ErrNotFound)
+}
+
+func (m *mockCustomerService) UpdateCustomer(ctx context.Context, id uint, req service.CustomerRequest) (*repository.Customer, error) {
+	if _, ok := m.customers[id]; !ok {
+		return nil, fmt.Errorf("customer %d %w", id, service.ErrNotFound)
+	}
+	return &repository.Customer{ID: id, ExternalRef: req.ExternalRef, Name: req.Name, Email: req.Email, Metadata: req.Metadata}, nil
+}
+
+func (m *mockCustomerService) DeleteCustomer(ctx context.Context, id uint) error {
+	if _, ok := m.customers[id]; !ok {
+		return fmt.Errorf("customer %d %w", id, service.ErrNotFound)
+	}
+	delete(m.customers, id)
+	return nil
+}
+
+func (m *mockCustomerService) ListCustomers(ctx context.Context, req service.ListCustomersRequest) (*service.CustomerPage, error) {
+	m.listReq = req
+	page := &service.CustomerPage{Customers: []repository.Customer{}}
+	for _, c := range m.customers {
+		page.Customers = append(page.Customers, *c)
+	}
+	return page, nil
+}
+
+func (m *mockCustomerService) ListPayments(ctx context.Context, id uint, req service.ListPaymentsRequest) (*service.PaymentPage, error) {
+	m.paymentsReq = req
+	if _, ok := m.customers[id]; !ok {
+		return nil, fmt.Errorf("customer %d %w", id, service.ErrNotFound)
+	}
+	return &service.PaymentPage{Payments: []repository.Payment{{ID: 3, CustomerID: &id}}}, nil
+}
+
+func withID(r *http.Request, id string) *http.Request {
+	return mux.SetURLVars(r, map[string]string{"id": id})
+}
+
+func TestCustomerHandler_CreateCustomer(t *testing.T) {
+	t.Run("created", func(t *testing.T) {
+		mock := &mockCustomerService{}
+		h := NewCustomerHandler(mock)
+		body := `{"external_ref":"cus-1","name":"Alice","email":"alice@example.com","metadata":{"tier":"gold"}}`
+		w := httptest.NewRecorder()
+		h.CreateCustomer(w, httptest.NewRequest(http.MethodPost, "/customers", strings.NewReader(body)))
+
+		if w.Code != http.StatusCreated {
+			t.Fatalf("got status %d, want %d", w.Code, http.StatusCreated)
+		}
+		if got := w.Header().Get("Location"); got != "/customers/5" {
+			t.Errorf("got Location %q, want /customers/5", got)
+		}
+		if mock.createReq.ExternalRef != "cus-1" || mock.createReq.Email != "alice@example.com" || mock.createReq.Metadata["tier"] != "gold" {
+			t.Errorf("unexpected request %+v", mock.createReq)
+		}
+	})
+
+	for name, tc := range map[string]struct {
+		body   string
+		err    error
+		status int
+	}{
+		"invalid body": {body: `{"name":`, status: http.StatusBadRequest},
+		"validation":   {body: `{}`, err: &service.ValidationError{Fields: []service.FieldError{{Field: "email", Message: "invalid email address"}}}, status: http.StatusUnprocessableEntity},
+		"conflict":     {body: `{}`, err: fmt.Errorf("%w: duplicate key", service.ErrConflict), status: http.StatusConflict},
+	} {
+		t.Run(name, func(t *testing.T) {
+			h := NewCustomerHandler(&mockCustomerService{createErr: tc.err})
+			w := httptest.NewRecorder()
+			h.CreateCustomer(w, httptest.NewRequest(http.MethodPost, "/customers", strings.NewReader(tc.body)))
+
+			if w.Code != tc.status {
+				t.Errorf("got status %d, want %d", w.Code, tc.status)
+			}
+		})
+	}
+}
+
+func TestCustomerHandler(t *testing.T) {
+	mock := &mockCustomerService{customers: map[uint]*repository.Customer{1: {ID: 1, Name: "Alice"}}}
+	h := NewCustomerHandler(mock)
+
+	t.Run("get", func(t *testing.T) {
+		for id, status := range map[string]int{"1": http.StatusOK, "2": http.StatusNotFound, "x": http.StatusBadRequest} {
+			w := httptest.NewRecorder()
+			h.GetCustomer(w, withID(httptest.NewRequest(http.MethodGet, "/customers/"+id, nil), id))
+			if w.Code != status {
+				t.Errorf("customer %s: got status %d, want %d", id, w.Code, status)
+			}
+		}
+	})
+
+	t.Run("list", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		h.ListCustomers(w, httptest.NewRequest(http.MethodGet, "/customers?external_ref=cus-1&limit=5", nil))
+		if w.Code != http.StatusOK {
+			t.Fatalf("got status %d, want %d", w.Code, http.StatusOK)
+		}
+		if mock.listReq.ExternalRef != "cus-1" || mock.listReq.Limit != 5 {
+			t.Errorf("unexpected request %+v", mock.listReq)
+		}
+		if !strings.Contains(w.Body.String(), `"name":"Alice"`) {
+			t.Errorf("body %s does not list the customer", w.Body)
+		}
+
+		w = httptest.NewRecorder()
+		h.ListCustomers(w, httptest.NewRequest(http.MethodGet, "/customers?limit=x", nil))
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("got status %d, want %d", w.Code, http.StatusBadRequest)
+		}
+	})
+
+	t.Run("update", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodPut, "/customers/1", strings.NewReader(`{"name":"Alice Smith"}`))
+		h.UpdateCustomer(w, withID(req, "1"))
+		if w.Code != http.StatusOK {
+			t.Fatalf("got status %d, want %d", w.Code, http.StatusOK)
+		}
+		if !strings.Contains(w.Body.String(), `"name":"Alice Smith"`) {
+			t.Errorf("got body %s", w.Body)
+		}
+	})
+
+	t.Run("payments", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		h.ListPayments(w, withID(httptest.NewRequest(http.MethodGet, "/customers/1/payments?status=pending", nil), "1"))
+		if w.Code != http.StatusOK {
+			t.Fatalf("got status %d, want %d", w.Code, http.StatusOK)
+		}
+		if mock.paymentsReq.Status != repository.StatusPending {
+			t.Errorf("unexpected request %+v", mock.paymentsReq)
+		}
+		if !strings.Contains(w.Body.String(), `"customer_id":1`) {
+			t.Errorf("got body %s", w.Body)
+		}
+
+		w = httptest.NewRecorder()
+		h.ListPayments(w, withID(httptest.NewRequest(http.MethodGet, "/customers/2/payments", nil), "2"))
+		if w.Code != http.StatusNotFound {
+			t.Errorf("got status %d, want %d", w.Code, http.StatusNotFound)
+		}
+	})
+
+	t.Run("delete", func(t *testing.T) {
+		for _, status := range []int{http.StatusOK, http.StatusNotFound} {
+			w := httptest.NewRecorder()
+			h.DeleteCustomer(w, withID(httptest.NewRequest(http.MethodDelete, "/customers/1", nil), "1"))
+			if w.Code != status {
+				t.Errorf("got status %d, want %d", w.Code, status)
+			}
+		}
+	})
+}
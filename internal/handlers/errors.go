@@ -0,0 +1,46 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+
+	service "github.com/eterrni/payments-api/internal/services"
+	"github.com/eterrni/payments-api/pkg/problem"
+)
+
+// respondWithServiceError maps errors returned by the services onto problem
+// responses. Errors the services do not classify are logged and reported as
+// internal errors with fallback as the detail, so internal details never leak.
+// A request canceled by its client is not logged; nobody reads the answer.
+func respondWithServiceError(w http.ResponseWriter, r *http.Request, err error, fallback string) {
+	var (
+		verr *service.ValidationError
+		terr *service.TransitionError
+	)
+	switch {
+	case errors.As(err, &verr):
+		fields := make([]problem.FieldError, len(verr.Fields))
+		for i, f := range verr.Fields {
+			fields[i] = problem.FieldError{Field: f.Field, Message: f.Message}
+		}
+		problem.Respond(w, r, problem.ValidationFailed, verr.Error(), fields...)
+	case errors.Is(err, service.ErrNotFound):
+		problem.Respond(w, r, problem.NotFound, err.Error())
+	case errors.Is(err, service.ErrVersionMismatch):
+		problem.Respond(w, r, problem.PreconditionFailed, err.Error())
+	case errors.As(err, &terr):
+		problem.Respond(w, r, problem.InvalidTransition, terr.Error())
+	case errors.Is(err, service.ErrConflict):
+		problem.Respond(w, r, problem.Conflict, "")
+	case errors.Is(err, context.Canceled):
+		problem.Respond(w, r, problem.Unavailable, "Request canceled")
+	case errors.Is(err, service.ErrUnavailable):
+		slog.Warn("Service unavailable", "error", err)
+		problem.Respond(w, r, problem.Unavailable, "Please retry later")
+	default:
+		slog.Error(fallback, "error", err)
+		problem.Respond(w, r, problem.Internal, fallback)
+	}
+}
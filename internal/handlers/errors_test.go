@@ -0,0 +1,90 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/eterrni/payments-api/internal/repository"
+	service "github.com/eterrni/payments-api/internal/services"
+	"github.com/eterrni/payments-api/pkg/problem"
+)
+
+func TestRespondWithServiceError(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want problem.Kind
+	}{
+		{"validation", &service.ValidationError{Fields: []service.FieldError{{Field: "amount", Message: "invalid payment amount"}}}, problem.ValidationFailed},
+		{"not found", fmt.Errorf("payment 7 %w", service.ErrNotFound), problem.NotFound},
+		{"transition", &service.TransitionError{From: repository.StatusSettled, To: repository.StatusCanceled}, problem.InvalidTransition},
+		{"conflict", fmt.Errorf("%w: duplicate key", service.ErrConflict), problem.Conflict},
+		{"version mismatch", fmt.Errorf("payment 7 %w", service.ErrVersionMismatch), problem.PreconditionFailed},
+		{"unavailable", fmt.Errorf("%w: connection refused", service.ErrUnavailable), problem.Unavailable},
+		{"canceled", fmt.Errorf("load payment: %w", context.Canceled), problem.Unavailable},
+		{"unknown", errors.New("boom"), problem.Internal},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			r := httptest.NewRequest(http.MethodGet, "/payments/7", nil)
+
+			respondWithServiceError(w, r, tt.err, "Something went wrong")
+
+			if w.Code != tt.want.Status {
+				t.Errorf("got status %d, want %d", w.Code, tt.want.Status)
+			}
+			p := decodeProblem(t, w)
+			if p.Code != tt.want.Code {
+				t.Errorf("got code %q, want %q", p.Code, tt.want.Code)
+			}
+			if p.Instance != "/payments/7" {
+				t.Errorf("got instance %q, want /payments/7", p.Instance)
+			}
+		})
+	}
+
+	t.Run("field errors", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		err := &service.ValidationError{Fields: []service.FieldError{
+			{Field: "amount", Message: "invalid payment amount"},
+			{Field: "currency", Message: "unknown currency"},
+		}}
+
+		respondWithServiceError(w, httptest.NewRequest(http.MethodPost, "/payments", nil), err, "")
+
+		p := decodeProblem(t, w)
+		if len(p.Errors) != 2 || p.Errors[0].Field != "amount" || p.Errors[1].Field != "currency" {
+			t.Errorf("got errors %+v", p.Errors)
+		}
+	})
+
+	t.Run("internal details are not leaked", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(http.MethodGet, "/payments/1", nil)
+
+		respondWithServiceError(w, r, errors.New("pq: password authentication failed"), "Could not get payment")
+
+		if p := decodeProblem(t, w); p.Detail != "Could not get payment" {
+			t.Errorf("got detail %q", p.Detail)
+		}
+	})
+}
+
+func decodeProblem(t *testing.T, w *httptest.ResponseRecorder) problem.Problem {
+	t.Helper()
+	if ct := w.Header().Get("Content-Type"); ct != problem.ContentType {
+		t.Errorf("Content-Type = %q, want %s", ct, problem.ContentType)
+	}
+	var p problem.Problem
+	if err := json.NewDecoder(w.Body).Decode(&p); err != nil {
+		t.Fatalf("decode body: %v", err)
+	}
+	return p
+}
@@ -0,0 +1,81 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/eterrni/payments-api/internal/repository"
+	"github.com/eterrni/payments-api/pkg/problem"
+	"github.com/eterrni/payments-api/pkg/utils"
+)
+
+var (
+	errPreconditionRequired = errors.New("If-Match header is required")
+	errInvalidIfMatch       = errors.New("Invalid If-Match header")
+)
+
+// etag is the entity tag of a payment version. It is strong: the version
+// changes with every write, and with it the representation.
+func etag(version int64) string {
+	return `"` + strconv.FormatInt(version, 10) + `"`
+}
+
+// respondWithPayment writes payment together with its ETag.
+func respondWithPayment(w http.ResponseWriter, status int, payment *repository.Payment) {
+	w.Header().Set("ETag", etag(payment.Version))
+	utils.RespondWithJSON(w, status, payment)
+}
+
+// ifMatchVersion returns the version named by the If-Match header of r, or 0
+// for "*", which matches any version. Only a single strong entity tag is
+// accepted, since an update can only be conditional on one version.
+func ifMatchVersion(r *http.Request) (int64, error) {
+	h := strings.TrimSpace(r.Header.Get("If-Match"))
+	switch {
+	case h == "":
+		return 0, errPreconditionRequired
+	case h == "*":
+		return 0, nil
+	case len(h) < 2 || h[0] != '"' || h[len(h)-1] != '"':
+		return 0, errInvalidIfMatch
+	}
+	version, err := strconv.ParseInt(h[1:len(h)-1], 10, 64)
+	if err != nil || version <= 0 {
+		return 0, errInvalidIfMatch
+	}
+	return version, nil
+}
+
+// requireIfMatch returns the version named by the If-Match header of r. If
+// the header is missing or invalid, it responds with a problem and reports
+// false.
+func requireIfMatch(w http.ResponseWriter, r *http.Request) (int64, bool) {
+	version, err := ifMatchVersion(r)
+	switch {
+	case errors.Is(err, errPreconditionRequired):
+		problem.Respond(w, r, problem.PreconditionRequired, "Send the ETag of the payment in If-Match")
+		return 0, false
+	case err != nil:
+		problem.Respond(w, r, problem.InvalidParameter, err.Error())
+		return 0, false
+	}
+	return version, true
+}
+
+// noneMatch reports whether the If-None-Match header of r lists tag, using
+// the weak comparison RFC 9110 prescribes for it.
+func noneMatch(r *http.Request, tag string) bool {
+	h := r.Header.Get("If-None-Match")
+	if h == "" {
+		return false
+	}
+	for _, t := range strings.Split(h, ",") {
+		t = strings.TrimPrefix(strings.TrimSpace(t), "W/")
+		if t == "*" || t == tag {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,87 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	service "github.com/eterrni/payments-api/internal/services"
+	"github.com/eterrni/payments-api/pkg/problem"
+	"github.com/eterrni/payments-api/pkg/utils"
+	"github.com/gorilla/mux"
+)
+
+type ledgerService interface {
+	ListAccounts(context.Context) ([]service.AccountBalances, error)
+	GetAccount(context.Context, string) (*service.AccountBalances, error)
+	ListEntries(context.Context, service.ListEntriesRequest) (*service.EntryPage, error)
+}
+
+type LedgerHandler struct {
+	service ledgerService
+}
+
+func NewLedgerHandler(svc ledgerService) *LedgerHandler {
+	return &LedgerHandler{service: svc}
+}
+
+// ListAccounts returns the chart of accounts with the balance of each
+// account per currency.
+func (h *LedgerHandler) ListAccounts(w http.ResponseWriter, r *http.Request) {
+	accounts, err := h.service.ListAccounts(r.Context())
+	if err != nil {
+		respondWithServiceError(w, r, err, "Could not list accounts")
+		return
+	}
+	utils.RespondWithList(w, accounts, "", false)
+}
+
+func (h *LedgerHandler) GetAccount(w http.ResponseWriter, r *http.Request) {
+	account, err := h.service.GetAccount(r.Context(), mux.Vars(r)["code"])
+	if err != nil {
+		respondWithServiceError(w, r, err, "Could not get account")
+		return
+	}
+	utils.RespondWithJSON(w, http.StatusOK, account)
+}
+
+// ListEntries returns journal entries with their postings, oldest first,
+// optionally only those of one payment or posting to one account.
+func (h *LedgerHandler) ListEntries(w http.ResponseWriter, r *http.Request) {
+	req, err := parseListEntriesRequest(r.URL.Query())
+	if err != nil {
+		problem.Respond(w, r, problem.InvalidParameter, err.Error())
+		return
+	}
+
+	page, err := h.service.ListEntries(r.Context(), req)
+	if err != nil {
+		respondWithServiceError(w, r, err, "Could not list entries")
+		return
+	}
+
+	utils.RespondWithList(w, page.Entries, page.NextCursor, page.HasMore)
+}
+
+func parseListEntriesRequest(q url.Values) (service.ListEntriesRequest, error) {
+	req := service.ListEntriesRequest{
+		Account: q.Get("account"),
+		Cursor:  q.Get("cursor"),
+	}
+	if v := q.Get("payment_id"); v != "" {
+		id, err := strconv.ParseUint(v, 10, 64)
+		if err != nil {
+			return req, fmt.Errorf("Invalid payment_id %q", v)
+		}
+		req.PaymentID = uint(id)
+	}
+	if v := q.Get("limit"); v != "" {
+		var err error
+		if req.Limit, err = strconv.Atoi(v); err != nil {
+			return req, fmt.Errorf("Invalid limit %q", v)
+		}
+	}
+	return req, nil
+}
@@ -0,0 +1,132 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/eterrni/payments-api/internal/ledger"
+	"github.com/eterrni/payments-api/internal/money"
+	service "github.com/eterrni/payments-api/internal/services"
+	"github.com/gorilla/mux"
+)
+
+type mockLedgerService struct {
+	accounts   []service.AccountBalances
+	entries    *service.EntryPage
+	entriesReq service.ListEntriesRequest
+}
+
+func (m *mockLedgerService) ListAccounts(ctx context.Context) ([]service.AccountBalances, error) {
+	return m.accounts, nil
+}
+
+func (m *mockLedgerService) GetAccount(ctx context.Context, code string) (*service.AccountBalances, error) {
+	for _, a := range m.accounts {
+		if a.Code == code {
+			return &a, nil
+		}
+	}
+	return nil, fmt.Errorf("account %q %w", code, service.ErrNotFound)
+}
+
+func (m *mockLedgerService) ListEntries(ctx context.Context, req service.ListEntriesRequest) (*service.EntryPage, error) {
+	m.entriesReq = req
+	return m.entries, nil
+}
+
+func TestLedgerHandler_Accounts(t *testing.T) {
+	cash, _ := ledger.LookupAccount(ledger.Cash)
+	mock := &mockLedgerService{accounts: []service.AccountBalances{{
+		Account:  cash,
+		Balances: []ledger.Balance{{Account: ledger.Cash, Currency: "USD", DebitMinor: 1000, CreditMinor: 250}},
+	}}}
+	h := NewLedgerHandler(mock)
+
+	t.Run("list", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		h.ListAccounts(w, httptest.NewRequest(http.MethodGet, "/ledger/accounts", nil))
+
+		if w.Code != http.StatusOK {
+			t.Fatalf("got status %d, want %d", w.Code, http.StatusOK)
+		}
+		for _, want := range []string{`"code":"cash"`, `"type":"asset"`, `"balance_minor":750`, `"balance":7.50`} {
+			if !strings.Contains(w.Body.String(), want) {
+				t.Errorf("body %s does not contain %s", w.Body, want)
+			}
+		}
+	})
+
+	for code, status := range map[string]int{"cash": http.StatusOK, "bank": http.StatusNotFound} {
+		t.Run("get "+code, func(t *testing.T) {
+			req := mux.SetURLVars(httptest.NewRequest(http.MethodGet, "/ledger/accounts/"+code, nil), map[string]string{"code": code})
+			w := httptest.NewRecorder()
+			h.GetAccount(w, req)
+
+			if w.Code != status {
+				t.Errorf("got status %d, want %d", w.Code, status)
+			}
+		})
+	}
+}
+
+func TestLedgerHandler_ListEntries(t *testing.T) {
+	entry := ledger.Refund(7, 3, money.Money{Amount: 250, Currency: "USD"})
+	entry.ID = 9
+
+	t.Run("filters", func(t *testing.T) {
+		mock := &mockLedgerService{entries: &service.EntryPage{Entries: []ledger.Entry{entry}, NextCursor: "next", HasMore: true}}
+		h := NewLedgerHandler(mock)
+		w := httptest.NewRecorder()
+
+		h.ListEntries(w, httptest.NewRequest(http.MethodGet, "/ledger/entries?payment_id=7&account=cash&limit=1&cursor=abc", nil))
+
+		if w.Code != http.StatusOK {
+			t.Fatalf("got status %d, want %d", w.Code, http.StatusOK)
+		}
+		if want := (service.ListEntriesRequest{PaymentID: 7, Account: "cash", Cursor: "abc", Limit: 1}); mock.entriesReq != want {
+			t.Errorf("got request %+v, want %+v", mock.entriesReq, want)
+		}
+		var body struct {
+			Data []struct {
+				ID       uint   `json:"id"`
+				Kind     string `json:"kind"`
+				RefundID uint   `json:"refund_id"`
+				Postings []struct {
+					Account     string `json:"account"`
+					Side        string `json:"side"`
+					AmountMinor int64  `json:"amount_minor"`
+				} `json:"postings"`
+			} `json:"data"`
+			NextCursor string `json:"next_cursor"`
+		}
+		if err := json.NewDecoder(w.Body).Decode(&body); err != nil {
+			t.Fatalf("decode body: %v", err)
+		}
+		if len(body.Data) != 1 || body.NextCursor != "next" {
+			t.Fatalf("got %+v", body)
+		}
+		e := body.Data[0]
+		if e.ID != 9 || e.Kind != "refund" || e.RefundID != 3 || len(e.Postings) != 2 ||
+			e.Postings[1].Account != "cash" || e.Postings[1].Side != "credit" || e.Postings[1].AmountMinor != 250 {
+			t.Errorf("got entry %+v", e)
+		}
+	})
+
+	for _, query := range []string{"payment_id=x", "limit=many"} {
+		t.Run(query, func(t *testing.T) {
+			h := NewLedgerHandler(&mockLedgerService{})
+			w := httptest.NewRecorder()
+
+			h.ListEntries(w, httptest.NewRequest(http.MethodGet, "/ledger/entries?"+query, nil))
+
+			if w.Code != http.StatusBadRequest {
+				t.Errorf("got status %d, want %d", w.Code, http.StatusBadRequest)
+			}
+		})
+	}
+}
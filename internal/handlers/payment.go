@@ -1,21 +1,38 @@
 package handlers
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
 	"net/http"
+	"net/url"
 	"strconv"
+	"time"
 
+	"github.com/eterrni/payments-api/internal/merchant"
+	"github.com/eterrni/payments-api/internal/money"
 	"github.com/eterrni/payments-api/internal/repository"
 	service "github.com/eterrni/payments-api/internal/services"
+	"github.com/eterrni/payments-api/pkg/middleware"
+	"github.com/eterrni/payments-api/pkg/problem"
 	"github.com/eterrni/payments-api/pkg/utils"
 	"github.com/gorilla/mux"
 )
 
 type paymentService interface {
-	CreatePayment(service.PaymentRequest) error
-	GetPayment(uint) (*repository.Payment, error)
-	UpdatePayment(uint, service.PaymentRequest) error
-	DeletePayment(uint) error
+	CreatePayment(context.Context, service.PaymentRequest) (*repository.Payment, error)
+	GetPayment(context.Context, uint) (*repository.Payment, error)
+	UpdatePayment(context.Context, uint, int64, service.PaymentRequest) (*repository.Payment, error)
+	PatchPayment(context.Context, uint, int64, service.PaymentPatch) (*repository.Payment, error)
+	DeletePayment(context.Context, uint, string) error
+	ListPayments(context.Context, service.ListPaymentsRequest) (*service.PaymentPage, error)
+	TransitionPayment(context.Context, uint, repository.Status, string, string) (*repository.Payment, error)
+	Capture(context.Context, uint, service.CaptureRequest) (*repository.Payment, error)
+	Void(context.Context, uint, string, string) (*repository.Payment, error)
+	ListTransitions(context.Context, uint) ([]repository.PaymentTransition, error)
 }
 
 type PaymentHandler struct {
@@ -27,72 +44,372 @@ func NewPaymentHandler(svc paymentService) *PaymentHandler {
 }
 
 func (h *PaymentHandler) CreatePayment(w http.ResponseWriter, r *http.Request) {
-	var payment service.PaymentRequest
-	if err := json.NewDecoder(r.Body).Decode(&payment); err != nil {
-		utils.RespondWithError(w, http.StatusBadRequest, "Invalid request body")
+	payment, err := decodePaymentRequest(r.Body)
+	if err != nil {
+		problem.Respond(w, r, problem.InvalidBody, err.Error())
 		return
 	}
 
-	if err := h.service.CreatePayment(payment); err != nil {
-		utils.RespondWithError(w, http.StatusInternalServerError, "Could not create payment")
+	created, err := h.service.CreatePayment(r.Context(), payment)
+	if err != nil {
+		respondWithServiceError(w, r, err, "Could not create payment")
 		return
 	}
 
-	utils.RespondWithJSON(w, http.StatusCreated, map[string]string{"status": "Payment created"})
+	w.Header().Set("Location", fmt.Sprintf("/payments/%d", created.ID))
+	respondWithPayment(w, http.StatusCreated, created)
 }
 
 func (h *PaymentHandler) GetPayment(w http.ResponseWriter, r *http.Request) {
 	id, err := getIDFromRequest(r)
 	if err != nil {
-		utils.RespondWithError(w, http.StatusBadRequest, "Invalid payment ID")
+		problem.Respond(w, r, problem.InvalidParameter, "Invalid payment ID")
+		return
+	}
+
+	payment, err := h.service.GetPayment(r.Context(), id)
+	if err != nil {
+		respondWithServiceError(w, r, err, "Could not get payment")
+		return
+	}
+
+	if tag := etag(payment.Version); noneMatch(r, tag) {
+		w.Header().Set("ETag", tag)
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	respondWithPayment(w, http.StatusOK, payment)
+}
+
+func (h *PaymentHandler) ListPayments(w http.ResponseWriter, r *http.Request) {
+	req, err := parseListPaymentsRequest(r.URL.Query())
+	if err != nil {
+		problem.Respond(w, r, problem.InvalidParameter, err.Error())
 		return
 	}
 
-	payment, err := h.service.GetPayment(id)
+	page, err := h.service.ListPayments(r.Context(), req)
 	if err != nil {
-		utils.RespondWithError(w, http.StatusNotFound, "Payment not found")
+		respondWithServiceError(w, r, err, "Could not list payments")
 		return
 	}
 
-	utils.RespondWithJSON(w, http.StatusOK, payment)
+	utils.RespondWithList(w, page.Payments, page.NextCursor, page.HasMore)
 }
 
+// UpdatePayment requires the ETag of the payment in If-Match, so that a
+// client cannot overwrite changes it has not seen.
 func (h *PaymentHandler) UpdatePayment(w http.ResponseWriter, r *http.Request) {
 	id, err := getIDFromRequest(r)
 	if err != nil {
-		utils.RespondWithError(w, http.StatusBadRequest, "Invalid payment ID")
+		problem.Respond(w, r, problem.InvalidParameter, "Invalid payment ID")
+		return
+	}
+
+	version, ok := requireIfMatch(w, r)
+	if !ok {
+		return
+	}
+
+	payment, err := decodePaymentRequest(r.Body)
+	if err != nil {
+		problem.Respond(w, r, problem.InvalidBody, err.Error())
+		return
+	}
+
+	updated, err := h.service.UpdatePayment(r.Context(), id, version, payment)
+	if err != nil {
+		respondWithServiceError(w, r, err, "Could not update payment")
+		return
+	}
+
+	respondWithPayment(w, http.StatusOK, updated)
+}
+
+// PatchPayment applies a JSON merge patch (RFC 7396) to the payment. Like
+// UpdatePayment, it requires the ETag of the payment in If-Match.
+func (h *PaymentHandler) PatchPayment(w http.ResponseWriter, r *http.Request) {
+	id, err := getIDFromRequest(r)
+	if err != nil {
+		problem.Respond(w, r, problem.InvalidParameter, "Invalid payment ID")
+		return
+	}
+
+	version, ok := requireIfMatch(w, r)
+	if !ok {
 		return
 	}
 
-	var payment service.PaymentRequest
-	if err := json.NewDecoder(r.Body).Decode(&payment); err != nil {
-		utils.RespondWithError(w, http.StatusBadRequest, "Invalid request body")
+	if ct := r.Header.Get("Content-Type"); ct != "" {
+		if mt, _, _ := mime.ParseMediaType(ct); mt != mergePatchType && mt != "application/json" {
+			problem.Respond(w, r, problem.UnsupportedMediaType, "Send the patch as "+mergePatchType)
+			return
+		}
+	}
+	var patch service.PaymentPatch
+	if err := json.NewDecoder(r.Body).Decode(&patch); err != nil || patch == nil {
+		problem.Respond(w, r, problem.InvalidBody, "Request body must be a JSON object")
 		return
 	}
 
-	if err := h.service.UpdatePayment(id, payment); err != nil {
-		utils.RespondWithError(w, http.StatusInternalServerError, "Could not update payment")
+	updated, err := h.service.PatchPayment(r.Context(), id, version, patch)
+	if err != nil {
+		respondWithServiceError(w, r, err, "Could not update payment")
 		return
 	}
 
-	utils.RespondWithJSON(w, http.StatusOK, map[string]string{"status": "Payment updated"})
+	respondWithPayment(w, http.StatusOK, updated)
 }
 
 func (h *PaymentHandler) DeletePayment(w http.ResponseWriter, r *http.Request) {
 	id, err := getIDFromRequest(r)
 	if err != nil {
-		utils.RespondWithError(w, http.StatusBadRequest, "Invalid payment ID")
+		problem.Respond(w, r, problem.InvalidParameter, "Invalid payment ID")
 		return
 	}
 
-	if err := h.service.DeletePayment(id); err != nil {
-		utils.RespondWithError(w, http.StatusInternalServerError, "Could not delete payment")
+	if err := h.service.DeletePayment(r.Context(), id, actorFromRequest(r)); err != nil {
+		respondWithServiceError(w, r, err, "Could not delete payment")
 		return
 	}
 
 	utils.RespondWithJSON(w, http.StatusOK, map[string]string{"status": "Payment deleted"})
 }
 
+func (h *PaymentHandler) AuthorizePayment(w http.ResponseWriter, r *http.Request) {
+	h.transitionPayment(w, r, repository.StatusAuthorized)
+}
+
+// CapturePayment captures the amount_minor given in the body, or the whole
+// authorized amount without it.
+func (h *PaymentHandler) CapturePayment(w http.ResponseWriter, r *http.Request) {
+	id, err := getIDFromRequest(r)
+	if err != nil {
+		problem.Respond(w, r, problem.InvalidParameter, "Invalid payment ID")
+		return
+	}
+
+	var body struct {
+		AmountMinor *int64 `json:"amount_minor"`
+		Reason      string `json:"reason"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil && err != io.EOF {
+		problem.Respond(w, r, problem.InvalidBody, "Invalid request body")
+		return
+	}
+
+	payment, err := h.service.Capture(r.Context(), id, service.CaptureRequest{
+		Amount: body.AmountMinor,
+		Reason: body.Reason,
+		Actor:  actorFromRequest(r),
+	})
+	if err != nil {
+		respondWithServiceError(w, r, err, "Could not capture payment")
+		return
+	}
+
+	respondWithPayment(w, http.StatusOK, payment)
+}
+
+func (h *PaymentHandler) VoidPayment(w http.ResponseWriter, r *http.Request) {
+	id, err := getIDFromRequest(r)
+	if err != nil {
+		problem.Respond(w, r, problem.InvalidParameter, "Invalid payment ID")
+		return
+	}
+
+	var body struct {
+		Reason string `json:"reason"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil && err != io.EOF {
+		problem.Respond(w, r, problem.InvalidBody, "Invalid request body")
+		return
+	}
+
+	payment, err := h.service.Void(r.Context(), id, body.Reason, actorFromRequest(r))
+	if err != nil {
+		respondWithServiceError(w, r, err, "Could not void payment")
+		return
+	}
+
+	respondWithPayment(w, http.StatusOK, payment)
+}
+
+func (h *PaymentHandler) SettlePayment(w http.ResponseWriter, r *http.Request) {
+	h.transitionPayment(w, r, repository.StatusSettled)
+}
+
+func (h *PaymentHandler) CancelPayment(w http.ResponseWriter, r *http.Request) {
+	h.transitionPayment(w, r, repository.StatusCanceled)
+}
+
+func (h *PaymentHandler) FailPayment(w http.ResponseWriter, r *http.Request) {
+	h.transitionPayment(w, r, repository.StatusFailed)
+}
+
+func (h *PaymentHandler) transitionPayment(w http.ResponseWriter, r *http.Request, status repository.Status) {
+	id, err := getIDFromRequest(r)
+	if err != nil {
+		problem.Respond(w, r, problem.InvalidParameter, "Invalid payment ID")
+		return
+	}
+
+	var body struct {
+		Reason string `json:"reason"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil && err != io.EOF {
+		problem.Respond(w, r, problem.InvalidBody, "Invalid request body")
+		return
+	}
+
+	payment, err := h.service.TransitionPayment(r.Context(), id, status, body.Reason, actorFromRequest(r))
+	if err != nil {
+		respondWithServiceError(w, r, err, "Could not change payment status")
+		return
+	}
+
+	respondWithPayment(w, http.StatusOK, payment)
+}
+
+func (h *PaymentHandler) ListTransitions(w http.ResponseWriter, r *http.Request) {
+	id, err := getIDFromRequest(r)
+	if err != nil {
+		problem.Respond(w, r, problem.InvalidParameter, "Invalid payment ID")
+		return
+	}
+
+	transitions, err := h.service.ListTransitions(r.Context(), id)
+	if err != nil {
+		respondWithServiceError(w, r, err, "Could not list transitions")
+		return
+	}
+
+	if transitions == nil {
+		transitions = []repository.PaymentTransition{}
+	}
+	utils.RespondWithList(w, transitions, "", false)
+}
+
+// paymentRequestBody is the wire format of a payment request. New clients
+// send "amount_minor" as an integer in minor units; "amount" as a decimal in
+// major units is still accepted for clients written before the switch.
+type paymentRequestBody struct {
+	AmountMinor *int64      `json:"amount_minor"`
+	Amount      json.Number `json:"amount"`
+	Currency    string      `json:"currency"`
+	CustomerID  *uint       `json:"customer_id"`
+}
+
+var errInvalidBody = errors.New("Invalid request body")
+
+const mergePatchType = "application/merge-patch+json"
+
+func decodePaymentRequest(r io.Reader) (service.PaymentRequest, error) {
+	var body paymentRequestBody
+	if err := json.NewDecoder(r).Decode(&body); err != nil {
+		return service.PaymentRequest{}, errInvalidBody
+	}
+
+	var (
+		amount money.Money
+		err    error
+	)
+	switch {
+	case body.AmountMinor != nil && body.Amount != "":
+		return service.PaymentRequest{}, errors.New("Only one of amount and amount_minor may be set")
+	case body.AmountMinor != nil:
+		amount = money.Money{Amount: *body.AmountMinor, Currency: body.Currency}
+	default:
+		amount, err = money.Parse(body.Amount.String(), body.Currency)
+	}
+	if err != nil {
+		return service.PaymentRequest{}, err
+	}
+	return service.PaymentRequest{Amount: amount, CustomerID: body.CustomerID}, nil
+}
+
+func parseListPaymentsRequest(q url.Values) (service.ListPaymentsRequest, error) {
+	req := service.ListPaymentsRequest{
+		Currency: q.Get("currency"),
+		Status:   repository.Status(q.Get("status")),
+		Sort:     q.Get("sort"),
+		Cursor:   q.Get("cursor"),
+	}
+
+	var err error
+	if req.MinAmount, err = parseInt64Param(q, "amount_min"); err != nil {
+		return req, err
+	}
+	if req.MaxAmount, err = parseInt64Param(q, "amount_max"); err != nil {
+		return req, err
+	}
+	if req.CreatedFrom, err = parseTimeParam(q, "created_from"); err != nil {
+		return req, err
+	}
+	if req.CreatedTo, err = parseTimeParam(q, "created_to"); err != nil {
+		return req, err
+	}
+	if v := q.Get("customer_id"); v != "" {
+		id, err := strconv.ParseUint(v, 10, 64)
+		if err != nil {
+			return req, fmt.Errorf("Invalid customer_id %q", v)
+		}
+		req.CustomerID = uint(id)
+	}
+	if v := q.Get("limit"); v != "" {
+		if req.Limit, err = strconv.Atoi(v); err != nil {
+			return req, fmt.Errorf("Invalid limit %q", v)
+		}
+	}
+	return req, nil
+}
+
+func parseInt64Param(q url.Values, name string) (*int64, error) {
+	v := q.Get(name)
+	if v == "" {
+		return nil, nil
+	}
+	n, err := strconv.ParseInt(v, 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid %s %q", name, v)
+	}
+	return &n, nil
+}
+
+func parseTimeParam(q url.Values, name string) (*time.Time, error) {
+	v := q.Get(name)
+	if v == "" {
+		return nil, nil
+	}
+	t, err := time.Parse(time.RFC3339, v)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid %s %q, expected RFC 3339", name, v)
+	}
+	return &t, nil
+}
+
+// maxActorNote limits the part of X-Actor kept in the audit trail.
+const maxActorNote = 100
+
+// actorFromRequest names who performs a change for the audit trail: the API
+// key or merchant token the request was authenticated with. X-Actor, which
+// the client can set to anything, is only kept as an unverified note.
+func actorFromRequest(r *http.Request) string {
+	actor := "anonymous"
+	if key, ok := middleware.KeyFromContext(r.Context()); ok {
+		actor = fmt.Sprintf("api_key:%d", key.ID)
+	} else if id, ok := merchant.FromContext(r.Context()); ok {
+		actor = "merchant:" + id
+	}
+	if note := r.Header.Get("X-Actor"); note != "" {
+		if runes := []rune(note); len(runes) > maxActorNote {
+			note = string(runes[:maxActorNote])
+		}
+		actor += fmt.Sprintf(" (unverified X-Actor %q)", note)
+	}
+	return actor
+}
+
 func getIDFromRequest(r *http.Request) (uint, error) {
 	vars := mux.Vars(r)
 	idStr, ok := vars["id"]
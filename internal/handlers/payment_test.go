@@ -2,41 +2,109 @@ package handlers
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
+	"time"
 
+	"github.com/eterrni/payments-api/internal/merchant"
 	"github.com/eterrni/payments-api/internal/repository"
 	service "github.com/eterrni/payments-api/internal/services"
+	"github.com/eterrni/payments-api/pkg/middleware"
 	"github.com/gorilla/mux"
 )
 
 type mockPaymentService struct {
-	createErr error
-	getResult *repository.Payment
-	getErr    error
-	updateErr error
-	deleteErr error
+	createErr        error
+	getResult        *repository.Payment
+	getErr           error
+	updateErr        error
+	updateVersion    int64
+	patch            service.PaymentPatch
+	deleteErr        error
+	transitionResult *repository.Payment
+	transitionErr    error
+	transitionedTo   repository.Status
+	transitionReason string
+	captureAmount    *int64
+	actor            string
+	transitions      []repository.PaymentTransition
+	transitionsErr   error
+	listResult       *service.PaymentPage
+	listErr          error
+	listRequest      service.ListPaymentsRequest
+	ctx              context.Context
 }
 
-func (m *mockPaymentService) CreatePayment(payment service.PaymentRequest) error {
-	return m.createErr
+func (m *mockPaymentService) CreatePayment(ctx context.Context, payment service.PaymentRequest) (*repository.Payment, error) {
+	if m.createErr != nil {
+		return nil, m.createErr
+	}
+	return &repository.Payment{
+		ID:          42,
+		AmountMinor: payment.Amount.Amount,
+		Currency:    payment.Amount.Currency,
+		Status:      repository.StatusPending,
+	}, nil
 }
 
-func (m *mockPaymentService) GetPayment(id uint) (*repository.Payment, error) {
+func (m *mockPaymentService) GetPayment(ctx context.Context, id uint) (*repository.Payment, error) {
+	m.ctx = ctx
 	return m.getResult, m.getErr
 }
 
-func (m *mockPaymentService) UpdatePayment(id uint, payment service.PaymentRequest) error {
-	return m.updateErr
+func (m *mockPaymentService) ListPayments(ctx context.Context, req service.ListPaymentsRequest) (*service.PaymentPage, error) {
+	m.listRequest = req
+	return m.listResult, m.listErr
 }
 
-func (m *mockPaymentService) DeletePayment(id uint) error {
+func (m *mockPaymentService) UpdatePayment(ctx context.Context, id uint, version int64, payment service.PaymentRequest) (*repository.Payment, error) {
+	m.updateVersion = version
+	if m.updateErr != nil {
+		return nil, m.updateErr
+	}
+	return &repository.Payment{ID: id, AmountMinor: payment.Amount.Amount, Currency: payment.Amount.Currency, Version: version + 1}, nil
+}
+
+func (m *mockPaymentService) PatchPayment(ctx context.Context, id uint, version int64, patch service.PaymentPatch) (*repository.Payment, error) {
+	m.updateVersion = version
+	m.patch = patch
+	if m.updateErr != nil {
+		return nil, m.updateErr
+	}
+	return &repository.Payment{ID: id, AmountMinor: 100, Currency: "USD", Version: version + 1}, nil
+}
+
+func (m *mockPaymentService) DeletePayment(ctx context.Context, id uint, actor string) error {
+	m.actor = actor
 	return m.deleteErr
 }
 
+func (m *mockPaymentService) TransitionPayment(ctx context.Context, id uint, status repository.Status, reason, actor string) (*repository.Payment, error) {
+	m.transitionedTo = status
+	m.transitionReason = reason
+	m.actor = actor
+	return m.transitionResult, m.transitionErr
+}
+
+func (m *mockPaymentService) Capture(ctx context.Context, id uint, req service.CaptureRequest) (*repository.Payment, error) {
+	m.captureAmount = req.Amount
+	return m.TransitionPayment(ctx, id, repository.StatusCaptured, req.Reason, req.Actor)
+}
+
+func (m *mockPaymentService) Void(ctx context.Context, id uint, reason, actor string) (*repository.Payment, error) {
+	return m.TransitionPayment(ctx, id, repository.StatusCanceled, reason, actor)
+}
+
+func (m *mockPaymentService) ListTransitions(ctx context.Context, id uint) ([]repository.PaymentTransition, error) {
+	return m.transitions, m.transitionsErr
+}
+
 func TestPaymentHandler_CreatePayment(t *testing.T) {
 	t.Run("success", func(t *testing.T) {
 		mock := &mockPaymentService{}
@@ -53,6 +121,47 @@ func TestPaymentHandler_CreatePayment(t *testing.T) {
 		if w.Code != http.StatusCreated {
 			t.Errorf("got status %d, want %d", w.Code, http.StatusCreated)
 		}
+		if loc := w.Header().Get("Location"); loc != "/payments/42" {
+			t.Errorf("Location = %q, want /payments/42", loc)
+		}
+		var created map[string]interface{}
+		if err := json.NewDecoder(w.Body).Decode(&created); err != nil {
+			t.Fatalf("decode body: %v", err)
+		}
+		if created["id"] != float64(42) || created["status"] != "pending" || created["amount_minor"] != float64(10050) {
+			t.Errorf("unexpected body %v", created)
+		}
+	})
+
+	t.Run("minor units", func(t *testing.T) {
+		mock := &mockPaymentService{}
+		h := NewPaymentHandler(mock)
+		body := map[string]interface{}{"amount_minor": 1234, "currency": "KWD"}
+		jsonBody, _ := json.Marshal(body)
+
+		req := httptest.NewRequest(http.MethodPost, "/payments", bytes.NewReader(jsonBody))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+
+		h.CreatePayment(w, req)
+
+		if w.Code != http.StatusCreated {
+			t.Errorf("got status %d, want %d", w.Code, http.StatusCreated)
+		}
+	})
+
+	t.Run("too many decimals", func(t *testing.T) {
+		h := NewPaymentHandler(&mockPaymentService{})
+
+		req := httptest.NewRequest(http.MethodPost, "/payments", bytes.NewReader([]byte(`{"amount": 100.505, "currency": "USD"}`)))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+
+		h.CreatePayment(w, req)
+
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("got status %d, want %d", w.Code, http.StatusBadRequest)
+		}
 	})
 
 	t.Run("invalid body", func(t *testing.T) {
@@ -69,6 +178,23 @@ func TestPaymentHandler_CreatePayment(t *testing.T) {
 		}
 	})
 
+	t.Run("validation error", func(t *testing.T) {
+		mock := &mockPaymentService{createErr: &service.ValidationError{
+			Fields: []service.FieldError{{Field: "currency", Message: "unsupported currency"}},
+		}}
+		h := NewPaymentHandler(mock)
+
+		req := httptest.NewRequest(http.MethodPost, "/payments", bytes.NewReader([]byte(`{"amount_minor": 100, "currency": "XYZ"}`)))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+
+		h.CreatePayment(w, req)
+
+		if w.Code != http.StatusUnprocessableEntity {
+			t.Errorf("got status %d, want %d", w.Code, http.StatusUnprocessableEntity)
+		}
+	})
+
 	t.Run("service error", func(t *testing.T) {
 		mock := &mockPaymentService{createErr: errors.New("db error")}
 		h := NewPaymentHandler(mock)
@@ -89,7 +215,7 @@ func TestPaymentHandler_CreatePayment(t *testing.T) {
 
 func TestPaymentHandler_GetPayment(t *testing.T) {
 	t.Run("success", func(t *testing.T) {
-		expected := &repository.Payment{ID: 1, Amount: 50, Currency: "EUR"}
+		expected := &repository.Payment{ID: 1, AmountMinor: 5000, Currency: "EUR"}
 		mock := &mockPaymentService{getResult: expected}
 		h := NewPaymentHandler(mock)
 
@@ -102,6 +228,65 @@ func TestPaymentHandler_GetPayment(t *testing.T) {
 		if w.Code != http.StatusOK {
 			t.Errorf("got status %d, want %d", w.Code, http.StatusOK)
 		}
+		if !strings.Contains(w.Body.String(), `"amount":50.00`) {
+			t.Errorf("body %s does not contain the decimal amount", w.Body.String())
+		}
+	})
+
+	t.Run("etag", func(t *testing.T) {
+		payment := &repository.Payment{ID: 1, AmountMinor: 5000, Currency: "EUR", Version: 7}
+		tests := []struct {
+			ifNoneMatch string
+			want        int
+		}{
+			{"", http.StatusOK},
+			{`"6"`, http.StatusOK},
+			{`"7"`, http.StatusNotModified},
+			{`W/"7"`, http.StatusNotModified},
+			{`"5", "7"`, http.StatusNotModified},
+			{"*", http.StatusNotModified},
+		}
+		for _, tt := range tests {
+			t.Run(tt.ifNoneMatch, func(t *testing.T) {
+				h := NewPaymentHandler(&mockPaymentService{getResult: payment})
+
+				req := httptest.NewRequest(http.MethodGet, "/payments/1", nil)
+				if tt.ifNoneMatch != "" {
+					req.Header.Set("If-None-Match", tt.ifNoneMatch)
+				}
+				req = mux.SetURLVars(req, map[string]string{"id": "1"})
+				w := httptest.NewRecorder()
+
+				h.GetPayment(w, req)
+
+				if w.Code != tt.want {
+					t.Errorf("got status %d, want %d", w.Code, tt.want)
+				}
+				if got := w.Header().Get("ETag"); got != `"7"` {
+					t.Errorf("got ETag %s, want \"7\"", got)
+				}
+				if tt.want == http.StatusNotModified && w.Body.Len() != 0 {
+					t.Errorf("304 response has a body: %s", w.Body)
+				}
+			})
+		}
+	})
+
+	t.Run("passes the request context", func(t *testing.T) {
+		mock := &mockPaymentService{getResult: &repository.Payment{ID: 1}}
+		h := NewPaymentHandler(mock)
+
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		req := httptest.NewRequest(http.MethodGet, "/payments/1", nil).WithContext(ctx)
+		req = mux.SetURLVars(req, map[string]string{"id": "1"})
+
+		h.GetPayment(httptest.NewRecorder(), req)
+		cancel()
+
+		if mock.ctx == nil || mock.ctx.Err() == nil {
+			t.Error("service did not get the request context")
+		}
 	})
 
 	t.Run("invalid id", func(t *testing.T) {
@@ -119,7 +304,7 @@ func TestPaymentHandler_GetPayment(t *testing.T) {
 	})
 
 	t.Run("not found", func(t *testing.T) {
-		mock := &mockPaymentService{getErr: errors.New("not found")}
+		mock := &mockPaymentService{getErr: service.ErrNotFound}
 		h := NewPaymentHandler(mock)
 
 		req := httptest.NewRequest(http.MethodGet, "/payments/999", nil)
@@ -134,6 +319,86 @@ func TestPaymentHandler_GetPayment(t *testing.T) {
 	})
 }
 
+func TestPaymentHandler_ListPayments(t *testing.T) {
+	t.Run("success", func(t *testing.T) {
+		mock := &mockPaymentService{listResult: &service.PaymentPage{
+			Payments:   []repository.Payment{{ID: 1, AmountMinor: 100, Currency: "USD"}},
+			NextCursor: "abc",
+			HasMore:    true,
+		}}
+		h := NewPaymentHandler(mock)
+
+		req := httptest.NewRequest(http.MethodGet, "/payments?currency=USD&status=captured&amount_min=100&amount_max=500"+
+			"&created_from=2026-01-01T00:00:00Z&created_to=2026-02-01T00:00:00Z&sort=-amount&cursor=xyz&limit=10&customer_id=7", nil)
+		w := httptest.NewRecorder()
+
+		h.ListPayments(w, req)
+
+		if w.Code != http.StatusOK {
+			t.Fatalf("got status %d, want %d", w.Code, http.StatusOK)
+		}
+		got := mock.listRequest
+		if got.Currency != "USD" || got.Status != repository.StatusCaptured || got.Sort != "-amount" ||
+			got.Cursor != "xyz" || got.Limit != 10 || got.CustomerID != 7 || *got.MinAmount != 100 || *got.MaxAmount != 500 ||
+			got.CreatedFrom.Month() != time.January || got.CreatedTo.Month() != time.February {
+			t.Errorf("unexpected request %+v", got)
+		}
+
+		var body struct {
+			Data       []map[string]interface{} `json:"data"`
+			NextCursor *string                  `json:"next_cursor"`
+			HasMore    bool                     `json:"has_more"`
+		}
+		if err := json.NewDecoder(w.Body).Decode(&body); err != nil {
+			t.Fatalf("decode body: %v", err)
+		}
+		if len(body.Data) != 1 || body.NextCursor == nil || *body.NextCursor != "abc" || !body.HasMore {
+			t.Errorf("unexpected body %+v", body)
+		}
+	})
+
+	t.Run("invalid query", func(t *testing.T) {
+		for _, query := range []string{"amount_min=x", "amount_max=1.5", "created_from=yesterday", "created_to=1", "limit=ten", "customer_id=-1"} {
+			h := NewPaymentHandler(&mockPaymentService{})
+			req := httptest.NewRequest(http.MethodGet, "/payments?"+query, nil)
+			w := httptest.NewRecorder()
+
+			h.ListPayments(w, req)
+
+			if w.Code != http.StatusBadRequest {
+				t.Errorf("%s: got status %d, want %d", query, w.Code, http.StatusBadRequest)
+			}
+		}
+	})
+
+	t.Run("validation error", func(t *testing.T) {
+		mock := &mockPaymentService{listErr: &service.ValidationError{
+			Fields: []service.FieldError{{Field: "sort", Message: "unknown sort field"}},
+		}}
+		h := NewPaymentHandler(mock)
+		req := httptest.NewRequest(http.MethodGet, "/payments?sort=id", nil)
+		w := httptest.NewRecorder()
+
+		h.ListPayments(w, req)
+
+		if w.Code != http.StatusUnprocessableEntity {
+			t.Errorf("got status %d, want %d", w.Code, http.StatusUnprocessableEntity)
+		}
+	})
+
+	t.Run("service error", func(t *testing.T) {
+		h := NewPaymentHandler(&mockPaymentService{listErr: errors.New("db error")})
+		req := httptest.NewRequest(http.MethodGet, "/payments", nil)
+		w := httptest.NewRecorder()
+
+		h.ListPayments(w, req)
+
+		if w.Code != http.StatusInternalServerError {
+			t.Errorf("got status %d, want %d", w.Code, http.StatusInternalServerError)
+		}
+	})
+}
+
 func TestPaymentHandler_UpdatePayment(t *testing.T) {
 	t.Run("success", func(t *testing.T) {
 		mock := &mockPaymentService{}
@@ -143,6 +408,7 @@ func TestPaymentHandler_UpdatePayment(t *testing.T) {
 
 		req := httptest.NewRequest(http.MethodPut, "/payments/1", bytes.NewReader(jsonBody))
 		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("If-Match", `"3"`)
 		req = mux.SetURLVars(req, map[string]string{"id": "1"})
 		w := httptest.NewRecorder()
 
@@ -151,6 +417,53 @@ func TestPaymentHandler_UpdatePayment(t *testing.T) {
 		if w.Code != http.StatusOK {
 			t.Errorf("got status %d, want %d", w.Code, http.StatusOK)
 		}
+		if !strings.Contains(w.Body.String(), `"amount_minor":20000`) {
+			t.Errorf("updated payment not returned: %s", w.Body.String())
+		}
+		if mock.updateVersion != 3 {
+			t.Errorf("got version %d, want 3 from If-Match", mock.updateVersion)
+		}
+		if got := w.Header().Get("ETag"); got != `"4"` {
+			t.Errorf("got ETag %s, want \"4\"", got)
+		}
+	})
+
+	t.Run("if-match", func(t *testing.T) {
+		tests := []struct {
+			ifMatch     string
+			err         error
+			wantStatus  int
+			wantVersion int64
+		}{
+			{"", nil, http.StatusPreconditionRequired, -1},
+			{"3", nil, http.StatusBadRequest, -1},
+			{`W/"3"`, nil, http.StatusBadRequest, -1},
+			{`"3", "4"`, nil, http.StatusBadRequest, -1},
+			{"*", nil, http.StatusOK, 0},
+			{`"3"`, fmt.Errorf("payment 1 %w", service.ErrVersionMismatch), http.StatusPreconditionFailed, 3},
+		}
+		for _, tt := range tests {
+			t.Run(tt.ifMatch, func(t *testing.T) {
+				mock := &mockPaymentService{updateErr: tt.err, updateVersion: -1}
+				h := NewPaymentHandler(mock)
+
+				req := httptest.NewRequest(http.MethodPut, "/payments/1", strings.NewReader(`{"amount_minor": 100, "currency": "USD"}`))
+				if tt.ifMatch != "" {
+					req.Header.Set("If-Match", tt.ifMatch)
+				}
+				req = mux.SetURLVars(req, map[string]string{"id": "1"})
+				w := httptest.NewRecorder()
+
+				h.UpdatePayment(w, req)
+
+				if w.Code != tt.wantStatus {
+					t.Errorf("got status %d, want %d: %s", w.Code, tt.wantStatus, w.Body)
+				}
+				if mock.updateVersion != tt.wantVersion {
+					t.Errorf("got version %d passed to the service, want %d", mock.updateVersion, tt.wantVersion)
+				}
+			})
+		}
 	})
 
 	t.Run("invalid id", func(t *testing.T) {
@@ -175,6 +488,7 @@ func TestPaymentHandler_UpdatePayment(t *testing.T) {
 
 		req := httptest.NewRequest(http.MethodPut, "/payments/1", bytes.NewReader(jsonBody))
 		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("If-Match", `"1"`)
 		req = mux.SetURLVars(req, map[string]string{"id": "1"})
 		w := httptest.NewRecorder()
 
@@ -186,6 +500,79 @@ func TestPaymentHandler_UpdatePayment(t *testing.T) {
 	})
 }
 
+func TestPaymentHandler_PatchPayment(t *testing.T) {
+	patch := func(body, contentType, ifMatch string) *http.Request {
+		req := httptest.NewRequest(http.MethodPatch, "/payments/1", strings.NewReader(body))
+		if contentType != "" {
+			req.Header.Set("Content-Type", contentType)
+		}
+		if ifMatch != "" {
+			req.Header.Set("If-Match", ifMatch)
+		}
+		return mux.SetURLVars(req, map[string]string{"id": "1"})
+	}
+
+	t.Run("success", func(t *testing.T) {
+		mock := &mockPaymentService{}
+		h := NewPaymentHandler(mock)
+		w := httptest.NewRecorder()
+
+		h.PatchPayment(w, patch(`{"description": null, "metadata": {"order": "7"}}`, "application/merge-patch+json", `"3"`))
+
+		if w.Code != http.StatusOK {
+			t.Fatalf("got status %d, want %d: %s", w.Code, http.StatusOK, w.Body)
+		}
+		if mock.updateVersion != 3 {
+			t.Errorf("got version %d, want 3 from If-Match", mock.updateVersion)
+		}
+		if string(mock.patch["description"]) != "null" || string(mock.patch["metadata"]) != `{"order": "7"}` {
+			t.Errorf("got patch %s", mock.patch)
+		}
+		if got := w.Header().Get("ETag"); got != `"4"` {
+			t.Errorf("got ETag %s, want \"4\"", got)
+		}
+	})
+
+	tests := []struct {
+		name        string
+		body        string
+		contentType string
+		ifMatch     string
+		err         error
+		want        int
+	}{
+		{"plain json", `{"description": "x"}`, "application/json; charset=utf-8", `"3"`, nil, http.StatusOK},
+		{"no content type", `{"description": "x"}`, "", `"3"`, nil, http.StatusOK},
+		{"missing if-match", `{"description": "x"}`, "application/merge-patch+json", "", nil, http.StatusPreconditionRequired},
+		{"unsupported media type", `[{"op": "remove", "path": "/description"}]`, "application/json-patch+json", `"3"`, nil, http.StatusUnsupportedMediaType},
+		{"not an object", `["description"]`, "application/merge-patch+json", `"3"`, nil, http.StatusBadRequest},
+		{"null", `null`, "application/merge-patch+json", `"3"`, nil, http.StatusBadRequest},
+		{"rejected fields", `{"status": "captured"}`, "application/merge-patch+json", `"3"`, &service.ValidationError{Fields: []service.FieldError{{Field: "status", Message: "status is read-only"}}}, http.StatusUnprocessableEntity},
+		{"stale", `{"description": "x"}`, "application/merge-patch+json", `"3"`, fmt.Errorf("payment 1 %w", service.ErrVersionMismatch), http.StatusPreconditionFailed},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := NewPaymentHandler(&mockPaymentService{updateErr: tt.err})
+			w := httptest.NewRecorder()
+
+			h.PatchPayment(w, patch(tt.body, tt.contentType, tt.ifMatch))
+
+			if w.Code != tt.want {
+				t.Errorf("got status %d, want %d: %s", w.Code, tt.want, w.Body)
+			}
+		})
+	}
+}
+
+// staticKey accepts every API key as key.
+type staticKey struct {
+	key *middleware.Key
+}
+
+func (s staticKey) VerifyKey(ctx context.Context, key string) (*middleware.Key, error) {
+	return s.key, nil
+}
+
 func TestPaymentHandler_DeletePayment(t *testing.T) {
 	t.Run("success", func(t *testing.T) {
 		mock := &mockPaymentService{}
@@ -200,6 +587,58 @@ func TestPaymentHandler_DeletePayment(t *testing.T) {
 		if w.Code != http.StatusOK {
 			t.Errorf("got status %d, want %d", w.Code, http.StatusOK)
 		}
+		if mock.actor != "anonymous" {
+			t.Errorf("got actor %q, want anonymous", mock.actor)
+		}
+	})
+
+	t.Run("records the credential as actor", func(t *testing.T) {
+		keyAuth := middleware.APIKeyAuth(staticKey{&middleware.Key{ID: 7, MerchantID: "acme"}})
+		tests := []struct {
+			name    string
+			handler func(h *PaymentHandler) http.Handler
+			actor   string
+			want    string
+		}{
+			{"API key", func(h *PaymentHandler) http.Handler { return keyAuth(http.HandlerFunc(h.DeletePayment)) }, "", "api_key:7"},
+			{"merchant token", func(h *PaymentHandler) http.Handler {
+				return merchant.Middleware(map[string]string{"acme": "secret"})(http.HandlerFunc(h.DeletePayment))
+			}, "", "merchant:acme"},
+			{"X-Actor is a note", func(h *PaymentHandler) http.Handler { return keyAuth(http.HandlerFunc(h.DeletePayment)) }, "alice", `api_key:7 (unverified X-Actor "alice")`},
+			{"X-Actor alone", func(h *PaymentHandler) http.Handler { return http.HandlerFunc(h.DeletePayment) }, "alice", `anonymous (unverified X-Actor "alice")`},
+		}
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				mock := &mockPaymentService{}
+				req := httptest.NewRequest(http.MethodDelete, "/payments/1", nil)
+				req.Header.Set("Authorization", "Bearer secret")
+				if tt.actor != "" {
+					req.Header.Set("X-Actor", tt.actor)
+				}
+				req = mux.SetURLVars(req, map[string]string{"id": "1"})
+
+				tt.handler(NewPaymentHandler(mock)).ServeHTTP(httptest.NewRecorder(), req)
+
+				if mock.actor != tt.want {
+					t.Errorf("got actor %q, want %q", mock.actor, tt.want)
+				}
+			})
+		}
+	})
+
+	t.Run("final status", func(t *testing.T) {
+		mock := &mockPaymentService{deleteErr: &service.TransitionError{From: repository.StatusSettled, To: repository.StatusCanceled}}
+		h := NewPaymentHandler(mock)
+
+		req := httptest.NewRequest(http.MethodDelete, "/payments/1", nil)
+		req = mux.SetURLVars(req, map[string]string{"id": "1"})
+		w := httptest.NewRecorder()
+
+		h.DeletePayment(w, req)
+
+		if w.Code != http.StatusConflict {
+			t.Errorf("got status %d, want %d", w.Code, http.StatusConflict)
+		}
 	})
 
 	t.Run("invalid id", func(t *testing.T) {
@@ -232,6 +671,180 @@ func TestPaymentHandler_DeletePayment(t *testing.T) {
 	})
 }
 
+func TestPaymentHandler_TransitionPayment(t *testing.T) {
+	endpoints := []struct {
+		name    string
+		handler func(h *PaymentHandler) http.HandlerFunc
+		status  repository.Status
+	}{
+		{"authorize", func(h *PaymentHandler) http.HandlerFunc { return h.AuthorizePayment }, repository.StatusAuthorized},
+		{"capture", func(h *PaymentHandler) http.HandlerFunc { return h.CapturePayment }, repository.StatusCaptured},
+		{"settle", func(h *PaymentHandler) http.HandlerFunc { return h.SettlePayment }, repository.StatusSettled},
+		{"cancel", func(h *PaymentHandler) http.HandlerFunc { return h.CancelPayment }, repository.StatusCanceled},
+		{"fail", func(h *PaymentHandler) http.HandlerFunc { return h.FailPayment }, repository.StatusFailed},
+		{"void", func(h *PaymentHandler) http.HandlerFunc { return h.VoidPayment }, repository.StatusCanceled},
+	}
+	for _, ep := range endpoints {
+		t.Run(ep.name, func(t *testing.T) {
+			mock := &mockPaymentService{transitionResult: &repository.Payment{ID: 1, Status: ep.status}}
+			h := NewPaymentHandler(mock)
+
+			req := httptest.NewRequest(http.MethodPost, "/payments/1/"+ep.name, bytes.NewReader([]byte(`{"reason": "requested by operator"}`)))
+			req = mux.SetURLVars(req, map[string]string{"id": "1"})
+			w := httptest.NewRecorder()
+
+			ep.handler(h)(w, req)
+
+			if w.Code != http.StatusOK {
+				t.Errorf("got status %d, want %d", w.Code, http.StatusOK)
+			}
+			if mock.transitionedTo != ep.status {
+				t.Errorf("got status %q, want %q", mock.transitionedTo, ep.status)
+			}
+			if mock.transitionReason != "requested by operator" {
+				t.Errorf("got reason %q", mock.transitionReason)
+			}
+		})
+	}
+
+	t.Run("partial capture", func(t *testing.T) {
+		mock := &mockPaymentService{transitionResult: &repository.Payment{ID: 1, Status: repository.StatusCaptured}}
+		h := NewPaymentHandler(mock)
+
+		req := httptest.NewRequest(http.MethodPost, "/payments/1/capture", strings.NewReader(`{"amount_minor": 400}`))
+		req = mux.SetURLVars(req, map[string]string{"id": "1"})
+		w := httptest.NewRecorder()
+
+		h.CapturePayment(w, req)
+
+		if w.Code != http.StatusOK {
+			t.Errorf("got status %d, want %d", w.Code, http.StatusOK)
+		}
+		if mock.captureAmount == nil || *mock.captureAmount != 400 {
+			t.Errorf("got capture amount %v, want 400", mock.captureAmount)
+		}
+	})
+
+	t.Run("empty body", func(t *testing.T) {
+		mock := &mockPaymentService{transitionResult: &repository.Payment{ID: 1}}
+		h := NewPaymentHandler(mock)
+
+		req := httptest.NewRequest(http.MethodPost, "/payments/1/authorize", nil)
+		req = mux.SetURLVars(req, map[string]string{"id": "1"})
+		w := httptest.NewRecorder()
+
+		h.AuthorizePayment(w, req)
+
+		if w.Code != http.StatusOK {
+			t.Errorf("got status %d, want %d", w.Code, http.StatusOK)
+		}
+	})
+
+	t.Run("illegal transition", func(t *testing.T) {
+		mock := &mockPaymentService{transitionErr: &service.TransitionError{
+			From: repository.StatusSettled,
+			To:   repository.StatusCanceled,
+		}}
+		h := NewPaymentHandler(mock)
+
+		req := httptest.NewRequest(http.MethodPost, "/payments/1/cancel", nil)
+		req = mux.SetURLVars(req, map[string]string{"id": "1"})
+		w := httptest.NewRecorder()
+
+		h.CancelPayment(w, req)
+
+		if w.Code != http.StatusConflict {
+			t.Errorf("got status %d, want %d", w.Code, http.StatusConflict)
+		}
+	})
+
+	t.Run("invalid id", func(t *testing.T) {
+		h := NewPaymentHandler(&mockPaymentService{})
+
+		req := httptest.NewRequest(http.MethodPost, "/payments/abc/capture", nil)
+		req = mux.SetURLVars(req, map[string]string{"id": "abc"})
+		w := httptest.NewRecorder()
+
+		h.CapturePayment(w, req)
+
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("got status %d, want %d", w.Code, http.StatusBadRequest)
+		}
+	})
+}
+
+func TestPaymentHandler_ListTransitions(t *testing.T) {
+	t.Run("success", func(t *testing.T) {
+		mock := &mockPaymentService{transitions: []repository.PaymentTransition{
+			{ID: 1, PaymentID: 1, FromStatus: repository.StatusPending, ToStatus: repository.StatusAuthorized},
+		}}
+		h := NewPaymentHandler(mock)
+
+		req := httptest.NewRequest(http.MethodGet, "/payments/1/transitions", nil)
+		req = mux.SetURLVars(req, map[string]string{"id": "1"})
+		w := httptest.NewRecorder()
+
+		h.ListTransitions(w, req)
+
+		if w.Code != http.StatusOK {
+			t.Errorf("got status %d, want %d", w.Code, http.StatusOK)
+		}
+		if !strings.Contains(w.Body.String(), `"to":"authorized"`) {
+			t.Errorf("unexpected body %s", w.Body.String())
+		}
+	})
+
+	t.Run("not found", func(t *testing.T) {
+		mock := &mockPaymentService{transitionsErr: service.ErrNotFound}
+		h := NewPaymentHandler(mock)
+
+		req := httptest.NewRequest(http.MethodGet, "/payments/9/transitions", nil)
+		req = mux.SetURLVars(req, map[string]string{"id": "9"})
+		w := httptest.NewRecorder()
+
+		h.ListTransitions(w, req)
+
+		if w.Code != http.StatusNotFound {
+			t.Errorf("got status %d, want %d", w.Code, http.StatusNotFound)
+		}
+	})
+}
+
+func TestDecodePaymentRequest(t *testing.T) {
+	tests := []struct {
+		name    string
+		body    string
+		want    int64
+		wantErr bool
+	}{
+		{"legacy decimal", `{"amount": 100.50, "currency": "USD"}`, 10050, false},
+		{"legacy integer", `{"amount": 100, "currency": "USD"}`, 10000, false},
+		{"legacy without minor units", `{"amount": 1500, "currency": "JPY"}`, 1500, false},
+		{"minor units", `{"amount_minor": 10050, "currency": "USD"}`, 10050, false},
+		{"both amounts", `{"amount": 1, "amount_minor": 100, "currency": "USD"}`, 0, true},
+		{"too many decimals", `{"amount": 0.001, "currency": "USD"}`, 0, true},
+		{"unknown currency", `{"amount": 1, "currency": "XYZ"}`, 0, true},
+		{"missing amount", `{"currency": "USD"}`, 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := decodePaymentRequest(strings.NewReader(tt.body))
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("expected error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got.Amount.Amount != tt.want {
+				t.Errorf("got amount %d, want %d", got.Amount.Amount, tt.want)
+			}
+		})
+	}
+}
+
 func TestGetIDFromRequest(t *testing.T) {
 	t.Run("valid id", func(t *testing.T) {
 		req := httptest.NewRequest(http.MethodGet, "/payments/42", nil)
@@ -0,0 +1,74 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+
+	"github.com/eterrni/payments-api/internal/repository"
+	service "github.com/eterrni/payments-api/internal/services"
+	"github.com/eterrni/payments-api/pkg/problem"
+	"github.com/eterrni/payments-api/pkg/utils"
+)
+
+type refundService interface {
+	CreateRefund(context.Context, uint, service.RefundRequest) (*repository.Refund, error)
+	ListRefunds(context.Context, uint) ([]repository.Refund, error)
+}
+
+type RefundHandler struct {
+	service refundService
+}
+
+func NewRefundHandler(svc refundService) *RefundHandler {
+	return &RefundHandler{service: svc}
+}
+
+func (h *RefundHandler) CreateRefund(w http.ResponseWriter, r *http.Request) {
+	id, err := getIDFromRequest(r)
+	if err != nil {
+		problem.Respond(w, r, problem.InvalidParameter, "Invalid payment ID")
+		return
+	}
+
+	var body struct {
+		AmountMinor *int64 `json:"amount_minor"`
+		Reason      string `json:"reason"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil && err != io.EOF {
+		problem.Respond(w, r, problem.InvalidBody, "Invalid request body")
+		return
+	}
+
+	refund, err := h.service.CreateRefund(r.Context(), id, service.RefundRequest{
+		Amount: body.AmountMinor,
+		Reason: body.Reason,
+		Actor:  actorFromRequest(r),
+	})
+	if err != nil {
+		respondWithServiceError(w, r, err, "Could not create refund")
+		return
+	}
+
+	utils.RespondWithJSON(w, http.StatusCreated, refund)
+}
+
+func (h *RefundHandler) ListRefunds(w http.ResponseWriter, r *http.Request) {
+	id, err := getIDFromRequest(r)
+	if err != nil {
+		problem.Respond(w, r, problem.InvalidParameter, "Invalid payment ID")
+		return
+	}
+
+	refunds, err := h.service.ListRefunds(r.Context(), id)
+	if err != nil {
+		respondWithServiceError(w, r, err, "Could not list refunds")
+		return
+	}
+	if refunds == nil {
+		refunds = []repository.Refund{}
+	}
+
+	utils.RespondWithList(w, refunds, "", false)
+}
@@ -0,0 +1,160 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/eterrni/payments-api/internal/repository"
+	service "github.com/eterrni/payments-api/internal/services"
+	"github.com/gorilla/mux"
+)
+
+type mockRefundService struct {
+	createResult *repository.Refund
+	createErr    error
+	createReq    service.RefundRequest
+	listResult   []repository.Refund
+	listErr      error
+}
+
+func (m *mockRefundService) CreateRefund(ctx context.Context, paymentID uint, req service.RefundRequest) (*repository.Refund, error) {
+	m.createReq = req
+	return m.createResult, m.createErr
+}
+
+func (m *mockRefundService) ListRefunds(ctx context.Context, paymentID uint) ([]repository.Refund, error) {
+	return m.listResult, m.listErr
+}
+
+func TestRefundHandler_CreateRefund(t *testing.T) {
+	newRequest := func(id, body string) *http.Request {
+		req := httptest.NewRequest(http.MethodPost, "/payments/"+id+"/refunds", bytes.NewReader([]byte(body)))
+		return mux.SetURLVars(req, map[string]string{"id": id})
+	}
+
+	t.Run("partial", func(t *testing.T) {
+		mock := &mockRefundService{createResult: &repository.Refund{ID: 1, PaymentID: 1, AmountMinor: 250, Currency: "USD"}}
+		h := NewRefundHandler(mock)
+		w := httptest.NewRecorder()
+
+		h.CreateRefund(w, newRequest("1", `{"amount_minor": 250, "reason": "damaged"}`))
+
+		if w.Code != http.StatusCreated {
+			t.Fatalf("got status %d, want %d", w.Code, http.StatusCreated)
+		}
+		if mock.createReq.Amount == nil || *mock.createReq.Amount != 250 || mock.createReq.Reason != "damaged" {
+			t.Errorf("unexpected request %+v", mock.createReq)
+		}
+		if !strings.Contains(w.Body.String(), `"amount":2.50`) {
+			t.Errorf("body %s does not contain the decimal amount", w.Body.String())
+		}
+	})
+
+	t.Run("full without body", func(t *testing.T) {
+		mock := &mockRefundService{createResult: &repository.Refund{ID: 1}}
+		h := NewRefundHandler(mock)
+		w := httptest.NewRecorder()
+
+		h.CreateRefund(w, newRequest("1", ""))
+
+		if w.Code != http.StatusCreated {
+			t.Fatalf("got status %d, want %d", w.Code, http.StatusCreated)
+		}
+		if mock.createReq.Amount != nil {
+			t.Errorf("got amount %d, want full refund", *mock.createReq.Amount)
+		}
+	})
+
+	t.Run("invalid body", func(t *testing.T) {
+		h := NewRefundHandler(&mockRefundService{})
+		w := httptest.NewRecorder()
+
+		h.CreateRefund(w, newRequest("1", "invalid"))
+
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("got status %d, want %d", w.Code, http.StatusBadRequest)
+		}
+	})
+
+	t.Run("invalid id", func(t *testing.T) {
+		h := NewRefundHandler(&mockRefundService{})
+		w := httptest.NewRecorder()
+
+		h.CreateRefund(w, newRequest("abc", ""))
+
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("got status %d, want %d", w.Code, http.StatusBadRequest)
+		}
+	})
+
+	t.Run("exceeds refundable amount", func(t *testing.T) {
+		mock := &mockRefundService{createErr: &service.ValidationError{
+			Fields: []service.FieldError{{Field: "amount", Message: "refund exceeds the refundable amount"}},
+		}}
+		h := NewRefundHandler(mock)
+		w := httptest.NewRecorder()
+
+		h.CreateRefund(w, newRequest("1", `{"amount_minor": 99999}`))
+
+		if w.Code != http.StatusUnprocessableEntity {
+			t.Errorf("got status %d, want %d", w.Code, http.StatusUnprocessableEntity)
+		}
+	})
+
+	t.Run("not refundable", func(t *testing.T) {
+		mock := &mockRefundService{createErr: &service.TransitionError{From: repository.StatusPending, To: repository.StatusRefunded}}
+		h := NewRefundHandler(mock)
+		w := httptest.NewRecorder()
+
+		h.CreateRefund(w, newRequest("1", ""))
+
+		if w.Code != http.StatusConflict {
+			t.Errorf("got status %d, want %d", w.Code, http.StatusConflict)
+		}
+	})
+
+	t.Run("service error", func(t *testing.T) {
+		h := NewRefundHandler(&mockRefundService{createErr: errors.New("db error")})
+		w := httptest.NewRecorder()
+
+		h.CreateRefund(w, newRequest("1", ""))
+
+		if w.Code != http.StatusInternalServerError {
+			t.Errorf("got status %d, want %d", w.Code, http.StatusInternalServerError)
+		}
+	})
+}
+
+func TestRefundHandler_ListRefunds(t *testing.T) {
+	t.Run("success", func(t *testing.T) {
+		h := NewRefundHandler(&mockRefundService{listResult: []repository.Refund{{ID: 1, PaymentID: 1}}})
+		req := mux.SetURLVars(httptest.NewRequest(http.MethodGet, "/payments/1/refunds", nil), map[string]string{"id": "1"})
+		w := httptest.NewRecorder()
+
+		h.ListRefunds(w, req)
+
+		if w.Code != http.StatusOK {
+			t.Errorf("got status %d, want %d", w.Code, http.StatusOK)
+		}
+		if !strings.Contains(w.Body.String(), `"has_more":false`) {
+			t.Errorf("unexpected body %s", w.Body.String())
+		}
+	})
+
+	t.Run("not found", func(t *testing.T) {
+		h := NewRefundHandler(&mockRefundService{listErr: service.ErrNotFound})
+		req := mux.SetURLVars(httptest.NewRequest(http.MethodGet, "/payments/9/refunds", nil), map[string]string{"id": "9"})
+		w := httptest.NewRecorder()
+
+		h.ListRefunds(w, req)
+
+		if w.Code != http.StatusNotFound {
+			t.Errorf("got status %d, want %d", w.Code, http.StatusNotFound)
+		}
+	})
+}
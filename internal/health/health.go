@@ -0,0 +1,166 @@
+// Package health serves the liveness and readiness probes. Subsystems
+// register named checks; readiness runs all of them and is reported as
+// failed once the server starts shutting down.
+package health
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/eterrni/payments-api/internal/migrations"
+	"github.com/eterrni/payments-api/pkg/utils"
+	"github.com/jinzhu/gorm"
+)
+
+const (
+	StatusOK           = "ok"
+	StatusUnavailable  = "unavailable"
+	StatusShuttingDown = "shutting_down"
+)
+
+// Check reports whether a dependency is usable. It must return when ctx is
+// done.
+type Check func(ctx context.Context) error
+
+type CheckResult struct {
+	Status    string  `json:"status"`
+	LatencyMS float64 `json:"latency_ms"`
+	Error     string  `json:"error,omitempty"`
+}
+
+type Report struct {
+	Status string                 `json:"status"`
+	Checks map[string]CheckResult `json:"checks,omitempty"`
+}
+
+type Health struct {
+	timeout      time.Duration
+	mu           sync.RWMutex
+	checks       map[string]Check
+	shuttingDown atomic.Bool
+}
+
+// New returns a Health whose checks each get at most timeout to complete.
+func New(timeout time.Duration) *Health {
+	return &Health{timeout: timeout, checks: map[string]Check{}}
+}
+
+// Register adds a readiness check, replacing any check with the same name.
+func (h *Health) Register(name string, check Check) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.checks[name] = check
+}
+
+// Shutdown makes readiness fail from now on, so that load balancers stop
+// routing new requests to this instance while it drains.
+func (h *Health) Shutdown() {
+	h.shuttingDown.Store(true)
+}
+
+// Liveness reports that the process is up and serving requests.
+func (h *Health) Liveness(w http.ResponseWriter, r *http.Request) {
+	utils.RespondWithJSON(w, http.StatusOK, Report{Status: StatusOK})
+}
+
+// Readiness runs every check concurrently and responds with 503 if any of
+// them fails or the server is shutting down.
+func (h *Health) Readiness(w http.ResponseWriter, r *http.Request) {
+	if h.shuttingDown.Load() {
+		utils.RespondWithJSON(w, http.StatusServiceUnavailable, Report{Status: StatusShuttingDown})
+		return
+	}
+
+	report := h.Run(r.Context())
+	status := http.StatusOK
+	if report.Status != StatusOK {
+		status = http.StatusServiceUnavailable
+	}
+	utils.RespondWithJSON(w, status, report)
+}
+
+// Run executes every registered check.
+func (h *Health) Run(ctx context.Context) Report {
+	h.mu.RLock()
+	names := make([]string, 0, len(h.checks))
+	for name := range h.checks {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	checks := make([]Check, len(names))
+	for i, name := range names {
+		checks[i] = h.checks[name]
+	}
+	h.mu.RUnlock()
+
+	results := make([]CheckResult, len(checks))
+	var wg sync.WaitGroup
+	for i, check := range checks {
+		wg.Add(1)
+		go func(i int, check Check) {
+			defer wg.Done()
+			results[i] = h.run(ctx, check)
+		}(i, check)
+	}
+	wg.Wait()
+
+	report := Report{Status: StatusOK, Checks: make(map[string]CheckResult, len(names))}
+	for i, name := range names {
+		report.Checks[name] = results[i]
+		if results[i].Status != StatusOK {
+			report.Status = StatusUnavailable
+		}
+	}
+	return report
+}
+
+func (h *Health) run(ctx context.Context, check Check) CheckResult {
+	ctx, cancel := context.WithTimeout(ctx, h.timeout)
+	defer cancel()
+
+	start := time.Now()
+	done := make(chan error, 1)
+	go func() { done <- check(ctx) }()
+
+	var err error
+	select {
+	case err = <-done:
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+	res := CheckResult{
+		Status:    StatusOK,
+		LatencyMS: float64(time.Since(start).Microseconds()) / 1000,
+	}
+	if err != nil {
+		res.Status = StatusUnavailable
+		res.Error = err.Error()
+	}
+	return res
+}
+
+// Database checks that the database answers a ping.
+func Database(db *gorm.DB) Check {
+	return func(ctx context.Context) error {
+		return db.DB().PingContext(ctx)
+	}
+}
+
+// Migrations checks that the schema has every migration this binary expects.
+func Migrations(m *migrations.Migrator) Check {
+	return func(ctx context.Context) error {
+		pending, err := m.Pending(ctx)
+		if err != nil {
+			return err
+		}
+		if len(pending) > 0 {
+			return fmt.Errorf("%d pending migrations, schema is behind version %d", len(pending), m.Latest())
+		}
+		return nil
+	}
+}
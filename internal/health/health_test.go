@@ -0,0 +1,109 @@
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func readiness(t *testing.T, h *Health) (int, Report) {
+	t.Helper()
+	w := httptest.NewRecorder()
+	h.Readiness(w, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+	var report Report
+	if err := json.NewDecoder(w.Body).Decode(&report); err != nil {
+		t.Fatalf("decode body: %v", err)
+	}
+	return w.Code, report
+}
+
+func TestHealth_Liveness(t *testing.T) {
+	h := New(time.Second)
+	h.Register("database", func(context.Context) error { return errors.New("down") })
+	w := httptest.NewRecorder()
+
+	h.Liveness(w, httptest.NewRequest(http.MethodGet, "/healthz", nil))
+
+	if w.Code != http.StatusOK {
+		t.Errorf("liveness must not depend on checks: got status %d", w.Code)
+	}
+}
+
+func TestHealth_Readiness(t *testing.T) {
+	t.Run("all checks pass", func(t *testing.T) {
+		h := New(time.Second)
+		h.Register("database", func(context.Context) error { return nil })
+		h.Register("migrations", func(context.Context) error { return nil })
+
+		code, report := readiness(t, h)
+
+		if code != http.StatusOK {
+			t.Errorf("got status %d, want %d", code, http.StatusOK)
+		}
+		if report.Status != StatusOK || len(report.Checks) != 2 {
+			t.Errorf("got %+v", report)
+		}
+		if report.Checks["database"].Status != StatusOK {
+			t.Errorf("got database check %+v", report.Checks["database"])
+		}
+	})
+
+	t.Run("failing check", func(t *testing.T) {
+		h := New(time.Second)
+		h.Register("database", func(context.Context) error { return errors.New("connection refused") })
+		h.Register("migrations", func(context.Context) error { return nil })
+
+		code, report := readiness(t, h)
+
+		if code != http.StatusServiceUnavailable {
+			t.Errorf("got status %d, want %d", code, http.StatusServiceUnavailable)
+		}
+		db := report.Checks["database"]
+		if db.Status != StatusUnavailable || db.Error != "connection refused" {
+			t.Errorf("got database check %+v", db)
+		}
+		if report.Checks["migrations"].Status != StatusOK {
+			t.Errorf("got migrations check %+v", report.Checks["migrations"])
+		}
+	})
+
+	t.Run("slow check times out", func(t *testing.T) {
+		h := New(20 * time.Millisecond)
+		block := make(chan struct{})
+		defer close(block)
+		h.Register("database", func(ctx context.Context) error {
+			<-block
+			return nil
+		})
+
+		start := time.Now()
+		code, report := readiness(t, h)
+
+		if time.Since(start) > time.Second {
+			t.Error("readiness waited for a hung check")
+		}
+		if code != http.StatusServiceUnavailable || report.Checks["database"].Error != context.DeadlineExceeded.Error() {
+			t.Errorf("got status %d, report %+v", code, report)
+		}
+	})
+
+	t.Run("shutting down", func(t *testing.T) {
+		h := New(time.Second)
+		called := false
+		h.Register("database", func(context.Context) error { called = true; return nil })
+
+		h.Shutdown()
+		code, report := readiness(t, h)
+
+		if code != http.StatusServiceUnavailable || report.Status != StatusShuttingDown {
+			t.Errorf("got status %d, report %+v", code, report)
+		}
+		if called {
+			t.Error("checks should not run while shutting down")
+		}
+	})
+}
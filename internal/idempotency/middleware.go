@@ -0,0 +1,170 @@
+package idempotency
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/eterrni/payments-api/internal/merchant"
+	"github.com/eterrni/payments-api/pkg/problem"
+)
+
+const (
+	HeaderKey      = "Idempotency-Key"
+	HeaderReplayed = "Idempotent-Replayed"
+
+	maxKeyLength = 255
+)
+
+// replayedHeaders are the response headers stored with a completed request
+// and sent again on replay.
+var replayedHeaders = []string{"Content-Type", "Location"}
+
+// Middleware makes requests carrying an Idempotency-Key header safe to retry.
+// The first response for a key is stored for ttl and replayed for later
+// requests with the same key and body. Keys are per merchant (see package
+// merchant), so that merchants cannot see each other's responses. Reusing
+// a key with a different body is rejected with 422, and a retry that
+// arrives while the first request is still running gets 409. Requests
+// without the header pass through untouched. The body is buffered to
+// fingerprint it, so bodies over maxBody bytes are rejected with 413.
+func Middleware(store Store, ttl time.Duration, maxBody int64) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			key := r.Header.Get(HeaderKey)
+			if key == "" {
+				next.ServeHTTP(w, r)
+				return
+			}
+			if len(key) > maxKeyLength {
+				problem.Respond(w, r, problem.InvalidParameter, "Idempotency-Key is too long")
+				return
+			}
+
+			body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxBody))
+			var tooLarge *http.MaxBytesError
+			if errors.As(err, &tooLarge) {
+				problem.Respond(w, r, problem.PayloadTooLarge, fmt.Sprintf("Request body must be at most %d bytes", maxBody))
+				return
+			}
+			if err != nil {
+				problem.Respond(w, r, problem.InvalidBody, "Invalid request body")
+				return
+			}
+			r.Body = io.NopCloser(bytes.NewReader(body))
+			if id, ok := merchant.FromContext(r.Context()); ok {
+				// Merchant IDs cannot contain "/", so keys of different
+				// merchants never collide.
+				key = id + "/" + key
+			}
+
+			now := time.Now()
+			rec := &Record{
+				Key:         key,
+				Fingerprint: fingerprint(r, body),
+				CreatedAt:   now,
+				ExpiresAt:   now.Add(ttl),
+			}
+			existing, err := store.Reserve(r.Context(), rec)
+			if err != nil {
+				slog.Error("Could not reserve idempotency key", "key", key, "error", err)
+				problem.Respond(w, r, problem.Internal, "Could not process idempotency key")
+				return
+			}
+			if existing != nil {
+				replay(w, r, existing, rec.Fingerprint)
+				return
+			}
+
+			// The outcome is recorded even if the client has gone away in
+			// the meantime; otherwise the key would stay in flight until it
+			// expires.
+			done := context.WithoutCancel(r.Context())
+			cw := &capturingWriter{ResponseWriter: w, status: http.StatusOK}
+			defer func() {
+				if p := recover(); p != nil {
+					release(done, store, key)
+					panic(p)
+				}
+			}()
+			next.ServeHTTP(cw, r)
+
+			// Server errors are not cached so that the client can retry.
+			if cw.status >= http.StatusInternalServerError {
+				release(done, store, key)
+				return
+			}
+			if err := store.Complete(done, key, cw.status, encodeHeader(w.Header()), cw.body.Bytes()); err != nil {
+				slog.Error("Could not complete idempotency key", "key", key, "error", err)
+			}
+		})
+	}
+}
+
+func replay(w http.ResponseWriter, r *http.Request, rec *Record, fp string) {
+	switch {
+	case rec.Fingerprint != fp:
+		problem.Respond(w, r, problem.IdempotencyKeyReused, "")
+	case !rec.Completed:
+		problem.Respond(w, r, problem.IdempotencyKeyInUse, "")
+	default:
+		var header map[string]string
+		_ = json.Unmarshal([]byte(rec.Header), &header)
+		for k, v := range header {
+			w.Header().Set(k, v)
+		}
+		slog.Debug("Replaying idempotent response", "key", rec.Key)
+		w.Header().Set(HeaderReplayed, "true")
+		w.WriteHeader(rec.StatusCode)
+		w.Write(rec.Body)
+	}
+}
+
+func release(ctx context.Context, store Store, key string) {
+	if err := store.Release(ctx, key); err != nil {
+		slog.Error("Could not release idempotency key", "key", key, "error", err)
+	}
+}
+
+func fingerprint(r *http.Request, body []byte) string {
+	h := sha256.New()
+	io.WriteString(h, r.Method+" "+r.URL.Path+"\n")
+	h.Write(body)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+func encodeHeader(h http.Header) string {
+	stored := make(map[string]string)
+	for _, name := range replayedHeaders {
+		if v := h.Get(name); v != "" {
+			stored[name] = v
+		}
+	}
+	b, _ := json.Marshal(stored)
+	return string(b)
+}
+
+// capturingWriter passes the response through while keeping a copy of it.
+type capturingWriter struct {
+	http.ResponseWriter
+	status int
+	body   bytes.Buffer
+}
+
+func (w *capturingWriter) WriteHeader(status int) {
+	w.status = status
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *capturingWriter) Write(b []byte) (int, error) {
+	w.body.Write(b)
+	return w.ResponseWriter.Write(b)
+}
@@ -0,0 +1,223 @@
+package idempotency
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/eterrni/payments-api/internal/merchant"
+)
+
+func newRequest(key, body string) *http.Request {
+	req := httptest.NewRequest(http.MethodPost, "/payments", bytes.NewReader([]byte(body)))
+	if key != "" {
+		req.Header.Set(HeaderKey, key)
+	}
+	return req
+}
+
+func TestMiddleware(t *testing.T) {
+	t.Run("replays the first response", func(t *testing.T) {
+		calls := 0
+		h := Middleware(NewMemoryStore(), time.Hour, 1<<20)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			calls++
+			body, _ := io.ReadAll(r.Body)
+			w.Header().Set("Content-Type", "application/json")
+			w.Header().Set("Location", "/payments/1")
+			w.WriteHeader(http.StatusCreated)
+			w.Write(body)
+		}))
+
+		first := httptest.NewRecorder()
+		h.ServeHTTP(first, newRequest("k1", `{"amount_minor":100}`))
+		second := httptest.NewRecorder()
+		h.ServeHTTP(second, newRequest("k1", `{"amount_minor":100}`))
+
+		if calls != 1 {
+			t.Fatalf("handler called %d times, want 1", calls)
+		}
+		if second.Code != http.StatusCreated {
+			t.Errorf("got status %d, want %d", second.Code, http.StatusCreated)
+		}
+		if second.Body.String() != first.Body.String() {
+			t.Errorf("got body %q, want %q", second.Body.String(), first.Body.String())
+		}
+		if second.Header().Get("Location") != "/payments/1" {
+			t.Errorf("Location = %q, want /payments/1", second.Header().Get("Location"))
+		}
+		if second.Header().Get(HeaderReplayed) != "true" {
+			t.Error("replayed response is not marked")
+		}
+	})
+
+	t.Run("keys are per merchant", func(t *testing.T) {
+		calls := 0
+		h := Middleware(NewMemoryStore(), time.Hour, 1<<20)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			calls++
+			w.WriteHeader(http.StatusCreated)
+		}))
+
+		for _, id := range []string{"acme", "globex"} {
+			req := newRequest("k1", `{"amount_minor":100}`)
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, req.WithContext(merchant.NewContext(req.Context(), id)))
+			if w.Header().Get(HeaderReplayed) != "" {
+				t.Errorf("%s: got the response of another merchant", id)
+			}
+		}
+		if calls != 2 {
+			t.Errorf("handler called %d times, want 2", calls)
+		}
+	})
+
+	t.Run("different body", func(t *testing.T) {
+		h := Middleware(NewMemoryStore(), time.Hour, 1<<20)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusCreated)
+		}))
+
+		h.ServeHTTP(httptest.NewRecorder(), newRequest("k1", `{"amount_minor":100}`))
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, newRequest("k1", `{"amount_minor":200}`))
+
+		if w.Code != http.StatusUnprocessableEntity {
+			t.Errorf("got status %d, want %d", w.Code, http.StatusUnprocessableEntity)
+		}
+		if !strings.Contains(w.Body.String(), `"code":"idempotency_key_reused"`) {
+			t.Errorf("got body %s", w.Body.String())
+		}
+	})
+
+	t.Run("in flight", func(t *testing.T) {
+		started, finish := make(chan struct{}), make(chan struct{})
+		h := Middleware(NewMemoryStore(), time.Hour, 1<<20)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			close(started)
+			<-finish
+			w.WriteHeader(http.StatusCreated)
+		}))
+
+		done := make(chan struct{})
+		go func() {
+			h.ServeHTTP(httptest.NewRecorder(), newRequest("k1", `{}`))
+			close(done)
+		}()
+		<-started
+
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, newRequest("k1", `{}`))
+		close(finish)
+		<-done
+
+		if w.Code != http.StatusConflict {
+			t.Errorf("got status %d, want %d", w.Code, http.StatusConflict)
+		}
+	})
+
+	t.Run("server errors are not cached", func(t *testing.T) {
+		status := http.StatusInternalServerError
+		h := Middleware(NewMemoryStore(), time.Hour, 1<<20)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(status)
+		}))
+
+		h.ServeHTTP(httptest.NewRecorder(), newRequest("k1", `{}`))
+		status = http.StatusCreated
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, newRequest("k1", `{}`))
+
+		if w.Code != http.StatusCreated {
+			t.Errorf("got status %d, want %d", w.Code, http.StatusCreated)
+		}
+	})
+
+	t.Run("expired key", func(t *testing.T) {
+		calls := 0
+		h := Middleware(NewMemoryStore(), -time.Second, 1<<20)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			calls++
+			w.WriteHeader(http.StatusCreated)
+		}))
+
+		h.ServeHTTP(httptest.NewRecorder(), newRequest("k1", `{}`))
+		h.ServeHTTP(httptest.NewRecorder(), newRequest("k1", `{"other":true}`))
+
+		if calls != 2 {
+			t.Errorf("handler called %d times, want 2", calls)
+		}
+	})
+
+	t.Run("completed after the client went away", func(t *testing.T) {
+		store := contextStore{NewMemoryStore()}
+		ctx, cancel := context.WithCancel(context.Background())
+		calls := 0
+		h := Middleware(store, time.Hour, 1<<20)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			calls++
+			cancel()
+			w.WriteHeader(http.StatusCreated)
+		}))
+
+		h.ServeHTTP(httptest.NewRecorder(), newRequest("k1", `{}`).WithContext(ctx))
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, newRequest("k1", `{}`))
+
+		if calls != 1 {
+			t.Errorf("handler called %d times, want 1", calls)
+		}
+		if w.Code != http.StatusCreated || w.Header().Get(HeaderReplayed) != "true" {
+			t.Errorf("got status %d, want replayed %d", w.Code, http.StatusCreated)
+		}
+	})
+
+	t.Run("body too large", func(t *testing.T) {
+		calls := 0
+		store := NewMemoryStore()
+		h := Middleware(store, time.Hour, 8)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			calls++
+		}))
+
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, newRequest("k1", `{"amount_minor":100}`))
+		if w.Code != http.StatusRequestEntityTooLarge || calls != 0 {
+			t.Fatalf("got status %d after %d calls, want %d before the handler", w.Code, calls, http.StatusRequestEntityTooLarge)
+		}
+		h.ServeHTTP(httptest.NewRecorder(), newRequest("k1", `{}`))
+		if calls != 1 {
+			t.Error("rejected request reserved its key")
+		}
+	})
+
+	t.Run("without key", func(t *testing.T) {
+		calls := 0
+		h := Middleware(NewMemoryStore(), time.Hour, 1<<20)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			calls++
+		}))
+
+		h.ServeHTTP(httptest.NewRecorder(), newRequest("", `{}`))
+		h.ServeHTTP(httptest.NewRecorder(), newRequest("", `{}`))
+
+		if calls != 2 {
+			t.Errorf("handler called %d times, want 2", calls)
+		}
+	})
+}
+
+// contextStore fails like a database store does once the context has ended.
+type contextStore struct {
+	Store
+}
+
+func (s contextStore) Complete(ctx context.Context, key string, statusCode int, header string, body []byte) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return s.Store.Complete(ctx, key, statusCode, header, body)
+}
+
+func (s contextStore) Release(ctx context.Context, key string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return s.Store.Release(ctx, key)
+}
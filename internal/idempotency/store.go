@@ -0,0 +1,151 @@
+package idempotency
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/eterrni/payments-api/internal/repository"
+	"github.com/jinzhu/gorm"
+)
+
+// Record is the stored state of one idempotency key. A record without
+// Completed set belongs to a request that is still being processed.
+type Record struct {
+	Key         string `gorm:"column:idempotency_key;primary_key"`
+	Fingerprint string `gorm:"not null"`
+	Completed   bool   `gorm:"not null"`
+	StatusCode  int
+	Header      string `gorm:"type:text"`
+	Body        []byte
+	CreatedAt   time.Time
+	ExpiresAt   time.Time `gorm:"index"`
+}
+
+func (Record) TableName() string {
+	return "idempotency_keys"
+}
+
+type Store interface {
+	// Reserve stores rec as an in-flight request. If an unexpired record
+	// with the same key already exists, it is returned instead and rec is
+	// not stored.
+	Reserve(ctx context.Context, rec *Record) (*Record, error)
+	Complete(ctx context.Context, key string, statusCode int, header string, body []byte) error
+	// Release forgets key so that the request can be retried.
+	Release(ctx context.Context, key string) error
+	// Purge deletes the records that expired at or before now and returns
+	// how many there were.
+	Purge(ctx context.Context, now time.Time) (int64, error)
+}
+
+type gormStore struct {
+	conn *repository.Conn
+}
+
+func NewStore(conn *repository.Conn) Store {
+	return &gormStore{conn: conn}
+}
+
+func (s *gormStore) Reserve(ctx context.Context, rec *Record) (*Record, error) {
+	var existing *Record
+	err := s.conn.Run(ctx, func(db *gorm.DB) error {
+		err := db.Where("idempotency_key = ? AND expires_at <= ?", rec.Key, time.Now()).Delete(&Record{}).Error
+		if err != nil {
+			return err
+		}
+
+		err = db.Create(rec).Error
+		if err == nil {
+			return nil
+		}
+		if !errors.Is(repository.Translate(err), repository.ErrConflict) {
+			return err
+		}
+
+		existing = &Record{}
+		return db.Where("idempotency_key = ?", rec.Key).First(existing).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return existing, nil
+}
+
+func (s *gormStore) Complete(ctx context.Context, key string, statusCode int, header string, body []byte) error {
+	return s.conn.Run(ctx, func(db *gorm.DB) error {
+		return db.Model(&Record{}).Where("idempotency_key = ?", key).Updates(map[string]interface{}{
+			"completed":   true,
+			"status_code": statusCode,
+			"header":      header,
+			"body":        body,
+		}).Error
+	})
+}
+
+func (s *gormStore) Release(ctx context.Context, key string) error {
+	return s.conn.Run(ctx, func(db *gorm.DB) error {
+		return db.Where("idempotency_key = ?", key).Delete(&Record{}).Error
+	})
+}
+
+func (s *gormStore) Purge(ctx context.Context, now time.Time) (int64, error) {
+	var n int64
+	err := s.conn.Run(ctx, func(db *gorm.DB) error {
+		res := db.Where("expires_at <= ?", now).Delete(&Record{})
+		n = res.RowsAffected
+		return res.Error
+	})
+	return n, err
+}
+
+type memoryStore struct {
+	mu      sync.Mutex
+	records map[string]Record
+}
+
+// NewMemoryStore keeps records in memory, for tests and local development.
+// Expired records are replaced when their key is reused or purged.
+func NewMemoryStore() Store {
+	return &memoryStore{records: make(map[string]Record)}
+}
+
+func (s *memoryStore) Reserve(ctx context.Context, rec *Record) (*Record, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if existing, ok := s.records[rec.Key]; ok && existing.ExpiresAt.After(time.Now()) {
+		return &existing, nil
+	}
+	s.records[rec.Key] = *rec
+	return nil, nil
+}
+
+func (s *memoryStore) Complete(ctx context.Context, key string, statusCode int, header string, body []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	rec := s.records[key]
+	rec.Completed, rec.StatusCode, rec.Header, rec.Body = true, statusCode, header, body
+	s.records[key] = rec
+	return nil
+}
+
+func (s *memoryStore) Release(ctx context.Context, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.records, key)
+	return nil
+}
+
+func (s *memoryStore) Purge(ctx context.Context, now time.Time) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var n int64
+	for key, rec := range s.records {
+		if !rec.ExpiresAt.After(now) {
+			delete(s.records, key)
+			n++
+		}
+	}
+	return n, nil
+}
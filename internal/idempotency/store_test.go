@@ -0,0 +1,69 @@
+package idempotency
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/eterrni/payments-api/internal/migrations"
+	"github.com/eterrni/payments-api/internal/repository"
+	"github.com/jinzhu/gorm"
+	_ "github.com/jinzhu/gorm/dialects/sqlite"
+)
+
+func TestStore_Purge(t *testing.T) {
+	t.Run("memory", func(t *testing.T) {
+		testPurge(t, NewMemoryStore())
+	})
+	t.Run("sqlite", func(t *testing.T) {
+		db, err := gorm.Open("sqlite3", filepath.Join(t.TempDir(), "payments.db"))
+		if err != nil {
+			t.Fatalf("open: %v", err)
+		}
+		t.Cleanup(func() { db.Close() })
+		m, err := migrations.New(db.DB(), migrations.SQLite)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := m.Up(t.Context()); err != nil {
+			t.Fatalf("migrate: %v", err)
+		}
+		testPurge(t, NewStore(repository.NewConn(db, 0)))
+
+		var left int
+		if err := db.Model(&Record{}).Count(&left).Error; err != nil {
+			t.Fatal(err)
+		}
+		if left != 1 {
+			t.Errorf("got %d rows after the sweep, want 1", left)
+		}
+	})
+}
+
+func testPurge(t *testing.T, s Store) {
+	now := time.Now().UTC().Truncate(time.Second)
+	for key, expires := range map[string]time.Time{
+		"old":   now.Add(-time.Hour),
+		"due":   now,
+		"fresh": now.Add(time.Hour),
+	} {
+		if _, err := s.Reserve(t.Context(), &Record{Key: key, Fingerprint: "f", CreatedAt: now, ExpiresAt: expires}); err != nil {
+			t.Fatalf("reserve %s: %v", key, err)
+		}
+	}
+
+	n, err := s.Purge(t.Context(), now)
+	if err != nil {
+		t.Fatalf("purge: %v", err)
+	}
+	if n != 2 {
+		t.Errorf("purged %d records, want 2", n)
+	}
+	if n, err := s.Purge(t.Context(), now); err != nil || n != 0 {
+		t.Errorf("second purge: got %d, error %v, want nothing left to purge", n, err)
+	}
+	existing, err := s.Reserve(t.Context(), &Record{Key: "fresh", Fingerprint: "other", CreatedAt: now, ExpiresAt: now.Add(time.Hour)})
+	if err != nil || existing == nil || existing.Fingerprint != "f" {
+		t.Errorf("unexpired record was purged: got %+v, error %v", existing, err)
+	}
+}
@@ -0,0 +1,194 @@
+// Package ledger is the double-entry accounting trail behind payments. Every
+// movement of money is a journal Entry of Postings to Accounts; the postings
+// of an entry balance in each currency, so that the balances of all accounts
+// always add up to zero. Entries are never changed once posted: mistakes and
+// reversals are corrected by posting more entries.
+package ledger
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/eterrni/payments-api/internal/money"
+)
+
+var (
+	ErrUnknownAccount = errors.New("unknown account")
+	ErrUnbalanced     = errors.New("entry does not balance")
+)
+
+type AccountType string
+
+const (
+	Asset     AccountType = "asset"
+	Liability AccountType = "liability"
+	Revenue   AccountType = "revenue"
+)
+
+type Account struct {
+	Code        string      `json:"code"`
+	Type        AccountType `json:"type"`
+	Description string      `json:"description"`
+}
+
+// creditNormal reports whether credits increase the balance of the account.
+func (a Account) creditNormal() bool {
+	return a.Type != Asset
+}
+
+// The chart of accounts. An open payment is owed by the payer and, in turn,
+// to the merchant; once captured, the collected funds are held as cash and
+// owed to the merchant less the fee.
+const (
+	Receivable      = "receivable"
+	MerchantPending = "merchant_pending"
+	Cash            = "cash"
+	MerchantPayable = "merchant_payable"
+	FeeRevenue      = "fee_revenue"
+)
+
+var accounts = []Account{
+	{Receivable, Asset, "Amounts of open payments, expected from payers"},
+	{MerchantPending, Liability, "Amounts of open payments, owed to merchants once captured"},
+	{Cash, Asset, "Funds collected from payers and not refunded"},
+	{MerchantPayable, Liability, "Captured funds owed to merchants, less fees and refunds"},
+	{FeeRevenue, Revenue, "Fees earned on captured payments"},
+}
+
+// Accounts returns the chart of accounts.
+func Accounts() []Account {
+	return slices.Clone(accounts)
+}
+
+func LookupAccount(code string) (Account, bool) {
+	for _, a := range accounts {
+		if a.Code == code {
+			return a, true
+		}
+	}
+	return Account{}, false
+}
+
+// Kind names the event an entry records.
+type Kind string
+
+const (
+	KindPaymentCreated  Kind = "payment_created"
+	KindPaymentAmended  Kind = "payment_amended"
+	KindPaymentCaptured Kind = "payment_captured"
+	KindPaymentReleased Kind = "payment_released"
+	KindFee             Kind = "fee"
+	KindRefund          Kind = "refund"
+)
+
+// Entry is a journal entry. PaymentID and RefundID link it to the records
+// whose change it accounts for.
+type Entry struct {
+	ID uint `json:"id" gorm:"primary_key"`
+	// MerchantID is the merchant whose payment the entry accounts for.
+	MerchantID string    `json:"merchant_id,omitempty" gorm:"not null;index"`
+	Kind       Kind      `json:"kind" gorm:"not null"`
+	PaymentID  uint      `json:"payment_id" gorm:"not null;index"`
+	RefundID   *uint     `json:"refund_id,omitempty"`
+	CreatedAt  time.Time `json:"created_at" gorm:"not null"`
+	Postings   []Posting `json:"postings" gorm:"foreignkey:EntryID"`
+}
+
+func (Entry) TableName() string {
+	return "ledger_entries"
+}
+
+// Posting debits or credits an account. Debits are stored as positive and
+// credits as negative amounts, so that every entry sums to zero.
+type Posting struct {
+	ID          uint   `json:"-" gorm:"primary_key"`
+	EntryID     uint   `json:"-" gorm:"not null;index"`
+	Account     string `json:"account" gorm:"not null;index"`
+	AmountMinor int64  `json:"-" gorm:"not null"`
+	Currency    string `json:"currency" gorm:"not null"`
+}
+
+func (Posting) TableName() string {
+	return "ledger_postings"
+}
+
+func Debit(account string, amount money.Money) Posting {
+	return Posting{Account: account, AmountMinor: amount.Amount, Currency: amount.Currency}
+}
+
+func Credit(account string, amount money.Money) Posting {
+	return Posting{Account: account, AmountMinor: -amount.Amount, Currency: amount.Currency}
+}
+
+// MarshalJSON renders the posting as a positive amount on the debit or
+// credit side.
+func (p Posting) MarshalJSON() ([]byte, error) {
+	type posting Posting
+	side, amount := "debit", p.AmountMinor
+	if amount < 0 {
+		side, amount = "credit", -amount
+	}
+	m := money.Money{Amount: amount, Currency: p.Currency}
+	return json.Marshal(struct {
+		posting
+		Side        string      `json:"side"`
+		AmountMinor int64       `json:"amount_minor"`
+		Amount      json.Number `json:"amount"`
+	}{posting(p), side, amount, json.Number(m.Decimal())})
+}
+
+// Validate checks that the entry posts non-zero amounts to known accounts
+// and balances in every currency.
+func (e Entry) Validate() error {
+	if len(e.Postings) < 2 {
+		return fmt.Errorf("%w: %s entry has %d postings", ErrUnbalanced, e.Kind, len(e.Postings))
+	}
+	sums := map[string]int64{}
+	for _, p := range e.Postings {
+		if _, ok := LookupAccount(p.Account); !ok {
+			return fmt.Errorf("%w %q", ErrUnknownAccount, p.Account)
+		}
+		if p.AmountMinor == 0 {
+			return fmt.Errorf("%s entry posts nothing to %s", e.Kind, p.Account)
+		}
+		sums[p.Currency] += p.AmountMinor
+	}
+	for code, sum := range sums {
+		if sum != 0 {
+			return fmt.Errorf("%w: %s entry is off by %d in %s", ErrUnbalanced, e.Kind, sum, code)
+		}
+	}
+	return nil
+}
+
+// Balance sums the postings of an account in one currency.
+type Balance struct {
+	Account     string
+	Currency    string
+	DebitMinor  int64
+	CreditMinor int64
+}
+
+// Minor is the balance in minor units, positive on the normal side of the
+// account: debits for assets, credits for liabilities and revenue.
+func (b Balance) Minor() int64 {
+	if a, ok := LookupAccount(b.Account); ok && a.creditNormal() {
+		return b.CreditMinor - b.DebitMinor
+	}
+	return b.DebitMinor - b.CreditMinor
+}
+
+func (b Balance) MarshalJSON() ([]byte, error) {
+	m := money.Money{Amount: b.Minor(), Currency: b.Currency}
+	return json.Marshal(struct {
+		Account      string      `json:"account"`
+		Currency     string      `json:"currency"`
+		DebitMinor   int64       `json:"debit_minor"`
+		CreditMinor  int64       `json:"credit_minor"`
+		BalanceMinor int64       `json:"balance_minor"`
+		Balance      json.Number `json:"balance"`
+	}{b.Account, b.Currency, b.DebitMinor, b.CreditMinor, m.Amount, json.Number(m.Decimal())})
+}
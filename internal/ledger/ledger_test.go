@@ -0,0 +1,139 @@
+package ledger
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/eterrni/payments-api/internal/money"
+)
+
+func usd(amount int64) money.Money {
+	return money.Money{Amount: amount, Currency: "USD"}
+}
+
+func TestRules(t *testing.T) {
+	tests := []struct {
+		name  string
+		entry Entry
+		want  []Posting
+	}{
+		{
+			name:  "created",
+			entry: PaymentCreated(1, usd(1000)),
+			want:  []Posting{Debit(Receivable, usd(1000)), Credit(MerchantPending, usd(1000))},
+		},
+		{
+			name:  "amended in the same currency",
+			entry: PaymentAmended(1, usd(1000), usd(1200)),
+			want:  []Posting{Debit(Receivable, usd(200)), Credit(MerchantPending, usd(200))},
+		},
+		{
+			name:  "amended to another currency",
+			entry: PaymentAmended(1, usd(1000), money.Money{Amount: 900, Currency: "EUR"}),
+			want: []Posting{
+				Credit(Receivable, usd(1000)),
+				Debit(MerchantPending, usd(1000)),
+				Debit(Receivable, money.Money{Amount: 900, Currency: "EUR"}),
+				Credit(MerchantPending, money.Money{Amount: 900, Currency: "EUR"}),
+			},
+		},
+		{
+			name:  "captured in part",
+			entry: PaymentCaptured(1, usd(1000), 600),
+			want: []Posting{
+				Credit(Receivable, usd(1000)),
+				Debit(MerchantPending, usd(1000)),
+				Debit(Cash, usd(600)),
+				Credit(MerchantPayable, usd(600)),
+			},
+		},
+		{
+			name:  "released",
+			entry: PaymentReleased(1, usd(1000)),
+			want:  []Posting{Credit(Receivable, usd(1000)), Debit(MerchantPending, usd(1000))},
+		},
+		{
+			name:  "fee",
+			entry: Fee(1, usd(30)),
+			want:  []Posting{Debit(MerchantPayable, usd(30)), Credit(FeeRevenue, usd(30))},
+		},
+		{
+			name:  "refund",
+			entry: Refund(1, 2, usd(400)),
+			want:  []Posting{Debit(MerchantPayable, usd(400)), Credit(Cash, usd(400))},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.entry.Validate(); err != nil {
+				t.Errorf("invalid entry: %v", err)
+			}
+			if tt.entry.PaymentID != 1 {
+				t.Errorf("got payment ID %d, want 1", tt.entry.PaymentID)
+			}
+			if !reflect.DeepEqual(tt.entry.Postings, tt.want) {
+				t.Errorf("got postings %+v, want %+v", tt.entry.Postings, tt.want)
+			}
+		})
+	}
+
+	if e := Refund(1, 2, usd(400)); e.RefundID == nil || *e.RefundID != 2 {
+		t.Errorf("refund entry not linked to the refund: %+v", e)
+	}
+}
+
+func TestEntry_Validate(t *testing.T) {
+	tests := []struct {
+		name     string
+		postings []Posting
+		want     error
+	}{
+		{"single posting", []Posting{Debit(Cash, usd(100))}, ErrUnbalanced},
+		{"unbalanced", []Posting{Debit(Cash, usd(100)), Credit(MerchantPayable, usd(90))}, ErrUnbalanced},
+		{
+			"balanced in total but not per currency",
+			[]Posting{Debit(Cash, usd(100)), Credit(MerchantPayable, money.Money{Amount: 100, Currency: "EUR"})},
+			ErrUnbalanced,
+		},
+		{"unknown account", []Posting{Debit("bank", usd(100)), Credit(Cash, usd(100))}, ErrUnknownAccount},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := Entry{Kind: KindFee, Postings: tt.postings}.Validate()
+			if !errors.Is(err, tt.want) {
+				t.Errorf("got error %v, want %v", err, tt.want)
+			}
+		})
+	}
+
+	t.Run("zero posting", func(t *testing.T) {
+		e := Entry{Kind: KindFee, Postings: []Posting{Debit(Cash, usd(0)), Credit(FeeRevenue, usd(0))}}
+		if err := e.Validate(); err == nil {
+			t.Error("expected error for zero postings")
+		}
+	})
+}
+
+func TestJSON(t *testing.T) {
+	b, err := json.Marshal(Credit(MerchantPayable, usd(1050)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := `{"account":"merchant_payable","currency":"USD","side":"credit","amount_minor":1050,"amount":10.50}`; string(b) != want {
+		t.Errorf("got posting %s, want %s", b, want)
+	}
+
+	b, err = json.Marshal(Balance{Account: MerchantPayable, Currency: "USD", DebitMinor: 400, CreditMinor: 1000})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := `{"account":"merchant_payable","currency":"USD","debit_minor":400,"credit_minor":1000,"balance_minor":600,"balance":6.00}`; string(b) != want {
+		t.Errorf("got balance %s, want %s", b, want)
+	}
+
+	if got := (Balance{Account: Cash, DebitMinor: 1000, CreditMinor: 400}).Minor(); got != 600 {
+		t.Errorf("got cash balance %d, want 600", got)
+	}
+}
@@ -0,0 +1,87 @@
+package ledger
+
+import "github.com/eterrni/payments-api/internal/money"
+
+// PaymentCreated records a new payment, which the payer is expected to pay
+// and the merchant to receive.
+func PaymentCreated(paymentID uint, amount money.Money) Entry {
+	return entry(KindPaymentCreated, paymentID,
+		Debit(Receivable, amount),
+		Credit(MerchantPending, amount),
+	)
+}
+
+// PaymentAmended records a change of the amount or currency of an open
+// payment.
+func PaymentAmended(paymentID uint, from, to money.Money) Entry {
+	return entry(KindPaymentAmended, paymentID,
+		Credit(Receivable, from),
+		Debit(MerchantPending, from),
+		Debit(Receivable, to),
+		Credit(MerchantPending, to),
+	)
+}
+
+// PaymentCaptured closes an open payment of amount by collecting captured
+// minor units of it; the rest is no longer expected.
+func PaymentCaptured(paymentID uint, amount money.Money, captured int64) Entry {
+	collected := money.Money{Amount: captured, Currency: amount.Currency}
+	return entry(KindPaymentCaptured, paymentID,
+		Credit(Receivable, amount),
+		Debit(MerchantPending, amount),
+		Debit(Cash, collected),
+		Credit(MerchantPayable, collected),
+	)
+}
+
+// PaymentReleased closes an open payment that was not captured: it was
+// canceled, voided, failed or its authorization expired.
+func PaymentReleased(paymentID uint, amount money.Money) Entry {
+	return entry(KindPaymentReleased, paymentID,
+		Credit(Receivable, amount),
+		Debit(MerchantPending, amount),
+	)
+}
+
+// Fee charges the merchant a fee for a payment.
+func Fee(paymentID uint, fee money.Money) Entry {
+	return entry(KindFee, paymentID,
+		Debit(MerchantPayable, fee),
+		Credit(FeeRevenue, fee),
+	)
+}
+
+// Refund returns collected funds to the payer on behalf of the merchant.
+func Refund(paymentID, refundID uint, amount money.Money) Entry {
+	e := entry(KindRefund, paymentID,
+		Debit(MerchantPayable, amount),
+		Credit(Cash, amount),
+	)
+	e.RefundID = &refundID
+	return e
+}
+
+// entry nets the postings per account and currency, dropping those that
+// cancel out, e.g. when an amendment keeps the currency.
+func entry(kind Kind, paymentID uint, postings ...Posting) Entry {
+	e := Entry{Kind: kind, PaymentID: paymentID}
+	for _, p := range postings {
+		i := 0
+		for i < len(e.Postings) && (e.Postings[i].Account != p.Account || e.Postings[i].Currency != p.Currency) {
+			i++
+		}
+		if i == len(e.Postings) {
+			e.Postings = append(e.Postings, p)
+		} else {
+			e.Postings[i].AmountMinor += p.AmountMinor
+		}
+	}
+	kept := e.Postings[:0]
+	for _, p := range e.Postings {
+		if p.AmountMinor != 0 {
+			kept = append(kept, p)
+		}
+	}
+	e.Postings = kept
+	return e
+}
@@ -0,0 +1,71 @@
+// Package merchant identifies the merchant, or tenant, a request acts for.
+// Payments, customers and ledger entries belong to exactly one merchant, and
+// the repositories only let a request see the data of its own.
+package merchant
+
+import (
+	"context"
+	"crypto/subtle"
+	"net/http"
+	"strings"
+
+	"github.com/eterrni/payments-api/pkg/middleware"
+	"github.com/eterrni/payments-api/pkg/problem"
+)
+
+type contextKey struct{}
+
+// NewContext returns a copy of ctx that acts for merchant id.
+func NewContext(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, contextKey{}, id)
+}
+
+// FromContext returns the merchant ctx acts for. ok is false for contexts
+// that act for no merchant in particular, such as background jobs and the
+// admin API; they see the data of every merchant.
+func FromContext(ctx context.Context) (id string, ok bool) {
+	id, ok = ctx.Value(contextKey{}).(string)
+	return id, ok
+}
+
+// Middleware resolves "Authorization: Bearer token" to the merchant the
+// token was issued to and runs the request on its behalf. tokens maps
+// merchant IDs to their tokens. Requests without a known token get 401.
+func Middleware(tokens map[string]string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			id, ok := lookup(tokens, strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer "))
+			if !ok {
+				problem.Respond(w, r, problem.Unauthorized, "")
+				return
+			}
+			next.ServeHTTP(w, r.WithContext(NewContext(r.Context(), id)))
+		})
+	}
+}
+
+// KeyMiddleware runs requests authenticated by middleware.APIKeyAuth on
+// behalf of the merchant their key was issued to.
+func KeyMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		key, ok := middleware.KeyFromContext(r.Context())
+		if !ok {
+			problem.Respond(w, r, problem.Unauthorized, "")
+			return
+		}
+		next.ServeHTTP(w, r.WithContext(NewContext(r.Context(), key.MerchantID)))
+	})
+}
+
+// lookup compares token with every known token, so that the time it takes
+// does not tell how close a guess was.
+func lookup(tokens map[string]string, token string) (string, bool) {
+	var found string
+	ok := false
+	for id, t := range tokens {
+		if subtle.ConstantTimeCompare([]byte(token), []byte(t)) == 1 {
+			found, ok = id, true
+		}
+	}
+	return found, ok && token != ""
+}
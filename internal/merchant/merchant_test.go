@@ -0,0 +1,94 @@
+package merchant
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/eterrni/payments-api/pkg/middleware"
+)
+
+func TestMiddleware(t *testing.T) {
+	tokens := map[string]string{"acme": "acme-secret", "globex": "globex-secret"}
+	var got string
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id, ok := FromContext(r.Context())
+		if !ok {
+			t.Error("request does not act for a merchant")
+		}
+		got = id
+	})
+
+	tests := []struct {
+		name   string
+		header string
+		want   int
+		id     string
+	}{
+		{"acme", "Bearer acme-secret", http.StatusOK, "acme"},
+		{"globex", "Bearer globex-secret", http.StatusOK, "globex"},
+		{"unknown token", "Bearer guess", http.StatusUnauthorized, ""},
+		{"empty token", "Bearer ", http.StatusUnauthorized, ""},
+		{"missing header", "", http.StatusUnauthorized, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got = ""
+			req := httptest.NewRequest(http.MethodGet, "/payments", nil)
+			if tt.header != "" {
+				req.Header.Set("Authorization", tt.header)
+			}
+			w := httptest.NewRecorder()
+
+			Middleware(tokens)(next).ServeHTTP(w, req)
+
+			if w.Code != tt.want {
+				t.Errorf("got status %d, want %d", w.Code, tt.want)
+			}
+			if got != tt.id {
+				t.Errorf("got merchant %q, want %q", got, tt.id)
+			}
+		})
+	}
+}
+
+func TestFromContext(t *testing.T) {
+	if _, ok := FromContext(context.Background()); ok {
+		t.Error("background context acts for a merchant")
+	}
+	if id, ok := FromContext(NewContext(context.Background(), "")); !ok || id != "" {
+		t.Errorf("got %q, %v, want the default merchant", id, ok)
+	}
+}
+
+type keys map[string]*middleware.Key
+
+func (k keys) VerifyKey(ctx context.Context, key string) (*middleware.Key, error) {
+	if found, ok := k[key]; ok {
+		return found, nil
+	}
+	return nil, middleware.ErrInvalidKey
+}
+
+func TestKeyMiddleware(t *testing.T) {
+	var got string
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got, _ = FromContext(r.Context())
+	})
+	auth := middleware.APIKeyAuth(keys{"pay_acme": {ID: 1, MerchantID: "acme"}})
+
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "/payments", nil)
+	req.Header.Set("Authorization", "Bearer pay_acme")
+	auth(KeyMiddleware(next)).ServeHTTP(w, req)
+	if w.Code != http.StatusOK || got != "acme" {
+		t.Errorf("got status %d, merchant %q, want %d, acme", w.Code, got, http.StatusOK)
+	}
+
+	w = httptest.NewRecorder()
+	KeyMiddleware(next).ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/payments", nil))
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("without a key: got status %d, want %d", w.Code, http.StatusUnauthorized)
+	}
+}
@@ -0,0 +1,14 @@
+// Package merchantid defines the format of merchant IDs. It has no
+// dependencies, unlike package merchant, so that the configuration can
+// check the IDs it is given.
+package merchantid
+
+import "regexp"
+
+var pattern = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]{0,63}$`)
+
+// Valid reports whether id is a well-formed merchant ID: up to 64 lowercase
+// letters, digits, _ and -, starting with a letter or digit.
+func Valid(id string) bool {
+	return pattern.MatchString(id)
+}
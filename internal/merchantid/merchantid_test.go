@@ -0,0 +1,26 @@
+package merchantid
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestValid(t *testing.T) {
+	tests := map[string]bool{
+		"acme":                  true,
+		"globex-2_eu":           true,
+		"0day":                  true,
+		strings.Repeat("a", 64): true,
+		strings.Repeat("a", 65): false,
+		"":                      false,
+		"Acme":                  false,
+		"-acme":                 false,
+		"acme corp":             false,
+		"acme:1":                false,
+	}
+	for id, want := range tests {
+		if got := Valid(id); got != want {
+			t.Errorf("Valid(%q) = %v, want %v", id, got, want)
+		}
+	}
+}
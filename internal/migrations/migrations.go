@@ -0,0 +1,373 @@
+// Package migrations applies the versioned SQL schema migrations embedded in
+// the binary. Each migration is a pair of files NNNN_name.up.sql and
+// NNNN_name.down.sql; applied versions are recorded in schema_migrations.
+// Every dialect has its own directory of migrations with the same versions.
+package migrations
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"fmt"
+	"io/fs"
+	"regexp"
+	"sort"
+	"strconv"
+	"time"
+)
+
+//go:embed postgres/*.sql sqlite/*.sql
+var files embed.FS
+
+// Dialects are named like the GORM dialects, so that callers can pass
+// db.Dialect().GetName().
+const (
+	Postgres = "postgres"
+	SQLite   = "sqlite3"
+)
+
+// lockID identifies the Postgres advisory lock held while migrating, so that
+// replicas started at the same time never migrate concurrently.
+const lockID int64 = 0x7061796d656e7473 // "payments"
+
+// dialect holds the statements that differ between databases.
+type dialect struct {
+	dir         string
+	lock        string
+	unlock      string
+	tableExists string
+	createTable string
+}
+
+var dialects = map[string]dialect{
+	Postgres: {
+		dir:         "postgres",
+		lock:        "SELECT pg_advisory_lock($1)",
+		unlock:      "SELECT pg_advisory_unlock($1)",
+		tableExists: "SELECT to_regclass('schema_migrations') IS NOT NULL",
+		createTable: `CREATE TABLE IF NOT EXISTS schema_migrations (
+			version integer PRIMARY KEY,
+			name text NOT NULL,
+			applied_at timestamp with time zone NOT NULL DEFAULT CURRENT_TIMESTAMP
+		)`,
+	},
+	// SQLite has no advisory locks; its database lock already serializes
+	// the migration transactions.
+	SQLite: {
+		dir:         "sqlite",
+		tableExists: "SELECT count(*) > 0 FROM sqlite_master WHERE type = 'table' AND name = 'schema_migrations'",
+		createTable: `CREATE TABLE IF NOT EXISTS schema_migrations (
+			version integer PRIMARY KEY,
+			name text NOT NULL,
+			applied_at timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP
+		)`,
+	},
+}
+
+type Migration struct {
+	Version int
+	Name    string
+	Up      string
+	Down    string
+}
+
+// Status describes one migration; AppliedAt is nil while it is pending.
+type Status struct {
+	Version   int
+	Name      string
+	AppliedAt *time.Time
+}
+
+var fileName = regexp.MustCompile(`^(\d+)_(\w+)\.(up|down)\.sql$`)
+
+// Load reads the migrations in the root of fsys, sorted by version. Every
+// version needs both an up and a down file.
+func Load(fsys fs.FS) ([]Migration, error) {
+	entries, err := fs.ReadDir(fsys, ".")
+	if err != nil {
+		return nil, err
+	}
+	byVersion := map[int]*Migration{}
+	for _, e := range entries {
+		m := fileName.FindStringSubmatch(e.Name())
+		if e.IsDir() || m == nil {
+			continue
+		}
+		version, _ := strconv.Atoi(m[1])
+		if version <= 0 {
+			return nil, fmt.Errorf("migration %s: version must be positive", e.Name())
+		}
+		body, err := fs.ReadFile(fsys, e.Name())
+		if err != nil {
+			return nil, err
+		}
+		mig := byVersion[version]
+		if mig == nil {
+			mig = &Migration{Version: version, Name: m[2]}
+			byVersion[version] = mig
+		} else if mig.Name != m[2] {
+			return nil, fmt.Errorf("migration %d has two names: %s and %s", version, mig.Name, m[2])
+		}
+		if m[3] == "up" {
+			mig.Up = string(body)
+		} else {
+			mig.Down = string(body)
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, mig := range byVersion {
+		if mig.Up == "" || mig.Down == "" {
+			return nil, fmt.Errorf("migration %d_%s needs both up and down files", mig.Version, mig.Name)
+		}
+		migrations = append(migrations, *mig)
+	}
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].Version < migrations[j].Version })
+	return migrations, nil
+}
+
+// Migrator applies migrations to a database.
+type Migrator struct {
+	db         *sql.DB
+	dialect    dialect
+	migrations []Migration
+}
+
+// New returns a Migrator for the migrations of dialect embedded in the
+// binary.
+func New(db *sql.DB, dialectName string) (*Migrator, error) {
+	d, ok := dialects[dialectName]
+	if !ok {
+		return nil, fmt.Errorf("no migrations for dialect %q", dialectName)
+	}
+	sub, err := fs.Sub(files, d.dir)
+	if err != nil {
+		return nil, err
+	}
+	migrations, err := Load(sub)
+	if err != nil {
+		return nil, err
+	}
+	return &Migrator{db: db, dialect: d, migrations: migrations}, nil
+}
+
+// Latest is the version of the newest known migration, 0 if there are none.
+func (m *Migrator) Latest() int {
+	if len(m.migrations) == 0 {
+		return 0
+	}
+	return m.migrations[len(m.migrations)-1].Version
+}
+
+// Up applies every pending migration.
+func (m *Migrator) Up(ctx context.Context) error {
+	return m.To(ctx, m.Latest())
+}
+
+// Down rolls back the most recently applied migration.
+func (m *Migrator) Down(ctx context.Context) error {
+	return m.withLock(ctx, func(conn *sql.Conn) error {
+		applied, err := appliedVersions(ctx, conn)
+		if err != nil {
+			return err
+		}
+		current := 0
+		for v := range applied {
+			if v > current {
+				current = v
+			}
+		}
+		if current == 0 {
+			return nil
+		}
+		target := 0
+		for v := range applied {
+			if v < current && v > target {
+				target = v
+			}
+		}
+		return m.migrate(ctx, conn, applied, target)
+	})
+}
+
+// To migrates up or down until exactly the migrations up to and including
+// version are applied. Version 0 rolls back everything.
+func (m *Migrator) To(ctx context.Context, version int) error {
+	if version != 0 && !contains(m.migrations, version) {
+		return fmt.Errorf("unknown migration version %d", version)
+	}
+	return m.withLock(ctx, func(conn *sql.Conn) error {
+		applied, err := appliedVersions(ctx, conn)
+		if err != nil {
+			return err
+		}
+		return m.migrate(ctx, conn, applied, version)
+	})
+}
+
+// Status lists every known migration with the time it was applied.
+func (m *Migrator) Status(ctx context.Context) ([]Status, error) {
+	conn, err := m.db.Conn(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	var exists bool
+	if err := conn.QueryRowContext(ctx, m.dialect.tableExists).Scan(&exists); err != nil {
+		return nil, err
+	}
+	applied := map[int]time.Time{}
+	if exists {
+		if applied, err = appliedVersions(ctx, conn); err != nil {
+			return nil, err
+		}
+	}
+
+	statuses := make([]Status, len(m.migrations))
+	for i, mig := range m.migrations {
+		statuses[i] = Status{Version: mig.Version, Name: mig.Name}
+		if at, ok := applied[mig.Version]; ok {
+			statuses[i].AppliedAt = &at
+		}
+	}
+	return statuses, nil
+}
+
+// Pending lists the known migrations that have not been applied yet.
+func (m *Migrator) Pending(ctx context.Context) ([]Status, error) {
+	statuses, err := m.Status(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var pending []Status
+	for _, s := range statuses {
+		if s.AppliedAt == nil {
+			pending = append(pending, s)
+		}
+	}
+	return pending, nil
+}
+
+type step struct {
+	Migration
+	up bool
+}
+
+// plan returns the steps that take a database with the applied versions to
+// target: rollbacks newest first, then pending migrations oldest first.
+func plan(migrations []Migration, applied map[int]time.Time, target int) ([]step, error) {
+	var steps []step
+	for i := len(migrations) - 1; i >= 0; i-- {
+		mig := migrations[i]
+		if _, ok := applied[mig.Version]; ok && mig.Version > target {
+			steps = append(steps, step{Migration: mig})
+		}
+	}
+	for v := range applied {
+		if v > target && !contains(migrations, v) {
+			return nil, fmt.Errorf("applied migration %d is unknown to this binary", v)
+		}
+	}
+	for _, mig := range migrations {
+		if _, ok := applied[mig.Version]; !ok && mig.Version <= target {
+			steps = append(steps, step{Migration: mig, up: true})
+		}
+	}
+	return steps, nil
+}
+
+func (m *Migrator) migrate(ctx context.Context, conn *sql.Conn, applied map[int]time.Time, target int) error {
+	steps, err := plan(m.migrations, applied, target)
+	if err != nil {
+		return err
+	}
+	for _, s := range steps {
+		if err := apply(ctx, conn, s); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// apply runs one step and records it in the same transaction, so a failed
+// migration leaves neither schema changes nor a schema_migrations row.
+func apply(ctx context.Context, conn *sql.Conn, s step) error {
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	query, record, args := s.Down, "DELETE FROM schema_migrations WHERE version = $1", []interface{}{s.Version}
+	if s.up {
+		query, record, args = s.Up, "INSERT INTO schema_migrations (version, name) VALUES ($1, $2)", []interface{}{s.Version, s.Name}
+	}
+	if _, err := tx.ExecContext(ctx, query); err != nil {
+		return fmt.Errorf("migration %s: %w", s.describe(), err)
+	}
+	if _, err := tx.ExecContext(ctx, record, args...); err != nil {
+		return fmt.Errorf("migration %s: %w", s.describe(), err)
+	}
+	return tx.Commit()
+}
+
+func (s step) describe() string {
+	direction := "down"
+	if s.up {
+		direction = "up"
+	}
+	return fmt.Sprintf("%04d_%s %s", s.Version, s.Name, direction)
+}
+
+// withLock runs fn on a single connection holding the migration advisory
+// lock, if the dialect has one, creating schema_migrations first if needed.
+func (m *Migrator) withLock(ctx context.Context, fn func(*sql.Conn) error) error {
+	conn, err := m.db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	if m.dialect.lock != "" {
+		if _, err := conn.ExecContext(ctx, m.dialect.lock, lockID); err != nil {
+			return fmt.Errorf("acquire migration lock: %w", err)
+		}
+		defer conn.ExecContext(context.Background(), m.dialect.unlock, lockID)
+	}
+
+	if _, err := conn.ExecContext(ctx, m.dialect.createTable); err != nil {
+		return err
+	}
+	return fn(conn)
+}
+
+func appliedVersions(ctx context.Context, conn *sql.Conn) (map[int]time.Time, error) {
+	rows, err := conn.QueryContext(ctx, "SELECT version, applied_at FROM schema_migrations")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	applied := map[int]time.Time{}
+	for rows.Next() {
+		var (
+			version int
+			at      time.Time
+		)
+		if err := rows.Scan(&version, &at); err != nil {
+			return nil, err
+		}
+		applied[version] = at
+	}
+	return applied, rows.Err()
+}
+
+func contains(migrations []Migration, version int) bool {
+	for _, mig := range migrations {
+		if mig.Version == version {
+			return true
+		}
+	}
+	return false
+}
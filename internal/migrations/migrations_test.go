@@ -0,0 +1,260 @@
+package migrations
+
+import (
+	"context"
+	"database/sql"
+	"maps"
+	"path/filepath"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+func TestLoad(t *testing.T) {
+	t.Run("sorted pairs", func(t *testing.T) {
+		fsys := fstest.MapFS{
+			"0002_add_status.up.sql":   {Data: []byte("ALTER 2")},
+			"0002_add_status.down.sql": {Data: []byte("REVERT 2")},
+			"0001_init.up.sql":         {Data: []byte("CREATE 1")},
+			"0001_init.down.sql":       {Data: []byte("DROP 1")},
+			"README.md":                {Data: []byte("ignored")},
+		}
+
+		migrations, err := Load(fsys)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if len(migrations) != 2 {
+			t.Fatalf("got %d migrations, want 2", len(migrations))
+		}
+		first := migrations[0]
+		if first.Version != 1 || first.Name != "init" || first.Up != "CREATE 1" || first.Down != "DROP 1" {
+			t.Errorf("got %+v", first)
+		}
+		if migrations[1].Version != 2 {
+			t.Errorf("got version %d, want 2", migrations[1].Version)
+		}
+	})
+
+	t.Run("missing down", func(t *testing.T) {
+		fsys := fstest.MapFS{"0001_init.up.sql": {Data: []byte("CREATE")}}
+
+		if _, err := Load(fsys); err == nil {
+			t.Fatal("expected error for migration without down file")
+		}
+	})
+
+	t.Run("conflicting names", func(t *testing.T) {
+		fsys := fstest.MapFS{
+			"0001_init.up.sql":    {Data: []byte("CREATE")},
+			"0001_other.down.sql": {Data: []byte("DROP")},
+		}
+
+		if _, err := Load(fsys); err == nil {
+			t.Fatal("expected error for version with two names")
+		}
+	})
+}
+
+func TestEmbeddedMigrations(t *testing.T) {
+	pg, err := New(nil, Postgres)
+	if err != nil {
+		t.Fatalf("load postgres migrations: %v", err)
+	}
+	for i, mig := range pg.migrations {
+		if mig.Version != i+1 {
+			t.Errorf("migration %s has version %d, want %d", mig.Name, mig.Version, i+1)
+		}
+	}
+	if pg.Latest() != len(pg.migrations) {
+		t.Errorf("got latest %d, want %d", pg.Latest(), len(pg.migrations))
+	}
+
+	lite, err := New(nil, SQLite)
+	if err != nil {
+		t.Fatalf("load sqlite migrations: %v", err)
+	}
+	if len(lite.migrations) != len(pg.migrations) {
+		t.Fatalf("got %d sqlite migrations, want %d like postgres", len(lite.migrations), len(pg.migrations))
+	}
+	for i, mig := range lite.migrations {
+		if want := pg.migrations[i]; mig.Version != want.Version || mig.Name != want.Name {
+			t.Errorf("sqlite migration %04d_%s, want %04d_%s", mig.Version, mig.Name, want.Version, want.Name)
+		}
+	}
+
+	if _, err := New(nil, "mysql"); err == nil {
+		t.Error("expected error for unknown dialect")
+	}
+}
+
+func TestMigrateSQLite(t *testing.T) {
+	db, err := sql.Open("sqlite3", filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	m, err := New(db, SQLite)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+
+	pending, err := m.Pending(ctx)
+	if err != nil {
+		t.Fatalf("pending on empty database: %v", err)
+	}
+	if len(pending) != m.Latest() {
+		t.Errorf("got %d pending migrations, want %d", len(pending), m.Latest())
+	}
+
+	if err := m.Up(ctx); err != nil {
+		t.Fatalf("up: %v", err)
+	}
+	if pending, err = m.Pending(ctx); err != nil || len(pending) != 0 {
+		t.Errorf("got %d pending migrations and error %v after up", len(pending), err)
+	}
+	if _, err := db.Exec("INSERT INTO payments (amount_minor, currency) VALUES (100, 'USD')"); err != nil {
+		t.Errorf("schema is not usable: %v", err)
+	}
+
+	if err := m.To(ctx, 0); err != nil {
+		t.Fatalf("down to zero: %v", err)
+	}
+	statuses, err := m.Status(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, s := range statuses {
+		if s.AppliedAt != nil {
+			t.Errorf("migration %d still applied after rollback", s.Version)
+		}
+	}
+	if err := m.Up(ctx); err != nil {
+		t.Errorf("up after rollback: %v", err)
+	}
+}
+
+// TestMigrateSQLite_Ledger checks that the ledger migration posts entries for
+// existing payments that balance, and that entries cannot be changed.
+func TestMigrateSQLite_Ledger(t *testing.T) {
+	db, err := sql.Open("sqlite3", filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	m, err := New(db, SQLite)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	if err := m.To(ctx, 5); err != nil {
+		t.Fatalf("up to 5: %v", err)
+	}
+	for _, stmt := range []string{
+		"INSERT INTO payments (id, amount_minor, currency, status, captured_minor) VALUES (1, 1000, 'USD', 'partially_refunded', 1000)",
+		"INSERT INTO refunds (payment_id, amount_minor, currency) VALUES (1, 400, 'USD')",
+		"INSERT INTO payments (id, amount_minor, currency, status) VALUES (2, 500, 'USD', 'canceled')",
+		"INSERT INTO payments (id, amount_minor, currency) VALUES (3, 700, 'EUR')",
+	} {
+		if _, err := db.Exec(stmt); err != nil {
+			t.Fatalf("%s: %v", stmt, err)
+		}
+	}
+	if err := m.Up(ctx); err != nil {
+		t.Fatalf("up: %v", err)
+	}
+
+	rows, err := db.Query("SELECT account, currency, SUM(amount_minor) FROM ledger_postings GROUP BY account, currency ORDER BY account, currency")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+	got := map[string]int64{}
+	for rows.Next() {
+		var account, code string
+		var sum int64
+		if err := rows.Scan(&account, &code, &sum); err != nil {
+			t.Fatal(err)
+		}
+		got[account+" "+code] = sum
+	}
+	want := map[string]int64{
+		"cash USD":             600,
+		"merchant_payable USD": -600,
+		"merchant_pending EUR": -700,
+		"merchant_pending USD": 0,
+		"receivable EUR":       700,
+		"receivable USD":       0,
+	}
+	if !maps.Equal(got, want) {
+		t.Errorf("got balances %v, want %v", got, want)
+	}
+
+	var unbalanced int
+	err = db.QueryRow("SELECT COUNT(*) FROM (SELECT entry_id FROM ledger_postings GROUP BY entry_id, currency HAVING SUM(amount_minor) <> 0)").Scan(&unbalanced)
+	if err != nil || unbalanced != 0 {
+		t.Errorf("got %d unbalanced entries and error %v", unbalanced, err)
+	}
+
+	if _, err := db.Exec("UPDATE ledger_postings SET amount_minor = 0"); err == nil {
+		t.Error("postings can be updated")
+	}
+	if _, err := db.Exec("DELETE FROM ledger_entries"); err == nil {
+		t.Error("entries can be deleted")
+	}
+}
+
+func TestPlan(t *testing.T) {
+	migrations := []Migration{{Version: 1, Name: "a"}, {Version: 2, Name: "b"}, {Version: 3, Name: "c"}}
+	now := time.Now()
+
+	tests := []struct {
+		name    string
+		applied []int
+		target  int
+		want    []string
+	}{
+		{"fresh database", nil, 3, []string{"0001_a up", "0002_b up", "0003_c up"}},
+		{"up to date", []int{1, 2, 3}, 3, nil},
+		{"partial up", []int{1}, 2, []string{"0002_b up"}},
+		{"down to version", []int{1, 2, 3}, 1, []string{"0003_c down", "0002_b down"}},
+		{"down to zero", []int{1, 2}, 0, []string{"0002_b down", "0001_a down"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			applied := map[int]time.Time{}
+			for _, v := range tt.applied {
+				applied[v] = now
+			}
+
+			steps, err := plan(migrations, applied, tt.target)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			var got []string
+			for _, s := range steps {
+				got = append(got, s.describe())
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("got %v, want %v", got, tt.want)
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Errorf("step %d: got %q, want %q", i, got[i], tt.want[i])
+				}
+			}
+		})
+	}
+
+	t.Run("unknown applied version", func(t *testing.T) {
+		applied := map[int]time.Time{1: now, 4: now}
+
+		if _, err := plan(migrations, applied, 1); err == nil {
+			t.Fatal("expected error when rolling back a migration this binary does not know")
+		}
+	})
+}
@@ -0,0 +1,70 @@
+-- Creates the schema, adopting tables previously created by GORM's
+-- AutoMigrate: every statement is a no-op when the object already exists.
+
+CREATE TABLE IF NOT EXISTS payments (
+    id serial PRIMARY KEY
+);
+ALTER TABLE payments ADD COLUMN IF NOT EXISTS amount_minor bigint;
+ALTER TABLE payments ADD COLUMN IF NOT EXISTS currency text;
+ALTER TABLE payments ADD COLUMN IF NOT EXISTS status text NOT NULL DEFAULT 'pending';
+ALTER TABLE payments ADD COLUMN IF NOT EXISTS refunded_minor bigint NOT NULL DEFAULT 0;
+ALTER TABLE payments ADD COLUMN IF NOT EXISTS created_at timestamp with time zone NOT NULL DEFAULT CURRENT_TIMESTAMP;
+ALTER TABLE payments ADD COLUMN IF NOT EXISTS updated_at timestamp with time zone NOT NULL DEFAULT CURRENT_TIMESTAMP;
+ALTER TABLE payments ADD COLUMN IF NOT EXISTS canceled_at timestamp with time zone;
+ALTER TABLE payments ADD COLUMN IF NOT EXISTS canceled_by text;
+ALTER TABLE payments ADD COLUMN IF NOT EXISTS deleted_at timestamp with time zone;
+ALTER TABLE payments ADD COLUMN IF NOT EXISTS deleted_by text;
+CREATE INDEX IF NOT EXISTS idx_payments_created_at ON payments (created_at);
+CREATE INDEX IF NOT EXISTS idx_payments_deleted_at ON payments (deleted_at);
+
+-- Rows written before amounts were stored in minor units only have the
+-- legacy decimal amount column.
+DO $$
+BEGIN
+    IF EXISTS (
+        SELECT 1 FROM information_schema.columns
+        WHERE table_schema = current_schema() AND table_name = 'payments' AND column_name = 'amount'
+    ) THEN
+        UPDATE payments SET amount_minor = ROUND(amount * CASE
+            WHEN currency IN ('BIF', 'CLP', 'DJF', 'GNF', 'ISK', 'JPY', 'KMF', 'KRW', 'PYG', 'RWF', 'UGX', 'VND', 'VUV', 'XAF', 'XOF', 'XPF') THEN 1
+            WHEN currency IN ('BHD', 'IQD', 'JOD', 'KWD', 'LYD', 'OMR', 'TND') THEN 1000
+            ELSE 100
+        END)
+        WHERE amount_minor IS NULL;
+    END IF;
+END
+$$;
+
+CREATE TABLE IF NOT EXISTS payment_transitions (
+    id serial PRIMARY KEY,
+    payment_id integer,
+    from_status text,
+    to_status text,
+    reason text,
+    actor text,
+    created_at timestamp with time zone
+);
+CREATE INDEX IF NOT EXISTS idx_payment_transitions_payment_id ON payment_transitions (payment_id);
+
+CREATE TABLE IF NOT EXISTS refunds (
+    id serial PRIMARY KEY,
+    payment_id integer NOT NULL,
+    amount_minor bigint NOT NULL,
+    currency text NOT NULL,
+    reason text,
+    created_by text,
+    created_at timestamp with time zone
+);
+CREATE INDEX IF NOT EXISTS idx_refunds_payment_id ON refunds (payment_id);
+
+CREATE TABLE IF NOT EXISTS idempotency_keys (
+    idempotency_key text PRIMARY KEY,
+    fingerprint text NOT NULL,
+    completed boolean NOT NULL,
+    status_code integer,
+    header text,
+    body bytea,
+    created_at timestamp with time zone,
+    expires_at timestamp with time zone
+);
+CREATE INDEX IF NOT EXISTS idx_idempotency_keys_expires_at ON idempotency_keys (expires_at);
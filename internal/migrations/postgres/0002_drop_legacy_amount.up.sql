@@ -0,0 +1,3 @@
+-- The decimal amount column was replaced by amount_minor and backfilled by
+-- the previous migration.
+ALTER TABLE payments DROP COLUMN IF EXISTS amount;
@@ -0,0 +1,2 @@
+-- version is incremented on every write and checked by conditional updates.
+ALTER TABLE payments ADD COLUMN IF NOT EXISTS version bigint NOT NULL DEFAULT 1;
@@ -0,0 +1,2 @@
+ALTER TABLE payments DROP COLUMN IF EXISTS metadata;
+ALTER TABLE payments DROP COLUMN IF EXISTS description;
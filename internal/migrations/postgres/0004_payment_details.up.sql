@@ -0,0 +1,3 @@
+-- Client-editable details of a payment; metadata is a JSON object of strings.
+ALTER TABLE payments ADD COLUMN IF NOT EXISTS description text NOT NULL DEFAULT '';
+ALTER TABLE payments ADD COLUMN IF NOT EXISTS metadata jsonb NOT NULL DEFAULT '{}';
@@ -0,0 +1,4 @@
+DROP INDEX IF EXISTS idx_payments_authorization_expires_at;
+ALTER TABLE payments DROP COLUMN IF EXISTS authorization_expires_at;
+ALTER TABLE payments DROP COLUMN IF EXISTS captured_minor;
+ALTER TABLE payments DROP COLUMN IF EXISTS authorized_minor;
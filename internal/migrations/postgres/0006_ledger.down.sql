@@ -0,0 +1,4 @@
+DROP TABLE IF EXISTS ledger_postings;
+DROP TABLE IF EXISTS ledger_entries;
+DROP FUNCTION IF EXISTS ledger_immutable();
+ALTER TABLE payments DROP COLUMN IF EXISTS fee_minor;
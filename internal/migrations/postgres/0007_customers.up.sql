@@ -0,0 +1,17 @@
+CREATE TABLE IF NOT EXISTS customers (
+    id serial PRIMARY KEY,
+    external_ref text NOT NULL DEFAULT '',
+    name text NOT NULL DEFAULT '',
+    email text NOT NULL DEFAULT '',
+    metadata jsonb NOT NULL DEFAULT '{}',
+    created_at timestamp with time zone NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at timestamp with time zone NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    deleted_at timestamp with time zone
+);
+CREATE INDEX IF NOT EXISTS idx_customers_deleted_at ON customers (deleted_at);
+-- External references identify live customers; deleted ones may be reused.
+CREATE UNIQUE INDEX IF NOT EXISTS idx_customers_external_ref ON customers (external_ref)
+    WHERE deleted_at IS NULL AND external_ref <> '';
+
+ALTER TABLE payments ADD COLUMN IF NOT EXISTS customer_id integer REFERENCES customers (id);
+CREATE INDEX IF NOT EXISTS idx_payments_customer_id ON payments (customer_id);
@@ -0,0 +1,11 @@
+DROP INDEX IF EXISTS idx_ledger_entries_merchant_id;
+ALTER TABLE ledger_entries DROP COLUMN IF EXISTS merchant_id;
+
+DROP INDEX IF EXISTS idx_customers_merchant_external_ref;
+DROP INDEX IF EXISTS idx_customers_merchant_id;
+ALTER TABLE customers DROP COLUMN IF EXISTS merchant_id;
+CREATE UNIQUE INDEX IF NOT EXISTS idx_customers_external_ref ON customers (external_ref)
+    WHERE deleted_at IS NULL AND external_ref <> '';
+
+DROP INDEX IF EXISTS idx_payments_merchant_id;
+ALTER TABLE payments DROP COLUMN IF EXISTS merchant_id;
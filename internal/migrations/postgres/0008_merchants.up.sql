@@ -0,0 +1,14 @@
+-- Every payment, customer and ledger entry belongs to a merchant. Rows
+-- written before merchants existed belong to the default merchant ''.
+ALTER TABLE payments ADD COLUMN IF NOT EXISTS merchant_id text NOT NULL DEFAULT '';
+CREATE INDEX IF NOT EXISTS idx_payments_merchant_id ON payments (merchant_id);
+
+ALTER TABLE customers ADD COLUMN IF NOT EXISTS merchant_id text NOT NULL DEFAULT '';
+CREATE INDEX IF NOT EXISTS idx_customers_merchant_id ON customers (merchant_id);
+-- External references are only unique within a merchant.
+DROP INDEX IF EXISTS idx_customers_external_ref;
+CREATE UNIQUE INDEX IF NOT EXISTS idx_customers_merchant_external_ref ON customers (merchant_id, external_ref)
+    WHERE deleted_at IS NULL AND external_ref <> '';
+
+ALTER TABLE ledger_entries ADD COLUMN IF NOT EXISTS merchant_id text NOT NULL DEFAULT '';
+CREATE INDEX IF NOT EXISTS idx_ledger_entries_merchant_id ON ledger_entries (merchant_id);
@@ -0,0 +1,16 @@
+CREATE TABLE IF NOT EXISTS api_keys (
+    id serial PRIMARY KEY,
+    merchant_id text NOT NULL DEFAULT '',
+    name text NOT NULL DEFAULT '',
+    prefix text NOT NULL,
+    secret_hash text NOT NULL,
+    scopes text NOT NULL DEFAULT '',
+    expires_at timestamp with time zone,
+    last_used_at timestamp with time zone,
+    revoked_at timestamp with time zone,
+    created_at timestamp with time zone NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at timestamp with time zone NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+-- Keys are looked up by their public prefix on every request.
+CREATE UNIQUE INDEX IF NOT EXISTS idx_api_keys_prefix ON api_keys (prefix);
+CREATE INDEX IF NOT EXISTS idx_api_keys_merchant_id ON api_keys (merchant_id);
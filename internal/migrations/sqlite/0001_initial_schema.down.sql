@@ -0,0 +1,4 @@
+DROP TABLE IF EXISTS idempotency_keys;
+DROP TABLE IF EXISTS refunds;
+DROP TABLE IF EXISTS payment_transitions;
+DROP TABLE IF EXISTS payments;
@@ -0,0 +1,49 @@
+CREATE TABLE payments (
+    id integer PRIMARY KEY AUTOINCREMENT,
+    amount_minor bigint,
+    currency text,
+    status text NOT NULL DEFAULT 'pending',
+    refunded_minor bigint NOT NULL DEFAULT 0,
+    created_at timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    canceled_at timestamp,
+    canceled_by text,
+    deleted_at timestamp,
+    deleted_by text
+);
+CREATE INDEX idx_payments_created_at ON payments (created_at);
+CREATE INDEX idx_payments_deleted_at ON payments (deleted_at);
+
+CREATE TABLE payment_transitions (
+    id integer PRIMARY KEY AUTOINCREMENT,
+    payment_id integer,
+    from_status text,
+    to_status text,
+    reason text,
+    actor text,
+    created_at timestamp
+);
+CREATE INDEX idx_payment_transitions_payment_id ON payment_transitions (payment_id);
+
+CREATE TABLE refunds (
+    id integer PRIMARY KEY AUTOINCREMENT,
+    payment_id integer NOT NULL,
+    amount_minor bigint NOT NULL,
+    currency text NOT NULL,
+    reason text,
+    created_by text,
+    created_at timestamp
+);
+CREATE INDEX idx_refunds_payment_id ON refunds (payment_id);
+
+CREATE TABLE idempotency_keys (
+    idempotency_key text PRIMARY KEY,
+    fingerprint text NOT NULL,
+    completed boolean NOT NULL,
+    status_code integer,
+    header text,
+    body blob,
+    created_at timestamp,
+    expires_at timestamp
+);
+CREATE INDEX idx_idempotency_keys_expires_at ON idempotency_keys (expires_at);
@@ -0,0 +1,2 @@
+-- See the up migration.
+SELECT 1;
@@ -0,0 +1,3 @@
+-- SQLite databases never had the legacy decimal amount column. The
+-- migration only keeps the versions in line with the Postgres ones.
+SELECT 1;
@@ -0,0 +1,2 @@
+ALTER TABLE payments DROP COLUMN metadata;
+ALTER TABLE payments DROP COLUMN description;
@@ -0,0 +1,3 @@
+-- Client-editable details of a payment; metadata is a JSON object of strings.
+ALTER TABLE payments ADD COLUMN description text NOT NULL DEFAULT '';
+ALTER TABLE payments ADD COLUMN metadata text NOT NULL DEFAULT '{}';
@@ -0,0 +1,4 @@
+DROP INDEX idx_payments_authorization_expires_at;
+ALTER TABLE payments DROP COLUMN authorization_expires_at;
+ALTER TABLE payments DROP COLUMN captured_minor;
+ALTER TABLE payments DROP COLUMN authorized_minor;
@@ -0,0 +1,12 @@
+-- Authorized and captured amounts are tracked separately so that a payment
+-- can be captured for less than was authorized.
+ALTER TABLE payments ADD COLUMN authorized_minor bigint NOT NULL DEFAULT 0;
+ALTER TABLE payments ADD COLUMN captured_minor bigint NOT NULL DEFAULT 0;
+ALTER TABLE payments ADD COLUMN authorization_expires_at timestamp;
+CREATE INDEX idx_payments_authorization_expires_at ON payments (authorization_expires_at);
+
+-- Earlier payments were always authorized and captured in full.
+UPDATE payments SET authorized_minor = amount_minor
+WHERE status IN ('authorized', 'captured', 'settled', 'partially_refunded', 'refunded');
+UPDATE payments SET captured_minor = amount_minor
+WHERE status IN ('captured', 'settled', 'partially_refunded', 'refunded');
@@ -0,0 +1,3 @@
+DROP TABLE ledger_postings;
+DROP TABLE ledger_entries;
+ALTER TABLE payments DROP COLUMN fee_minor;
@@ -0,0 +1,80 @@
+-- Double-entry ledger: every entry's postings sum to zero per currency,
+-- debits being positive and credits negative.
+ALTER TABLE payments ADD COLUMN fee_minor bigint NOT NULL DEFAULT 0;
+
+CREATE TABLE ledger_entries (
+    id integer PRIMARY KEY AUTOINCREMENT,
+    kind text NOT NULL,
+    payment_id integer NOT NULL,
+    refund_id integer,
+    created_at timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+CREATE INDEX idx_ledger_entries_payment_id ON ledger_entries (payment_id);
+
+CREATE TABLE ledger_postings (
+    id integer PRIMARY KEY AUTOINCREMENT,
+    entry_id integer NOT NULL REFERENCES ledger_entries (id),
+    account text NOT NULL,
+    amount_minor bigint NOT NULL,
+    currency text NOT NULL
+);
+CREATE INDEX idx_ledger_postings_entry_id ON ledger_postings (entry_id);
+CREATE INDEX idx_ledger_postings_account ON ledger_postings (account);
+
+-- Entries are immutable; corrections are posted as new entries.
+CREATE TRIGGER ledger_entries_no_update BEFORE UPDATE ON ledger_entries
+BEGIN
+    SELECT RAISE(ABORT, 'ledger_entries is append-only');
+END;
+CREATE TRIGGER ledger_entries_no_delete BEFORE DELETE ON ledger_entries
+BEGIN
+    SELECT RAISE(ABORT, 'ledger_entries is append-only');
+END;
+CREATE TRIGGER ledger_postings_no_update BEFORE UPDATE ON ledger_postings
+BEGIN
+    SELECT RAISE(ABORT, 'ledger_postings is append-only');
+END;
+CREATE TRIGGER ledger_postings_no_delete BEFORE DELETE ON ledger_postings
+BEGIN
+    SELECT RAISE(ABORT, 'ledger_postings is append-only');
+END;
+
+-- Post the entries that existing payments and refunds would have posted.
+-- Fees were not charged before.
+INSERT INTO ledger_entries (kind, payment_id, created_at)
+SELECT 'payment_created', id, created_at FROM payments ORDER BY id;
+INSERT INTO ledger_entries (kind, payment_id, created_at)
+SELECT 'payment_captured', id, updated_at FROM payments
+WHERE status IN ('captured', 'settled', 'partially_refunded', 'refunded') ORDER BY id;
+INSERT INTO ledger_entries (kind, payment_id, created_at)
+SELECT 'payment_released', id, updated_at FROM payments
+WHERE status IN ('canceled', 'failed', 'expired') ORDER BY id;
+INSERT INTO ledger_entries (kind, payment_id, refund_id, created_at)
+SELECT 'refund', payment_id, id, COALESCE(created_at, CURRENT_TIMESTAMP) FROM refunds ORDER BY id;
+
+INSERT INTO ledger_postings (entry_id, account, amount_minor, currency)
+SELECT e.id, 'receivable', p.amount_minor, p.currency
+FROM ledger_entries e JOIN payments p ON p.id = e.payment_id WHERE e.kind = 'payment_created';
+INSERT INTO ledger_postings (entry_id, account, amount_minor, currency)
+SELECT e.id, 'merchant_pending', -p.amount_minor, p.currency
+FROM ledger_entries e JOIN payments p ON p.id = e.payment_id WHERE e.kind = 'payment_created';
+
+INSERT INTO ledger_postings (entry_id, account, amount_minor, currency)
+SELECT e.id, 'receivable', -p.amount_minor, p.currency
+FROM ledger_entries e JOIN payments p ON p.id = e.payment_id WHERE e.kind IN ('payment_captured', 'payment_released');
+INSERT INTO ledger_postings (entry_id, account, amount_minor, currency)
+SELECT e.id, 'merchant_pending', p.amount_minor, p.currency
+FROM ledger_entries e JOIN payments p ON p.id = e.payment_id WHERE e.kind IN ('payment_captured', 'payment_released');
+INSERT INTO ledger_postings (entry_id, account, amount_minor, currency)
+SELECT e.id, 'cash', p.captured_minor, p.currency
+FROM ledger_entries e JOIN payments p ON p.id = e.payment_id WHERE e.kind = 'payment_captured';
+INSERT INTO ledger_postings (entry_id, account, amount_minor, currency)
+SELECT e.id, 'merchant_payable', -p.captured_minor, p.currency
+FROM ledger_entries e JOIN payments p ON p.id = e.payment_id WHERE e.kind = 'payment_captured';
+
+INSERT INTO ledger_postings (entry_id, account, amount_minor, currency)
+SELECT e.id, 'merchant_payable', r.amount_minor, r.currency
+FROM ledger_entries e JOIN refunds r ON r.id = e.refund_id WHERE e.kind = 'refund';
+INSERT INTO ledger_postings (entry_id, account, amount_minor, currency)
+SELECT e.id, 'cash', -r.amount_minor, r.currency
+FROM ledger_entries e JOIN refunds r ON r.id = e.refund_id WHERE e.kind = 'refund';
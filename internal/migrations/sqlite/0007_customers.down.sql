@@ -0,0 +1,3 @@
+DROP INDEX idx_payments_customer_id;
+ALTER TABLE payments DROP COLUMN customer_id;
+DROP TABLE customers;
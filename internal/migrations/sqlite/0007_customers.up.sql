@@ -0,0 +1,17 @@
+CREATE TABLE customers (
+    id integer PRIMARY KEY AUTOINCREMENT,
+    external_ref text NOT NULL DEFAULT '',
+    name text NOT NULL DEFAULT '',
+    email text NOT NULL DEFAULT '',
+    metadata text NOT NULL DEFAULT '{}',
+    created_at timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    deleted_at timestamp
+);
+CREATE INDEX idx_customers_deleted_at ON customers (deleted_at);
+-- External references identify live customers; deleted ones may be reused.
+CREATE UNIQUE INDEX idx_customers_external_ref ON customers (external_ref)
+    WHERE deleted_at IS NULL AND external_ref <> '';
+
+ALTER TABLE payments ADD COLUMN customer_id integer REFERENCES customers (id);
+CREATE INDEX idx_payments_customer_id ON payments (customer_id);
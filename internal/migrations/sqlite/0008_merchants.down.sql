@@ -0,0 +1,11 @@
+DROP INDEX idx_ledger_entries_merchant_id;
+ALTER TABLE ledger_entries DROP COLUMN merchant_id;
+
+DROP INDEX idx_customers_merchant_external_ref;
+DROP INDEX idx_customers_merchant_id;
+ALTER TABLE customers DROP COLUMN merchant_id;
+CREATE UNIQUE INDEX idx_customers_external_ref ON customers (external_ref)
+    WHERE deleted_at IS NULL AND external_ref <> '';
+
+DROP INDEX idx_payments_merchant_id;
+ALTER TABLE payments DROP COLUMN merchant_id;
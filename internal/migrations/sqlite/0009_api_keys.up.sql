@@ -0,0 +1,16 @@
+CREATE TABLE api_keys (
+    id integer PRIMARY KEY AUTOINCREMENT,
+    merchant_id text NOT NULL DEFAULT '',
+    name text NOT NULL DEFAULT '',
+    prefix text NOT NULL,
+    secret_hash text NOT NULL,
+    scopes text NOT NULL DEFAULT '',
+    expires_at timestamp,
+    last_used_at timestamp,
+    revoked_at timestamp,
+    created_at timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+-- Keys are looked up by their public prefix on every request.
+CREATE UNIQUE INDEX idx_api_keys_prefix ON api_keys (prefix);
+CREATE INDEX idx_api_keys_merchant_id ON api_keys (merchant_id);
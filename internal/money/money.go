@@ -0,0 +1,93 @@
+package money
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+	"strings"
+
+	"github.com/eterrni/payments-api/internal/currency"
+)
+
+var (
+	ErrUnknownCurrency  = errors.New("unknown currency")
+	ErrTooManyDecimals  = errors.New("too many decimal places for currency")
+	ErrInvalidAmount    = errors.New("invalid amount")
+	ErrAmountOutOfRange = errors.New("amount out of range")
+)
+
+// Money is an amount expressed in the minor units of its currency,
+// e.g. {Amount: 10050, Currency: "USD"} is 100.50 USD.
+type Money struct {
+	Amount   int64
+	Currency string
+}
+
+func New(amount int64, code string) (Money, error) {
+	if _, err := Exponent(code); err != nil {
+		return Money{}, err
+	}
+	return Money{Amount: amount, Currency: code}, nil
+}
+
+// Exponent returns the ISO 4217 minor unit exponent of currency: 0 for JPY,
+// 2 for USD, 3 for KWD. Withdrawn currencies are still known here so that
+// historical amounts can be rendered.
+func Exponent(code string) (int, error) {
+	c, ok := currency.Lookup(code)
+	if !ok {
+		return 0, fmt.Errorf("%w: %q", ErrUnknownCurrency, code)
+	}
+	return c.Exponent, nil
+}
+
+// Parse converts a decimal amount in major units ("100.50") into Money.
+// Amounts with more decimal places than the currency allows are rejected
+// instead of being rounded.
+func Parse(amount, code string) (Money, error) {
+	exp, err := Exponent(code)
+	if err != nil {
+		return Money{}, err
+	}
+
+	r, ok := new(big.Rat).SetString(strings.TrimSpace(amount))
+	if !ok {
+		return Money{}, fmt.Errorf("%w: %q", ErrInvalidAmount, amount)
+	}
+	r.Mul(r, new(big.Rat).SetInt(new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(exp)), nil)))
+	if !r.IsInt() {
+		return Money{}, fmt.Errorf("%w: %s allows %d", ErrTooManyDecimals, code, exp)
+	}
+	n := r.Num()
+	if !n.IsInt64() {
+		return Money{}, fmt.Errorf("%w: %q", ErrAmountOutOfRange, amount)
+	}
+	return Money{Amount: n.Int64(), Currency: code}, nil
+}
+
+func (m Money) IsPositive() bool {
+	return m.Amount > 0
+}
+
+// Decimal formats the amount in major units with exactly as many decimal
+// places as the currency exponent, e.g. "100.50" for USD or "1500" for JPY.
+func (m Money) Decimal() string {
+	exp, err := Exponent(m.Currency)
+	if err != nil || exp == 0 {
+		return fmt.Sprintf("%d", m.Amount)
+	}
+
+	sign := ""
+	abs := uint64(m.Amount)
+	if m.Amount < 0 {
+		sign = "-"
+		abs = uint64(-(m.Amount + 1)) + 1
+	}
+	unit := uint64(math.Pow10(exp))
+	return fmt.Sprintf("%s%d.%0*d", sign, abs/unit, exp, abs%unit)
+}
+
+func (m Money) String() string {
+	return m.Decimal() + " " + m.Currency
+}
@@ -0,0 +1,74 @@
+package money
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		amount   string
+		currency string
+		want     int64
+		wantErr  error
+	}{
+		{"100.50", "USD", 10050, nil},
+		{"100.5", "USD", 10050, nil},
+		{"0.1", "USD", 10, nil},
+		{"1500", "JPY", 1500, nil},
+		{"1.234", "KWD", 1234, nil},
+		{"-2.5", "EUR", -250, nil},
+		{"1e2", "USD", 10000, nil},
+		{"100.505", "USD", 0, ErrTooManyDecimals},
+		{"1.5", "JPY", 0, ErrTooManyDecimals},
+		{"1.2345", "KWD", 0, ErrTooManyDecimals},
+		{"abc", "USD", 0, ErrInvalidAmount},
+		{"", "USD", 0, ErrInvalidAmount},
+		{"10", "XYZ", 0, ErrUnknownCurrency},
+		{"100000000000000000000", "USD", 0, ErrAmountOutOfRange},
+	}
+	for _, tt := range tests {
+		t.Run(tt.amount+" "+tt.currency, func(t *testing.T) {
+			got, err := Parse(tt.amount, tt.currency)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("got error %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got.Amount != tt.want || got.Currency != tt.currency {
+				t.Errorf("got %+v, want %d %s", got, tt.want, tt.currency)
+			}
+		})
+	}
+}
+
+func TestMoney_Decimal(t *testing.T) {
+	tests := []struct {
+		money Money
+		want  string
+	}{
+		{Money{Amount: 10050, Currency: "USD"}, "100.50"},
+		{Money{Amount: 5, Currency: "USD"}, "0.05"},
+		{Money{Amount: -250, Currency: "EUR"}, "-2.50"},
+		{Money{Amount: 1500, Currency: "JPY"}, "1500"},
+		{Money{Amount: 1234, Currency: "KWD"}, "1.234"},
+	}
+	for _, tt := range tests {
+		if got := tt.money.Decimal(); got != tt.want {
+			t.Errorf("%+v: got %q, want %q", tt.money, got, tt.want)
+		}
+	}
+}
+
+func TestNew(t *testing.T) {
+	if _, err := New(100, "USD"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := New(100, "usd"); !errors.Is(err, ErrUnknownCurrency) {
+		t.Errorf("got error %v, want %v", err, ErrUnknownCurrency)
+	}
+}
@@ -0,0 +1,183 @@
+package repository
+
+import (
+	"context"
+	"database/sql/driver"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/jinzhu/gorm"
+)
+
+// APIKey authenticates requests on behalf of a merchant. Prefix is the
+// public part of the key; of the secret only a hash is stored.
+type APIKey struct {
+	ID         uint       `json:"id" gorm:"primary_key"`
+	MerchantID string     `json:"merchant_id,omitempty" gorm:"not null;index"`
+	Name       string     `json:"name,omitempty" gorm:"not null"`
+	Prefix     string     `json:"prefix" gorm:"not null;unique_index"`
+	SecretHash string     `json:"-" gorm:"not null"`
+	Scopes     Scopes     `json:"scopes" gorm:"not null"`
+	ExpiresAt  *time.Time `json:"expires_at,omitempty"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+	RevokedAt  *time.Time `json:"revoked_at,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+	UpdatedAt  time.Time  `json:"updated_at"`
+}
+
+func (APIKey) TableName() string {
+	return "api_keys"
+}
+
+// Active reports whether the key may be used at t: it is neither revoked
+// nor expired.
+func (k *APIKey) Active(t time.Time) bool {
+	return k.RevokedAt == nil && (k.ExpiresAt == nil || t.Before(*k.ExpiresAt))
+}
+
+// Scopes are stored as a comma-separated list.
+type Scopes []string
+
+func (s Scopes) Value() (driver.Value, error) {
+	return strings.Join(s, ","), nil
+}
+
+func (s *Scopes) Scan(src interface{}) error {
+	var v string
+	switch src := src.(type) {
+	case nil:
+	case []byte:
+		v = string(src)
+	case string:
+		v = src
+	default:
+		return fmt.Errorf("cannot scan %T into Scopes", src)
+	}
+	*s = nil
+	if v != "" {
+		*s = strings.Split(v, ",")
+	}
+	return nil
+}
+
+// APIKeyFilter selects keys for List, ordered by ID. Zero fields do not
+// filter.
+type APIKeyFilter struct {
+	MerchantID string
+}
+
+// APIKeyRepository stores API keys. Except for GetByPrefix and Touch, which
+// authenticate requests before their merchant is known, it only sees the
+// keys of the merchant the context acts for.
+type APIKeyRepository interface {
+	// Create stores key and fills in its generated fields. A key with the
+	// same prefix is reported as ErrConflict.
+	Create(ctx context.Context, key *APIKey) error
+	GetByID(ctx context.Context, id uint) (*APIKey, error)
+	GetByPrefix(ctx context.Context, prefix string) (*APIKey, error)
+	List(ctx context.Context, filter APIKeyFilter) ([]APIKey, error)
+	// Update locks the key, lets apply change it and stores the result.
+	// Nothing is written if apply returns an error.
+	Update(ctx context.Context, id uint, apply func(k *APIKey) error) (*APIKey, error)
+	// Rotate locks the key and lets apply change it and fill in the key
+	// that replaces it, then stores both in one transaction. The
+	// replacement belongs to the merchant of the key.
+	Rotate(ctx context.Context, id uint, apply func(k, replacement *APIKey) error) (*APIKey, error)
+	// Touch records that the key was used at t.
+	Touch(ctx context.Context, id uint, t time.Time) error
+}
+
+type apiKeyRepository struct {
+	conn *Conn
+}
+
+func NewAPIKeyRepository(conn *Conn) APIKeyRepository {
+	return &apiKeyRepository{conn: conn}
+}
+
+func (r *apiKeyRepository) Create(ctx context.Context, key *APIKey) error {
+	key.MerchantID = Owner(ctx, key.MerchantID)
+	return Translate(r.conn.Run(ctx, func(db *gorm.DB) error {
+		return db.Create(key).Error
+	}))
+}
+
+func (r *apiKeyRepository) GetByID(ctx context.Context, id uint) (*APIKey, error) {
+	var key APIKey
+	err := r.conn.Run(ctx, func(db *gorm.DB) error {
+		return scoped(ctx, db).First(&key, id).Error
+	})
+	if err != nil {
+		return nil, Translate(err)
+	}
+	return &key, nil
+}
+
+func (r *apiKeyRepository) GetByPrefix(ctx context.Context, prefix string) (*APIKey, error) {
+	var key APIKey
+	err := r.conn.Run(ctx, func(db *gorm.DB) error {
+		return db.Where("prefix = ?", prefix).First(&key).Error
+	})
+	if err != nil {
+		return nil, Translate(err)
+	}
+	return &key, nil
+}
+
+func (r *apiKeyRepository) List(ctx context.Context, filter APIKeyFilter) ([]APIKey, error) {
+	var keys []APIKey
+	err := r.conn.Run(ctx, func(db *gorm.DB) error {
+		q := scoped(ctx, db).Order("id")
+		if filter.MerchantID != "" {
+			q = q.Where("merchant_id = ?", filter.MerchantID)
+		}
+		return q.Find(&keys).Error
+	})
+	return keys, Translate(err)
+}
+
+func (r *apiKeyRepository) Update(ctx context.Context, id uint, apply func(k *APIKey) error) (*APIKey, error) {
+	var key APIKey
+	err := r.conn.Transaction(ctx, func(tx *gorm.DB) error {
+		if err := forUpdate(scoped(ctx, tx)).First(&key, id).Error; err != nil {
+			return err
+		}
+		if err := apply(&key); err != nil {
+			return err
+		}
+		return tx.Save(&key).Error
+	})
+	if err != nil {
+		return nil, Translate(err)
+	}
+	return &key, nil
+}
+
+func (r *apiKeyRepository) Rotate(ctx context.Context, id uint, apply func(k, replacement *APIKey) error) (*APIKey, error) {
+	var replacement APIKey
+	err := r.conn.Transaction(ctx, func(tx *gorm.DB) error {
+		var key APIKey
+		if err := forUpdate(scoped(ctx, tx)).First(&key, id).Error; err != nil {
+			return err
+		}
+		if err := apply(&key, &replacement); err != nil {
+			return err
+		}
+		replacement.MerchantID = key.MerchantID
+		if err := tx.Save(&key).Error; err != nil {
+			return err
+		}
+		return tx.Create(&replacement).Error
+	})
+	if err != nil {
+		return nil, Translate(err)
+	}
+	return &replacement, nil
+}
+
+func (r *apiKeyRepository) Touch(ctx context.Context, id uint, t time.Time) error {
+	return Translate(r.conn.Run(ctx, func(db *gorm.DB) error {
+		return db.Model(&APIKey{}).Where("id = ?", id).UpdateColumn("last_used_at", t).Error
+	}))
+}
@@ -0,0 +1,117 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jinzhu/gorm"
+)
+
+// Conn runs GORM operations on behalf of a request. GORM v1 does not take a
+// context, so every operation gets a handle whose queries are bound to the
+// caller's context: canceling it aborts the running query and returns the
+// connection to the pool. Each operation is limited to Timeout on top of
+// the caller's own deadline.
+type Conn struct {
+	dialect string
+	db      *sql.DB
+	timeout time.Duration
+}
+
+// NewConn wraps db. A zero timeout leaves operations limited by the
+// caller's context only.
+func NewConn(db *gorm.DB, timeout time.Duration) *Conn {
+	return &Conn{dialect: db.Dialect().GetName(), db: db.DB(), timeout: timeout}
+}
+
+// Run calls fn with a handle bound to ctx.
+func (c *Conn) Run(ctx context.Context, fn func(db *gorm.DB) error) error {
+	ctx, cancel := c.withTimeout(ctx)
+	defer cancel()
+	return contextError(ctx, fn(c.open(ctxDB{ctx: ctx, db: c.db})))
+}
+
+// Transaction calls fn with a handle on a transaction bound to ctx. The
+// transaction is committed if fn returns nil and rolled back otherwise.
+func (c *Conn) Transaction(ctx context.Context, fn func(tx *gorm.DB) error) error {
+	ctx, cancel := c.withTimeout(ctx)
+	defer cancel()
+	tx, err := c.db.BeginTx(ctx, nil)
+	if err != nil {
+		return contextError(ctx, err)
+	}
+	defer tx.Rollback()
+
+	if err := fn(c.open(ctxTx{ctx: ctx, tx: tx})); err != nil {
+		return contextError(ctx, err)
+	}
+	return contextError(ctx, tx.Commit())
+}
+
+func (c *Conn) withTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	if c.timeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, c.timeout)
+}
+
+func (c *Conn) open(common gorm.SQLCommon) *gorm.DB {
+	// Open only fails for sources other than a SQLCommon.
+	db, _ := gorm.Open(c.dialect, common)
+	return db
+}
+
+// contextError reports a failure after ctx ended as the context's error,
+// whatever the driver turned the cancellation into, so that callers can
+// tell it apart from database failures.
+func contextError(ctx context.Context, err error) error {
+	if err == nil || ctx.Err() == nil || errors.Is(err, ctx.Err()) {
+		return err
+	}
+	return fmt.Errorf("%w: %w", ctx.Err(), err)
+}
+
+type ctxDB struct {
+	ctx context.Context
+	db  *sql.DB
+}
+
+func (c ctxDB) Exec(query string, args ...interface{}) (sql.Result, error) {
+	return c.db.ExecContext(c.ctx, query, args...)
+}
+
+func (c ctxDB) Prepare(query string) (*sql.Stmt, error) {
+	return c.db.PrepareContext(c.ctx, query)
+}
+
+func (c ctxDB) Query(query string, args ...interface{}) (*sql.Rows, error) {
+	return c.db.QueryContext(c.ctx, query, args...)
+}
+
+func (c ctxDB) QueryRow(query string, args ...interface{}) *sql.Row {
+	return c.db.QueryRowContext(c.ctx, query, args...)
+}
+
+type ctxTx struct {
+	ctx context.Context
+	tx  *sql.Tx
+}
+
+func (c ctxTx) Exec(query string, args ...interface{}) (sql.Result, error) {
+	return c.tx.ExecContext(c.ctx, query, args...)
+}
+
+func (c ctxTx) Prepare(query string) (*sql.Stmt, error) {
+	return c.tx.PrepareContext(c.ctx, query)
+}
+
+func (c ctxTx) Query(query string, args ...interface{}) (*sql.Rows, error) {
+	return c.tx.QueryContext(c.ctx, query, args...)
+}
+
+func (c ctxTx) QueryRow(query string, args ...interface{}) *sql.Row {
+	return c.tx.QueryRowContext(c.ctx, query, args...)
+}
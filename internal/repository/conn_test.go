@@ -0,0 +1,82 @@
+package repository_test
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/eterrni/payments-api/internal/repository"
+	"github.com/jinzhu/gorm"
+)
+
+// slowQuery counts to a billion, which takes SQLite far longer than any test
+// may run unless it is interrupted.
+const slowQuery = `WITH RECURSIVE c(x) AS (SELECT 1 UNION ALL SELECT x + 1 FROM c WHERE x < 1000000000)
+	SELECT count(*) FROM c`
+
+func TestConn(t *testing.T) {
+	db, err := gorm.Open("sqlite3", filepath.Join(t.TempDir(), "conn.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	runSlow := func(ctx context.Context, conn *repository.Conn) (time.Duration, error) {
+		start := time.Now()
+		err := conn.Run(ctx, func(db *gorm.DB) error {
+			var n int64
+			return db.Raw(slowQuery).Row().Scan(&n)
+		})
+		return time.Since(start), err
+	}
+
+	t.Run("canceled context aborts the query", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		time.AfterFunc(50*time.Millisecond, cancel)
+
+		took, err := runSlow(ctx, repository.NewConn(db, 0))
+		if !errors.Is(err, context.Canceled) {
+			t.Errorf("got error %v, want context.Canceled", err)
+		}
+		if took > 5*time.Second {
+			t.Errorf("query ran for %s after cancel", took)
+		}
+	})
+
+	t.Run("operation timeout", func(t *testing.T) {
+		took, err := runSlow(context.Background(), repository.NewConn(db, 50*time.Millisecond))
+		if !errors.Is(err, context.DeadlineExceeded) {
+			t.Errorf("got error %v, want context.DeadlineExceeded", err)
+		}
+		if took > 5*time.Second {
+			t.Errorf("query ran for %s past the timeout", took)
+		}
+	})
+
+	t.Run("canceled transaction rolls back", func(t *testing.T) {
+		if err := db.Exec("CREATE TABLE t (x integer)").Error; err != nil {
+			t.Fatal(err)
+		}
+		ctx, cancel := context.WithCancel(context.Background())
+		err := repository.NewConn(db, 0).Transaction(ctx, func(tx *gorm.DB) error {
+			if err := tx.Exec("INSERT INTO t VALUES (1)").Error; err != nil {
+				return err
+			}
+			cancel()
+			return tx.Exec("INSERT INTO t VALUES (2)").Error
+		})
+		if !errors.Is(err, context.Canceled) {
+			t.Errorf("got error %v, want context.Canceled", err)
+		}
+		var n int
+		if err := db.Raw("SELECT count(*) FROM t").Row().Scan(&n); err != nil || n != 0 {
+			t.Errorf("got %d rows and error %v, want the insert rolled back", n, err)
+		}
+	})
+
+	if inUse := db.DB().Stats().InUse; inUse != 0 {
+		t.Errorf("%d connections still in use", inUse)
+	}
+}
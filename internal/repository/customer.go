@@ -0,0 +1,134 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/jinzhu/gorm"
+)
+
+// Customer is a payer. ExternalRef is the client's own identifier for the
+// customer and is unique among the merchant's customers that are not
+// deleted.
+type Customer struct {
+	ID          uint      `json:"id" gorm:"primary_key"`
+	MerchantID  string    `json:"merchant_id,omitempty" gorm:"not null;index"`
+	ExternalRef string    `json:"external_ref,omitempty" gorm:"not null"`
+	Name        string    `json:"name,omitempty" gorm:"not null"`
+	Email       string    `json:"email,omitempty" gorm:"not null"`
+	Metadata    Metadata  `json:"metadata,omitempty" gorm:"not null"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+	// DeletedAt soft-deletes the customer, so that its payments keep
+	// referring to it.
+	DeletedAt *time.Time `json:"-" gorm:"index"`
+}
+
+// CustomerFilter selects customers for List, ordered by ID. Zero fields do
+// not filter.
+type CustomerFilter struct {
+	ExternalRef string
+	AfterID     uint
+	Limit       int
+}
+
+// CustomerRepository stores customers. Like PaymentRepository, it only sees
+// the customers of the merchant the context acts for.
+type CustomerRepository interface {
+	// Create stores customer and fills in its generated fields. A customer
+	// with the same ExternalRef is reported as ErrConflict.
+	Create(ctx context.Context, customer *Customer) error
+	GetByID(ctx context.Context, id uint) (*Customer, error)
+	List(ctx context.Context, filter CustomerFilter) ([]Customer, error)
+	// Update locks the customer, lets apply change it and stores the
+	// result, zero fields included. Nothing is written if apply returns an
+	// error.
+	Update(ctx context.Context, id uint, apply func(c *Customer) error) (*Customer, error)
+	// Delete soft-deletes the customer. New payments cannot refer to it.
+	Delete(ctx context.Context, id uint) error
+}
+
+type customerRepository struct {
+	conn *Conn
+}
+
+func NewCustomerRepository(conn *Conn) CustomerRepository {
+	return &customerRepository{conn: conn}
+}
+
+func (r *customerRepository) Create(ctx context.Context, customer *Customer) error {
+	customer.MerchantID = Owner(ctx, customer.MerchantID)
+	return Translate(r.conn.Run(ctx, func(db *gorm.DB) error {
+		return db.Create(customer).Error
+	}))
+}
+
+func (r *customerRepository) GetByID(ctx context.Context, id uint) (*Customer, error) {
+	var customer Customer
+	err := r.conn.Run(ctx, func(db *gorm.DB) error {
+		return scoped(ctx, db).First(&customer, id).Error
+	})
+	if err != nil {
+		return nil, Translate(err)
+	}
+	return &customer, nil
+}
+
+func (r *customerRepository) List(ctx context.Context, filter CustomerFilter) ([]Customer, error) {
+	var customers []Customer
+	err := r.conn.Run(ctx, func(db *gorm.DB) error {
+		q := scoped(ctx, db).Order("id")
+		if filter.ExternalRef != "" {
+			q = q.Where("external_ref = ?", filter.ExternalRef)
+		}
+		if filter.AfterID != 0 {
+			q = q.Where("id > ?", filter.AfterID)
+		}
+		if filter.Limit > 0 {
+			q = q.Limit(filter.Limit)
+		}
+		return q.Find(&customers).Error
+	})
+	return customers, Translate(err)
+}
+
+func (r *customerRepository) Update(ctx context.Context, id uint, apply func(c *Customer) error) (*Customer, error) {
+	var customer Customer
+	err := r.conn.Transaction(ctx, func(tx *gorm.DB) error {
+		if err := forUpdate(scoped(ctx, tx)).First(&customer, id).Error; err != nil {
+			return err
+		}
+		if err := apply(&customer); err != nil {
+			return err
+		}
+		return tx.Save(&customer).Error
+	})
+	if err != nil {
+		return nil, Translate(err)
+	}
+	return &customer, nil
+}
+
+func (r *customerRepository) Delete(ctx context.Context, id uint) error {
+	return Translate(r.conn.Transaction(ctx, func(tx *gorm.DB) error {
+		var customer Customer
+		if err := forUpdate(scoped(ctx, tx)).First(&customer, id).Error; err != nil {
+			return err
+		}
+		return tx.Delete(&customer).Error
+	}))
+}
+
+// checkCustomer locks the customer a new payment refers to, so that it
+// cannot be deleted before the payment is stored. The customer must belong
+// to the merchant of the payment.
+func checkCustomer(tx *gorm.DB, p *Payment) error {
+	if p.CustomerID == nil {
+		return nil
+	}
+	err := forUpdate(tx).Where("merchant_id = ?", p.MerchantID).First(&Customer{}, *p.CustomerID).Error
+	if gorm.IsRecordNotFoundError(err) {
+		return ErrCustomerNotFound
+	}
+	return err
+}
@@ -0,0 +1,82 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+
+	"github.com/jinzhu/gorm"
+	"github.com/lib/pq"
+	"github.com/mattn/go-sqlite3"
+)
+
+var (
+	ErrNotFound    = errors.New("record not found")
+	ErrConflict    = errors.New("conflicting record")
+	ErrUnavailable = errors.New("database unavailable")
+	// ErrVersionMismatch is returned by conditional writes when the record
+	// has been changed since the caller read it.
+	ErrVersionMismatch = errors.New("version mismatch")
+	// ErrCustomerNotFound is returned when a new payment refers to a
+	// customer that does not exist or has been deleted.
+	ErrCustomerNotFound = errors.New("customer not found")
+)
+
+// Translate maps driver and GORM errors onto the repository errors so that
+// callers do not depend on the database in use. Other errors, including
+// those returned by apply callbacks and context errors, are passed through
+// unchanged.
+func Translate(err error) error {
+	switch {
+	case err == nil:
+		return nil
+	case errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded):
+		return err
+	case gorm.IsRecordNotFoundError(err):
+		return ErrNotFound
+	case isUniqueViolation(err):
+		return fmt.Errorf("%w: %w", ErrConflict, err)
+	case isUnavailable(err):
+		return fmt.Errorf("%w: %w", ErrUnavailable, err)
+	}
+	return err
+}
+
+func isUniqueViolation(err error) bool {
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) {
+		return pqErr.Code == "23505"
+	}
+	var liteErr sqlite3.Error
+	return errors.As(err, &liteErr) &&
+		(liteErr.ExtendedCode == sqlite3.ErrConstraintUnique || liteErr.ExtendedCode == sqlite3.ErrConstraintPrimaryKey)
+}
+
+func isUnavailable(err error) bool {
+	if errors.Is(err, driver.ErrBadConn) || errors.Is(err, sql.ErrConnDone) ||
+		errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+		return true
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) {
+		return true
+	}
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) {
+		// Class 08 is connection exceptions, 53 insufficient resources and
+		// 57P0x the server shutting down or starting up.
+		code := string(pqErr.Code)
+		return strings.HasPrefix(code, "08") || strings.HasPrefix(code, "53") || strings.HasPrefix(code, "57P0")
+	}
+	// A database still locked after the busy timeout is as good as down.
+	var liteErr sqlite3.Error
+	if errors.As(err, &liteErr) {
+		return liteErr.Code == sqlite3.ErrBusy || liteErr.Code == sqlite3.ErrLocked || liteErr.Code == sqlite3.ErrCantOpen
+	}
+	return false
+}
@@ -0,0 +1,141 @@
+package repository
+
+import (
+	"context"
+
+	"github.com/eterrni/payments-api/internal/ledger"
+	"github.com/eterrni/payments-api/internal/merchant"
+	"github.com/eterrni/payments-api/internal/money"
+	"github.com/jinzhu/gorm"
+)
+
+// EntryFilter selects entries for ListEntries. Zero fields do not filter.
+type EntryFilter struct {
+	PaymentID uint
+	// Account selects the entries that post to it.
+	Account string
+	// AfterID skips the entries up to and including it.
+	AfterID uint
+	Limit   int
+}
+
+// LedgerRepository reads the ledger. Entries are only ever written by the
+// other repositories, together with the change they account for, and
+// belong to the merchant of their payment. Both methods only see the
+// entries of the merchant the context acts for.
+type LedgerRepository interface {
+	// Balances sums the postings per account and currency, ordered by
+	// both; only those of account unless it is empty. Accounts without
+	// postings are left out.
+	Balances(ctx context.Context, account string) ([]ledger.Balance, error)
+	// ListEntries returns entries with their postings, oldest first.
+	ListEntries(ctx context.Context, filter EntryFilter) ([]ledger.Entry, error)
+}
+
+// PaymentEntries returns the entries that account for a payment changing
+// from before to after, or for creating after if before is nil. They
+// belong to the merchant of the payment.
+func PaymentEntries(before, after *Payment) []ledger.Entry {
+	entries := paymentEntries(before, after)
+	for i := range entries {
+		entries[i].MerchantID = after.MerchantID
+	}
+	return entries
+}
+
+func paymentEntries(before, after *Payment) []ledger.Entry {
+	if before == nil {
+		return []ledger.Entry{ledger.PaymentCreated(after.ID, after.Money())}
+	}
+
+	var entries []ledger.Entry
+	switch {
+	case !before.open():
+	case after.open():
+		if before.Money() != after.Money() {
+			entries = append(entries, ledger.PaymentAmended(after.ID, before.Money(), after.Money()))
+		}
+	case after.CapturedMinor > 0:
+		entries = append(entries, ledger.PaymentCaptured(after.ID, before.Money(), after.CapturedMinor))
+	default:
+		entries = append(entries, ledger.PaymentReleased(after.ID, before.Money()))
+	}
+	if fee := after.FeeMinor - before.FeeMinor; fee > 0 {
+		entries = append(entries, ledger.Fee(after.ID, money.Money{Amount: fee, Currency: after.Currency}))
+	}
+	return entries
+}
+
+// RefundEntry returns the entry that accounts for refund of payment.
+func RefundEntry(payment *Payment, refund *Refund) ledger.Entry {
+	e := ledger.Refund(payment.ID, refund.ID, refund.Money())
+	e.MerchantID = payment.MerchantID
+	return e
+}
+
+// open reports whether the payment may still be captured or released.
+func (p *Payment) open() bool {
+	return p.Status == StatusPending || p.Status == StatusAuthorized
+}
+
+// post writes entries in tx. An entry that does not balance is a bug in the
+// posting rules and fails the transaction.
+func post(tx *gorm.DB, entries ...ledger.Entry) error {
+	for _, e := range entries {
+		if err := e.Validate(); err != nil {
+			return err
+		}
+		if err := tx.Create(&e).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+type ledgerRepository struct {
+	conn *Conn
+}
+
+func NewLedgerRepository(conn *Conn) LedgerRepository {
+	return &ledgerRepository{conn: conn}
+}
+
+func (r *ledgerRepository) Balances(ctx context.Context, account string) ([]ledger.Balance, error) {
+	var balances []ledger.Balance
+	err := r.conn.Run(ctx, func(db *gorm.DB) error {
+		q := db.Table(ledger.Posting{}.TableName()).Select(
+			"account, currency, " +
+				"SUM(CASE WHEN amount_minor > 0 THEN amount_minor ELSE 0 END) AS debit_minor, " +
+				"SUM(CASE WHEN amount_minor < 0 THEN -amount_minor ELSE 0 END) AS credit_minor")
+		if account != "" {
+			q = q.Where("account = ?", account)
+		}
+		if id, ok := merchant.FromContext(ctx); ok {
+			q = q.Where("entry_id IN (SELECT id FROM ledger_entries WHERE merchant_id = ?)", id)
+		}
+		return q.Group("account, currency").Order("account").Order("currency").Scan(&balances).Error
+	})
+	return balances, Translate(err)
+}
+
+func (r *ledgerRepository) ListEntries(ctx context.Context, filter EntryFilter) ([]ledger.Entry, error) {
+	var entries []ledger.Entry
+	err := r.conn.Run(ctx, func(db *gorm.DB) error {
+		q := scoped(ctx, db).Preload("Postings", func(db *gorm.DB) *gorm.DB { return db.Order("id") })
+		if filter.PaymentID != 0 {
+			q = q.Where("payment_id = ?", filter.PaymentID)
+		}
+		if filter.Account != "" {
+			q = q.Where("id IN (SELECT entry_id FROM ledger_postings WHERE account = ?)", filter.Account)
+		}
+		if filter.AfterID != 0 {
+			q = q.Where("id > ?", filter.AfterID)
+		}
+		q = q.Order("id")
+		if filter.Limit > 0 {
+			q = q.Limit(filter.Limit)
+		}
+		return q.Find(&entries).Error
+	})
+	return entries, Translate(err)
+}
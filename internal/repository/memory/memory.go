@@ -0,0 +1,776 @@
+// Package memory implements the repositories in memory. It follows the
+// semantics of the GORM implementation, including soft deletion, merchant
+// scoping and the per-payment locking of transitions and refunds, and is
+// meant for tests and local development.
+package memory
+
+import (
+	"context"
+	"maps"
+	"slices"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/eterrni/payments-api/internal/ledger"
+	"github.com/eterrni/payments-api/internal/merchant"
+	"github.com/eterrni/payments-api/internal/repository"
+)
+
+// Store holds the data shared by the repositories it returns. It is safe
+// for concurrent use.
+type Store struct {
+	mu           sync.Mutex
+	payments     map[uint]repository.Payment
+	customers    map[uint]repository.Customer
+	apiKeys      map[uint]repository.APIKey
+	transitions  []repository.PaymentTransition
+	refunds      []repository.Refund
+	entries      []ledger.Entry
+	lastID       uint
+	lastTransID  uint
+	lastRefundID uint
+	lastEntryID  uint
+	lastCustID   uint
+	lastKeyID    uint
+}
+
+func NewStore() *Store {
+	return &Store{
+		payments:  map[uint]repository.Payment{},
+		customers: map[uint]repository.Customer{},
+		apiKeys:   map[uint]repository.APIKey{},
+	}
+}
+
+func (s *Store) Payments() repository.PaymentRepository {
+	return &paymentRepository{s}
+}
+
+func (s *Store) Refunds() repository.RefundRepository {
+	return &refundRepository{s}
+}
+
+func (s *Store) Ledger() repository.LedgerRepository {
+	return &ledgerRepository{s}
+}
+
+func (s *Store) Customers() repository.CustomerRepository {
+	return &customerRepository{s}
+}
+
+func (s *Store) APIKeys() repository.APIKeyRepository {
+	return &apiKeyRepository{s}
+}
+
+// now matches the microsecond precision of Postgres timestamps.
+func now() time.Time {
+	return time.Now().Truncate(time.Microsecond)
+}
+
+type paymentRepository struct {
+	s *Store
+}
+
+func (r *paymentRepository) CreatePayment(ctx context.Context, payment *repository.Payment) error {
+	s := r.s
+	if err := s.lock(ctx); err != nil {
+		return err
+	}
+	defer s.mu.Unlock()
+
+	payment.MerchantID = repository.Owner(ctx, payment.MerchantID)
+	if id := payment.CustomerID; id != nil {
+		if c, ok := s.customers[*id]; !ok || c.DeletedAt != nil || c.MerchantID != payment.MerchantID {
+			return repository.ErrCustomerNotFound
+		}
+	}
+	s.lastID++
+	payment.ID = s.lastID
+	t := now()
+	if payment.CreatedAt.IsZero() {
+		payment.CreatedAt = t
+	}
+	payment.UpdatedAt = t
+	if payment.Status == "" {
+		payment.Status = repository.StatusPending
+	}
+	if payment.Version == 0 {
+		payment.Version = 1
+	}
+	if err := s.post(repository.PaymentEntries(nil, payment)...); err != nil {
+		return err
+	}
+	s.put(*payment)
+	return nil
+}
+
+func (r *paymentRepository) GetByID(ctx context.Context, id uint) (*repository.Payment, error) {
+	s := r.s
+	if err := s.lock(ctx); err != nil {
+		return nil, err
+	}
+	defer s.mu.Unlock()
+
+	p, ok := s.live(ctx, id)
+	if !ok {
+		return nil, repository.ErrNotFound
+	}
+	return &p, nil
+}
+
+func (r *paymentRepository) List(ctx context.Context, filter repository.PaymentFilter) ([]repository.Payment, error) {
+	s := r.s
+	if err := s.lock(ctx); err != nil {
+		return nil, err
+	}
+	var payments []repository.Payment
+	for _, p := range s.payments {
+		if p.DeletedAt == nil && visible(ctx, p.MerchantID) && matches(p, filter) {
+			payments = append(payments, clone(p))
+		}
+	}
+	s.mu.Unlock()
+
+	less := func(a, b repository.Payment) bool {
+		if filter.Sort == repository.SortAmount && a.AmountMinor != b.AmountMinor {
+			return a.AmountMinor < b.AmountMinor
+		}
+		if filter.Sort != repository.SortAmount && !a.CreatedAt.Equal(b.CreatedAt) {
+			return a.CreatedAt.Before(b.CreatedAt)
+		}
+		return a.ID < b.ID
+	}
+	sort.Slice(payments, func(i, j int) bool {
+		if filter.Desc {
+			return less(payments[j], payments[i])
+		}
+		return less(payments[i], payments[j])
+	})
+
+	if c := filter.After; c != nil {
+		after := repository.Payment{ID: c.ID, CreatedAt: c.CreatedAt, AmountMinor: c.AmountMinor}
+		i := sort.Search(len(payments), func(i int) bool {
+			if filter.Desc {
+				return less(payments[i], after)
+			}
+			return less(after, payments[i])
+		})
+		payments = payments[i:]
+	}
+	if filter.Limit > 0 && len(payments) > filter.Limit {
+		payments = payments[:filter.Limit]
+	}
+	return payments, nil
+}
+
+func matches(p repository.Payment, f repository.PaymentFilter) bool {
+	switch {
+	case f.Currency != "" && p.Currency != f.Currency,
+		f.Status != "" && p.Status != f.Status,
+		f.CustomerID != 0 && (p.CustomerID == nil || *p.CustomerID != f.CustomerID),
+		f.MinAmount != nil && p.AmountMinor < *f.MinAmount,
+		f.MaxAmount != nil && p.AmountMinor > *f.MaxAmount,
+		f.CreatedFrom != nil && p.CreatedAt.Before(*f.CreatedFrom),
+		f.CreatedTo != nil && !p.CreatedAt.Before(*f.CreatedTo),
+		f.AuthorizationExpiredBy != nil && (p.AuthorizationExpiresAt == nil || p.AuthorizationExpiresAt.After(*f.AuthorizationExpiredBy)):
+		return false
+	}
+	return true
+}
+
+func (r *paymentRepository) Update(ctx context.Context, id uint, version int64, apply func(p *repository.Payment) error) (*repository.Payment, error) {
+	s := r.s
+	if err := s.lock(ctx); err != nil {
+		return nil, err
+	}
+	defer s.mu.Unlock()
+
+	p, ok := s.live(ctx, id)
+	if !ok {
+		return nil, repository.ErrNotFound
+	}
+	if version != 0 && p.Version != version {
+		return nil, repository.ErrVersionMismatch
+	}
+	before := clone(p)
+	if err := apply(&p); err != nil {
+		return nil, err
+	}
+	if err := s.post(repository.PaymentEntries(&before, &p)...); err != nil {
+		return nil, err
+	}
+	p.Version++
+	p.UpdatedAt = now()
+	s.put(p)
+	return &p, nil
+}
+
+func (r *paymentRepository) Transition(ctx context.Context, id uint, reason, actor string, apply func(p *repository.Payment) error) (*repository.Payment, error) {
+	s := r.s
+	if err := s.lock(ctx); err != nil {
+		return nil, err
+	}
+	defer s.mu.Unlock()
+
+	p, ok := s.live(ctx, id)
+	if !ok {
+		return nil, repository.ErrNotFound
+	}
+	before := clone(p)
+	if err := apply(&p); err != nil {
+		return nil, err
+	}
+	if err := s.post(repository.PaymentEntries(&before, &p)...); err != nil {
+		return nil, err
+	}
+	p.Version++
+	p.UpdatedAt = now()
+	s.put(p)
+	s.addTransition(id, before.Status, p.Status, reason, actor)
+	return &p, nil
+}
+
+func (r *paymentRepository) ListTransitions(ctx context.Context, paymentID uint) ([]repository.PaymentTransition, error) {
+	s := r.s
+	if err := s.lock(ctx); err != nil {
+		return nil, err
+	}
+	defer s.mu.Unlock()
+
+	if p, ok := s.payments[paymentID]; ok && !visible(ctx, p.MerchantID) {
+		return nil, nil
+	}
+	var transitions []repository.PaymentTransition
+	for _, t := range s.transitions {
+		if t.PaymentID == paymentID {
+			transitions = append(transitions, t)
+		}
+	}
+	return transitions, nil
+}
+
+func (r *paymentRepository) Purge(ctx context.Context, id uint) error {
+	s := r.s
+	if err := s.lock(ctx); err != nil {
+		return err
+	}
+	defer s.mu.Unlock()
+
+	p, ok := s.payments[id]
+	if !ok || p.DeletedAt == nil || !visible(ctx, p.MerchantID) {
+		return repository.ErrNotFound
+	}
+	delete(s.payments, id)
+
+	transitions := s.transitions[:0]
+	for _, t := range s.transitions {
+		if t.PaymentID != id {
+			transitions = append(transitions, t)
+		}
+	}
+	s.transitions = transitions
+	refunds := s.refunds[:0]
+	for _, rf := range s.refunds {
+		if rf.PaymentID != id {
+			refunds = append(refunds, rf)
+		}
+	}
+	s.refunds = refunds
+	return nil
+}
+
+type refundRepository struct {
+	s *Store
+}
+
+func (r *refundRepository) Create(ctx context.Context, paymentID uint, apply func(p *repository.Payment, refund *repository.Refund) error) (*repository.Refund, *repository.Payment, error) {
+	s := r.s
+	if err := s.lock(ctx); err != nil {
+		return nil, nil, err
+	}
+	defer s.mu.Unlock()
+
+	p, ok := s.live(ctx, paymentID)
+	if !ok {
+		return nil, nil, repository.ErrNotFound
+	}
+	from := p.Status
+	refund := repository.Refund{PaymentID: paymentID}
+	if err := apply(&p, &refund); err != nil {
+		return nil, nil, err
+	}
+
+	refund.ID = s.lastRefundID + 1
+	if err := s.post(repository.RefundEntry(&p, &refund)); err != nil {
+		return nil, nil, err
+	}
+	s.lastRefundID++
+	refund.CreatedAt = now()
+	s.refunds = append(s.refunds, refund)
+	p.Version++
+	p.UpdatedAt = refund.CreatedAt
+	s.put(p)
+	if p.Status != from {
+		s.addTransition(paymentID, from, p.Status, refund.Reason, refund.CreatedBy)
+	}
+	return &refund, &p, nil
+}
+
+func (r *refundRepository) ListByPayment(ctx context.Context, paymentID uint) ([]repository.Refund, error) {
+	s := r.s
+	if err := s.lock(ctx); err != nil {
+		return nil, err
+	}
+	defer s.mu.Unlock()
+
+	if p, ok := s.payments[paymentID]; ok && !visible(ctx, p.MerchantID) {
+		return nil, nil
+	}
+	var refunds []repository.Refund
+	for _, rf := range s.refunds {
+		if rf.PaymentID == paymentID {
+			refunds = append(refunds, rf)
+		}
+	}
+	return refunds, nil
+}
+
+type ledgerRepository struct {
+	s *Store
+}
+
+func (r *ledgerRepository) Balances(ctx context.Context, account string) ([]ledger.Balance, error) {
+	s := r.s
+	if err := s.lock(ctx); err != nil {
+		return nil, err
+	}
+	type key struct{ account, currency string }
+	sums := map[key]*ledger.Balance{}
+	for _, e := range s.entries {
+		if !visible(ctx, e.MerchantID) {
+			continue
+		}
+		for _, p := range e.Postings {
+			if account != "" && p.Account != account {
+				continue
+			}
+			k := key{p.Account, p.Currency}
+			b, ok := sums[k]
+			if !ok {
+				b = &ledger.Balance{Account: p.Account, Currency: p.Currency}
+				sums[k] = b
+			}
+			if p.AmountMinor > 0 {
+				b.DebitMinor += p.AmountMinor
+			} else {
+				b.CreditMinor -= p.AmountMinor
+			}
+		}
+	}
+	s.mu.Unlock()
+
+	var balances []ledger.Balance
+	for _, b := range sums {
+		balances = append(balances, *b)
+	}
+	sort.Slice(balances, func(i, j int) bool {
+		if balances[i].Account != balances[j].Account {
+			return balances[i].Account < balances[j].Account
+		}
+		return balances[i].Currency < balances[j].Currency
+	})
+	return balances, nil
+}
+
+func (r *ledgerRepository) ListEntries(ctx context.Context, filter repository.EntryFilter) ([]ledger.Entry, error) {
+	s := r.s
+	if err := s.lock(ctx); err != nil {
+		return nil, err
+	}
+	defer s.mu.Unlock()
+
+	var entries []ledger.Entry
+	for _, e := range s.entries {
+		switch {
+		case !visible(ctx, e.MerchantID),
+			filter.PaymentID != 0 && e.PaymentID != filter.PaymentID,
+			filter.Account != "" && !slices.ContainsFunc(e.Postings, func(p ledger.Posting) bool { return p.Account == filter.Account }),
+			e.ID <= filter.AfterID:
+			continue
+		}
+		if filter.Limit > 0 && len(entries) == filter.Limit {
+			break
+		}
+		e.Postings = slices.Clone(e.Postings)
+		entries = append(entries, e)
+	}
+	return entries, nil
+}
+
+// post checks entries and, if they all balance, appends them to the
+// ledger. The caller must hold s.mu.
+func (s *Store) post(entries ...ledger.Entry) error {
+	for _, e := range entries {
+		if err := e.Validate(); err != nil {
+			return err
+		}
+	}
+	t := now()
+	for _, e := range entries {
+		s.lastEntryID++
+		e.ID = s.lastEntryID
+		e.CreatedAt = t
+		e.Postings = slices.Clone(e.Postings)
+		for i := range e.Postings {
+			e.Postings[i].EntryID = e.ID
+		}
+		s.entries = append(s.entries, e)
+	}
+	return nil
+}
+
+type customerRepository struct {
+	s *Store
+}
+
+func (r *customerRepository) Create(ctx context.Context, customer *repository.Customer) error {
+	s := r.s
+	if err := s.lock(ctx); err != nil {
+		return err
+	}
+	defer s.mu.Unlock()
+
+	customer.MerchantID = repository.Owner(ctx, customer.MerchantID)
+	if s.externalRefTaken(*customer) {
+		return repository.ErrConflict
+	}
+	s.lastCustID++
+	customer.ID = s.lastCustID
+	t := now()
+	customer.CreatedAt, customer.UpdatedAt = t, t
+	s.putCustomer(*customer)
+	return nil
+}
+
+func (r *customerRepository) GetByID(ctx context.Context, id uint) (*repository.Customer, error) {
+	s := r.s
+	if err := s.lock(ctx); err != nil {
+		return nil, err
+	}
+	defer s.mu.Unlock()
+
+	c, ok := s.liveCustomer(ctx, id)
+	if !ok {
+		return nil, repository.ErrNotFound
+	}
+	return &c, nil
+}
+
+func (r *customerRepository) List(ctx context.Context, filter repository.CustomerFilter) ([]repository.Customer, error) {
+	s := r.s
+	if err := s.lock(ctx); err != nil {
+		return nil, err
+	}
+	var customers []repository.Customer
+	for _, c := range s.customers {
+		if c.DeletedAt == nil && visible(ctx, c.MerchantID) && c.ID > filter.AfterID && (filter.ExternalRef == "" || c.ExternalRef == filter.ExternalRef) {
+			c.Metadata = maps.Clone(c.Metadata)
+			customers = append(customers, c)
+		}
+	}
+	s.mu.Unlock()
+
+	sort.Slice(customers, func(i, j int) bool { return customers[i].ID < customers[j].ID })
+	if filter.Limit > 0 && len(customers) > filter.Limit {
+		customers = customers[:filter.Limit]
+	}
+	return customers, nil
+}
+
+func (r *customerRepository) Update(ctx context.Context, id uint, apply func(c *repository.Customer) error) (*repository.Customer, error) {
+	s := r.s
+	if err := s.lock(ctx); err != nil {
+		return nil, err
+	}
+	defer s.mu.Unlock()
+
+	c, ok := s.liveCustomer(ctx, id)
+	if !ok {
+		return nil, repository.ErrNotFound
+	}
+	if err := apply(&c); err != nil {
+		return nil, err
+	}
+	if s.externalRefTaken(c) {
+		return nil, repository.ErrConflict
+	}
+	c.UpdatedAt = now()
+	s.putCustomer(c)
+	return &c, nil
+}
+
+func (r *customerRepository) Delete(ctx context.Context, id uint) error {
+	s := r.s
+	if err := s.lock(ctx); err != nil {
+		return err
+	}
+	defer s.mu.Unlock()
+
+	c, ok := s.liveCustomer(ctx, id)
+	if !ok {
+		return repository.ErrNotFound
+	}
+	t := now()
+	c.DeletedAt = &t
+	s.putCustomer(c)
+	return nil
+}
+
+// liveCustomer returns the customer unless it does not exist, is deleted
+// or belongs to another merchant than ctx acts for. The caller must hold
+// s.mu.
+func (s *Store) liveCustomer(ctx context.Context, id uint) (repository.Customer, bool) {
+	c, ok := s.customers[id]
+	if !ok || c.DeletedAt != nil || !visible(ctx, c.MerchantID) {
+		return repository.Customer{}, false
+	}
+	c.Metadata = maps.Clone(c.Metadata)
+	return c, true
+}
+
+// putCustomer stores a copy of c. The caller must hold s.mu.
+func (s *Store) putCustomer(c repository.Customer) {
+	c.Metadata = maps.Clone(c.Metadata)
+	s.customers[c.ID] = c
+}
+
+// externalRefTaken reports whether another live customer of the same
+// merchant has the external reference of c, like the unique index of the
+// SQL schema. The caller must hold s.mu.
+func (s *Store) externalRefTaken(c repository.Customer) bool {
+	if c.ExternalRef == "" {
+		return false
+	}
+	for _, other := range s.customers {
+		if other.ID != c.ID && other.DeletedAt == nil && other.MerchantID == c.MerchantID && other.ExternalRef == c.ExternalRef {
+			return true
+		}
+	}
+	return false
+}
+
+type apiKeyRepository struct {
+	s *Store
+}
+
+func (r *apiKeyRepository) Create(ctx context.Context, key *repository.APIKey) error {
+	s := r.s
+	if err := s.lock(ctx); err != nil {
+		return err
+	}
+	defer s.mu.Unlock()
+
+	key.MerchantID = repository.Owner(ctx, key.MerchantID)
+	if s.prefixTaken(*key) {
+		return repository.ErrConflict
+	}
+	s.lastKeyID++
+	key.ID = s.lastKeyID
+	t := now()
+	key.CreatedAt, key.UpdatedAt = t, t
+	s.putKey(*key)
+	return nil
+}
+
+func (r *apiKeyRepository) GetByID(ctx context.Context, id uint) (*repository.APIKey, error) {
+	s := r.s
+	if err := s.lock(ctx); err != nil {
+		return nil, err
+	}
+	defer s.mu.Unlock()
+
+	k, ok := s.apiKeys[id]
+	if !ok || !visible(ctx, k.MerchantID) {
+		return nil, repository.ErrNotFound
+	}
+	k.Scopes = slices.Clone(k.Scopes)
+	return &k, nil
+}
+
+func (r *apiKeyRepository) GetByPrefix(ctx context.Context, prefix string) (*repository.APIKey, error) {
+	s := r.s
+	if err := s.lock(ctx); err != nil {
+		return nil, err
+	}
+	defer s.mu.Unlock()
+
+	for _, k := range s.apiKeys {
+		if k.Prefix == prefix {
+			k.Scopes = slices.Clone(k.Scopes)
+			return &k, nil
+		}
+	}
+	return nil, repository.ErrNotFound
+}
+
+func (r *apiKeyRepository) List(ctx context.Context, filter repository.APIKeyFilter) ([]repository.APIKey, error) {
+	s := r.s
+	if err := s.lock(ctx); err != nil {
+		return nil, err
+	}
+	var keys []repository.APIKey
+	for _, k := range s.apiKeys {
+		if visible(ctx, k.MerchantID) && (filter.MerchantID == "" || k.MerchantID == filter.MerchantID) {
+			k.Scopes = slices.Clone(k.Scopes)
+			keys = append(keys, k)
+		}
+	}
+	s.mu.Unlock()
+
+	sort.Slice(keys, func(i, j int) bool { return keys[i].ID < keys[j].ID })
+	return keys, nil
+}
+
+func (r *apiKeyRepository) Update(ctx context.Context, id uint, apply func(k *repository.APIKey) error) (*repository.APIKey, error) {
+	s := r.s
+	if err := s.lock(ctx); err != nil {
+		return nil, err
+	}
+	defer s.mu.Unlock()
+
+	k, ok := s.apiKeys[id]
+	if !ok || !visible(ctx, k.MerchantID) {
+		return nil, repository.ErrNotFound
+	}
+	k.Scopes = slices.Clone(k.Scopes)
+	if err := apply(&k); err != nil {
+		return nil, err
+	}
+	if s.prefixTaken(k) {
+		return nil, repository.ErrConflict
+	}
+	k.UpdatedAt = now()
+	s.putKey(k)
+	return &k, nil
+}
+
+func (r *apiKeyRepository) Rotate(ctx context.Context, id uint, apply func(k, replacement *repository.APIKey) error) (*repository.APIKey, error) {
+	s := r.s
+	if err := s.lock(ctx); err != nil {
+		return nil, err
+	}
+	defer s.mu.Unlock()
+
+	k, ok := s.apiKeys[id]
+	if !ok || !visible(ctx, k.MerchantID) {
+		return nil, repository.ErrNotFound
+	}
+	k.Scopes = slices.Clone(k.Scopes)
+	var replacement repository.APIKey
+	if err := apply(&k, &replacement); err != nil {
+		return nil, err
+	}
+	replacement.MerchantID = k.MerchantID
+	if s.prefixTaken(k) || s.prefixTaken(replacement) || k.Prefix == replacement.Prefix {
+		return nil, repository.ErrConflict
+	}
+	t := now()
+	k.UpdatedAt = t
+	s.putKey(k)
+	s.lastKeyID++
+	replacement.ID = s.lastKeyID
+	replacement.CreatedAt, replacement.UpdatedAt = t, t
+	s.putKey(replacement)
+	return &replacement, nil
+}
+
+func (r *apiKeyRepository) Touch(ctx context.Context, id uint, t time.Time) error {
+	s := r.s
+	if err := s.lock(ctx); err != nil {
+		return err
+	}
+	defer s.mu.Unlock()
+
+	if k, ok := s.apiKeys[id]; ok {
+		t = t.Truncate(time.Microsecond)
+		k.LastUsedAt = &t
+		s.apiKeys[id] = k
+	}
+	return nil
+}
+
+// prefixTaken reports whether another key has the prefix of k, like the
+// unique index of the SQL schema. The caller must hold s.mu.
+func (s *Store) prefixTaken(k repository.APIKey) bool {
+	for _, other := range s.apiKeys {
+		if other.ID != k.ID && other.Prefix == k.Prefix {
+			return true
+		}
+	}
+	return false
+}
+
+// putKey stores a copy of k. The caller must hold s.mu.
+func (s *Store) putKey(k repository.APIKey) {
+	k.Scopes = slices.Clone(k.Scopes)
+	s.apiKeys[k.ID] = k
+}
+
+// lock locks s unless ctx has already ended. Operations in memory are too
+// short to be worth interrupting once started.
+func (s *Store) lock(ctx context.Context) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	return nil
+}
+
+// live returns the payment unless it does not exist, is soft-deleted or
+// belongs to another merchant than ctx acts for. The caller must hold s.mu.
+func (s *Store) live(ctx context.Context, id uint) (repository.Payment, bool) {
+	p, ok := s.payments[id]
+	if !ok || p.DeletedAt != nil || !visible(ctx, p.MerchantID) {
+		return repository.Payment{}, false
+	}
+	return clone(p), true
+}
+
+// visible reports whether a record of merchant id can be seen on behalf of
+// ctx; see package merchant.
+func visible(ctx context.Context, id string) bool {
+	m, ok := merchant.FromContext(ctx)
+	return !ok || m == id
+}
+
+// put stores a copy of p, so that the caller may keep changing p. The caller
+// must hold s.mu.
+func (s *Store) put(p repository.Payment) {
+	s.payments[p.ID] = clone(p)
+}
+
+// clone copies the metadata and customer ID of p, which would otherwise be
+// shared.
+func clone(p repository.Payment) repository.Payment {
+	p.Metadata = maps.Clone(p.Metadata)
+	if p.CustomerID != nil {
+		id := *p.CustomerID
+		p.CustomerID = &id
+	}
+	return p
+}
+
+// addTransition records a status change. The caller must hold s.mu.
+func (s *Store) addTransition(paymentID uint, from, to repository.Status, reason, actor string) {
+	s.lastTransID++
+	s.transitions = append(s.transitions, repository.PaymentTransition{
+		ID:         s.lastTransID,
+		PaymentID:  paymentID,
+		FromStatus: from,
+		ToStatus:   to,
+		Reason:     reason,
+		Actor:      actor,
+		CreatedAt:  now(),
+	})
+}
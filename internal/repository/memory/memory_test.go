@@ -0,0 +1,20 @@
+package memory
+
+import (
+	"testing"
+
+	"github.com/eterrni/payments-api/internal/repository/repotest"
+)
+
+func TestConformance(t *testing.T) {
+	repotest.Run(t, func(t *testing.T) repotest.Repositories {
+		s := NewStore()
+		return repotest.Repositories{
+			Payments:  s.Payments(),
+			Refunds:   s.Refunds(),
+			Ledger:    s.Ledger(),
+			Customers: s.Customers(),
+			APIKeys:   s.APIKeys(),
+		}
+	})
+}
@@ -0,0 +1,36 @@
+package repository
+
+import (
+	"context"
+
+	"github.com/eterrni/payments-api/internal/merchant"
+	"github.com/jinzhu/gorm"
+)
+
+// scoped restricts the queries of db to the rows of the merchant ctx acts
+// for. Contexts that act for no merchant see every row.
+func scoped(ctx context.Context, db *gorm.DB) *gorm.DB {
+	if id, ok := merchant.FromContext(ctx); ok {
+		return db.Where("merchant_id = ?", id)
+	}
+	return db
+}
+
+// scopedByPayment restricts queries of transitions and refunds, which have
+// no merchant of their own, to those of the merchant's payments.
+func scopedByPayment(ctx context.Context, db *gorm.DB) *gorm.DB {
+	if id, ok := merchant.FromContext(ctx); ok {
+		return db.Where("payment_id IN (SELECT id FROM payments WHERE merchant_id = ?)", id)
+	}
+	return db
+}
+
+// Owner returns the merchant that records created on behalf of ctx belong
+// to: the one ctx acts for, or def for contexts that act for none. Stores
+// other than the GORM one use it to fill in MerchantID the same way.
+func Owner(ctx context.Context, def string) string {
+	if id, ok := merchant.FromContext(ctx); ok {
+		return id
+	}
+	return def
+}
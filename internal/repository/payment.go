@@ -1,46 +1,368 @@
 package repository
 
 import (
+	"context"
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/eterrni/payments-api/internal/money"
 	"github.com/jinzhu/gorm"
 )
 
+type Status string
+
+const (
+	StatusPending    Status = "pending"
+	StatusAuthorized Status = "authorized"
+	StatusCaptured   Status = "captured"
+	StatusSettled    Status = "settled"
+	StatusFailed     Status = "failed"
+	StatusCanceled   Status = "canceled"
+	StatusExpired    Status = "expired"
+
+	StatusPartiallyRefunded Status = "partially_refunded"
+	StatusRefunded          Status = "refunded"
+)
+
+// Payment stores its amount in minor units of Currency (cents for USD,
+// yen for JPY, fils for KWD) so that sums never drift.
 type Payment struct {
-	ID       uint    `json:"id" gorm:"primary_key"`
-	Amount   float64 `json:"amount"`
-	Currency string  `json:"currency"`
+	ID uint `json:"id" gorm:"primary_key"`
+	// MerchantID is the merchant the payment belongs to; see package
+	// merchant. Requests acting for another merchant cannot see it.
+	MerchantID    string `json:"merchant_id,omitempty" gorm:"not null;index"`
+	AmountMinor   int64  `json:"amount_minor"`
+	Currency      string `json:"currency"`
+	Status        Status `json:"status" gorm:"not null;default:'pending'"`
+	CustomerID    *uint  `json:"customer_id,omitempty" gorm:"index"`
+	RefundedMinor int64  `json:"refunded_minor" gorm:"not null;default:0"`
+	// AuthorizedMinor is reserved when the payment is authorized and
+	// CapturedMinor is the part of it that was captured; refunds are
+	// limited by the latter.
+	AuthorizedMinor        int64      `json:"authorized_minor" gorm:"not null;default:0"`
+	CapturedMinor          int64      `json:"captured_minor" gorm:"not null;default:0"`
+	AuthorizationExpiresAt *time.Time `json:"authorization_expires_at,omitempty" gorm:"index"`
+	// FeeMinor is charged to the merchant when the payment is captured.
+	FeeMinor    int64    `json:"fee_minor" gorm:"not null;default:0"`
+	Description string   `json:"description,omitempty" gorm:"not null"`
+	Metadata    Metadata `json:"metadata,omitempty" gorm:"not null"`
+	// Version starts at 1 and is incremented by every write, so that
+	// clients can detect concurrent changes.
+	Version    int64      `json:"version" gorm:"not null;default:1"`
+	CreatedAt  time.Time  `json:"created_at" gorm:"not null;default:CURRENT_TIMESTAMP;index"`
+	UpdatedAt  time.Time  `json:"updated_at" gorm:"not null;default:CURRENT_TIMESTAMP"`
+	CanceledAt *time.Time `json:"canceled_at,omitempty"`
+	CanceledBy string     `json:"canceled_by,omitempty"`
+	// DeletedAt makes GORM soft-delete payments: deleted rows stay in the
+	// table for auditing but are hidden from every query that is not
+	// explicitly Unscoped.
+	DeletedAt *time.Time `json:"-" gorm:"index"`
+	DeletedBy string     `json:"-"`
 }
 
+// Metadata holds client-defined key-value pairs. It is stored as a JSON
+// object.
+type Metadata map[string]string
+
+func (m Metadata) Value() (driver.Value, error) {
+	if m == nil {
+		return "{}", nil
+	}
+	b, err := json.Marshal(m)
+	return string(b), err
+}
+
+func (m *Metadata) Scan(src interface{}) error {
+	var b []byte
+	switch v := src.(type) {
+	case nil:
+		*m = nil
+		return nil
+	case []byte:
+		b = v
+	case string:
+		b = []byte(v)
+	default:
+		return fmt.Errorf("cannot scan %T into Metadata", src)
+	}
+	*m = nil
+	return json.Unmarshal(b, m)
+}
+
+// PaymentTransition records a single status change of a payment.
+type PaymentTransition struct {
+	ID         uint      `json:"id" gorm:"primary_key"`
+	PaymentID  uint      `json:"payment_id" gorm:"index"`
+	FromStatus Status    `json:"from"`
+	ToStatus   Status    `json:"to"`
+	Reason     string    `json:"reason"`
+	Actor      string    `json:"actor"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+func (p Payment) Money() money.Money {
+	return money.Money{Amount: p.AmountMinor, Currency: p.Currency}
+}
+
+// MarshalJSON adds the decimal "amount" field that clients relied on before
+// amounts were stored in minor units. It is rendered from the integer amount,
+// so it is always exact.
+func (p Payment) MarshalJSON() ([]byte, error) {
+	type payment Payment
+	return json.Marshal(struct {
+		payment
+		Amount json.Number `json:"amount"`
+	}{payment(p), json.Number(p.Money().Decimal())})
+}
+
+type PaymentSort string
+
+const (
+	SortCreatedAt PaymentSort = "created_at"
+	SortAmount    PaymentSort = "amount_minor"
+)
+
+// PaymentCursor identifies the last payment of a page. Only the field of the
+// sort column and ID are used.
+type PaymentCursor struct {
+	CreatedAt   time.Time
+	AmountMinor int64
+	ID          uint
+}
+
+// PaymentFilter selects payments for List. Zero fields do not filter.
+// CreatedFrom is inclusive and CreatedTo is exclusive.
+type PaymentFilter struct {
+	Currency    string
+	Status      Status
+	CustomerID  uint
+	MinAmount   *int64
+	MaxAmount   *int64
+	CreatedFrom *time.Time
+	CreatedTo   *time.Time
+	// AuthorizationExpiredBy selects payments whose authorization expires
+	// at or before it.
+	AuthorizationExpiredBy *time.Time
+	Sort                   PaymentSort
+	Desc                   bool
+	After                  *PaymentCursor
+	Limit                  int
+}
+
+// PaymentRepository stores payments. Every write also posts the ledger
+// entries the change implies (see PaymentEntries) in the same transaction.
+//
+// Every method only sees the payments of the merchant the context acts for
+// (see package merchant); those of other merchants are reported as
+// ErrNotFound. CreatePayment assigns new payments to that merchant.
 type PaymentRepository interface {
-	CreatePayment(payment Payment) error
-	GetByID(id uint) (*Payment, error)
-	Update(id uint, payment Payment) error
-	Delete(id uint) error
+	// CreatePayment stores payment and fills in its generated fields. A
+	// payment referring to a customer that does not exist, is deleted or
+	// belongs to another merchant is rejected with ErrCustomerNotFound.
+	CreatePayment(ctx context.Context, payment *Payment) error
+	GetByID(ctx context.Context, id uint) (*Payment, error)
+	List(ctx context.Context, filter PaymentFilter) ([]Payment, error)
+	// Update locks the payment, lets apply change it and stores the result,
+	// zero fields included. It only does so if the stored version is still
+	// version, or regardless of it if version is 0; a payment with another
+	// version is left alone and reported as ErrVersionMismatch. Nothing is
+	// written if apply returns an error.
+	Update(ctx context.Context, id uint, version int64, apply func(p *Payment) error) (*Payment, error)
+	// Transition locks the payment, lets apply change it and stores the
+	// result together with a PaymentTransition record. Nothing is written
+	// if apply returns an error. Setting DeletedAt in apply soft-deletes
+	// the payment.
+	Transition(ctx context.Context, id uint, reason, actor string, apply func(p *Payment) error) (*Payment, error)
+	ListTransitions(ctx context.Context, paymentID uint) ([]PaymentTransition, error)
+	// Purge permanently removes a soft-deleted payment together with its
+	// transitions and refunds; its ledger entries are kept. Payments that
+	// are not deleted are left alone and reported as not found.
+	Purge(ctx context.Context, id uint) error
 }
 
 type paymentRepository struct {
-	db *gorm.DB
+	conn *Conn
 }
 
-func NewPaymentRepository(db *gorm.DB) PaymentRepository {
-	return &paymentRepository{db: db}
+func NewPaymentRepository(conn *Conn) PaymentRepository {
+	return &paymentRepository{conn: conn}
 }
 
-func (r *paymentRepository) CreatePayment(payment Payment) error {
-	return r.db.Create(&payment).Error
+func (r *paymentRepository) CreatePayment(ctx context.Context, payment *Payment) error {
+	// GORM leaves zero fields with a default out of the INSERT and does not
+	// read the default back.
+	if payment.Version == 0 {
+		payment.Version = 1
+	}
+	payment.MerchantID = Owner(ctx, payment.MerchantID)
+	return Translate(r.conn.Transaction(ctx, func(tx *gorm.DB) error {
+		if err := checkCustomer(tx, payment); err != nil {
+			return err
+		}
+		if err := tx.Create(payment).Error; err != nil {
+			return err
+		}
+		return post(tx, PaymentEntries(nil, payment)...)
+	}))
 }
 
-func (r *paymentRepository) GetByID(id uint) (*Payment, error) {
+func (r *paymentRepository) GetByID(ctx context.Context, id uint) (*Payment, error) {
 	var payment Payment
-	if err := r.db.First(&payment, id).Error; err != nil {
-		return nil, err
+	err := r.conn.Run(ctx, func(db *gorm.DB) error {
+		return scoped(ctx, db).First(&payment, id).Error
+	})
+	if err != nil {
+		return nil, Translate(err)
 	}
 	return &payment, nil
 }
 
-func (r *paymentRepository) Update(id uint, payment Payment) error {
-	return r.db.Model(&Payment{}).Where("id = ?", id).Updates(payment).Error
+func (r *paymentRepository) List(ctx context.Context, filter PaymentFilter) ([]Payment, error) {
+	var payments []Payment
+	err := r.conn.Run(ctx, func(db *gorm.DB) error {
+		return listQuery(scoped(ctx, db), filter).Find(&payments).Error
+	})
+	return payments, Translate(err)
+}
+
+func listQuery(db *gorm.DB, filter PaymentFilter) *gorm.DB {
+	q := db.Model(&Payment{})
+	if filter.Currency != "" {
+		q = q.Where("currency = ?", filter.Currency)
+	}
+	if filter.Status != "" {
+		q = q.Where("status = ?", filter.Status)
+	}
+	if filter.CustomerID != 0 {
+		q = q.Where("customer_id = ?", filter.CustomerID)
+	}
+	if filter.MinAmount != nil {
+		q = q.Where("amount_minor >= ?", *filter.MinAmount)
+	}
+	if filter.MaxAmount != nil {
+		q = q.Where("amount_minor <= ?", *filter.MaxAmount)
+	}
+	if filter.CreatedFrom != nil {
+		q = q.Where("created_at >= ?", *filter.CreatedFrom)
+	}
+	if filter.CreatedTo != nil {
+		q = q.Where("created_at < ?", *filter.CreatedTo)
+	}
+	if filter.AuthorizationExpiredBy != nil {
+		q = q.Where("authorization_expires_at <= ?", *filter.AuthorizationExpiredBy)
+	}
+
+	column := string(SortCreatedAt)
+	if filter.Sort == SortAmount {
+		column = string(SortAmount)
+	}
+	op, dir := ">", "ASC"
+	if filter.Desc {
+		op, dir = "<", "DESC"
+	}
+	if c := filter.After; c != nil {
+		var value interface{} = c.CreatedAt
+		if column == string(SortAmount) {
+			value = c.AmountMinor
+		}
+		q = q.Where(fmt.Sprintf("%[1]s %[2]s ? OR (%[1]s = ? AND id %[2]s ?)", column, op), value, value, c.ID)
+	}
+
+	q = q.Order(column + " " + dir).Order("id " + dir)
+	if filter.Limit > 0 {
+		q = q.Limit(filter.Limit)
+	}
+	return q
+}
+
+func (r *paymentRepository) Update(ctx context.Context, id uint, version int64, apply func(p *Payment) error) (*Payment, error) {
+	var payment Payment
+	err := r.conn.Transaction(ctx, func(tx *gorm.DB) error {
+		if err := forUpdate(scoped(ctx, tx)).First(&payment, id).Error; err != nil {
+			return err
+		}
+		if version != 0 && payment.Version != version {
+			return ErrVersionMismatch
+		}
+		before := payment
+		if err := apply(&payment); err != nil {
+			return err
+		}
+		payment.Version++
+		if err := tx.Save(&payment).Error; err != nil {
+			return err
+		}
+		return post(tx, PaymentEntries(&before, &payment)...)
+	})
+	if err != nil {
+		return nil, Translate(err)
+	}
+	return &payment, nil
+}
+
+func (r *paymentRepository) Transition(ctx context.Context, id uint, reason, actor string, apply func(p *Payment) error) (*Payment, error) {
+	var payment Payment
+	err := r.conn.Transaction(ctx, func(tx *gorm.DB) error {
+		if err := forUpdate(scoped(ctx, tx)).First(&payment, id).Error; err != nil {
+			return err
+		}
+		before := payment
+		if err := apply(&payment); err != nil {
+			return err
+		}
+		payment.Version++
+		if err := tx.Save(&payment).Error; err != nil {
+			return err
+		}
+		if err := post(tx, PaymentEntries(&before, &payment)...); err != nil {
+			return err
+		}
+		return tx.Create(&PaymentTransition{
+			PaymentID:  id,
+			FromStatus: before.Status,
+			ToStatus:   payment.Status,
+			Reason:     reason,
+			Actor:      actor,
+		}).Error
+	})
+	if err != nil {
+		return nil, Translate(err)
+	}
+	return &payment, nil
+}
+
+// forUpdate locks the rows read by tx until it ends. SQLite has no row locks;
+// there the transaction already holds the database write lock, taken when it
+// began (see config.DB.SQLiteDSN).
+func forUpdate(tx *gorm.DB) *gorm.DB {
+	if tx.Dialect().GetName() == "sqlite3" {
+		return tx
+	}
+	return tx.Set("gorm:query_option", "FOR UPDATE")
+}
+
+func (r *paymentRepository) ListTransitions(ctx context.Context, paymentID uint) ([]PaymentTransition, error) {
+	var transitions []PaymentTransition
+	err := r.conn.Run(ctx, func(db *gorm.DB) error {
+		return scopedByPayment(ctx, db).Where("payment_id = ?", paymentID).Order("id").Find(&transitions).Error
+	})
+	return transitions, Translate(err)
 }
 
-func (r *paymentRepository) Delete(id uint) error {
-	return r.db.Delete(&Payment{}, id).Error
+func (r *paymentRepository) Purge(ctx context.Context, id uint) error {
+	return Translate(r.conn.Transaction(ctx, func(tx *gorm.DB) error {
+		res := scoped(ctx, tx.Unscoped()).Where("id = ? AND deleted_at IS NOT NULL", id).Delete(&Payment{})
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 0 {
+			return ErrNotFound
+		}
+		if err := tx.Where("payment_id = ?", id).Delete(&Refund{}).Error; err != nil {
+			return err
+		}
+		return tx.Where("payment_id = ?", id).Delete(&PaymentTransition{}).Error
+	}))
 }
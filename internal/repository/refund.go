@@ -0,0 +1,99 @@
+package repository
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/eterrni/payments-api/internal/money"
+	"github.com/jinzhu/gorm"
+)
+
+type Refund struct {
+	ID          uint      `json:"id" gorm:"primary_key"`
+	PaymentID   uint      `json:"payment_id" gorm:"not null;index"`
+	AmountMinor int64     `json:"amount_minor" gorm:"not null"`
+	Currency    string    `json:"currency" gorm:"not null"`
+	Reason      string    `json:"reason"`
+	CreatedBy   string    `json:"created_by"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+func (r Refund) Money() money.Money {
+	return money.Money{Amount: r.AmountMinor, Currency: r.Currency}
+}
+
+func (r Refund) MarshalJSON() ([]byte, error) {
+	type refund Refund
+	return json.Marshal(struct {
+		refund
+		Amount json.Number `json:"amount"`
+	}{refund(r), json.Number(r.Money().Decimal())})
+}
+
+type RefundRepository interface {
+	// Create locks the payment and lets apply fill in refund and update the
+	// payment's refunded amount and status. The refund, the payment, its
+	// ledger entry and, if the status changed, a PaymentTransition are
+	// stored together. Because the payment stays locked until commit,
+	// concurrent refunds of the same payment are applied one after another.
+	Create(ctx context.Context, paymentID uint, apply func(p *Payment, refund *Refund) error) (*Refund, *Payment, error)
+	ListByPayment(ctx context.Context, paymentID uint) ([]Refund, error)
+}
+
+type refundRepository struct {
+	conn *Conn
+}
+
+func NewRefundRepository(conn *Conn) RefundRepository {
+	return &refundRepository{conn: conn}
+}
+
+func (r *refundRepository) Create(ctx context.Context, paymentID uint, apply func(p *Payment, refund *Refund) error) (*Refund, *Payment, error) {
+	var (
+		payment Payment
+		refund  Refund
+	)
+	err := r.conn.Transaction(ctx, func(tx *gorm.DB) error {
+		if err := forUpdate(scoped(ctx, tx)).First(&payment, paymentID).Error; err != nil {
+			return err
+		}
+		from := payment.Status
+		refund.PaymentID = paymentID
+		if err := apply(&payment, &refund); err != nil {
+			return err
+		}
+		if err := tx.Create(&refund).Error; err != nil {
+			return err
+		}
+		if err := post(tx, RefundEntry(&payment, &refund)); err != nil {
+			return err
+		}
+		payment.Version++
+		if err := tx.Save(&payment).Error; err != nil {
+			return err
+		}
+		if payment.Status == from {
+			return nil
+		}
+		return tx.Create(&PaymentTransition{
+			PaymentID:  paymentID,
+			FromStatus: from,
+			ToStatus:   payment.Status,
+			Reason:     refund.Reason,
+			Actor:      refund.CreatedBy,
+		}).Error
+	})
+	if err != nil {
+		return nil, nil, Translate(err)
+	}
+	return &refund, &payment, nil
+}
+
+func (r *refundRepository) ListByPayment(ctx context.Context, paymentID uint) ([]Refund, error) {
+	var refunds []Refund
+	err := r.conn.Run(ctx, func(db *gorm.DB) error {
+		return scopedByPayment(ctx, db).Where("payment_id = ?", paymentID).Order("id").Find(&refunds).Error
+	})
+	return refunds, Translate(err)
+}
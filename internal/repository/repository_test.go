@@ -0,0 +1,79 @@
+package repository_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/eterrni/payments-api/internal/config"
+	"github.com/eterrni/payments-api/internal/migrations"
+	"github.com/eterrni/payments-api/internal/repository"
+	"github.com/eterrni/payments-api/internal/repository/repotest"
+	"github.com/jinzhu/gorm"
+	_ "github.com/jinzhu/gorm/dialects/postgres"
+	_ "github.com/jinzhu/gorm/dialects/sqlite"
+)
+
+// TestConformancePostgres runs the repository conformance suite against the
+// PostgreSQL database in TEST_DATABASE_DSN. Its tables are truncated.
+func TestConformancePostgres(t *testing.T) {
+	dsn := os.Getenv("TEST_DATABASE_DSN")
+	if dsn == "" {
+		t.Skip("TEST_DATABASE_DSN is not set")
+	}
+	db, err := gorm.Open("postgres", dsn)
+	if err != nil {
+		t.Fatalf("connect: %v", err)
+	}
+	defer db.Close()
+	m, err := migrations.New(db.DB(), migrations.Postgres)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Up(context.Background()); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+
+	conn := repository.NewConn(db, 0)
+	repotest.Run(t, func(t *testing.T) repotest.Repositories {
+		if err := db.Exec("TRUNCATE payments, payment_transitions, refunds, ledger_entries, ledger_postings, customers, api_keys RESTART IDENTITY").Error; err != nil {
+			t.Fatalf("truncate: %v", err)
+		}
+		return repotest.Repositories{
+			Payments:  repository.NewPaymentRepository(conn),
+			Refunds:   repository.NewRefundRepository(conn),
+			Ledger:    repository.NewLedgerRepository(conn),
+			Customers: repository.NewCustomerRepository(conn),
+			APIKeys:   repository.NewAPIKeyRepository(conn),
+		}
+	})
+}
+
+// TestConformanceSQLite runs the conformance suite against a fresh SQLite
+// database file for every subtest.
+func TestConformanceSQLite(t *testing.T) {
+	repotest.Run(t, func(t *testing.T) repotest.Repositories {
+		cfg := config.DB{DSN: filepath.Join(t.TempDir(), "payments.db")}
+		db, err := gorm.Open("sqlite3", cfg.SQLiteDSN())
+		if err != nil {
+			t.Fatalf("open: %v", err)
+		}
+		t.Cleanup(func() { db.Close() })
+		m, err := migrations.New(db.DB(), migrations.SQLite)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := m.Up(context.Background()); err != nil {
+			t.Fatalf("migrate: %v", err)
+		}
+		conn := repository.NewConn(db, 0)
+		return repotest.Repositories{
+			Payments:  repository.NewPaymentRepository(conn),
+			Refunds:   repository.NewRefundRepository(conn),
+			Ledger:    repository.NewLedgerRepository(conn),
+			Customers: repository.NewCustomerRepository(conn),
+			APIKeys:   repository.NewAPIKeyRepository(conn),
+		}
+	})
+}
@@ -0,0 +1,1090 @@
+// Package repotest is the conformance suite every implementation of the
+// repository interfaces must pass, so that they stay interchangeable.
+package repotest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/eterrni/payments-api/internal/ledger"
+	"github.com/eterrni/payments-api/internal/merchant"
+	"github.com/eterrni/payments-api/internal/repository"
+)
+
+// Repositories are the implementations under test. They must share their
+// storage, like the GORM repositories share a database.
+type Repositories struct {
+	Payments  repository.PaymentRepository
+	Refunds   repository.RefundRepository
+	Ledger    repository.LedgerRepository
+	Customers repository.CustomerRepository
+	APIKeys   repository.APIKeyRepository
+}
+
+// Run runs the suite. open must return repositories backed by empty storage
+// every time it is called.
+func Run(t *testing.T, open func(t *testing.T) Repositories) {
+	t.Run("CreatePayment", func(t *testing.T) { testCreate(t, open(t)) })
+	t.Run("GetByID", func(t *testing.T) { testGet(t, open(t)) })
+	t.Run("Update", func(t *testing.T) { testUpdate(t, open(t)) })
+	t.Run("List", func(t *testing.T) { testList(t, open) })
+	t.Run("Transition", func(t *testing.T) { testTransition(t, open(t)) })
+	t.Run("AuthorizationExpiry", func(t *testing.T) { testAuthorizationExpiry(t, open(t)) })
+	t.Run("ConcurrentTransitions", func(t *testing.T) { testConcurrentTransitions(t, open(t)) })
+	t.Run("SoftDeleteAndPurge", func(t *testing.T) { testSoftDeleteAndPurge(t, open(t)) })
+	t.Run("Refunds", func(t *testing.T) { testRefunds(t, open(t)) })
+	t.Run("ConcurrentRefunds", func(t *testing.T) { testConcurrentRefunds(t, open(t)) })
+	t.Run("Ledger", func(t *testing.T) { testLedger(t, open(t)) })
+	t.Run("Customers", func(t *testing.T) { testCustomers(t, open(t)) })
+	t.Run("CustomerPayments", func(t *testing.T) { testCustomerPayments(t, open(t)) })
+	t.Run("APIKeys", func(t *testing.T) { testAPIKeys(t, open(t)) })
+	t.Run("MerchantIsolation", func(t *testing.T) { testMerchantIsolation(t, open(t)) })
+	t.Run("CanceledContext", func(t *testing.T) { testCanceledContext(t, open(t)) })
+}
+
+// base is a fixed creation time; databases store microseconds in UTC.
+var base = time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+
+func create(t *testing.T, r Repositories, p repository.Payment) *repository.Payment {
+	t.Helper()
+	if err := r.Payments.CreatePayment(t.Context(), &p); err != nil {
+		t.Fatalf("create payment: %v", err)
+	}
+	return &p
+}
+
+func testCreate(t *testing.T, r Repositories) {
+	first := create(t, r, repository.Payment{AmountMinor: 1000, Currency: "USD"})
+	second := create(t, r, repository.Payment{AmountMinor: 2000, Currency: "EUR"})
+
+	if first.ID == 0 || second.ID == 0 || first.ID == second.ID {
+		t.Errorf("got IDs %d and %d, want distinct non-zero IDs", first.ID, second.ID)
+	}
+	if first.Status != repository.StatusPending {
+		t.Errorf("got status %q, want %q by default", first.Status, repository.StatusPending)
+	}
+	if first.CreatedAt.IsZero() || first.UpdatedAt.IsZero() {
+		t.Errorf("timestamps not set: %+v", first)
+	}
+
+	got, err := r.Payments.GetByID(t.Context(), second.ID)
+	if err != nil {
+		t.Fatalf("get: %v", err)
+	}
+	if got.AmountMinor != 2000 || got.Currency != "EUR" || got.RefundedMinor != 0 {
+		t.Errorf("got %+v", got)
+	}
+
+	withTime := create(t, r, repository.Payment{AmountMinor: 1, Currency: "USD", CreatedAt: base})
+	got, err = r.Payments.GetByID(t.Context(), withTime.ID)
+	if err != nil {
+		t.Fatalf("get: %v", err)
+	}
+	if !got.CreatedAt.Equal(base) {
+		t.Errorf("got created_at %s, want %s", got.CreatedAt, base)
+	}
+}
+
+func testGet(t *testing.T, r Repositories) {
+	_, err := r.Payments.GetByID(t.Context(), 12345)
+	if !errors.Is(err, repository.ErrNotFound) {
+		t.Errorf("got error %v, want ErrNotFound", err)
+	}
+}
+
+func testUpdate(t *testing.T, r Repositories) {
+	p := create(t, r, repository.Payment{AmountMinor: 1000, Currency: "USD", Description: "order 1"})
+	if p.Version != 1 {
+		t.Errorf("got version %d after create, want 1", p.Version)
+	}
+
+	updated, err := r.Payments.Update(t.Context(), p.ID, 1, func(p *repository.Payment) error {
+		p.AmountMinor = 1500
+		p.Metadata = repository.Metadata{"order": "1", "note": ""}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("update: %v", err)
+	}
+	if updated.AmountMinor != 1500 || updated.Currency != "USD" || updated.Description != "order 1" {
+		t.Errorf("got %+v", updated)
+	}
+	if updated.Version != 2 {
+		t.Errorf("got version %d, want 2", updated.Version)
+	}
+	if updated.UpdatedAt.Before(p.UpdatedAt) {
+		t.Errorf("updated_at went backwards")
+	}
+	stored, err := r.Payments.GetByID(t.Context(), p.ID)
+	if err != nil {
+		t.Fatalf("get: %v", err)
+	}
+	if want := (repository.Metadata{"order": "1", "note": ""}); !reflect.DeepEqual(stored.Metadata, want) {
+		t.Errorf("got metadata %v, want %v", stored.Metadata, want)
+	}
+	stored.Metadata["order"] = "changed"
+	if again, _ := r.Payments.GetByID(t.Context(), p.ID); again.Metadata["order"] != "1" {
+		t.Errorf("changing a returned payment changed the stored one")
+	}
+
+	_, err = r.Payments.Update(t.Context(), p.ID, 1, func(p *repository.Payment) error {
+		t.Error("apply called for a stale version")
+		return nil
+	})
+	if !errors.Is(err, repository.ErrVersionMismatch) {
+		t.Errorf("stale update: got error %v, want ErrVersionMismatch", err)
+	}
+
+	errApply := errors.New("rejected")
+	_, err = r.Payments.Update(t.Context(), p.ID, 2, func(p *repository.Payment) error {
+		p.AmountMinor = 9999
+		return errApply
+	})
+	if !errors.Is(err, errApply) {
+		t.Errorf("got error %v, want the error of apply", err)
+	}
+	stored, err = r.Payments.GetByID(t.Context(), p.ID)
+	if err != nil {
+		t.Fatalf("get: %v", err)
+	}
+	if stored.AmountMinor != 1500 || stored.Version != 2 {
+		t.Errorf("rejected update was stored: %+v", stored)
+	}
+
+	updated, err = r.Payments.Update(t.Context(), p.ID, 0, func(p *repository.Payment) error {
+		p.Description = ""
+		p.Metadata = nil
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("unconditional update: %v", err)
+	}
+	stored, err = r.Payments.GetByID(t.Context(), p.ID)
+	if err != nil {
+		t.Fatalf("get: %v", err)
+	}
+	if updated.Version != 3 || stored.Version != 3 {
+		t.Errorf("got version %d, stored %d, want 3", updated.Version, stored.Version)
+	}
+	if stored.Description != "" || len(stored.Metadata) != 0 {
+		t.Errorf("zero fields must be stored: got %+v", stored)
+	}
+
+	_, err = r.Payments.Update(t.Context(), 12345, 1, func(p *repository.Payment) error { return nil })
+	if !errors.Is(err, repository.ErrNotFound) {
+		t.Errorf("got error %v, want ErrNotFound", err)
+	}
+}
+
+func testList(t *testing.T, open func(t *testing.T) Repositories) {
+	r := open(t)
+	// Amounts repeat so that ties are broken by ID.
+	fixtures := []struct {
+		amount   int64
+		currency string
+		status   repository.Status
+		minute   int
+	}{
+		{500, "USD", repository.StatusPending, 0},
+		{100, "EUR", repository.StatusAuthorized, 1},
+		{300, "USD", repository.StatusPending, 2},
+		{300, "USD", repository.StatusCaptured, 3},
+		{900, "JPY", repository.StatusPending, 4},
+		{100, "USD", repository.StatusPending, 4},
+	}
+	ids := make([]uint, len(fixtures))
+	for i, f := range fixtures {
+		p := create(t, r, repository.Payment{
+			AmountMinor: f.amount,
+			Currency:    f.currency,
+			Status:      f.status,
+			CreatedAt:   base.Add(time.Duration(f.minute) * time.Minute),
+		})
+		ids[i] = p.ID
+	}
+	at := func(minute int) *time.Time {
+		t := base.Add(time.Duration(minute) * time.Minute)
+		return &t
+	}
+	amount := func(n int64) *int64 { return &n }
+
+	tests := []struct {
+		name   string
+		filter repository.PaymentFilter
+		want   []int
+	}{
+		{"default order", repository.PaymentFilter{}, []int{0, 1, 2, 3, 4, 5}},
+		{"created_at descending", repository.PaymentFilter{Desc: true}, []int{5, 4, 3, 2, 1, 0}},
+		{"amount ascending", repository.PaymentFilter{Sort: repository.SortAmount}, []int{1, 5, 2, 3, 0, 4}},
+		{"amount descending", repository.PaymentFilter{Sort: repository.SortAmount, Desc: true}, []int{4, 0, 3, 2, 5, 1}},
+		{"currency", repository.PaymentFilter{Currency: "USD"}, []int{0, 2, 3, 5}},
+		{"status", repository.PaymentFilter{Status: repository.StatusPending}, []int{0, 2, 4, 5}},
+		{"amount range", repository.PaymentFilter{MinAmount: amount(300), MaxAmount: amount(500)}, []int{0, 2, 3}},
+		{"created range", repository.PaymentFilter{CreatedFrom: at(1), CreatedTo: at(4)}, []int{1, 2, 3}},
+		{"limit", repository.PaymentFilter{Limit: 2}, []int{0, 1}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := r.Payments.List(t.Context(), tt.filter)
+			if err != nil {
+				t.Fatalf("list: %v", err)
+			}
+			want := make([]uint, len(tt.want))
+			for i, n := range tt.want {
+				want[i] = ids[n]
+			}
+			if fmt.Sprint(paymentIDs(got)) != fmt.Sprint(want) {
+				t.Errorf("got IDs %v, want %v", paymentIDs(got), want)
+			}
+		})
+	}
+
+	for _, sort := range []repository.PaymentSort{repository.SortCreatedAt, repository.SortAmount} {
+		for _, desc := range []bool{false, true} {
+			t.Run(fmt.Sprintf("pages by %s desc=%t", sort, desc), func(t *testing.T) {
+				all, err := r.Payments.List(t.Context(), repository.PaymentFilter{Sort: sort, Desc: desc})
+				if err != nil {
+					t.Fatalf("list: %v", err)
+				}
+				var paged []repository.Payment
+				filter := repository.PaymentFilter{Sort: sort, Desc: desc, Limit: 2}
+				for page := 0; page < len(fixtures); page++ {
+					got, err := r.Payments.List(t.Context(), filter)
+					if err != nil {
+						t.Fatalf("list page %d: %v", page, err)
+					}
+					if len(got) == 0 {
+						break
+					}
+					paged = append(paged, got...)
+					last := got[len(got)-1]
+					filter.After = &repository.PaymentCursor{CreatedAt: last.CreatedAt, AmountMinor: last.AmountMinor, ID: last.ID}
+				}
+				if fmt.Sprint(paymentIDs(paged)) != fmt.Sprint(paymentIDs(all)) {
+					t.Errorf("pages gave %v, want %v", paymentIDs(paged), paymentIDs(all))
+				}
+			})
+		}
+	}
+
+	t.Run("soft-deleted payments are hidden", func(t *testing.T) {
+		_, err := r.Payments.Transition(t.Context(), ids[0], "deleted", "test", func(p *repository.Payment) error {
+			now := time.Now()
+			p.DeletedAt = &now
+			return nil
+		})
+		if err != nil {
+			t.Fatalf("delete: %v", err)
+		}
+		got, err := r.Payments.List(t.Context(), repository.PaymentFilter{Currency: "USD"})
+		if err != nil {
+			t.Fatalf("list: %v", err)
+		}
+		if fmt.Sprint(paymentIDs(got)) != fmt.Sprint([]uint{ids[2], ids[3], ids[5]}) {
+			t.Errorf("got IDs %v", paymentIDs(got))
+		}
+	})
+}
+
+func paymentIDs(payments []repository.Payment) []uint {
+	ids := make([]uint, len(payments))
+	for i, p := range payments {
+		ids[i] = p.ID
+	}
+	return ids
+}
+
+func testAuthorizationExpiry(t *testing.T, r Repositories) {
+	authorized := func(expires *time.Time) uint {
+		p := create(t, r, repository.Payment{AmountMinor: 1000, Currency: "USD", Status: repository.StatusAuthorized, AuthorizedMinor: 1000, AuthorizationExpiresAt: expires})
+		return p.ID
+	}
+	early, late := base.Add(-time.Minute), base.Add(time.Minute)
+	expired := authorized(&early)
+	atCutoff := authorized(&base)
+	authorized(&late)
+	authorized(nil)
+
+	got, err := r.Payments.List(t.Context(), repository.PaymentFilter{AuthorizationExpiredBy: &base})
+	if err != nil {
+		t.Fatalf("list: %v", err)
+	}
+	var ids []uint
+	for _, p := range got {
+		ids = append(ids, p.ID)
+	}
+	if want := []uint{expired, atCutoff}; !reflect.DeepEqual(ids, want) {
+		t.Errorf("got payments %v, want %v", ids, want)
+	}
+}
+
+func testTransition(t *testing.T, r Repositories) {
+	p := create(t, r, repository.Payment{AmountMinor: 1000, Currency: "USD"})
+
+	expires := base.Add(time.Hour)
+	got, err := r.Payments.Transition(t.Context(), p.ID, "card ok", "alice", func(p *repository.Payment) error {
+		p.Status = repository.StatusAuthorized
+		p.AuthorizedMinor = p.AmountMinor
+		p.AuthorizationExpiresAt = &expires
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("transition: %v", err)
+	}
+	if got.Status != repository.StatusAuthorized {
+		t.Errorf("got status %q", got.Status)
+	}
+
+	rejected := errors.New("rejected")
+	_, err = r.Payments.Transition(t.Context(), p.ID, "nope", "bob", func(p *repository.Payment) error {
+		p.Status = repository.StatusFailed
+		return rejected
+	})
+	if !errors.Is(err, rejected) {
+		t.Errorf("got error %v, want the apply error", err)
+	}
+
+	stored, err := r.Payments.GetByID(t.Context(), p.ID)
+	if err != nil {
+		t.Fatalf("get: %v", err)
+	}
+	if stored.Status != repository.StatusAuthorized {
+		t.Errorf("failed transition was stored: status %q", stored.Status)
+	}
+	if stored.AuthorizedMinor != 1000 || stored.AuthorizationExpiresAt == nil || !stored.AuthorizationExpiresAt.Equal(expires) {
+		t.Errorf("authorization not stored: %+v", stored)
+	}
+	if stored.Version != 2 {
+		t.Errorf("got version %d after one transition, want 2", stored.Version)
+	}
+
+	transitions, err := r.Payments.ListTransitions(t.Context(), p.ID)
+	if err != nil {
+		t.Fatalf("list transitions: %v", err)
+	}
+	if len(transitions) != 1 {
+		t.Fatalf("got %d transitions, want 1", len(transitions))
+	}
+	tr := transitions[0]
+	if tr.FromStatus != repository.StatusPending || tr.ToStatus != repository.StatusAuthorized ||
+		tr.Reason != "card ok" || tr.Actor != "alice" || tr.CreatedAt.IsZero() {
+		t.Errorf("got %+v", tr)
+	}
+
+	_, err = r.Payments.Transition(t.Context(), 12345, "", "", func(*repository.Payment) error { return nil })
+	if !errors.Is(err, repository.ErrNotFound) {
+		t.Errorf("got error %v, want ErrNotFound", err)
+	}
+}
+
+// testConcurrentTransitions checks that apply sees the latest state: of many
+// concurrent attempts to leave pending, exactly one may succeed.
+func testConcurrentTransitions(t *testing.T, r Repositories) {
+	p := create(t, r, repository.Payment{AmountMinor: 1000, Currency: "USD"})
+	errStale := errors.New("not pending")
+
+	const workers = 10
+	var (
+		wg        sync.WaitGroup
+		mu        sync.Mutex
+		succeeded int
+	)
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := r.Payments.Transition(t.Context(), p.ID, "", "", func(p *repository.Payment) error {
+				if p.Status != repository.StatusPending {
+					return errStale
+				}
+				p.Status = repository.StatusAuthorized
+				return nil
+			})
+			if err == nil {
+				mu.Lock()
+				succeeded++
+				mu.Unlock()
+			} else if !errors.Is(err, errStale) {
+				t.Errorf("unexpected error: %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if succeeded != 1 {
+		t.Errorf("%d transitions succeeded, want exactly 1", succeeded)
+	}
+	transitions, err := r.Payments.ListTransitions(t.Context(), p.ID)
+	if err != nil {
+		t.Fatalf("list transitions: %v", err)
+	}
+	if len(transitions) != 1 {
+		t.Errorf("got %d transitions, want 1", len(transitions))
+	}
+}
+
+func testSoftDeleteAndPurge(t *testing.T, r Repositories) {
+	kept := create(t, r, repository.Payment{AmountMinor: 1000, Currency: "USD"})
+	deleted := create(t, r, repository.Payment{AmountMinor: 2000, Currency: "USD"})
+
+	if err := r.Payments.Purge(t.Context(), kept.ID); !errors.Is(err, repository.ErrNotFound) {
+		t.Errorf("purging a live payment: got error %v, want ErrNotFound", err)
+	}
+
+	_, err := r.Payments.Transition(t.Context(), deleted.ID, "deleted", "alice", func(p *repository.Payment) error {
+		now := time.Now()
+		p.Status = repository.StatusCanceled
+		p.DeletedAt = &now
+		p.DeletedBy = "alice"
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("delete: %v", err)
+	}
+	if _, err := r.Payments.GetByID(t.Context(), deleted.ID); !errors.Is(err, repository.ErrNotFound) {
+		t.Errorf("deleted payment: got error %v, want ErrNotFound", err)
+	}
+	if _, err := r.Payments.Update(t.Context(), deleted.ID, 0, func(p *repository.Payment) error { return nil }); !errors.Is(err, repository.ErrNotFound) {
+		t.Errorf("updating deleted payment: got error %v, want ErrNotFound", err)
+	}
+	transitions, err := r.Payments.ListTransitions(t.Context(), deleted.ID)
+	if err != nil || len(transitions) != 1 {
+		t.Errorf("audit trail of deleted payment: got %d transitions, error %v", len(transitions), err)
+	}
+
+	if err := r.Payments.Purge(t.Context(), deleted.ID); err != nil {
+		t.Fatalf("purge: %v", err)
+	}
+	if err := r.Payments.Purge(t.Context(), deleted.ID); !errors.Is(err, repository.ErrNotFound) {
+		t.Errorf("second purge: got error %v, want ErrNotFound", err)
+	}
+	if transitions, _ := r.Payments.ListTransitions(t.Context(), deleted.ID); len(transitions) != 0 {
+		t.Errorf("purge left %d transitions", len(transitions))
+	}
+	if _, err := r.Payments.GetByID(t.Context(), kept.ID); err != nil {
+		t.Errorf("purge touched another payment: %v", err)
+	}
+}
+
+// refundOf returns an apply function refunding amount like the refund
+// service does, failing once the payment is fully refunded.
+func refundOf(amount int64) func(p *repository.Payment, refund *repository.Refund) error {
+	return func(p *repository.Payment, refund *repository.Refund) error {
+		if p.RefundedMinor+amount > p.AmountMinor {
+			return errExceeds
+		}
+		refund.AmountMinor = amount
+		refund.Currency = p.Currency
+		refund.Reason = "customer request"
+		refund.CreatedBy = "alice"
+		p.RefundedMinor += amount
+		p.Status = repository.StatusPartiallyRefunded
+		if p.RefundedMinor == p.AmountMinor {
+			p.Status = repository.StatusRefunded
+		}
+		return nil
+	}
+}
+
+var errExceeds = errors.New("refund exceeds payment")
+
+func testRefunds(t *testing.T, r Repositories) {
+	p := create(t, r, repository.Payment{AmountMinor: 1000, Currency: "EUR", Status: repository.StatusCaptured})
+
+	refund, payment, err := r.Refunds.Create(t.Context(), p.ID, refundOf(400))
+	if err != nil {
+		t.Fatalf("create refund: %v", err)
+	}
+	if refund.ID == 0 || refund.PaymentID != p.ID || refund.AmountMinor != 400 || refund.Currency != "EUR" || refund.CreatedAt.IsZero() {
+		t.Errorf("got refund %+v", refund)
+	}
+	if payment.RefundedMinor != 400 || payment.Status != repository.StatusPartiallyRefunded {
+		t.Errorf("got payment %+v", payment)
+	}
+
+	// A second partial refund does not change the status and records no
+	// transition.
+	if _, _, err := r.Refunds.Create(t.Context(), p.ID, refundOf(100)); err != nil {
+		t.Fatalf("create refund: %v", err)
+	}
+	if _, _, err := r.Refunds.Create(t.Context(), p.ID, refundOf(600)); !errors.Is(err, errExceeds) {
+		t.Errorf("got error %v, want the apply error", err)
+	}
+	if _, payment, err = r.Refunds.Create(t.Context(), p.ID, refundOf(500)); err != nil {
+		t.Fatalf("create refund: %v", err)
+	}
+	if payment.Status != repository.StatusRefunded {
+		t.Errorf("got status %q, want %q", payment.Status, repository.StatusRefunded)
+	}
+	if payment.Version != 4 {
+		t.Errorf("got version %d after three refunds, want 4", payment.Version)
+	}
+
+	refunds, err := r.Refunds.ListByPayment(t.Context(), p.ID)
+	if err != nil {
+		t.Fatalf("list refunds: %v", err)
+	}
+	var amounts []int64
+	for _, rf := range refunds {
+		amounts = append(amounts, rf.AmountMinor)
+	}
+	if fmt.Sprint(amounts) != "[400 100 500]" {
+		t.Errorf("got refunds %v, want [400 100 500] in creation order", amounts)
+	}
+
+	transitions, err := r.Payments.ListTransitions(t.Context(), p.ID)
+	if err != nil {
+		t.Fatalf("list transitions: %v", err)
+	}
+	if len(transitions) != 2 || transitions[0].ToStatus != repository.StatusPartiallyRefunded ||
+		transitions[1].ToStatus != repository.StatusRefunded || transitions[0].Actor != "alice" {
+		t.Errorf("got transitions %+v", transitions)
+	}
+
+	if _, _, err := r.Refunds.Create(t.Context(), 12345, refundOf(1)); !errors.Is(err, repository.ErrNotFound) {
+		t.Errorf("got error %v, want ErrNotFound", err)
+	}
+}
+
+// testConcurrentRefunds checks that concurrent refunds never exceed the
+// payment amount.
+func testConcurrentRefunds(t *testing.T, r Repositories) {
+	p := create(t, r, repository.Payment{AmountMinor: 1000, Currency: "USD", Status: repository.StatusCaptured})
+
+	const workers = 10
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, _, err := r.Refunds.Create(t.Context(), p.ID, refundOf(300)); err != nil && !errors.Is(err, errExceeds) {
+				t.Errorf("unexpected error: %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	refunds, err := r.Refunds.ListByPayment(t.Context(), p.ID)
+	if err != nil {
+		t.Fatalf("list refunds: %v", err)
+	}
+	if len(refunds) != 3 {
+		t.Errorf("got %d refunds, want 3", len(refunds))
+	}
+	stored, err := r.Payments.GetByID(t.Context(), p.ID)
+	if err != nil {
+		t.Fatalf("get: %v", err)
+	}
+	if stored.RefundedMinor != 900 {
+		t.Errorf("got refunded %d, want 900", stored.RefundedMinor)
+	}
+}
+
+// testLedger checks that every change posts the entries it implies, and
+// nothing when it fails.
+func testLedger(t *testing.T, r Repositories) {
+	ctx := t.Context()
+	p := create(t, r, repository.Payment{AmountMinor: 1000, Currency: "USD"})
+	_, err := r.Payments.Update(ctx, p.ID, 0, func(p *repository.Payment) error {
+		p.AmountMinor = 1200
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("amend: %v", err)
+	}
+	_, err = r.Payments.Update(ctx, p.ID, 0, func(p *repository.Payment) error {
+		p.AmountMinor = 1
+		return errors.New("rejected")
+	})
+	if err == nil {
+		t.Fatal("rejected update succeeded")
+	}
+	transition := func(reason string, apply func(p *repository.Payment)) {
+		t.Helper()
+		_, err := r.Payments.Transition(ctx, p.ID, reason, "alice", func(p *repository.Payment) error {
+			apply(p)
+			return nil
+		})
+		if err != nil {
+			t.Fatalf("%s: %v", reason, err)
+		}
+	}
+	transition("authorize", func(p *repository.Payment) { p.Status = repository.StatusAuthorized })
+	transition("capture", func(p *repository.Payment) {
+		p.Status, p.CapturedMinor, p.FeeMinor = repository.StatusCaptured, 1000, 30
+	})
+	refund, _, err := r.Refunds.Create(ctx, p.ID, refundOf(400))
+	if err != nil {
+		t.Fatalf("refund: %v", err)
+	}
+	canceled := create(t, r, repository.Payment{AmountMinor: 500, Currency: "EUR"})
+	_, err = r.Payments.Transition(ctx, canceled.ID, "cancel", "alice", func(p *repository.Payment) error {
+		p.Status = repository.StatusCanceled
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("cancel: %v", err)
+	}
+
+	entries, err := r.Ledger.ListEntries(ctx, repository.EntryFilter{PaymentID: p.ID})
+	if err != nil {
+		t.Fatalf("list entries: %v", err)
+	}
+	var kinds []ledger.Kind
+	for i, e := range entries {
+		kinds = append(kinds, e.Kind)
+		if err := e.Validate(); err != nil {
+			t.Errorf("entry %d: %v", e.ID, err)
+		}
+		if e.CreatedAt.IsZero() || i > 0 && e.ID <= entries[i-1].ID {
+			t.Errorf("got entry %+v after %d", e, entries[i-1].ID)
+		}
+	}
+	want := []ledger.Kind{ledger.KindPaymentCreated, ledger.KindPaymentAmended, ledger.KindPaymentCaptured, ledger.KindFee, ledger.KindRefund}
+	if !reflect.DeepEqual(kinds, want) {
+		t.Fatalf("got entries %v, want %v", kinds, want)
+	}
+	if e := entries[4]; e.RefundID == nil || *e.RefundID != refund.ID {
+		t.Errorf("refund entry not linked to refund %d: %+v", refund.ID, e)
+	}
+	if got := entries[2].Postings; len(got) != 4 || got[2] != (ledger.Posting{ID: got[2].ID, EntryID: entries[2].ID, Account: ledger.Cash, AmountMinor: 1000, Currency: "USD"}) {
+		t.Errorf("got capture postings %+v", got)
+	}
+
+	page, err := r.Ledger.ListEntries(ctx, repository.EntryFilter{AfterID: entries[0].ID, Limit: 2})
+	if err != nil {
+		t.Fatalf("list entries: %v", err)
+	}
+	if len(page) != 2 || page[0].ID != entries[1].ID || page[1].ID != entries[2].ID {
+		t.Errorf("got page %+v, want entries %d and %d", page, entries[1].ID, entries[2].ID)
+	}
+	fees, err := r.Ledger.ListEntries(ctx, repository.EntryFilter{Account: ledger.FeeRevenue})
+	if err != nil {
+		t.Fatalf("list entries: %v", err)
+	}
+	if len(fees) != 1 || fees[0].Kind != ledger.KindFee || len(fees[0].Postings) != 2 {
+		t.Errorf("got fee entries %+v", fees)
+	}
+	released, err := r.Ledger.ListEntries(ctx, repository.EntryFilter{PaymentID: canceled.ID})
+	if err != nil {
+		t.Fatalf("list entries: %v", err)
+	}
+	if len(released) != 2 || released[1].Kind != ledger.KindPaymentReleased {
+		t.Errorf("got entries %+v for the canceled payment", released)
+	}
+
+	balances, err := r.Ledger.Balances(ctx, "")
+	if err != nil {
+		t.Fatalf("balances: %v", err)
+	}
+	wantBalances := []ledger.Balance{
+		{Account: ledger.Cash, Currency: "USD", DebitMinor: 1000, CreditMinor: 400},
+		{Account: ledger.FeeRevenue, Currency: "USD", CreditMinor: 30},
+		{Account: ledger.MerchantPayable, Currency: "USD", DebitMinor: 430, CreditMinor: 1000},
+		{Account: ledger.MerchantPending, Currency: "EUR", DebitMinor: 500, CreditMinor: 500},
+		{Account: ledger.MerchantPending, Currency: "USD", DebitMinor: 1200, CreditMinor: 1200},
+		{Account: ledger.Receivable, Currency: "EUR", DebitMinor: 500, CreditMinor: 500},
+		{Account: ledger.Receivable, Currency: "USD", DebitMinor: 1200, CreditMinor: 1200},
+	}
+	if !reflect.DeepEqual(balances, wantBalances) {
+		t.Errorf("got balances %+v, want %+v", balances, wantBalances)
+	}
+	cash, err := r.Ledger.Balances(ctx, ledger.Cash)
+	if err != nil {
+		t.Fatalf("balances: %v", err)
+	}
+	if len(cash) != 1 || cash[0].Minor() != 600 {
+		t.Errorf("got cash balances %+v", cash)
+	}
+}
+
+func testCustomers(t *testing.T, r Repositories) {
+	ctx := t.Context()
+	alice := &repository.Customer{ExternalRef: "cus-1", Name: "Alice", Email: "alice@example.com", Metadata: repository.Metadata{"tier": "gold"}}
+	if err := r.Customers.Create(ctx, alice); err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	if alice.ID == 0 || alice.CreatedAt.IsZero() {
+		t.Errorf("generated fields not set: %+v", alice)
+	}
+	bob := &repository.Customer{Name: "Bob"}
+	anon := &repository.Customer{}
+	for _, c := range []*repository.Customer{bob, anon} {
+		if err := r.Customers.Create(ctx, c); err != nil {
+			t.Fatalf("create without external reference: %v", err)
+		}
+	}
+	if err := r.Customers.Create(ctx, &repository.Customer{ExternalRef: "cus-1"}); !errors.Is(err, repository.ErrConflict) {
+		t.Errorf("duplicate external reference: got error %v, want ErrConflict", err)
+	}
+
+	got, err := r.Customers.GetByID(ctx, alice.ID)
+	if err != nil {
+		t.Fatalf("get: %v", err)
+	}
+	if got.ExternalRef != "cus-1" || got.Name != "Alice" || got.Email != "alice@example.com" || got.Metadata["tier"] != "gold" {
+		t.Errorf("got %+v", got)
+	}
+
+	updated, err := r.Customers.Update(ctx, bob.ID, func(c *repository.Customer) error {
+		c.Name, c.Email = "", "bob@example.com"
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("update: %v", err)
+	}
+	if updated.Name != "" || updated.Email != "bob@example.com" {
+		t.Errorf("got %+v", updated)
+	}
+	_, err = r.Customers.Update(ctx, bob.ID, func(c *repository.Customer) error {
+		c.ExternalRef = "cus-1"
+		return nil
+	})
+	if !errors.Is(err, repository.ErrConflict) {
+		t.Errorf("update to a taken external reference: got error %v, want ErrConflict", err)
+	}
+
+	list, err := r.Customers.List(ctx, repository.CustomerFilter{AfterID: alice.ID, Limit: 1})
+	if err != nil {
+		t.Fatalf("list: %v", err)
+	}
+	if len(list) != 1 || list[0].ID != bob.ID {
+		t.Errorf("got %+v, want bob", list)
+	}
+	list, err = r.Customers.List(ctx, repository.CustomerFilter{ExternalRef: "cus-1"})
+	if err != nil {
+		t.Fatalf("list: %v", err)
+	}
+	if len(list) != 1 || list[0].ID != alice.ID {
+		t.Errorf("got %+v, want alice", list)
+	}
+
+	if err := r.Customers.Delete(ctx, alice.ID); err != nil {
+		t.Fatalf("delete: %v", err)
+	}
+	if _, err := r.Customers.GetByID(ctx, alice.ID); !errors.Is(err, repository.ErrNotFound) {
+		t.Errorf("get deleted: got error %v, want ErrNotFound", err)
+	}
+	if err := r.Customers.Delete(ctx, alice.ID); !errors.Is(err, repository.ErrNotFound) {
+		t.Errorf("delete twice: got error %v, want ErrNotFound", err)
+	}
+	if list, _ := r.Customers.List(ctx, repository.CustomerFilter{}); len(list) != 2 {
+		t.Errorf("got %d customers after delete, want 2", len(list))
+	}
+	if err := r.Customers.Create(ctx, &repository.Customer{ExternalRef: "cus-1"}); err != nil {
+		t.Errorf("reusing the external reference of a deleted customer: %v", err)
+	}
+}
+
+func testCustomerPayments(t *testing.T, r Repositories) {
+	ctx := t.Context()
+	alice, bob := &repository.Customer{Name: "Alice"}, &repository.Customer{Name: "Bob"}
+	for _, c := range []*repository.Customer{alice, bob} {
+		if err := r.Customers.Create(ctx, c); err != nil {
+			t.Fatalf("create customer: %v", err)
+		}
+	}
+	first := create(t, r, repository.Payment{AmountMinor: 1000, Currency: "USD", CustomerID: &alice.ID})
+	create(t, r, repository.Payment{AmountMinor: 2000, Currency: "USD", CustomerID: &bob.ID})
+	create(t, r, repository.Payment{AmountMinor: 3000, Currency: "USD"})
+	second := create(t, r, repository.Payment{AmountMinor: 4000, Currency: "USD", CustomerID: &alice.ID})
+
+	got, err := r.Payments.List(ctx, repository.PaymentFilter{CustomerID: alice.ID})
+	if err != nil {
+		t.Fatalf("list: %v", err)
+	}
+	if ids := paymentIDs(got); !reflect.DeepEqual(ids, []uint{first.ID, second.ID}) {
+		t.Errorf("got payments %v, want %v", ids, []uint{first.ID, second.ID})
+	}
+	stored, err := r.Payments.GetByID(ctx, first.ID)
+	if err != nil {
+		t.Fatalf("get: %v", err)
+	}
+	if stored.CustomerID == nil || *stored.CustomerID != alice.ID {
+		t.Errorf("got customer %v, want %d", stored.CustomerID, alice.ID)
+	}
+
+	missing := uint(12345)
+	err = r.Payments.CreatePayment(ctx, &repository.Payment{AmountMinor: 1, Currency: "USD", CustomerID: &missing})
+	if !errors.Is(err, repository.ErrCustomerNotFound) {
+		t.Errorf("unknown customer: got error %v, want ErrCustomerNotFound", err)
+	}
+	if err := r.Customers.Delete(ctx, bob.ID); err != nil {
+		t.Fatalf("delete customer: %v", err)
+	}
+	err = r.Payments.CreatePayment(ctx, &repository.Payment{AmountMinor: 1, Currency: "USD", CustomerID: &bob.ID})
+	if !errors.Is(err, repository.ErrCustomerNotFound) {
+		t.Errorf("deleted customer: got error %v, want ErrCustomerNotFound", err)
+	}
+}
+
+func testAPIKeys(t *testing.T, r Repositories) {
+	acme := merchant.NewContext(t.Context(), "acme")
+	globex := merchant.NewContext(t.Context(), "globex")
+	expires := base.Add(24 * time.Hour)
+
+	key := &repository.APIKey{Name: "backend", Prefix: "0123456789ab", SecretHash: "hash", Scopes: repository.Scopes{"read", "write"}, ExpiresAt: &expires}
+	if err := r.APIKeys.Create(acme, key); err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	if key.ID == 0 || key.CreatedAt.IsZero() || key.MerchantID != "acme" {
+		t.Errorf("generated fields not set: %+v", key)
+	}
+	if err := r.APIKeys.Create(t.Context(), &repository.APIKey{MerchantID: "globex", Prefix: "0123456789ab", SecretHash: "other"}); !errors.Is(err, repository.ErrConflict) {
+		t.Errorf("duplicate prefix: got error %v, want ErrConflict", err)
+	}
+	other := &repository.APIKey{MerchantID: "globex", Prefix: "ba9876543210", SecretHash: "other"}
+	if err := r.APIKeys.Create(t.Context(), other); err != nil {
+		t.Fatalf("create for a merchant: %v", err)
+	}
+
+	t.Run("get", func(t *testing.T) {
+		got, err := r.APIKeys.GetByPrefix(globex, "0123456789ab")
+		if err != nil {
+			t.Fatalf("get by prefix: %v", err)
+		}
+		if got.ID != key.ID || got.SecretHash != "hash" || !reflect.DeepEqual(got.Scopes, key.Scopes) || got.ExpiresAt == nil || !got.ExpiresAt.Equal(expires) {
+			t.Errorf("got %+v", got)
+		}
+		if _, err := r.APIKeys.GetByPrefix(acme, "000000000000"); !errors.Is(err, repository.ErrNotFound) {
+			t.Errorf("unknown prefix: got error %v, want ErrNotFound", err)
+		}
+		if _, err := r.APIKeys.GetByID(acme, key.ID); err != nil {
+			t.Errorf("get: %v", err)
+		}
+		if _, err := r.APIKeys.GetByID(globex, key.ID); !errors.Is(err, repository.ErrNotFound) {
+			t.Errorf("key of another merchant: got error %v, want ErrNotFound", err)
+		}
+	})
+
+	t.Run("list", func(t *testing.T) {
+		for ctx, want := range map[context.Context][]uint{
+			acme:        {key.ID},
+			globex:      {other.ID},
+			t.Context(): {key.ID, other.ID},
+		} {
+			keys, err := r.APIKeys.List(ctx, repository.APIKeyFilter{})
+			if err != nil {
+				t.Fatalf("list: %v", err)
+			}
+			var got []uint
+			for _, k := range keys {
+				got = append(got, k.ID)
+			}
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("got keys %v, want %v", got, want)
+			}
+		}
+		keys, err := r.APIKeys.List(t.Context(), repository.APIKeyFilter{MerchantID: "globex"})
+		if err != nil || len(keys) != 1 || keys[0].ID != other.ID {
+			t.Errorf("got %+v, error %v, want the key of globex", keys, err)
+		}
+	})
+
+	t.Run("update and touch", func(t *testing.T) {
+		revoked := base.Add(time.Hour)
+		updated, err := r.APIKeys.Update(acme, key.ID, func(k *repository.APIKey) error {
+			k.RevokedAt = &revoked
+			return nil
+		})
+		if err != nil {
+			t.Fatalf("update: %v", err)
+		}
+		if updated.RevokedAt == nil || !updated.RevokedAt.Equal(revoked) {
+			t.Errorf("got %+v", updated)
+		}
+		if _, err := r.APIKeys.Update(globex, key.ID, func(*repository.APIKey) error { return nil }); !errors.Is(err, repository.ErrNotFound) {
+			t.Errorf("update key of another merchant: got error %v, want ErrNotFound", err)
+		}
+
+		used := base.Add(2 * time.Hour)
+		if err := r.APIKeys.Touch(globex, key.ID, used); err != nil {
+			t.Fatalf("touch: %v", err)
+		}
+		got, err := r.APIKeys.GetByID(acme, key.ID)
+		if err != nil {
+			t.Fatalf("get: %v", err)
+		}
+		if got.LastUsedAt == nil || !got.LastUsedAt.Equal(used) || got.RevokedAt == nil {
+			t.Errorf("got %+v", got)
+		}
+	})
+
+	t.Run("rotate", func(t *testing.T) {
+		overlap := base.Add(3 * time.Hour)
+		replacement, err := r.APIKeys.Rotate(t.Context(), other.ID, func(k, replacement *repository.APIKey) error {
+			k.ExpiresAt = &overlap
+			*replacement = repository.APIKey{Name: k.Name, Prefix: "cccccccccccc", SecretHash: "new", Scopes: k.Scopes}
+			return nil
+		})
+		if err != nil {
+			t.Fatalf("rotate: %v", err)
+		}
+		if replacement.ID == 0 || replacement.MerchantID != "globex" || replacement.Prefix != "cccccccccccc" {
+			t.Errorf("got replacement %+v", replacement)
+		}
+		old, err := r.APIKeys.GetByID(t.Context(), other.ID)
+		if err != nil {
+			t.Fatalf("get: %v", err)
+		}
+		if old.ExpiresAt == nil || !old.ExpiresAt.Equal(overlap) {
+			t.Errorf("got rotated key %+v", old)
+		}
+
+		failed := errors.New("failed")
+		_, err = r.APIKeys.Rotate(t.Context(), other.ID, func(k, replacement *repository.APIKey) error {
+			k.ExpiresAt = nil
+			replacement.Prefix = "dddddddddddd"
+			return failed
+		})
+		if !errors.Is(err, failed) {
+			t.Errorf("got error %v, want the error of apply", err)
+		}
+		if _, err := r.APIKeys.GetByPrefix(t.Context(), "dddddddddddd"); !errors.Is(err, repository.ErrNotFound) {
+			t.Errorf("failed rotation stored a replacement: %v", err)
+		}
+		if _, err := r.APIKeys.Rotate(acme, other.ID, func(_, _ *repository.APIKey) error { return nil }); !errors.Is(err, repository.ErrNotFound) {
+			t.Errorf("rotate key of another merchant: got error %v, want ErrNotFound", err)
+		}
+	})
+}
+
+func testMerchantIsolation(t *testing.T, r Repositories) {
+	acme := merchant.NewContext(t.Context(), "acme")
+	globex := merchant.NewContext(t.Context(), "globex")
+
+	customer := &repository.Customer{ExternalRef: "cus-1"}
+	if err := r.Customers.Create(acme, customer); err != nil {
+		t.Fatalf("create customer: %v", err)
+	}
+	if err := r.Customers.Create(globex, &repository.Customer{ExternalRef: "cus-1"}); err != nil {
+		t.Errorf("external reference of another merchant: %v", err)
+	}
+	p := &repository.Payment{AmountMinor: 1000, Currency: "USD", CustomerID: &customer.ID}
+	if err := r.Payments.CreatePayment(acme, p); err != nil {
+		t.Fatalf("create payment: %v", err)
+	}
+	if p.MerchantID != "acme" {
+		t.Errorf("got merchant %q, want acme", p.MerchantID)
+	}
+	if _, _, err := r.Refunds.Create(acme, p.ID, refundOf(100)); err != nil {
+		t.Fatalf("refund: %v", err)
+	}
+
+	t.Run("own merchant", func(t *testing.T) {
+		got, err := r.Payments.GetByID(acme, p.ID)
+		if err != nil {
+			t.Fatalf("get: %v", err)
+		}
+		if got.MerchantID != "acme" {
+			t.Errorf("got merchant %q, want acme", got.MerchantID)
+		}
+		entries, err := r.Ledger.ListEntries(acme, repository.EntryFilter{})
+		if err != nil {
+			t.Fatalf("list entries: %v", err)
+		}
+		if len(entries) != 2 || entries[0].MerchantID != "acme" || entries[1].MerchantID != "acme" {
+			t.Errorf("got entries %+v, want the payment and refund entries of acme", entries)
+		}
+	})
+
+	t.Run("other merchant", func(t *testing.T) {
+		apply := func(*repository.Payment) error { return nil }
+		notFound := map[string]error{}
+		_, notFound["GetByID"] = r.Payments.GetByID(globex, p.ID)
+		_, notFound["Update"] = r.Payments.Update(globex, p.ID, 0, apply)
+		_, notFound["Transition"] = r.Payments.Transition(globex, p.ID, "", "mallory", apply)
+		_, _, notFound["Refunds.Create"] = r.Refunds.Create(globex, p.ID, refundOf(100))
+		_, notFound["Customers.GetByID"] = r.Customers.GetByID(globex, customer.ID)
+		_, notFound["Customers.Update"] = r.Customers.Update(globex, customer.ID, func(*repository.Customer) error { return nil })
+		notFound["Customers.Delete"] = r.Customers.Delete(globex, customer.ID)
+		for op, err := range notFound {
+			if !errors.Is(err, repository.ErrNotFound) {
+				t.Errorf("%s: got error %v, want ErrNotFound", op, err)
+			}
+		}
+
+		err := r.Payments.CreatePayment(globex, &repository.Payment{AmountMinor: 1, Currency: "USD", CustomerID: &customer.ID})
+		if !errors.Is(err, repository.ErrCustomerNotFound) {
+			t.Errorf("payment for another merchant's customer: got error %v, want ErrCustomerNotFound", err)
+		}
+
+		payments, err := r.Payments.List(globex, repository.PaymentFilter{})
+		if err != nil {
+			t.Fatalf("list: %v", err)
+		}
+		empty := map[string]int{"List": len(payments)}
+		transitions, _ := r.Payments.ListTransitions(globex, p.ID)
+		empty["ListTransitions"] = len(transitions)
+		refunds, _ := r.Refunds.ListByPayment(globex, p.ID)
+		empty["ListByPayment"] = len(refunds)
+		entries, _ := r.Ledger.ListEntries(globex, repository.EntryFilter{PaymentID: p.ID})
+		empty["ListEntries"] = len(entries)
+		balances, _ := r.Ledger.Balances(globex, "")
+		empty["Balances"] = len(balances)
+		customers, _ := r.Customers.List(globex, repository.CustomerFilter{ExternalRef: "cus-1"})
+		for _, c := range customers {
+			if c.ID == customer.ID {
+				empty["Customers.List"]++
+			}
+		}
+		for op, n := range empty {
+			if n != 0 {
+				t.Errorf("%s: got %d records of another merchant", op, n)
+			}
+		}
+	})
+
+	t.Run("no merchant", func(t *testing.T) {
+		// Background jobs and the admin API act for every merchant.
+		if _, err := r.Payments.GetByID(t.Context(), p.ID); err != nil {
+			t.Errorf("get: %v", err)
+		}
+		balances, err := r.Ledger.Balances(t.Context(), ledger.Receivable)
+		if err != nil {
+			t.Fatalf("balances: %v", err)
+		}
+		if len(balances) != 1 || balances[0].Minor() != 1000 {
+			t.Errorf("got balances %+v", balances)
+		}
+	})
+}
+
+func testCanceledContext(t *testing.T, r Repositories) {
+	p := create(t, r, repository.Payment{AmountMinor: 1000, Currency: "USD"})
+	ctx, cancel := context.WithCancel(t.Context())
+	cancel()
+
+	if err := r.Payments.CreatePayment(ctx, &repository.Payment{AmountMinor: 1, Currency: "USD"}); !errors.Is(err, context.Canceled) {
+		t.Errorf("create: got error %v, want context.Canceled", err)
+	}
+	if _, err := r.Payments.GetByID(ctx, p.ID); !errors.Is(err, context.Canceled) {
+		t.Errorf("get: got error %v, want context.Canceled", err)
+	}
+	if _, err := r.Payments.List(ctx, repository.PaymentFilter{}); !errors.Is(err, context.Canceled) {
+		t.Errorf("list: got error %v, want context.Canceled", err)
+	}
+	_, err := r.Payments.Transition(ctx, p.ID, "", "", func(p *repository.Payment) error {
+		p.Status = repository.StatusAuthorized
+		return nil
+	})
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("transition: got error %v, want context.Canceled", err)
+	}
+	if _, _, err := r.Refunds.Create(ctx, p.ID, refundOf(100)); !errors.Is(err, context.Canceled) {
+		t.Errorf("refund: got error %v, want context.Canceled", err)
+	}
+
+	all, err := r.Payments.List(t.Context(), repository.PaymentFilter{})
+	if err != nil {
+		t.Fatalf("list: %v", err)
+	}
+	if len(all) != 1 || all[0].Status != repository.StatusPending || all[0].RefundedMinor != 0 {
+		t.Errorf("canceled operations changed the data: %+v", all)
+	}
+}
@@ -0,0 +1,104 @@
+// Package server runs the HTTP server and shuts it down gracefully: on
+// cancellation it stops accepting connections, waits for in-flight requests
+// up to a deadline and then releases the resources registered with OnStop.
+package server
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/eterrni/payments-api/internal/config"
+)
+
+type Server struct {
+	http            *http.Server
+	shutdownTimeout time.Duration
+	shutdownDelay   time.Duration
+	onShutdown      []func()
+	onStop          []func(context.Context) error
+}
+
+func New(handler http.Handler, cfg config.HTTP) *Server {
+	return &Server{
+		http: &http.Server{
+			Handler:      handler,
+			Addr:         cfg.Addr,
+			ReadTimeout:  cfg.ReadTimeout,
+			WriteTimeout: cfg.WriteTimeout,
+			IdleTimeout:  cfg.IdleTimeout,
+		},
+		shutdownTimeout: cfg.ShutdownTimeout,
+		shutdownDelay:   cfg.ShutdownDelay,
+	}
+}
+
+// OnShutdown registers fn to run as soon as shutdown begins. The server keeps
+// accepting requests for the configured shutdown delay afterwards, so fn is
+// the place to fail readiness checks.
+func (s *Server) OnShutdown(fn func()) {
+	s.onShutdown = append(s.onShutdown, fn)
+}
+
+// OnStop registers fn to run after in-flight requests have finished, e.g. to
+// flush background workers or close the database. Functions run in reverse
+// order of registration and share what is left of the shutdown deadline.
+func (s *Server) OnStop(fn func(context.Context) error) {
+	s.onStop = append(s.onStop, fn)
+}
+
+// Run listens on the configured address and serves until ctx is canceled.
+func (s *Server) Run(ctx context.Context) error {
+	ln, err := net.Listen("tcp", s.http.Addr)
+	if err != nil {
+		return err
+	}
+	return s.Serve(ctx, ln)
+}
+
+// Serve serves on ln until ctx is canceled, then shuts down gracefully. It
+// returns once every request has finished and every OnStop function ran.
+func (s *Server) Serve(ctx context.Context, ln net.Listener) error {
+	serveErr := make(chan error, 1)
+	go func() {
+		serveErr <- s.http.Serve(ln)
+	}()
+
+	select {
+	case err := <-serveErr:
+		s.stop(context.Background())
+		return err
+	case <-ctx.Done():
+	}
+
+	slog.Info("Shutting down, draining in-flight requests", "timeout", s.shutdownTimeout)
+	for _, fn := range s.onShutdown {
+		fn()
+	}
+	time.Sleep(s.shutdownDelay)
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), s.shutdownTimeout)
+	defer cancel()
+
+	err := s.http.Shutdown(shutdownCtx)
+	if errors.Is(err, context.DeadlineExceeded) {
+		slog.Warn("Shutdown deadline exceeded, closing remaining connections")
+		s.http.Close()
+	}
+	if serr := <-serveErr; !errors.Is(serr, http.ErrServerClosed) && err == nil {
+		err = serr
+	}
+	return errors.Join(err, s.stop(shutdownCtx))
+}
+
+func (s *Server) stop(ctx context.Context) error {
+	var errs []error
+	for i := len(s.onStop) - 1; i >= 0; i-- {
+		if err := s.onStop[i](ctx); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,160 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/eterrni/payments-api/internal/config"
+)
+
+func testConfig(shutdown time.Duration) config.HTTP {
+	return config.HTTP{ReadTimeout: time.Second, WriteTimeout: 5 * time.Second, ShutdownTimeout: shutdown}
+}
+
+func listen(t *testing.T) net.Listener {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return ln
+}
+
+func TestServer_Serve(t *testing.T) {
+	t.Run("in-flight request completes during shutdown", func(t *testing.T) {
+		started, release := make(chan struct{}), make(chan struct{})
+		handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			close(started)
+			<-release
+			w.Write([]byte("done"))
+		})
+		srv := New(handler, testConfig(5*time.Second))
+		var stopped []string
+		srv.OnStop(func(context.Context) error { stopped = append(stopped, "db"); return nil })
+		srv.OnStop(func(context.Context) error { stopped = append(stopped, "workers"); return nil })
+
+		ln := listen(t)
+		addr := ln.Addr().String()
+		ctx, cancel := context.WithCancel(context.Background())
+		served := make(chan error, 1)
+		go func() { served <- srv.Serve(ctx, ln) }()
+
+		type result struct {
+			body string
+			err  error
+		}
+		resp := make(chan result, 1)
+		go func() {
+			res, err := http.Get("http://" + addr + "/payments")
+			if err != nil {
+				resp <- result{err: err}
+				return
+			}
+			defer res.Body.Close()
+			body, err := io.ReadAll(res.Body)
+			resp <- result{string(body), err}
+		}()
+		<-started
+		cancel()
+
+		// New connections are refused once shutdown has begun.
+		deadline := time.Now().Add(2 * time.Second)
+		for {
+			conn, err := net.Dial("tcp", addr)
+			if err != nil {
+				break
+			}
+			conn.Close()
+			if time.Now().After(deadline) {
+				t.Fatal("server still accepts connections after shutdown began")
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+		select {
+		case <-served:
+			t.Fatal("server stopped before the in-flight request finished")
+		default:
+		}
+
+		close(release)
+		r := <-resp
+		if r.err != nil || r.body != "done" {
+			t.Fatalf("in-flight request got body %q, error %v", r.body, r.err)
+		}
+		if err := <-served; err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if len(stopped) != 2 || stopped[0] != "workers" || stopped[1] != "db" {
+			t.Errorf("got stop order %v, want [workers db]", stopped)
+		}
+	})
+
+	t.Run("deadline exceeded", func(t *testing.T) {
+		started, release := make(chan struct{}), make(chan struct{})
+		defer close(release)
+		srv := New(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			close(started)
+			<-release
+		}), testConfig(50*time.Millisecond))
+		ln := listen(t)
+		ctx, cancel := context.WithCancel(context.Background())
+		served := make(chan error, 1)
+		go func() { served <- srv.Serve(ctx, ln) }()
+
+		go http.Get("http://" + ln.Addr().String())
+		<-started
+		cancel()
+
+		select {
+		case err := <-served:
+			if !errors.Is(err, context.DeadlineExceeded) {
+				t.Errorf("got error %v, want context.DeadlineExceeded", err)
+			}
+		case <-time.After(2 * time.Second):
+			t.Fatal("shutdown did not respect its deadline")
+		}
+	})
+
+	t.Run("shutdown hooks run first", func(t *testing.T) {
+		srv := New(http.NotFoundHandler(), testConfig(time.Second))
+		var order []string
+		srv.OnShutdown(func() { order = append(order, "shutdown") })
+		srv.OnStop(func(context.Context) error { order = append(order, "stop"); return nil })
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+
+		if err := srv.Serve(ctx, listen(t)); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if len(order) != 2 || order[0] != "shutdown" || order[1] != "stop" {
+			t.Errorf("got order %v", order)
+		}
+	})
+	t.Run("keeps serving during shutdown delay", func(t *testing.T) {
+		cfg := testConfig(time.Second)
+		cfg.ShutdownDelay = 300 * time.Millisecond
+		srv := New(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}), cfg)
+		shuttingDown := make(chan struct{})
+		srv.OnShutdown(func() { close(shuttingDown) })
+		ln := listen(t)
+		ctx, cancel := context.WithCancel(context.Background())
+		served := make(chan error, 1)
+		go func() { served <- srv.Serve(ctx, ln) }()
+
+		cancel()
+		<-shuttingDown
+		res, err := http.Get("http://" + ln.Addr().String())
+		if err != nil {
+			t.Fatalf("request during shutdown delay failed: %v", err)
+		}
+		res.Body.Close()
+		if err := <-served; err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	})
+}
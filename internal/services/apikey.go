@@ -0,0 +1,237 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"slices"
+	"time"
+	"unicode/utf8"
+
+	"github.com/eterrni/payments-api/internal/apikey"
+	"github.com/eterrni/payments-api/internal/merchant"
+	"github.com/eterrni/payments-api/internal/merchantid"
+	"github.com/eterrni/payments-api/internal/repository"
+)
+
+// ErrInvalidKey is returned by VerifyKey for keys that are malformed,
+// unknown, revoked or expired. It does not tell which, so as not to help
+// guessing.
+var ErrInvalidKey = errors.New("invalid API key")
+
+const (
+	// DefaultRotationOverlap is how long a rotated key keeps working next
+	// to its replacement, so that clients can switch without downtime.
+	DefaultRotationOverlap = 24 * time.Hour
+	MaxRotationOverlap     = 30 * 24 * time.Hour
+
+	maxKeyNameLength = 200
+	// lastUsedInterval limits how often verifying a key writes down its
+	// last use.
+	lastUsedInterval = time.Minute
+)
+
+type APIKeyService struct {
+	keys repository.APIKeyRepository
+}
+
+func NewAPIKeyService(keys repository.APIKeyRepository) APIKeyService {
+	return APIKeyService{keys: keys}
+}
+
+// IssueKeyRequest describes a new key. MerchantID is required when the
+// context acts for no merchant, as on the admin API; an explicit "" issues
+// a key for the default merchant of data created before merchants were
+// configured. Otherwise the key belongs to the merchant of the context.
+type IssueKeyRequest struct {
+	MerchantID *string
+	Name       string
+	Scopes     []string
+	ExpiresAt  *time.Time
+}
+
+// RotateKeyRequest describes the replacement of a key. Overlap is how long
+// the old key keeps working, DefaultRotationOverlap if nil.
+type RotateKeyRequest struct {
+	Overlap   *time.Duration
+	ExpiresAt *time.Time
+}
+
+// IssuedKey is a new key together with its secret, which cannot be
+// retrieved again.
+type IssuedKey struct {
+	APIKey *repository.APIKey
+	Key    string
+}
+
+func (s *APIKeyService) IssueKey(ctx context.Context, req IssueKeyRequest) (*IssuedKey, error) {
+	verr := &ValidationError{}
+	var merchantID string
+	if req.MerchantID != nil {
+		merchantID = *req.MerchantID
+	}
+	id, scoped := merchant.FromContext(ctx)
+	switch {
+	case scoped && req.MerchantID != nil && merchantID != id:
+		verr.add("merchant_id", "cannot issue keys for another merchant")
+	case !scoped && req.MerchantID == nil:
+		verr.add("merchant_id", `merchant_id is required; use "" for the default merchant`)
+	case merchantID != "" && !merchantid.Valid(merchantID):
+		verr.add("merchant_id", "merchant_id must be lowercase letters, digits, _ and -")
+	}
+	if utf8.RuneCountInString(req.Name) > maxKeyNameLength {
+		verr.add("name", fmt.Sprintf("name must be at most %d characters", maxKeyNameLength))
+	}
+	scopes := validateScopes(req.Scopes, verr)
+	validateExpiry(req.ExpiresAt, time.Now(), verr)
+	if err := verr.orNil(); err != nil {
+		return nil, err
+	}
+
+	key, prefix, hash, err := apikey.Generate()
+	if err != nil {
+		return nil, err
+	}
+	created := &repository.APIKey{
+		MerchantID: merchantID,
+		Name:       req.Name,
+		Prefix:     prefix,
+		SecretHash: hash,
+		Scopes:     scopes,
+		ExpiresAt:  req.ExpiresAt,
+	}
+	if err := s.keys.Create(ctx, created); err != nil {
+		return nil, fromRepository(err, "API key", 0)
+	}
+	return &IssuedKey{APIKey: created, Key: key}, nil
+}
+
+func (s *APIKeyService) GetKey(ctx context.Context, id uint) (*repository.APIKey, error) {
+	key, err := s.keys.GetByID(ctx, id)
+	return key, fromRepository(err, "API key", id)
+}
+
+// ListKeys lists the keys, revoked and expired ones included. merchantID
+// narrows the list down to one merchant.
+func (s *APIKeyService) ListKeys(ctx context.Context, merchantID string) ([]repository.APIKey, error) {
+	keys, err := s.keys.List(ctx, repository.APIKeyFilter{MerchantID: merchantID})
+	if err != nil {
+		return nil, fromRepository(err, "API key", 0)
+	}
+	if keys == nil {
+		keys = []repository.APIKey{}
+	}
+	return keys, nil
+}
+
+// RevokeKey stops the key from working right away. Revoking a revoked key
+// changes nothing.
+func (s *APIKeyService) RevokeKey(ctx context.Context, id uint) (*repository.APIKey, error) {
+	key, err := s.keys.Update(ctx, id, func(k *repository.APIKey) error {
+		if k.RevokedAt == nil {
+			now := time.Now()
+			k.RevokedAt = &now
+		}
+		return nil
+	})
+	return key, fromRepository(err, "API key", id)
+}
+
+// RotateKey issues a key with the name and scopes of key id and lets the
+// old one expire after the overlap, unless it expires sooner anyway.
+func (s *APIKeyService) RotateKey(ctx context.Context, id uint, req RotateKeyRequest) (*IssuedKey, error) {
+	now := time.Now()
+	overlap := DefaultRotationOverlap
+	verr := &ValidationError{}
+	if req.Overlap != nil {
+		overlap = *req.Overlap
+		if overlap < 0 || overlap > MaxRotationOverlap {
+			verr.add("overlap", fmt.Sprintf("overlap must be between 0s and %s", MaxRotationOverlap))
+		}
+	}
+	validateExpiry(req.ExpiresAt, now, verr)
+	if err := verr.orNil(); err != nil {
+		return nil, err
+	}
+
+	key, prefix, hash, err := apikey.Generate()
+	if err != nil {
+		return nil, err
+	}
+	replacement, err := s.keys.Rotate(ctx, id, func(k, replacement *repository.APIKey) error {
+		if !k.Active(now) {
+			return fmt.Errorf("API key %d is revoked or expired: %w", id, ErrConflict)
+		}
+		if end := now.Add(overlap); k.ExpiresAt == nil || end.Before(*k.ExpiresAt) {
+			k.ExpiresAt = &end
+		}
+		*replacement = repository.APIKey{
+			Name:       k.Name,
+			Prefix:     prefix,
+			SecretHash: hash,
+			Scopes:     k.Scopes,
+			ExpiresAt:  req.ExpiresAt,
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fromRepository(err, "API key", id)
+	}
+	return &IssuedKey{APIKey: replacement, Key: key}, nil
+}
+
+// VerifyKey returns the active key that key is the secret of, and records
+// its use.
+func (s *APIKeyService) VerifyKey(ctx context.Context, key string) (*repository.APIKey, error) {
+	prefix, secret, ok := apikey.Parse(key)
+	if !ok {
+		return nil, ErrInvalidKey
+	}
+	found, err := s.keys.GetByPrefix(ctx, prefix)
+	if errors.Is(err, repository.ErrNotFound) {
+		return nil, ErrInvalidKey
+	} else if err != nil {
+		return nil, fromRepository(err, "API key", 0)
+	}
+	now := time.Now()
+	if !apikey.Matches(secret, found.SecretHash) || !found.Active(now) {
+		return nil, ErrInvalidKey
+	}
+
+	if found.LastUsedAt == nil || now.Sub(*found.LastUsedAt) >= lastUsedInterval {
+		if err := s.keys.Touch(ctx, found.ID, now); err != nil {
+			slog.Warn("Could not record use of API key", "id", found.ID, "error", err)
+		} else {
+			found.LastUsedAt = &now
+		}
+	}
+	return found, nil
+}
+
+// validateScopes returns scopes without duplicates, in the order of
+// apikey.Scopes.
+func validateScopes(scopes []string, verr *ValidationError) repository.Scopes {
+	if len(scopes) == 0 {
+		verr.add("scopes", "at least one scope is required")
+		return nil
+	}
+	var valid repository.Scopes
+	for _, scope := range apikey.Scopes {
+		if slices.Contains(scopes, scope) {
+			valid = append(valid, scope)
+		}
+	}
+	for _, scope := range scopes {
+		if !apikey.ValidScope(scope) {
+			verr.add("scopes", fmt.Sprintf("unknown scope %q", scope))
+		}
+	}
+	return valid
+}
+
+func validateExpiry(expiresAt *time.Time, now time.Time, verr *ValidationError) {
+	if expiresAt != nil && !expiresAt.After(now) {
+		verr.add("expires_at", "expires_at must be in the future")
+	}
+}
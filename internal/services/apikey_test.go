@@ -0,0 +1,169 @@
+package service
+
+import (
+	"errors"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/eterrni/payments-api/internal/merchant"
+	"github.com/eterrni/payments-api/internal/repository"
+	"github.com/eterrni/payments-api/internal/repository/memory"
+)
+
+func TestAPIKeyService(t *testing.T) {
+	store := memory.NewStore()
+	svc := NewAPIKeyService(store.APIKeys())
+	merchantID := func(id string) *string { return &id }
+
+	issued, err := svc.IssueKey(t.Context(), IssueKeyRequest{MerchantID: merchantID("acme"), Name: "backend", Scopes: []string{"write", "read", "read"}})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if issued.APIKey.MerchantID != "acme" || !slices.Equal(issued.APIKey.Scopes, []string{"read", "write"}) {
+		t.Errorf("got %+v", issued.APIKey)
+	}
+
+	t.Run("invalid request", func(t *testing.T) {
+		past := time.Now().Add(-time.Minute)
+		for _, req := range []IssueKeyRequest{
+			{MerchantID: merchantID("acme"), Scopes: nil},
+			{MerchantID: merchantID("acme"), Scopes: []string{"read", "delete"}},
+			{MerchantID: merchantID("Acme"), Scopes: []string{"read"}},
+			{MerchantID: merchantID("acme"), Scopes: []string{"read"}, ExpiresAt: &past},
+		} {
+			if _, err := svc.IssueKey(t.Context(), req); !errors.Is(err, ErrValidation) {
+				t.Errorf("%+v: got error %v, want ErrValidation", req, err)
+			}
+		}
+		acme := merchant.NewContext(t.Context(), "acme")
+		if _, err := svc.IssueKey(acme, IssueKeyRequest{MerchantID: merchantID("globex"), Scopes: []string{"read"}}); !errors.Is(err, ErrValidation) {
+			t.Errorf("key for another merchant: got error %v, want ErrValidation", err)
+		}
+	})
+
+	t.Run("merchant", func(t *testing.T) {
+		_, err := svc.IssueKey(t.Context(), IssueKeyRequest{Scopes: []string{"read"}})
+		var verr *ValidationError
+		if !errors.As(err, &verr) || len(verr.Fields) != 1 || verr.Fields[0].Field != "merchant_id" {
+			t.Errorf("without merchant_id: got error %v, want a validation error of merchant_id", err)
+		}
+
+		legacy, err := svc.IssueKey(t.Context(), IssueKeyRequest{MerchantID: merchantID(""), Scopes: []string{"read"}})
+		if err != nil || legacy.APIKey.MerchantID != "" {
+			t.Errorf("default merchant: got %+v, error %v", legacy, err)
+		}
+		own, err := svc.IssueKey(merchant.NewContext(t.Context(), "initech"), IssueKeyRequest{Scopes: []string{"read"}})
+		if err != nil || own.APIKey.MerchantID != "initech" {
+			t.Errorf("key of the context's merchant: got %+v, error %v", own, err)
+		}
+	})
+
+	t.Run("verify", func(t *testing.T) {
+		key, err := svc.VerifyKey(t.Context(), issued.Key)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if key.ID != issued.APIKey.ID || key.LastUsedAt == nil {
+			t.Errorf("got %+v", key)
+		}
+		stored, _ := svc.GetKey(t.Context(), key.ID)
+		if stored.LastUsedAt == nil {
+			t.Error("last use not recorded")
+		}
+
+		tampered := issued.Key[:len(issued.Key)-1] + "x"
+		for _, k := range []string{"", "guess", tampered, "pay_000000000000_" + issued.Key[len(issued.Key)-64:]} {
+			if _, err := svc.VerifyKey(t.Context(), k); !errors.Is(err, ErrInvalidKey) {
+				t.Errorf("%q: got error %v, want ErrInvalidKey", k, err)
+			}
+		}
+	})
+
+	t.Run("rotate", func(t *testing.T) {
+		overlap := time.Hour
+		rotated, err := svc.RotateKey(t.Context(), issued.APIKey.ID, RotateKeyRequest{Overlap: &overlap})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if rotated.Key == issued.Key || rotated.APIKey.Name != "backend" || rotated.APIKey.MerchantID != "acme" {
+			t.Errorf("got %+v", rotated.APIKey)
+		}
+		for _, k := range []string{issued.Key, rotated.Key} {
+			if _, err := svc.VerifyKey(t.Context(), k); err != nil {
+				t.Errorf("key does not work during the overlap: %v", err)
+			}
+		}
+		old, _ := svc.GetKey(t.Context(), issued.APIKey.ID)
+		if old.ExpiresAt == nil || old.ExpiresAt.After(time.Now().Add(overlap)) {
+			t.Errorf("got expiry %v, want within the overlap", old.ExpiresAt)
+		}
+
+		none := time.Duration(0)
+		if _, err := svc.RotateKey(t.Context(), rotated.APIKey.ID, RotateKeyRequest{Overlap: &none}); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if _, err := svc.VerifyKey(t.Context(), rotated.Key); !errors.Is(err, ErrInvalidKey) {
+			t.Errorf("key rotated without overlap: got error %v, want ErrInvalidKey", err)
+		}
+		if _, err := svc.RotateKey(t.Context(), rotated.APIKey.ID, RotateKeyRequest{}); !errors.Is(err, ErrConflict) {
+			t.Errorf("rotate expired key: got error %v, want ErrConflict", err)
+		}
+		long := MaxRotationOverlap + time.Hour
+		if _, err := svc.RotateKey(t.Context(), issued.APIKey.ID, RotateKeyRequest{Overlap: &long}); !errors.Is(err, ErrValidation) {
+			t.Errorf("got error %v, want ErrValidation", err)
+		}
+	})
+
+	t.Run("revoke", func(t *testing.T) {
+		fresh, err := svc.IssueKey(t.Context(), IssueKeyRequest{MerchantID: merchantID("acme"), Scopes: []string{"admin"}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		revoked, err := svc.RevokeKey(t.Context(), fresh.APIKey.ID)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		again, err := svc.RevokeKey(t.Context(), fresh.APIKey.ID)
+		if err != nil || !again.RevokedAt.Equal(*revoked.RevokedAt) {
+			t.Errorf("revoking twice: got %+v, error %v", again, err)
+		}
+		if _, err := svc.VerifyKey(t.Context(), fresh.Key); !errors.Is(err, ErrInvalidKey) {
+			t.Errorf("revoked key: got error %v, want ErrInvalidKey", err)
+		}
+		if _, err := svc.RevokeKey(merchant.NewContext(t.Context(), "globex"), fresh.APIKey.ID); !errors.Is(err, ErrNotFound) {
+			t.Errorf("key of another merchant: got error %v, want ErrNotFound", err)
+		}
+	})
+
+	t.Run("expired", func(t *testing.T) {
+		fresh, err := svc.IssueKey(t.Context(), IssueKeyRequest{MerchantID: merchantID(""), Scopes: []string{"read"}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		past := time.Now().Add(-time.Second)
+		if _, err := store.APIKeys().Update(t.Context(), fresh.APIKey.ID, func(k *repository.APIKey) error {
+			k.ExpiresAt = &past
+			return nil
+		}); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := svc.VerifyKey(t.Context(), fresh.Key); !errors.Is(err, ErrInvalidKey) {
+			t.Errorf("got error %v, want ErrInvalidKey", err)
+		}
+	})
+
+	t.Run("list", func(t *testing.T) {
+		keys, err := svc.ListKeys(t.Context(), "acme")
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if len(keys) != 4 {
+			t.Errorf("got %d keys of acme, want 4", len(keys))
+		}
+		keys, err = svc.ListKeys(merchant.NewContext(t.Context(), "globex"), "")
+		if err != nil || len(keys) != 0 {
+			t.Errorf("got %d keys of another merchant, error %v", len(keys), err)
+		}
+	})
+}
@@ -0,0 +1,143 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/eterrni/payments-api/internal/money"
+	"github.com/eterrni/payments-api/internal/repository"
+)
+
+// SystemActor is recorded as the actor of changes nobody requested, such as
+// expired authorizations.
+const SystemActor = "system"
+
+// expiryBatch bounds how many payments ExpireAuthorizations loads at once.
+const expiryBatch = 100
+
+var errNotExpired = errors.New("authorization has not expired")
+
+// CaptureRequest captures Amount minor units of the authorized amount, or
+// all of it when Amount is nil. The rest of the authorization is released.
+type CaptureRequest struct {
+	Amount *int64
+	Reason string
+	Actor  string
+}
+
+// Authorize reserves the amount of a pending payment. Unless it is captured
+// or voided first, the authorization expires after the window the service
+// was created with.
+func (s *PaymentService) Authorize(ctx context.Context, id uint, reason, actor string) (*repository.Payment, error) {
+	payment, err := s.repo.Transition(ctx, id, reason, actor, func(p *repository.Payment) error {
+		if err := transition(p, repository.StatusAuthorized); err != nil {
+			return err
+		}
+		p.AuthorizedMinor = p.AmountMinor
+		if s.opts.AuthorizationTTL > 0 {
+			expires := time.Now().Add(s.opts.AuthorizationTTL)
+			p.AuthorizationExpiresAt = &expires
+		}
+		return nil
+	})
+	return payment, fromRepository(err, "payment", id)
+}
+
+// Capture captures an authorized payment, in full or in part, and charges
+// the fee on the captured amount.
+func (s *PaymentService) Capture(ctx context.Context, id uint, req CaptureRequest) (*repository.Payment, error) {
+	if req.Amount != nil && *req.Amount <= 0 {
+		return nil, &ValidationError{Fields: []FieldError{{Field: "amount", Message: "invalid capture amount"}}}
+	}
+
+	payment, err := s.repo.Transition(ctx, id, req.Reason, req.Actor, func(p *repository.Payment) error {
+		if authorizationExpired(p, time.Now()) {
+			return &TransitionError{From: p.Status, To: repository.StatusCaptured, Reason: "authorization has expired"}
+		}
+		if err := transition(p, repository.StatusCaptured); err != nil {
+			return err
+		}
+		amount := p.AuthorizedMinor
+		if req.Amount != nil {
+			amount = *req.Amount
+		}
+		if amount > p.AuthorizedMinor {
+			authorized := money.Money{Amount: p.AuthorizedMinor, Currency: p.Currency}
+			return &ValidationError{Fields: []FieldError{{
+				Field:   "amount",
+				Message: fmt.Sprintf("capture exceeds the authorized amount of %s", authorized),
+			}}}
+		}
+		p.CapturedMinor = amount
+		p.FeeMinor = fee(amount, s.opts.FeeBasisPoints)
+		return nil
+	})
+	return payment, fromRepository(err, "payment", id)
+}
+
+// Void releases the authorization of an authorized payment and cancels it.
+// Payments in any other status are rejected; pending ones can be canceled.
+func (s *PaymentService) Void(ctx context.Context, id uint, reason, actor string) (*repository.Payment, error) {
+	payment, err := s.repo.Transition(ctx, id, reason, actor, func(p *repository.Payment) error {
+		if p.Status != repository.StatusAuthorized {
+			return &TransitionError{From: p.Status, To: repository.StatusCanceled, Reason: "only authorized payments can be voided"}
+		}
+		if err := transition(p, repository.StatusCanceled); err != nil {
+			return err
+		}
+		markCanceled(p, actor, time.Now())
+		return nil
+	})
+	return payment, fromRepository(err, "payment", id)
+}
+
+// ExpireAuthorizations moves every payment whose authorization expired by
+// now to expired and returns how many it moved. Payments captured or voided
+// in the meantime are left alone.
+func (s *PaymentService) ExpireAuthorizations(ctx context.Context, now time.Time) (int, error) {
+	expired := 0
+	for {
+		payments, err := s.repo.List(ctx, repository.PaymentFilter{
+			Status:                 repository.StatusAuthorized,
+			AuthorizationExpiredBy: &now,
+			Limit:                  expiryBatch,
+		})
+		if err != nil {
+			return expired, fromRepository(err, "payment", 0)
+		}
+
+		n := 0
+		for _, p := range payments {
+			_, err := s.repo.Transition(ctx, p.ID, "authorization expired", SystemActor, func(p *repository.Payment) error {
+				if !authorizationExpired(p, now) {
+					return errNotExpired
+				}
+				return transition(p, repository.StatusExpired)
+			})
+			switch {
+			case err == nil:
+				n++
+			case errors.Is(err, errNotExpired), errors.Is(err, repository.ErrNotFound):
+			default:
+				return expired + n, fromRepository(err, "payment", p.ID)
+			}
+		}
+		expired += n
+		if len(payments) < expiryBatch || n == 0 {
+			return expired, nil
+		}
+	}
+}
+
+// fee returns basisPoints hundredths of a percent of amount, rounded half
+// up, without overflowing for any fee of at most 100%.
+func fee(amount, basisPoints int64) int64 {
+	return amount/10000*basisPoints + (amount%10000*basisPoints+5000)/10000
+}
+
+func authorizationExpired(p *repository.Payment, now time.Time) bool {
+	return p.Status == repository.StatusAuthorized &&
+		p.AuthorizationExpiresAt != nil && !p.AuthorizationExpiresAt.After(now)
+}
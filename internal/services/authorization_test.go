@@ -0,0 +1,243 @@
+package service
+
+import (
+	"errors"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/eterrni/payments-api/internal/repository"
+	"github.com/eterrni/payments-api/internal/repository/memory"
+)
+
+func TestPaymentService_Authorize(t *testing.T) {
+	pending := repository.Payment{AmountMinor: 1000, Currency: "USD"}
+
+	t.Run("reserves the amount", func(t *testing.T) {
+		svc := NewPaymentService(newStore(t, pending).Payments(), PaymentOptions{AuthorizationTTL: time.Hour})
+
+		before := time.Now()
+		payment, err := svc.Authorize(t.Context(), 1, "3DS passed", "alice")
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if payment.Status != repository.StatusAuthorized || payment.AuthorizedMinor != 1000 || payment.CapturedMinor != 0 {
+			t.Errorf("got %+v", payment)
+		}
+		if exp := payment.AuthorizationExpiresAt; exp == nil || exp.Before(before.Add(time.Hour)) || exp.After(time.Now().Add(time.Hour)) {
+			t.Errorf("got expiry %v, want an hour from now", exp)
+		}
+	})
+
+	t.Run("without expiry", func(t *testing.T) {
+		svc := NewPaymentService(newStore(t, pending).Payments(), PaymentOptions{})
+
+		payment, err := svc.Authorize(t.Context(), 1, "", "alice")
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if payment.AuthorizationExpiresAt != nil {
+			t.Errorf("got expiry %v, want none", payment.AuthorizationExpiresAt)
+		}
+	})
+
+	t.Run("not pending", func(t *testing.T) {
+		captured := repository.Payment{AmountMinor: 1000, AuthorizedMinor: 1000, CapturedMinor: 1000, Currency: "USD", Status: repository.StatusCaptured}
+		svc := NewPaymentService(newStore(t, captured).Payments(), PaymentOptions{AuthorizationTTL: time.Hour})
+
+		_, err := svc.Authorize(t.Context(), 1, "", "alice")
+		var terr *TransitionError
+		if !errors.As(err, &terr) {
+			t.Errorf("got error %v, want *TransitionError", err)
+		}
+	})
+}
+
+func TestPaymentService_Capture(t *testing.T) {
+	amount := func(n int64) *int64 { return &n }
+	future, past := time.Now().Add(time.Hour), time.Now().Add(-time.Second)
+	authorized := func(expires *time.Time) repository.Payment {
+		return repository.Payment{AmountMinor: 1000, AuthorizedMinor: 1000, Currency: "USD", Status: repository.StatusAuthorized, AuthorizationExpiresAt: expires}
+	}
+
+	tests := []struct {
+		name        string
+		payment     repository.Payment
+		amount      *int64
+		wantErr     interface{}
+		wantCapture int64
+	}{
+		{"full", authorized(&future), nil, nil, 1000},
+		{"partial", authorized(&future), amount(400), nil, 400},
+		{"never expires", authorized(nil), amount(1000), nil, 1000},
+		{"exceeds authorization", authorized(&future), amount(1001), new(*ValidationError), 0},
+		{"invalid amount", authorized(&future), amount(0), new(*ValidationError), 0},
+		{"expired", authorized(&past), nil, new(*TransitionError), 0},
+		{"not authorized", repository.Payment{AmountMinor: 1000, Currency: "USD"}, nil, new(*TransitionError), 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := newStore(t, tt.payment).Payments()
+			svc := NewPaymentService(repo, PaymentOptions{AuthorizationTTL: time.Hour})
+
+			payment, err := svc.Capture(t.Context(), 1, CaptureRequest{Amount: tt.amount, Actor: "alice"})
+			if tt.wantErr != nil {
+				if !errors.As(err, tt.wantErr) {
+					t.Fatalf("got error %v, want %T", err, tt.wantErr)
+				}
+				if transitions, _ := repo.ListTransitions(t.Context(), 1); len(transitions) != 0 {
+					t.Error("rejected capture was stored")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if payment.Status != repository.StatusCaptured || payment.CapturedMinor != tt.wantCapture || payment.AuthorizedMinor != 1000 {
+				t.Errorf("got %+v, want %d captured", payment, tt.wantCapture)
+			}
+			if payment.AuthorizationExpiresAt != nil {
+				t.Error("capture must release the authorization")
+			}
+		})
+	}
+}
+
+func TestPaymentService_CaptureFee(t *testing.T) {
+	authorized := repository.Payment{AmountMinor: 1000, AuthorizedMinor: 1000, Currency: "USD", Status: repository.StatusAuthorized}
+	svc := NewPaymentService(newStore(t, authorized).Payments(), PaymentOptions{FeeBasisPoints: 290})
+
+	amount := int64(750)
+	payment, err := svc.Capture(t.Context(), 1, CaptureRequest{Amount: &amount})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if payment.FeeMinor != 22 {
+		t.Errorf("got fee %d, want 22 (2.9%% of 750, rounded)", payment.FeeMinor)
+	}
+}
+
+func TestFee(t *testing.T) {
+	tests := []struct {
+		amount, basisPoints, want int64
+	}{
+		{1000, 0, 0},
+		{1000, 250, 25},
+		{10, 250, 0},
+		{20, 250, 1},
+		{12345, 10000, 12345},
+		{math.MaxInt64, 10000, math.MaxInt64},
+		{math.MaxInt64, 1, 922337203685478},
+	}
+	for _, tt := range tests {
+		if got := fee(tt.amount, tt.basisPoints); got != tt.want {
+			t.Errorf("fee(%d, %d) = %d, want %d", tt.amount, tt.basisPoints, got, tt.want)
+		}
+	}
+}
+
+func TestPaymentService_Void(t *testing.T) {
+	t.Run("authorized", func(t *testing.T) {
+		expires := time.Now().Add(time.Hour)
+		authorized := repository.Payment{AmountMinor: 1000, AuthorizedMinor: 1000, Currency: "USD", Status: repository.StatusAuthorized, AuthorizationExpiresAt: &expires}
+		svc := NewPaymentService(newStore(t, authorized).Payments(), PaymentOptions{AuthorizationTTL: time.Hour})
+
+		payment, err := svc.Void(t.Context(), 1, "customer changed their mind", "alice")
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if payment.Status != repository.StatusCanceled || payment.CanceledBy != "alice" || payment.AuthorizationExpiresAt != nil {
+			t.Errorf("got %+v", payment)
+		}
+	})
+
+	t.Run("not authorized", func(t *testing.T) {
+		for _, status := range []repository.Status{repository.StatusPending, repository.StatusCaptured, repository.StatusExpired} {
+			svc := NewPaymentService(newStore(t, repository.Payment{AmountMinor: 1000, Currency: "USD", Status: status}).Payments(), PaymentOptions{AuthorizationTTL: time.Hour})
+
+			_, err := svc.Void(t.Context(), 1, "", "alice")
+			var terr *TransitionError
+			if !errors.As(err, &terr) {
+				t.Errorf("%s: got error %v, want *TransitionError", status, err)
+			}
+		}
+	})
+}
+
+func TestPaymentService_ExpireAuthorizations(t *testing.T) {
+	store := memory.NewStore()
+	repo := store.Payments()
+	svc := NewPaymentService(repo, PaymentOptions{AuthorizationTTL: time.Hour})
+	now := time.Now()
+
+	authorize := func(expires time.Time) uint {
+		t.Helper()
+		p := &repository.Payment{AmountMinor: 1000, Currency: "USD"}
+		if err := repo.CreatePayment(t.Context(), p); err != nil {
+			t.Fatal(err)
+		}
+		_, err := repo.Transition(t.Context(), p.ID, "", "alice", func(p *repository.Payment) error {
+			p.Status, p.AuthorizedMinor, p.AuthorizationExpiresAt = repository.StatusAuthorized, p.AmountMinor, &expires
+			return nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return p.ID
+	}
+
+	var expired []uint
+	for i := 0; i < expiryBatch+5; i++ {
+		expired = append(expired, authorize(now.Add(-time.Minute)))
+	}
+	onTime := authorize(now)
+	valid := authorize(now.Add(time.Minute))
+	captured := authorize(now.Add(-time.Minute))
+	if _, err := svc.Capture(t.Context(), captured, CaptureRequest{}); err == nil {
+		t.Fatal("captured an expired authorization")
+	}
+	if _, err := repo.Transition(t.Context(), captured, "", "alice", func(p *repository.Payment) error {
+		return transition(p, repository.StatusCaptured)
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	n, err := svc.ExpireAuthorizations(t.Context(), now)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if n != len(expired)+1 {
+		t.Errorf("expired %d payments, want %d", n, len(expired)+1)
+	}
+
+	status := func(id uint) repository.Status {
+		p, err := repo.GetByID(t.Context(), id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return p.Status
+	}
+	for _, id := range append(expired, onTime) {
+		if got := status(id); got != repository.StatusExpired {
+			t.Errorf("payment %d: got status %q, want %q", id, got, repository.StatusExpired)
+		}
+	}
+	if got := status(valid); got != repository.StatusAuthorized {
+		t.Errorf("unexpired authorization: got status %q", got)
+	}
+	if got := status(captured); got != repository.StatusCaptured {
+		t.Errorf("captured payment: got status %q", got)
+	}
+
+	transitions, err := repo.ListTransitions(t.Context(), onTime)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if last := transitions[len(transitions)-1]; last.Actor != SystemActor || last.ToStatus != repository.StatusExpired {
+		t.Errorf("got transition %+v", last)
+	}
+
+	if n, err := svc.ExpireAuthorizations(t.Context(), now); n != 0 || err != nil {
+		t.Errorf("second run: expired %d, error %v", n, err)
+	}
+}
@@ -0,0 +1,162 @@
+package service
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/mail"
+	"unicode/utf8"
+
+	"github.com/eterrni/payments-api/internal/repository"
+)
+
+// customersSort is the sort order of customer cursors, so that other cursors
+// cannot be used for customers.
+const customersSort = "customers"
+
+const (
+	maxExternalRefLength = 255
+	maxNameLength        = 200
+	maxEmailLength       = 254
+)
+
+type CustomerService struct {
+	customers repository.CustomerRepository
+	payments  repository.PaymentRepository
+}
+
+func NewCustomerService(customers repository.CustomerRepository, payments repository.PaymentRepository) CustomerService {
+	return CustomerService{customers: customers, payments: payments}
+}
+
+// CustomerRequest holds every client-settable field of a customer.
+// UpdateCustomer replaces all of them, so an omitted field is cleared.
+type CustomerRequest struct {
+	ExternalRef string
+	Name        string
+	Email       string
+	Metadata    repository.Metadata
+}
+
+// ListCustomersRequest describes one page of customers, oldest first.
+type ListCustomersRequest struct {
+	ExternalRef string
+	Cursor      string
+	Limit       int
+}
+
+type CustomerPage struct {
+	Customers  []repository.Customer
+	NextCursor string
+	HasMore    bool
+}
+
+func (s *CustomerService) CreateCustomer(ctx context.Context, req CustomerRequest) (*repository.Customer, error) {
+	if err := validateCustomerRequest(req); err != nil {
+		return nil, err
+	}
+	customer := &repository.Customer{
+		ExternalRef: req.ExternalRef,
+		Name:        req.Name,
+		Email:       req.Email,
+		Metadata:    req.Metadata,
+	}
+	if err := s.customers.Create(ctx, customer); err != nil {
+		return nil, fromRepository(err, "customer", 0)
+	}
+	return customer, nil
+}
+
+func (s *CustomerService) GetCustomer(ctx context.Context, id uint) (*repository.Customer, error) {
+	customer, err := s.customers.GetByID(ctx, id)
+	return customer, fromRepository(err, "customer", id)
+}
+
+func (s *CustomerService) UpdateCustomer(ctx context.Context, id uint, req CustomerRequest) (*repository.Customer, error) {
+	if err := validateCustomerRequest(req); err != nil {
+		return nil, err
+	}
+	customer, err := s.customers.Update(ctx, id, func(c *repository.Customer) error {
+		c.ExternalRef, c.Name, c.Email, c.Metadata = req.ExternalRef, req.Name, req.Email, req.Metadata
+		return nil
+	})
+	return customer, fromRepository(err, "customer", id)
+}
+
+// DeleteCustomer hides the customer from the API. Its payments keep their
+// customer_id, but new payments cannot be created for it.
+func (s *CustomerService) DeleteCustomer(ctx context.Context, id uint) error {
+	return fromRepository(s.customers.Delete(ctx, id), "customer", id)
+}
+
+func (s *CustomerService) ListCustomers(ctx context.Context, req ListCustomersRequest) (*CustomerPage, error) {
+	verr := &ValidationError{}
+	filter := repository.CustomerFilter{ExternalRef: req.ExternalRef, Limit: req.Limit}
+	switch {
+	case req.Limit == 0:
+		filter.Limit = DefaultPageSize
+	case req.Limit < 0 || req.Limit > MaxPageSize:
+		verr.add("limit", "must be between 1 and 100")
+	}
+	if req.Cursor != "" {
+		c, err := decodeCursor(req.Cursor)
+		if err != nil || c.Sort != customersSort {
+			verr.add("cursor", "invalid cursor")
+		}
+		filter.AfterID = c.ID
+	}
+	if err := verr.orNil(); err != nil {
+		return nil, err
+	}
+
+	limit := filter.Limit
+	filter.Limit = limit + 1
+	customers, err := s.customers.List(ctx, filter)
+	if err != nil {
+		return nil, fromRepository(err, "customer", 0)
+	}
+
+	page := &CustomerPage{Customers: customers}
+	if len(customers) > limit {
+		page.Customers = customers[:limit]
+		page.HasMore = true
+		b, _ := json.Marshal(cursor{Sort: customersSort, ID: page.Customers[limit-1].ID})
+		page.NextCursor = base64.RawURLEncoding.EncodeToString(b)
+	}
+	if page.Customers == nil {
+		page.Customers = []repository.Customer{}
+	}
+	return page, nil
+}
+
+// ListPayments lists the payments of a customer with the filters of
+// PaymentService.ListPayments.
+func (s *CustomerService) ListPayments(ctx context.Context, id uint, req ListPaymentsRequest) (*PaymentPage, error) {
+	if _, err := s.customers.GetByID(ctx, id); err != nil {
+		return nil, fromRepository(err, "customer", id)
+	}
+	req.CustomerID = id
+	return listPayments(ctx, s.payments, req)
+}
+
+func validateCustomerRequest(req CustomerRequest) error {
+	verr := &ValidationError{}
+	if utf8.RuneCountInString(req.ExternalRef) > maxExternalRefLength {
+		verr.add("external_ref", fmt.Sprintf("external_ref must be at most %d characters", maxExternalRefLength))
+	}
+	if utf8.RuneCountInString(req.Name) > maxNameLength {
+		verr.add("name", fmt.Sprintf("name must be at most %d characters", maxNameLength))
+	}
+	if req.Email != "" {
+		addr, err := mail.ParseAddress(req.Email)
+		switch {
+		case err != nil || addr.Address != req.Email:
+			verr.add("email", "invalid email address")
+		case len(req.Email) > maxEmailLength:
+			verr.add("email", fmt.Sprintf("email must be at most %d characters", maxEmailLength))
+		}
+	}
+	validateMetadata(req.Metadata, verr)
+	return verr.orNil()
+}
@@ -0,0 +1,126 @@
+package service
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/eterrni/payments-api/internal/money"
+	"github.com/eterrni/payments-api/internal/repository"
+	"github.com/eterrni/payments-api/internal/repository/memory"
+)
+
+func TestCustomerService(t *testing.T) {
+	store := memory.NewStore()
+	svc := NewCustomerService(store.Customers(), store.Payments())
+	payments := NewPaymentService(store.Payments(), PaymentOptions{})
+
+	alice, err := svc.CreateCustomer(t.Context(), CustomerRequest{ExternalRef: "cus-1", Name: "Alice", Email: "alice@example.com"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	t.Run("duplicate external reference", func(t *testing.T) {
+		_, err := svc.CreateCustomer(t.Context(), CustomerRequest{ExternalRef: "cus-1"})
+		if !errors.Is(err, ErrConflict) {
+			t.Errorf("got error %v, want ErrConflict", err)
+		}
+	})
+
+	t.Run("invalid request", func(t *testing.T) {
+		for _, req := range []CustomerRequest{
+			{Email: "alice"},
+			{Email: "Alice <alice@example.com>"},
+			{Name: strings.Repeat("a", 201)},
+			{ExternalRef: strings.Repeat("a", 256)},
+			{Metadata: repository.Metadata{"": "x"}},
+		} {
+			if _, err := svc.CreateCustomer(t.Context(), req); !errors.Is(err, ErrValidation) {
+				t.Errorf("%+v: got error %v, want ErrValidation", req, err)
+			}
+		}
+	})
+
+	t.Run("update replaces every field", func(t *testing.T) {
+		c, err := svc.UpdateCustomer(t.Context(), alice.ID, CustomerRequest{Name: "Alice Smith"})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if c.Name != "Alice Smith" || c.Email != "" || c.ExternalRef != "" {
+			t.Errorf("got %+v", c)
+		}
+		if _, err := svc.UpdateCustomer(t.Context(), 999, CustomerRequest{}); !errors.Is(err, ErrNotFound) {
+			t.Errorf("got error %v, want ErrNotFound", err)
+		}
+	})
+
+	t.Run("list", func(t *testing.T) {
+		for range 2 {
+			if _, err := svc.CreateCustomer(t.Context(), CustomerRequest{}); err != nil {
+				t.Fatal(err)
+			}
+		}
+		var ids []uint
+		req := ListCustomersRequest{Limit: 2}
+		for {
+			page, err := svc.ListCustomers(t.Context(), req)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			for _, c := range page.Customers {
+				ids = append(ids, c.ID)
+			}
+			if !page.HasMore {
+				break
+			}
+			req.Cursor = page.NextCursor
+		}
+		if len(ids) != 3 || ids[0] != alice.ID {
+			t.Errorf("got customers %v", ids)
+		}
+		for _, req := range []ListCustomersRequest{
+			{Limit: 101},
+			{Cursor: "!"},
+			{Cursor: encodeCursor("", repository.Payment{ID: 1})},
+		} {
+			if _, err := svc.ListCustomers(t.Context(), req); !errors.Is(err, ErrValidation) {
+				t.Errorf("%+v: got error %v, want ErrValidation", req, err)
+			}
+		}
+	})
+
+	t.Run("payments", func(t *testing.T) {
+		amount := money.Money{Amount: 1000, Currency: "USD"}
+		p, err := payments.CreatePayment(t.Context(), PaymentRequest{Amount: amount, CustomerID: &alice.ID})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if _, err := payments.CreatePayment(t.Context(), PaymentRequest{Amount: amount}); err != nil {
+			t.Fatal(err)
+		}
+		page, err := svc.ListPayments(t.Context(), alice.ID, ListPaymentsRequest{})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if len(page.Payments) != 1 || page.Payments[0].ID != p.ID {
+			t.Errorf("got payments %+v, want payment %d", page.Payments, p.ID)
+		}
+		if _, err := svc.ListPayments(t.Context(), 999, ListPaymentsRequest{}); !errors.Is(err, ErrNotFound) {
+			t.Errorf("got error %v, want ErrNotFound", err)
+		}
+	})
+
+	t.Run("delete", func(t *testing.T) {
+		if err := svc.DeleteCustomer(t.Context(), alice.ID); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if _, err := svc.GetCustomer(t.Context(), alice.ID); !errors.Is(err, ErrNotFound) {
+			t.Errorf("got error %v, want ErrNotFound", err)
+		}
+		_, err := payments.CreatePayment(t.Context(), PaymentRequest{Amount: money.Money{Amount: 1, Currency: "USD"}, CustomerID: &alice.ID})
+		var verr *ValidationError
+		if !errors.As(err, &verr) || verr.Fields[0].Field != "customer_id" {
+			t.Errorf("got error %v, want a validation error on customer_id", err)
+		}
+	})
+}
@@ -0,0 +1,75 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/eterrni/payments-api/internal/repository"
+)
+
+// Errors returned by the services. Use errors.Is to check for them; the
+// concrete errors carry the details.
+var (
+	ErrNotFound    = errors.New("not found")
+	ErrValidation  = errors.New("validation failed")
+	ErrConflict    = errors.New("conflict")
+	ErrUnavailable = errors.New("temporarily unavailable")
+	// ErrVersionMismatch is returned by conditional updates of a record
+	// that has been changed since the client read it.
+	ErrVersionMismatch = errors.New("has been modified")
+)
+
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// ValidationError is returned when a request is well-formed but breaks a
+// business rule. It lists every offending field, not just the first one.
+type ValidationError struct {
+	Fields []FieldError
+}
+
+func (e *ValidationError) Error() string {
+	msgs := make([]string, len(e.Fields))
+	for i, f := range e.Fields {
+		msgs[i] = f.Message
+	}
+	return strings.Join(msgs, "; ")
+}
+
+func (e *ValidationError) Is(target error) bool {
+	return target == ErrValidation
+}
+
+func (e *ValidationError) add(field, message string) {
+	e.Fields = append(e.Fields, FieldError{Field: field, Message: message})
+}
+
+func (e *ValidationError) orNil() error {
+	if len(e.Fields) == 0 {
+		return nil
+	}
+	return e
+}
+
+// fromRepository converts repository errors into service errors. what and id
+// name the record for not-found messages, e.g. "payment 7 not found". A
+// database operation that ran out of time is reported as unavailable.
+func fromRepository(err error, what string, id uint) error {
+	switch {
+	case err == nil:
+		return nil
+	case errors.Is(err, repository.ErrNotFound):
+		return fmt.Errorf("%s %d %w", what, id, ErrNotFound)
+	case errors.Is(err, repository.ErrVersionMismatch):
+		return fmt.Errorf("%s %d %w", what, id, ErrVersionMismatch)
+	case errors.Is(err, repository.ErrConflict):
+		return fmt.Errorf("%w: %w", ErrConflict, err)
+	case errors.Is(err, repository.ErrUnavailable), errors.Is(err, context.DeadlineExceeded):
+		return fmt.Errorf("%w: %w", ErrUnavailable, err)
+	}
+	return err
+}
@@ -0,0 +1,125 @@
+package service
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+
+	"github.com/eterrni/payments-api/internal/ledger"
+	"github.com/eterrni/payments-api/internal/repository"
+)
+
+// entriesSort is the sort order of entry cursors, so that payment cursors
+// cannot be used for entries and vice versa.
+const entriesSort = "entries"
+
+type LedgerService struct {
+	repo repository.LedgerRepository
+}
+
+func NewLedgerService(repo repository.LedgerRepository) LedgerService {
+	return LedgerService{repo: repo}
+}
+
+// AccountBalances is an account with its balance in every currency that has
+// been posted to it.
+type AccountBalances struct {
+	ledger.Account
+	Balances []ledger.Balance `json:"balances"`
+}
+
+// ListEntriesRequest describes one page of entries, oldest first.
+type ListEntriesRequest struct {
+	PaymentID uint
+	Account   string
+	Cursor    string
+	Limit     int
+}
+
+type EntryPage struct {
+	Entries    []ledger.Entry
+	NextCursor string
+	HasMore    bool
+}
+
+// ListAccounts returns the chart of accounts with their balances.
+func (s *LedgerService) ListAccounts(ctx context.Context) ([]AccountBalances, error) {
+	balances, err := s.repo.Balances(ctx, "")
+	if err != nil {
+		return nil, fromRepository(err, "account", 0)
+	}
+	accounts := []AccountBalances{}
+	for _, a := range ledger.Accounts() {
+		accounts = append(accounts, withBalances(a, balances))
+	}
+	return accounts, nil
+}
+
+func (s *LedgerService) GetAccount(ctx context.Context, code string) (*AccountBalances, error) {
+	a, ok := ledger.LookupAccount(code)
+	if !ok {
+		return nil, fmt.Errorf("account %q %w", code, ErrNotFound)
+	}
+	balances, err := s.repo.Balances(ctx, code)
+	if err != nil {
+		return nil, fromRepository(err, "account", 0)
+	}
+	account := withBalances(a, balances)
+	return &account, nil
+}
+
+func withBalances(a ledger.Account, balances []ledger.Balance) AccountBalances {
+	account := AccountBalances{Account: a, Balances: []ledger.Balance{}}
+	for _, b := range balances {
+		if b.Account == a.Code {
+			account.Balances = append(account.Balances, b)
+		}
+	}
+	return account
+}
+
+func (s *LedgerService) ListEntries(ctx context.Context, req ListEntriesRequest) (*EntryPage, error) {
+	verr := &ValidationError{}
+	filter := repository.EntryFilter{PaymentID: req.PaymentID, Account: req.Account, Limit: req.Limit}
+	if req.Account != "" {
+		if _, ok := ledger.LookupAccount(req.Account); !ok {
+			verr.add("account", `unknown account "`+req.Account+`"`)
+		}
+	}
+	switch {
+	case req.Limit == 0:
+		filter.Limit = DefaultPageSize
+	case req.Limit < 0 || req.Limit > MaxPageSize:
+		verr.add("limit", "must be between 1 and 100")
+	}
+	if req.Cursor != "" {
+		c, err := decodeCursor(req.Cursor)
+		if err != nil || c.Sort != entriesSort {
+			verr.add("cursor", "invalid cursor")
+		}
+		filter.AfterID = c.ID
+	}
+	if err := verr.orNil(); err != nil {
+		return nil, err
+	}
+
+	limit := filter.Limit
+	filter.Limit = limit + 1
+	entries, err := s.repo.ListEntries(ctx, filter)
+	if err != nil {
+		return nil, fromRepository(err, "entry", 0)
+	}
+
+	page := &EntryPage{Entries: entries}
+	if len(entries) > limit {
+		page.Entries = entries[:limit]
+		page.HasMore = true
+		b, _ := json.Marshal(cursor{Sort: entriesSort, ID: page.Entries[limit-1].ID})
+		page.NextCursor = base64.RawURLEncoding.EncodeToString(b)
+	}
+	if page.Entries == nil {
+		page.Entries = []ledger.Entry{}
+	}
+	return page, nil
+}
@@ -0,0 +1,112 @@
+package service
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/eterrni/payments-api/internal/ledger"
+	"github.com/eterrni/payments-api/internal/money"
+	"github.com/eterrni/payments-api/internal/repository"
+	"github.com/eterrni/payments-api/internal/repository/memory"
+)
+
+func TestLedgerService(t *testing.T) {
+	store := memory.NewStore()
+	payments := NewPaymentService(store.Payments(), PaymentOptions{FeeBasisPoints: 100})
+	var ids []uint
+	for range 3 {
+		p, err := payments.CreatePayment(t.Context(), PaymentRequest{Amount: money.Money{Amount: 1000, Currency: "USD"}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids = append(ids, p.ID)
+	}
+	if _, err := payments.Authorize(t.Context(), ids[0], "", "alice"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := payments.Capture(t.Context(), ids[0], CaptureRequest{}); err != nil {
+		t.Fatal(err)
+	}
+	svc := NewLedgerService(store.Ledger())
+
+	t.Run("accounts", func(t *testing.T) {
+		accounts, err := svc.ListAccounts(t.Context())
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if len(accounts) != len(ledger.Accounts()) || accounts[0].Code != ledger.Receivable {
+			t.Fatalf("got accounts %+v, want the chart of accounts", accounts)
+		}
+		for _, a := range accounts {
+			want := map[string]int64{
+				ledger.Receivable:      2000,
+				ledger.MerchantPending: 2000,
+				ledger.Cash:            1000,
+				ledger.MerchantPayable: 990,
+				ledger.FeeRevenue:      10,
+			}[a.Code]
+			if len(a.Balances) != 1 || a.Balances[0].Minor() != want {
+				t.Errorf("got %s balances %+v, want %d", a.Code, a.Balances, want)
+			}
+		}
+	})
+
+	t.Run("account", func(t *testing.T) {
+		a, err := svc.GetAccount(t.Context(), ledger.FeeRevenue)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if a.Type != ledger.Revenue || len(a.Balances) != 1 || a.Balances[0].CreditMinor != 10 {
+			t.Errorf("got %+v", a)
+		}
+		if _, err := svc.GetAccount(t.Context(), "bank"); !errors.Is(err, ErrNotFound) {
+			t.Errorf("got error %v, want ErrNotFound", err)
+		}
+	})
+
+	t.Run("entries", func(t *testing.T) {
+		var kinds []ledger.Kind
+		req := ListEntriesRequest{Limit: 2}
+		for pages := 0; ; pages++ {
+			page, err := svc.ListEntries(t.Context(), req)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			for _, e := range page.Entries {
+				kinds = append(kinds, e.Kind)
+			}
+			if !page.HasMore {
+				if pages != 2 {
+					t.Errorf("got %d pages, want 3", pages+1)
+				}
+				break
+			}
+			req.Cursor = page.NextCursor
+		}
+		if len(kinds) != 5 || kinds[3] != ledger.KindPaymentCaptured || kinds[4] != ledger.KindFee {
+			t.Errorf("got entries %v", kinds)
+		}
+
+		page, err := svc.ListEntries(t.Context(), ListEntriesRequest{PaymentID: ids[1]})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if len(page.Entries) != 1 || page.Entries[0].PaymentID != ids[1] {
+			t.Errorf("got entries %+v for payment %d", page.Entries, ids[1])
+		}
+	})
+
+	t.Run("invalid entries request", func(t *testing.T) {
+		paymentCursor := encodeCursor("", repository.Payment{ID: 1})
+		for _, req := range []ListEntriesRequest{
+			{Account: "bank"},
+			{Limit: 101},
+			{Cursor: "!"},
+			{Cursor: paymentCursor},
+		} {
+			if _, err := svc.ListEntries(t.Context(), req); !errors.Is(err, ErrValidation) {
+				t.Errorf("%+v: got error %v, want ErrValidation", req, err)
+			}
+		}
+	})
+}
@@ -0,0 +1,161 @@
+package service
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"strings"
+	"time"
+
+	"github.com/eterrni/payments-api/internal/currency"
+	"github.com/eterrni/payments-api/internal/repository"
+)
+
+const (
+	DefaultPageSize = 20
+	MaxPageSize     = 100
+)
+
+var sortFields = map[string]repository.PaymentSort{
+	"created_at": repository.SortCreatedAt,
+	"amount":     repository.SortAmount,
+}
+
+// ListPaymentsRequest describes one page of payments. Sort is a field name,
+// optionally prefixed with "-" for descending order ("-created_at").
+type ListPaymentsRequest struct {
+	Currency    string
+	Status      repository.Status
+	MinAmount   *int64
+	MaxAmount   *int64
+	CreatedFrom *time.Time
+	CreatedTo   *time.Time
+	CustomerID  uint
+	Sort        string
+	Cursor      string
+	Limit       int
+}
+
+type PaymentPage struct {
+	Payments   []repository.Payment
+	NextCursor string
+	HasMore    bool
+}
+
+// cursor is the decoded form of the opaque next_cursor token. It carries the
+// sort order so that a token cannot be replayed against a different one.
+type cursor struct {
+	Sort        string    `json:"s"`
+	CreatedAt   time.Time `json:"c,omitempty"`
+	AmountMinor int64     `json:"a,omitempty"`
+	ID          uint      `json:"i"`
+}
+
+func (s *PaymentService) ListPayments(ctx context.Context, req ListPaymentsRequest) (*PaymentPage, error) {
+	return listPayments(ctx, s.repo, req)
+}
+
+func listPayments(ctx context.Context, repo repository.PaymentRepository, req ListPaymentsRequest) (*PaymentPage, error) {
+	filter, err := paymentFilter(req)
+	if err != nil {
+		return nil, err
+	}
+
+	limit := filter.Limit
+	filter.Limit = limit + 1
+	payments, err := repo.List(ctx, filter)
+	if err != nil {
+		return nil, fromRepository(err, "payment", 0)
+	}
+
+	page := &PaymentPage{Payments: payments}
+	if len(payments) > limit {
+		page.Payments = payments[:limit]
+		page.HasMore = true
+		page.NextCursor = encodeCursor(req.Sort, page.Payments[limit-1])
+	}
+	if page.Payments == nil {
+		page.Payments = []repository.Payment{}
+	}
+	return page, nil
+}
+
+func paymentFilter(req ListPaymentsRequest) (repository.PaymentFilter, error) {
+	verr := &ValidationError{}
+	filter := repository.PaymentFilter{
+		Currency:    req.Currency,
+		Status:      req.Status,
+		MinAmount:   req.MinAmount,
+		MaxAmount:   req.MaxAmount,
+		CreatedFrom: req.CreatedFrom,
+		CreatedTo:   req.CreatedTo,
+		CustomerID:  req.CustomerID,
+		Limit:       req.Limit,
+	}
+
+	if req.Currency != "" {
+		if _, ok := currency.Lookup(req.Currency); !ok {
+			verr.add("currency", `unsupported currency "`+req.Currency+`"`)
+		}
+	}
+	if req.Status != "" && !IsKnownStatus(req.Status) {
+		verr.add("status", `unknown status "`+string(req.Status)+`"`)
+	}
+	if req.MinAmount != nil && req.MaxAmount != nil && *req.MinAmount > *req.MaxAmount {
+		verr.add("amount_min", "must not be greater than amount_max")
+	}
+	if req.CreatedFrom != nil && req.CreatedTo != nil && !req.CreatedFrom.Before(*req.CreatedTo) {
+		verr.add("created_from", "must be before created_to")
+	}
+	switch {
+	case req.Limit == 0:
+		filter.Limit = DefaultPageSize
+	case req.Limit < 0 || req.Limit > MaxPageSize:
+		verr.add("limit", "must be between 1 and 100")
+	}
+
+	sort := req.Sort
+	if sort == "" {
+		sort = "created_at"
+	}
+	field, ok := sortFields[strings.TrimPrefix(sort, "-")]
+	if !ok {
+		verr.add("sort", `unknown sort field "`+sort+`"`)
+	}
+	filter.Sort = field
+	filter.Desc = strings.HasPrefix(sort, "-")
+
+	if req.Cursor != "" {
+		c, err := decodeCursor(req.Cursor)
+		if err != nil || c.Sort != sort {
+			verr.add("cursor", "invalid cursor")
+		} else {
+			filter.After = &repository.PaymentCursor{CreatedAt: c.CreatedAt, AmountMinor: c.AmountMinor, ID: c.ID}
+		}
+	}
+	return filter, verr.orNil()
+}
+
+func encodeCursor(sort string, last repository.Payment) string {
+	if sort == "" {
+		sort = "created_at"
+	}
+	c := cursor{Sort: sort, ID: last.ID}
+	if sortFields[strings.TrimPrefix(sort, "-")] == repository.SortAmount {
+		c.AmountMinor = last.AmountMinor
+	} else {
+		c.CreatedAt = last.CreatedAt
+	}
+	b, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func decodeCursor(token string) (cursor, error) {
+	var c cursor
+	b, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return c, err
+	}
+	err = json.Unmarshal(b, &c)
+	return c, err
+}
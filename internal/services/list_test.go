@@ -0,0 +1,135 @@
+package service
+
+import (
+	"errors"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/eterrni/payments-api/internal/repository"
+	"github.com/eterrni/payments-api/internal/repository/memory"
+)
+
+func TestPaymentService_ListPayments(t *testing.T) {
+	created := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	payments := []repository.Payment{
+		{AmountMinor: 100, Currency: "USD", CreatedAt: created},
+		{AmountMinor: 200, Currency: "USD", CreatedAt: created.Add(time.Second)},
+		{AmountMinor: 300, Currency: "USD", CreatedAt: created.Add(2 * time.Second)},
+	}
+	ids := func(page *PaymentPage) []uint {
+		var ids []uint
+		for _, p := range page.Payments {
+			ids = append(ids, p.ID)
+		}
+		return ids
+	}
+
+	t.Run("first page", func(t *testing.T) {
+		svc := NewPaymentService(newStore(t, payments...).Payments(), PaymentOptions{})
+
+		page, err := svc.ListPayments(t.Context(), ListPaymentsRequest{Limit: 2})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if len(page.Payments) != 2 || !page.HasMore || page.NextCursor == "" {
+			t.Fatalf("got %d payments, has_more %v, cursor %q", len(page.Payments), page.HasMore, page.NextCursor)
+		}
+		if got := ids(page); !slices.Equal(got, []uint{1, 2}) {
+			t.Errorf("got payments %v, want created_at ascending", got)
+		}
+	})
+
+	t.Run("next page", func(t *testing.T) {
+		svc := NewPaymentService(newStore(t, payments...).Payments(), PaymentOptions{})
+		first, _ := svc.ListPayments(t.Context(), ListPaymentsRequest{Limit: 2, Sort: "-amount"})
+		if got := ids(first); !slices.Equal(got, []uint{3, 2}) {
+			t.Fatalf("got payments %v, want amount descending", got)
+		}
+
+		page, err := svc.ListPayments(t.Context(), ListPaymentsRequest{Limit: 2, Sort: "-amount", Cursor: first.NextCursor})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if got := ids(page); !slices.Equal(got, []uint{1}) || page.HasMore {
+			t.Fatalf("got payments %v, has_more %v, want payment 1 only", got, page.HasMore)
+		}
+	})
+
+	t.Run("last page", func(t *testing.T) {
+		svc := NewPaymentService(newStore(t, payments...).Payments(), PaymentOptions{})
+
+		page, err := svc.ListPayments(t.Context(), ListPaymentsRequest{})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if len(page.Payments) != 3 || page.HasMore || page.NextCursor != "" {
+			t.Errorf("got %d payments, has_more %v, cursor %q", len(page.Payments), page.HasMore, page.NextCursor)
+		}
+	})
+
+	t.Run("empty", func(t *testing.T) {
+		svc := NewPaymentService(memory.NewStore().Payments(), PaymentOptions{})
+
+		page, err := svc.ListPayments(t.Context(), ListPaymentsRequest{})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if page.Payments == nil {
+			t.Error("payments must not be nil")
+		}
+	})
+
+	t.Run("default page size", func(t *testing.T) {
+		many := make([]repository.Payment, DefaultPageSize+1)
+		for i := range many {
+			many[i] = repository.Payment{AmountMinor: 100, Currency: "USD"}
+		}
+		svc := NewPaymentService(newStore(t, many...).Payments(), PaymentOptions{})
+
+		page, err := svc.ListPayments(t.Context(), ListPaymentsRequest{})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if len(page.Payments) != DefaultPageSize || !page.HasMore {
+			t.Errorf("got %d payments, has_more %v, want the default page size", len(page.Payments), page.HasMore)
+		}
+	})
+
+	t.Run("cursor from another sort order", func(t *testing.T) {
+		svc := NewPaymentService(newStore(t, payments...).Payments(), PaymentOptions{})
+		first, _ := svc.ListPayments(t.Context(), ListPaymentsRequest{Limit: 1, Sort: "amount"})
+
+		_, err := svc.ListPayments(t.Context(), ListPaymentsRequest{Limit: 1, Sort: "created_at", Cursor: first.NextCursor})
+		var verr *ValidationError
+		if !errors.As(err, &verr) {
+			t.Fatalf("got error %v, want *ValidationError", err)
+		}
+	})
+
+	t.Run("invalid request", func(t *testing.T) {
+		min, max := int64(500), int64(100)
+		tests := []struct {
+			name string
+			req  ListPaymentsRequest
+		}{
+			{"currency", ListPaymentsRequest{Currency: "XYZ"}},
+			{"status", ListPaymentsRequest{Status: "lost"}},
+			{"amount range", ListPaymentsRequest{MinAmount: &min, MaxAmount: &max}},
+			{"created range", ListPaymentsRequest{CreatedFrom: &created, CreatedTo: &created}},
+			{"sort", ListPaymentsRequest{Sort: "currency"}},
+			{"limit", ListPaymentsRequest{Limit: MaxPageSize + 1}},
+			{"cursor", ListPaymentsRequest{Cursor: "not a cursor"}},
+		}
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				svc := NewPaymentService(memory.NewStore().Payments(), PaymentOptions{})
+				_, err := svc.ListPayments(t.Context(), tt.req)
+				var verr *ValidationError
+				if !errors.As(err, &verr) {
+					t.Fatalf("got error %v, want *ValidationError", err)
+				}
+			})
+		}
+	})
+}
@@ -0,0 +1,245 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"unicode/utf8"
+
+	"github.com/eterrni/payments-api/internal/currency"
+	"github.com/eterrni/payments-api/internal/money"
+	"github.com/eterrni/payments-api/internal/repository"
+)
+
+// PaymentPatch is a JSON merge patch (RFC 7396) of a payment: every member
+// replaces the field of the same name, and null removes it.
+type PaymentPatch map[string]json.RawMessage
+
+// mutability says whether clients may change a payment field.
+type mutability int
+
+const (
+	readOnly mutability = iota
+	// untilAuthorized fields are frozen once the payment leaves pending.
+	untilAuthorized
+	mutable
+)
+
+// paymentFields lists every field of a payment by its JSON name.
+var paymentFields = map[string]mutability{
+	"id":                       readOnly,
+	"merchant_id":              readOnly,
+	"status":                   readOnly,
+	"refunded_minor":           readOnly,
+	"authorized_minor":         readOnly,
+	"captured_minor":           readOnly,
+	"fee_minor":                readOnly,
+	"customer_id":              readOnly,
+	"authorization_expires_at": readOnly,
+	"version":                  readOnly,
+	"created_at":               readOnly,
+	"updated_at":               readOnly,
+	"canceled_at":              readOnly,
+	"canceled_by":              readOnly,
+	"amount":                   untilAuthorized,
+	"amount_minor":             untilAuthorized,
+	"currency":                 untilAuthorized,
+	"description":              mutable,
+	"metadata":                 mutable,
+}
+
+const (
+	maxDescriptionLength   = 1000
+	maxMetadataKeys        = 50
+	maxMetadataKeyLength   = 40
+	maxMetadataValueLength = 500
+)
+
+// paymentChanges is a PaymentPatch decoded into the fields it sets.
+type paymentChanges struct {
+	description *string
+	// metadata maps keys to their new values, or to nil to remove them.
+	metadata      map[string]*string
+	clearMetadata bool
+	amountMinor   *int64
+	amount        *string
+	currency      *string
+}
+
+// PatchPayment applies patch to the payment if it is still at version, or
+// to whatever version is stored if version is 0. Fields that are unknown,
+// read-only or frozen in the status of the payment are rejected with a
+// *ValidationError that names each of them.
+func (s *PaymentService) PatchPayment(ctx context.Context, id uint, version int64, patch PaymentPatch) (*repository.Payment, error) {
+	changes, err := decodePaymentPatch(patch)
+	if err != nil {
+		return nil, err
+	}
+	updated, err := s.repo.Update(ctx, id, version, func(p *repository.Payment) error {
+		verr := &ValidationError{}
+		changes.apply(p, verr)
+		return verr.orNil()
+	})
+	return updated, fromRepository(err, "payment", id)
+}
+
+func decodePaymentPatch(patch PaymentPatch) (*paymentChanges, error) {
+	verr := &ValidationError{}
+	c := &paymentChanges{}
+	fields := make([]string, 0, len(patch))
+	for field := range patch {
+		fields = append(fields, field)
+	}
+	slices.Sort(fields)
+
+	for _, field := range fields {
+		value := patch[field]
+		null := bytes.Equal(bytes.TrimSpace(value), []byte("null"))
+		m, ok := paymentFields[field]
+		switch {
+		case !ok:
+			verr.add(field, fmt.Sprintf("unknown field %s", field))
+			continue
+		case m == readOnly:
+			verr.add(field, fmt.Sprintf("%s is read-only", field))
+			continue
+		}
+
+		switch field {
+		case "description":
+			var d string
+			if !null && json.Unmarshal(value, &d) != nil {
+				verr.add(field, "description must be a string or null")
+				continue
+			}
+			c.description = &d
+		case "metadata":
+			if null {
+				c.clearMetadata = true
+				continue
+			}
+			if json.Unmarshal(value, &c.metadata) != nil {
+				verr.add(field, "metadata must be an object of strings or null")
+			}
+		case "amount_minor":
+			var n int64
+			if null || json.Unmarshal(value, &n) != nil {
+				verr.add(field, "amount_minor must be an integer")
+				continue
+			}
+			c.amountMinor = &n
+		case "amount":
+			var n json.Number
+			if null || json.Unmarshal(value, &n) != nil {
+				verr.add(field, "amount must be a decimal number")
+				continue
+			}
+			a := n.String()
+			c.amount = &a
+		case "currency":
+			var code string
+			if null || json.Unmarshal(value, &code) != nil {
+				verr.add(field, "currency must be a string")
+				continue
+			}
+			c.currency = &code
+		}
+	}
+	if c.amount != nil && c.amountMinor != nil {
+		verr.add("amount", "only one of amount and amount_minor may be set")
+	}
+	return c, verr.orNil()
+}
+
+// apply changes p, adding the changes that p does not allow to verr.
+func (c *paymentChanges) apply(p *repository.Payment, verr *ValidationError) {
+	if c.amountMinor != nil || c.amount != nil || c.currency != nil {
+		amount, field := p.Money(), "amount_minor"
+		if c.currency != nil {
+			amount.Currency = *c.currency
+		}
+		switch {
+		case c.amountMinor != nil:
+			amount.Amount = *c.amountMinor
+		case c.amount != nil:
+			field = "amount"
+			if currency.Validate(amount.Currency) == nil {
+				parsed, err := money.Parse(*c.amount, amount.Currency)
+				if err != nil {
+					verr.add(field, err.Error())
+					return
+				}
+				amount = parsed
+			}
+		}
+		setAmount(p, field, amount, verr)
+	}
+
+	if c.description != nil {
+		p.Description = *c.description
+	}
+	if c.clearMetadata {
+		p.Metadata = nil
+	}
+	for key, value := range c.metadata {
+		switch {
+		case value == nil:
+			delete(p.Metadata, key)
+		case p.Metadata == nil:
+			p.Metadata = repository.Metadata{key: *value}
+		default:
+			p.Metadata[key] = *value
+		}
+	}
+	validateDetails(p, verr)
+}
+
+// setAmount changes the amount of p to amount, reporting a change after the
+// payment has left pending under field (or "currency").
+func setAmount(p *repository.Payment, field string, amount money.Money, verr *ValidationError) {
+	if amount == p.Money() {
+		return
+	}
+	if p.Status != repository.StatusPending {
+		if amount.Amount != p.AmountMinor {
+			verr.add(field, fmt.Sprintf("%s can only be changed while the payment is pending, not %s", field, p.Status))
+		}
+		if amount.Currency != p.Currency {
+			verr.add("currency", fmt.Sprintf("currency can only be changed while the payment is pending, not %s", p.Status))
+		}
+		return
+	}
+	before := len(verr.Fields)
+	validateMoney(amount, field, verr)
+	if len(verr.Fields) == before {
+		p.AmountMinor, p.Currency = amount.Amount, amount.Currency
+	}
+}
+
+func validateDetails(p *repository.Payment, verr *ValidationError) {
+	if utf8.RuneCountInString(p.Description) > maxDescriptionLength {
+		verr.add("description", fmt.Sprintf("description must be at most %d characters", maxDescriptionLength))
+	}
+	validateMetadata(p.Metadata, verr)
+}
+
+func validateMetadata(metadata repository.Metadata, verr *ValidationError) {
+	if len(metadata) > maxMetadataKeys {
+		verr.add("metadata", fmt.Sprintf("metadata can have at most %d keys", maxMetadataKeys))
+	}
+	keys := make([]string, 0, len(metadata))
+	for key := range metadata {
+		keys = append(keys, key)
+	}
+	slices.Sort(keys)
+	for _, key := range keys {
+		switch {
+		case key == "" || utf8.RuneCountInString(key) > maxMetadataKeyLength:
+			verr.add("metadata", fmt.Sprintf("metadata key %q must be 1 to %d characters", key, maxMetadataKeyLength))
+		case utf8.RuneCountInString(metadata[key]) > maxMetadataValueLength:
+			verr.add("metadata", fmt.Sprintf("metadata value of %q must be at most %d characters", key, maxMetadataValueLength))
+		}
+	}
+}
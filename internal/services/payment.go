@@ -1,49 +1,157 @@
 package service
 
 import (
+	"context"
 	"errors"
+	"fmt"
+	"time"
 
+	"github.com/eterrni/payments-api/internal/currency"
+	"github.com/eterrni/payments-api/internal/money"
 	"github.com/eterrni/payments-api/internal/repository"
 )
 
 type PaymentService struct {
 	repo repository.PaymentRepository
+	opts PaymentOptions
+}
+
+// PaymentOptions configure a PaymentService. The zero value charges no fees
+// and keeps authorizations valid until they are captured or voided.
+type PaymentOptions struct {
+	// AuthorizationTTL is how long an authorization can be captured.
+	AuthorizationTTL time.Duration
+	// FeeBasisPoints is the fee charged on the captured amount, in
+	// hundredths of a percent.
+	FeeBasisPoints int64
 }
 
 type PaymentRequest struct {
-	Amount   float64 `json:"amount"`
-	Currency string  `json:"currency"`
+	Amount money.Money
+	// CustomerID links a new payment to a customer. It is ignored by
+	// UpdatePayment.
+	CustomerID *uint
+}
+
+func NewPaymentService(repo repository.PaymentRepository, opts PaymentOptions) PaymentService {
+	return PaymentService{repo: repo, opts: opts}
+}
+
+func (s *PaymentService) CreatePayment(ctx context.Context, payment PaymentRequest) (*repository.Payment, error) {
+	if err := validatePaymentRequest(payment); err != nil {
+		return nil, err
+	}
+
+	created := &repository.Payment{
+		AmountMinor: payment.Amount.Amount,
+		Currency:    payment.Amount.Currency,
+		Status:      repository.StatusPending,
+		CustomerID:  payment.CustomerID,
+	}
+	err := s.repo.CreatePayment(ctx, created)
+	if errors.Is(err, repository.ErrCustomerNotFound) {
+		verr := &ValidationError{}
+		verr.add("customer_id", fmt.Sprintf("customer %d not found", *payment.CustomerID))
+		return nil, verr
+	}
+	if err != nil {
+		return nil, fromRepository(err, "payment", 0)
+	}
+	return created, nil
 }
 
-func NewPaymentService(repo repository.PaymentRepository) PaymentService {
-	return PaymentService{repo: repo}
+func (s *PaymentService) GetPayment(ctx context.Context, id uint) (*repository.Payment, error) {
+	payment, err := s.repo.GetByID(ctx, id)
+	return payment, fromRepository(err, "payment", id)
 }
 
-func (s *PaymentService) CreatePayment(payment PaymentRequest) error {
-	if payment.Amount <= 0 {
-		return errors.New("invalid payment amount")
+// UpdatePayment replaces the amount of the payment if it is still at
+// version, failing with ErrVersionMismatch otherwise. Version 0 updates
+// whatever version is stored. Like PatchPayment, it cannot change the
+// amount once the payment has been authorized.
+func (s *PaymentService) UpdatePayment(ctx context.Context, id uint, version int64, payment PaymentRequest) (*repository.Payment, error) {
+	if err := validatePaymentRequest(payment); err != nil {
+		return nil, err
 	}
+	updated, err := s.repo.Update(ctx, id, version, func(p *repository.Payment) error {
+		verr := &ValidationError{}
+		setAmount(p, "amount", payment.Amount, verr)
+		return verr.orNil()
+	})
+	return updated, fromRepository(err, "payment", id)
+}
 
-	return s.repo.CreatePayment(repository.Payment{
-		Amount:   payment.Amount,
-		Currency: payment.Currency,
+// DeletePayment voids the payment and hides it from the API. The row is kept
+// with the time and actor of the deletion; only payments that can still be
+// canceled may be deleted.
+func (s *PaymentService) DeletePayment(ctx context.Context, id uint, actor string) error {
+	_, err := s.repo.Transition(ctx, id, "deleted", actor, func(p *repository.Payment) error {
+		if err := transition(p, repository.StatusCanceled); err != nil {
+			return err
+		}
+		now := time.Now()
+		markCanceled(p, actor, now)
+		p.DeletedAt = &now
+		p.DeletedBy = actor
+		return nil
 	})
+	return fromRepository(err, "payment", id)
 }
 
-func (s *PaymentService) GetPayment(id uint) (*repository.Payment, error) {
-	return s.repo.GetByID(id)
+// PurgePayment permanently removes a deleted payment. It is meant for
+// administrators only and is not exposed through the public API.
+func (s *PaymentService) PurgePayment(ctx context.Context, id uint) error {
+	return fromRepository(s.repo.Purge(ctx, id), "deleted payment", id)
 }
 
-func (s *PaymentService) UpdatePayment(id uint, payment PaymentRequest) error {
-	if payment.Amount <= 0 {
-		return errors.New("invalid payment amount")
+// TransitionPayment moves a payment to status, rejecting moves the payment
+// lifecycle does not allow with a *TransitionError. Moves to authorized and
+// captured go through Authorize and a full Capture.
+func (s *PaymentService) TransitionPayment(ctx context.Context, id uint, status repository.Status, reason, actor string) (*repository.Payment, error) {
+	switch status {
+	case repository.StatusAuthorized:
+		return s.Authorize(ctx, id, reason, actor)
+	case repository.StatusCaptured:
+		return s.Capture(ctx, id, CaptureRequest{Reason: reason, Actor: actor})
 	}
-	return s.repo.Update(id, repository.Payment{
-		Amount:   payment.Amount,
-		Currency: payment.Currency,
+	payment, err := s.repo.Transition(ctx, id, reason, actor, func(p *repository.Payment) error {
+		if err := transition(p, status); err != nil {
+			return err
+		}
+		if status == repository.StatusCanceled {
+			markCanceled(p, actor, time.Now())
+		}
+		return nil
 	})
+	return payment, fromRepository(err, "payment", id)
+}
+
+func (s *PaymentService) ListTransitions(ctx context.Context, id uint) ([]repository.PaymentTransition, error) {
+	if _, err := s.repo.GetByID(ctx, id); err != nil {
+		return nil, fromRepository(err, "payment", id)
+	}
+	transitions, err := s.repo.ListTransitions(ctx, id)
+	return transitions, fromRepository(err, "payment", id)
 }
 
-func (s *PaymentService) DeletePayment(id uint) error {
-	return s.repo.Delete(id)
+func markCanceled(p *repository.Payment, actor string, at time.Time) {
+	p.CanceledAt = &at
+	p.CanceledBy = actor
+}
+
+func validatePaymentRequest(payment PaymentRequest) error {
+	verr := &ValidationError{}
+	validateMoney(payment.Amount, "amount", verr)
+	return verr.orNil()
+}
+
+// validateMoney checks the amount of a payment, reporting the amount itself
+// under field.
+func validateMoney(amount money.Money, field string, verr *ValidationError) {
+	if !amount.IsPositive() {
+		verr.add(field, "invalid payment amount")
+	}
+	if err := currency.Validate(amount.Currency); err != nil {
+		verr.add("currency", err.Error())
+	}
 }
@@ -1,55 +1,91 @@
 package service
 
 import (
+	"context"
+	"encoding/json"
 	"errors"
+	"fmt"
+	"slices"
+	"strings"
 	"testing"
+	"time"
 
+	"github.com/eterrni/payments-api/internal/money"
 	"github.com/eterrni/payments-api/internal/repository"
+	"github.com/eterrni/payments-api/internal/repository/memory"
 )
 
-type mockPaymentRepository struct {
-	createErr error
-	getResult *repository.Payment
-	getErr    error
-	updateErr error
-	deleteErr error
+// newStore returns a memory store holding payments as given, whatever their
+// status; the first one gets ID 1.
+func newStore(t *testing.T, payments ...repository.Payment) *memory.Store {
+	t.Helper()
+	store := memory.NewStore()
+	for _, p := range payments {
+		if err := store.Payments().CreatePayment(t.Context(), &p); err != nil {
+			t.Fatalf("create payment: %v", err)
+		}
+	}
+	return store
+}
+
+// brokenPayments is a payment repository whose every call fails with err.
+type brokenPayments struct {
+	err error
+}
+
+func (b brokenPayments) CreatePayment(ctx context.Context, payment *repository.Payment) error {
+	return b.err
+}
+
+func (b brokenPayments) GetByID(ctx context.Context, id uint) (*repository.Payment, error) {
+	return nil, b.err
+}
+
+func (b brokenPayments) List(ctx context.Context, filter repository.PaymentFilter) ([]repository.Payment, error) {
+	return nil, b.err
 }
 
-func (m *mockPaymentRepository) CreatePayment(payment repository.Payment) error {
-	return m.createErr
+func (b brokenPayments) Update(ctx context.Context, id uint, version int64, apply func(p *repository.Payment) error) (*repository.Payment, error) {
+	return nil, b.err
 }
 
-func (m *mockPaymentRepository) GetByID(id uint) (*repository.Payment, error) {
-	return m.getResult, m.getErr
+func (b brokenPayments) Transition(ctx context.Context, id uint, reason, actor string, apply func(p *repository.Payment) error) (*repository.Payment, error) {
+	return nil, b.err
 }
 
-func (m *mockPaymentRepository) Update(id uint, payment repository.Payment) error {
-	return m.updateErr
+func (b brokenPayments) ListTransitions(ctx context.Context, paymentID uint) ([]repository.PaymentTransition, error) {
+	return nil, b.err
 }
 
-func (m *mockPaymentRepository) Delete(id uint) error {
-	return m.deleteErr
+func (b brokenPayments) Purge(ctx context.Context, id uint) error {
+	return b.err
 }
 
 func TestPaymentService_CreatePayment(t *testing.T) {
 	t.Run("success", func(t *testing.T) {
-		repo := &mockPaymentRepository{}
-		svc := NewPaymentService(repo)
+		repo := memory.NewStore().Payments()
+		svc := NewPaymentService(repo, PaymentOptions{})
 
-		err := svc.CreatePayment(PaymentRequest{Amount: 100.5, Currency: "USD"})
+		payment, err := svc.CreatePayment(t.Context(), PaymentRequest{Amount: money.Money{Amount: 10050, Currency: "USD"}})
 		if err != nil {
 			t.Fatalf("unexpected error: %v", err)
 		}
-		if repo.createErr != nil {
-			t.Fatal("createErr should be nil")
+		if payment.ID != 1 || payment.AmountMinor != 10050 {
+			t.Errorf("created payment not returned: %+v", payment)
+		}
+		stored, err := repo.GetByID(t.Context(), payment.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if stored.Status != repository.StatusPending {
+			t.Errorf("got status %q, want %q", stored.Status, repository.StatusPending)
 		}
 	})
 
 	t.Run("invalid amount zero", func(t *testing.T) {
-		repo := &mockPaymentRepository{}
-		svc := NewPaymentService(repo)
+		svc := NewPaymentService(memory.NewStore().Payments(), PaymentOptions{})
 
-		err := svc.CreatePayment(PaymentRequest{Amount: 0, Currency: "USD"})
+		_, err := svc.CreatePayment(t.Context(), PaymentRequest{Amount: money.Money{Amount: 0, Currency: "USD"}})
 		if err == nil {
 			t.Fatal("expected error for zero amount")
 		}
@@ -59,20 +95,46 @@ func TestPaymentService_CreatePayment(t *testing.T) {
 	})
 
 	t.Run("invalid amount negative", func(t *testing.T) {
-		repo := &mockPaymentRepository{}
-		svc := NewPaymentService(repo)
+		svc := NewPaymentService(memory.NewStore().Payments(), PaymentOptions{})
 
-		err := svc.CreatePayment(PaymentRequest{Amount: -10, Currency: "USD"})
+		_, err := svc.CreatePayment(t.Context(), PaymentRequest{Amount: money.Money{Amount: -1000, Currency: "USD"}})
 		if err == nil {
 			t.Fatal("expected error for negative amount")
 		}
 	})
 
+	t.Run("invalid currency", func(t *testing.T) {
+		for _, code := range []string{"", "usd", "XYZ", "HRK"} {
+			svc := NewPaymentService(memory.NewStore().Payments(), PaymentOptions{})
+
+			_, err := svc.CreatePayment(t.Context(), PaymentRequest{Amount: money.Money{Amount: 100, Currency: code}})
+			var verr *ValidationError
+			if !errors.As(err, &verr) {
+				t.Fatalf("%q: got error %v, want *ValidationError", code, err)
+			}
+			if len(verr.Fields) != 1 || verr.Fields[0].Field != "currency" {
+				t.Errorf("%q: got fields %+v", code, verr.Fields)
+			}
+		}
+	})
+
+	t.Run("reports every invalid field", func(t *testing.T) {
+		svc := NewPaymentService(memory.NewStore().Payments(), PaymentOptions{})
+
+		_, err := svc.CreatePayment(t.Context(), PaymentRequest{Amount: money.Money{Amount: 0, Currency: "XYZ"}})
+		var verr *ValidationError
+		if !errors.As(err, &verr) {
+			t.Fatalf("got error %v, want *ValidationError", err)
+		}
+		if len(verr.Fields) != 2 {
+			t.Errorf("got fields %+v, want amount and currency", verr.Fields)
+		}
+	})
+
 	t.Run("repository error", func(t *testing.T) {
-		repo := &mockPaymentRepository{createErr: errors.New("db error")}
-		svc := NewPaymentService(repo)
+		svc := NewPaymentService(brokenPayments{errors.New("db error")}, PaymentOptions{})
 
-		err := svc.CreatePayment(PaymentRequest{Amount: 100, Currency: "USD"})
+		_, err := svc.CreatePayment(t.Context(), PaymentRequest{Amount: money.Money{Amount: 10000, Currency: "USD"}})
 		if err == nil {
 			t.Fatal("expected error from repository")
 		}
@@ -83,81 +145,432 @@ func TestPaymentService_CreatePayment(t *testing.T) {
 }
 
 func TestPaymentService_GetPayment(t *testing.T) {
+	stored := repository.Payment{AmountMinor: 5000, Currency: "EUR"}
+
 	t.Run("success", func(t *testing.T) {
-		expected := &repository.Payment{ID: 1, Amount: 50, Currency: "EUR"}
-		repo := &mockPaymentRepository{getResult: expected}
-		svc := NewPaymentService(repo)
+		svc := NewPaymentService(newStore(t, stored).Payments(), PaymentOptions{})
 
-		payment, err := svc.GetPayment(1)
+		payment, err := svc.GetPayment(t.Context(), 1)
 		if err != nil {
 			t.Fatalf("unexpected error: %v", err)
 		}
-		if payment != expected {
-			t.Errorf("got %+v, want %+v", payment, expected)
+		if payment.ID != 1 || payment.AmountMinor != stored.AmountMinor || payment.Currency != stored.Currency {
+			t.Errorf("got %+v, want %+v", payment, stored)
 		}
 	})
 
 	t.Run("not found", func(t *testing.T) {
-		repo := &mockPaymentRepository{getErr: errors.New("record not found")}
-		svc := NewPaymentService(repo)
+		svc := NewPaymentService(newStore(t, stored).Payments(), PaymentOptions{})
 
-		_, err := svc.GetPayment(999)
-		if err == nil {
-			t.Fatal("expected error")
+		_, err := svc.GetPayment(t.Context(), 999)
+		if !errors.Is(err, ErrNotFound) {
+			t.Fatalf("got error %v, want ErrNotFound", err)
+		}
+		if err.Error() != "payment 999 not found" {
+			t.Errorf("got message %q", err.Error())
+		}
+	})
+
+	t.Run("database unavailable", func(t *testing.T) {
+		svc := NewPaymentService(brokenPayments{fmt.Errorf("%w: connection refused", repository.ErrUnavailable)}, PaymentOptions{})
+
+		_, err := svc.GetPayment(t.Context(), 1)
+		if !errors.Is(err, ErrUnavailable) {
+			t.Fatalf("got error %v, want ErrUnavailable", err)
+		}
+		if errors.Is(err, ErrNotFound) {
+			t.Error("outage must not look like a missing payment")
+		}
+	})
+
+	t.Run("database timeout", func(t *testing.T) {
+		svc := NewPaymentService(newStore(t, stored).Payments(), PaymentOptions{})
+		ctx, cancel := context.WithDeadline(t.Context(), time.Now())
+		defer cancel()
+
+		_, err := svc.GetPayment(ctx, 1)
+		if !errors.Is(err, ErrUnavailable) {
+			t.Errorf("got error %v, want ErrUnavailable", err)
+		}
+	})
+
+	t.Run("canceled request", func(t *testing.T) {
+		svc := NewPaymentService(newStore(t, stored).Payments(), PaymentOptions{})
+		ctx, cancel := context.WithCancel(t.Context())
+		cancel()
+
+		_, err := svc.GetPayment(ctx, 1)
+		if !errors.Is(err, context.Canceled) || errors.Is(err, ErrUnavailable) {
+			t.Errorf("got error %v, want context.Canceled", err)
 		}
 	})
 }
 
 func TestPaymentService_UpdatePayment(t *testing.T) {
+	pending := repository.Payment{AmountMinor: 10000, Currency: "USD"}
+
 	t.Run("success", func(t *testing.T) {
-		repo := &mockPaymentRepository{}
-		svc := NewPaymentService(repo)
+		svc := NewPaymentService(newStore(t, pending).Payments(), PaymentOptions{})
 
-		err := svc.UpdatePayment(1, PaymentRequest{Amount: 200, Currency: "USD"})
+		payment, err := svc.UpdatePayment(t.Context(), 1, 1, PaymentRequest{Amount: money.Money{Amount: 20000, Currency: "USD"}})
 		if err != nil {
 			t.Fatalf("unexpected error: %v", err)
 		}
+		if payment.AmountMinor != 20000 || payment.Version != 2 {
+			t.Errorf("updated payment not returned: %+v", payment)
+		}
+	})
+
+	t.Run("stale version", func(t *testing.T) {
+		svc := NewPaymentService(newStore(t, pending).Payments(), PaymentOptions{})
+
+		_, err := svc.UpdatePayment(t.Context(), 1, 3, PaymentRequest{Amount: money.Money{Amount: 10000, Currency: "USD"}})
+		if !errors.Is(err, ErrVersionMismatch) {
+			t.Fatalf("got error %v, want ErrVersionMismatch", err)
+		}
+		if err.Error() != "payment 1 has been modified" {
+			t.Errorf("got message %q", err.Error())
+		}
 	})
 
 	t.Run("invalid amount", func(t *testing.T) {
-		repo := &mockPaymentRepository{}
-		svc := NewPaymentService(repo)
+		svc := NewPaymentService(newStore(t, pending).Payments(), PaymentOptions{})
 
-		err := svc.UpdatePayment(1, PaymentRequest{Amount: 0, Currency: "USD"})
+		_, err := svc.UpdatePayment(t.Context(), 1, 1, PaymentRequest{Amount: money.Money{Amount: 0, Currency: "USD"}})
 		if err == nil {
 			t.Fatal("expected error for invalid amount")
 		}
 	})
 
+	t.Run("invalid currency", func(t *testing.T) {
+		svc := NewPaymentService(newStore(t, pending).Payments(), PaymentOptions{})
+
+		_, err := svc.UpdatePayment(t.Context(), 1, 1, PaymentRequest{Amount: money.Money{Amount: 100, Currency: "usd"}})
+		var verr *ValidationError
+		if !errors.As(err, &verr) {
+			t.Fatalf("got error %v, want *ValidationError", err)
+		}
+	})
+
+	t.Run("amount frozen after authorization", func(t *testing.T) {
+		authorized := pending
+		authorized.Status, authorized.AuthorizedMinor = repository.StatusAuthorized, pending.AmountMinor
+		repo := newStore(t, authorized).Payments()
+		svc := NewPaymentService(repo, PaymentOptions{})
+
+		_, err := svc.UpdatePayment(t.Context(), 1, 1, PaymentRequest{Amount: money.Money{Amount: 20000, Currency: "USD"}})
+		var verr *ValidationError
+		if !errors.As(err, &verr) || len(verr.Fields) != 1 || verr.Fields[0].Field != "amount" {
+			t.Fatalf("got error %v, want a validation error of amount", err)
+		}
+		if stored, _ := repo.GetByID(t.Context(), 1); stored.Version != 1 {
+			t.Errorf("payment was written: %+v", stored)
+		}
+
+		if _, err := svc.UpdatePayment(t.Context(), 1, 1, PaymentRequest{Amount: money.Money{Amount: 10000, Currency: "USD"}}); err != nil {
+			t.Errorf("unchanged amount: got error %v", err)
+		}
+	})
+
+	t.Run("missing payment", func(t *testing.T) {
+		svc := NewPaymentService(newStore(t, pending).Payments(), PaymentOptions{})
+
+		_, err := svc.UpdatePayment(t.Context(), 42, 1, PaymentRequest{Amount: money.Money{Amount: 10000, Currency: "USD"}})
+		if !errors.Is(err, ErrNotFound) {
+			t.Fatalf("got error %v, want ErrNotFound", err)
+		}
+	})
+
 	t.Run("repository error", func(t *testing.T) {
-		repo := &mockPaymentRepository{updateErr: errors.New("update failed")}
-		svc := NewPaymentService(repo)
+		svc := NewPaymentService(brokenPayments{errors.New("update failed")}, PaymentOptions{})
 
-		err := svc.UpdatePayment(1, PaymentRequest{Amount: 100, Currency: "USD"})
+		_, err := svc.UpdatePayment(t.Context(), 1, 1, PaymentRequest{Amount: money.Money{Amount: 10000, Currency: "USD"}})
 		if err == nil {
 			t.Fatal("expected error from repository")
 		}
 	})
 }
 
+func TestPaymentService_PatchPayment(t *testing.T) {
+	pending := repository.Payment{
+		AmountMinor: 10000,
+		Currency:    "USD",
+		Status:      repository.StatusPending,
+		Description: "order 1",
+		Metadata:    repository.Metadata{"order": "1", "channel": "web"},
+	}
+	authorized := pending
+	authorized.Status, authorized.AuthorizedMinor = repository.StatusAuthorized, pending.AmountMinor
+
+	tests := []struct {
+		name       string
+		payment    repository.Payment
+		patch      string
+		want       func(p *repository.Payment) bool
+		wantFields []string
+	}{
+		{
+			name:    "merges metadata",
+			payment: pending,
+			patch:   `{"description": "order 2", "metadata": {"order": "2", "channel": null, "note": ""}}`,
+			want: func(p *repository.Payment) bool {
+				return p.Description == "order 2" && len(p.Metadata) == 2 && p.Metadata["order"] == "2" && p.Metadata["note"] == ""
+			},
+		},
+		{
+			name:    "null removes",
+			payment: authorized,
+			patch:   `{"description": null, "metadata": null}`,
+			want: func(p *repository.Payment) bool {
+				return p.Description == "" && p.Metadata == nil && p.AmountMinor == 10000
+			},
+		},
+		{
+			name:    "metadata added to empty",
+			payment: repository.Payment{AmountMinor: 100, CapturedMinor: 100, Currency: "USD", Status: repository.StatusCaptured},
+			patch:   `{"metadata": {"order": "1"}}`,
+			want:    func(p *repository.Payment) bool { return p.Metadata["order"] == "1" },
+		},
+		{
+			name:    "amount while pending",
+			payment: pending,
+			patch:   `{"amount": "12.5", "currency": "EUR"}`,
+			want: func(p *repository.Payment) bool {
+				return p.AmountMinor == 1250 && p.Currency == "EUR"
+			},
+		},
+		{
+			name:    "unchanged amount after authorization",
+			payment: authorized,
+			patch:   `{"amount_minor": 10000, "currency": "USD", "description": "x"}`,
+			want:    func(p *repository.Payment) bool { return p.Description == "x" },
+		},
+		{
+			name:       "amount frozen after authorization",
+			payment:    authorized,
+			patch:      `{"amount_minor": 500, "currency": "EUR", "description": "x"}`,
+			wantFields: []string{"amount_minor", "currency"},
+		},
+		{
+			name:       "read-only and unknown fields",
+			payment:    pending,
+			patch:      `{"status": "captured", "id": 2, "colour": "red", "description": "x"}`,
+			wantFields: []string{"colour", "id", "status"},
+		},
+		{
+			name:       "wrong types",
+			payment:    pending,
+			patch:      `{"description": 5, "metadata": {"order": 1}, "amount_minor": null, "currency": null}`,
+			wantFields: []string{"amount_minor", "currency", "description", "metadata"},
+		},
+		{
+			name:       "amount and amount_minor",
+			payment:    pending,
+			patch:      `{"amount": "1.00", "amount_minor": 100}`,
+			wantFields: []string{"amount"},
+		},
+		{
+			name:       "invalid amount",
+			payment:    pending,
+			patch:      `{"amount_minor": 0, "currency": "XYZ"}`,
+			wantFields: []string{"amount_minor", "currency"},
+		},
+		{
+			name:       "limits",
+			payment:    pending,
+			patch:      fmt.Sprintf(`{"description": %q, "metadata": {"": "x", %q: "x"}}`, strings.Repeat("d", 1001), strings.Repeat("k", 41)),
+			wantFields: []string{"description", "metadata", "metadata"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := newStore(t, tt.payment).Payments()
+			svc := NewPaymentService(repo, PaymentOptions{})
+
+			var patch PaymentPatch
+			if err := json.Unmarshal([]byte(tt.patch), &patch); err != nil {
+				t.Fatal(err)
+			}
+			updated, err := svc.PatchPayment(t.Context(), 1, 1, patch)
+
+			if tt.wantFields != nil {
+				var verr *ValidationError
+				if !errors.As(err, &verr) {
+					t.Fatalf("got error %v, want *ValidationError", err)
+				}
+				var fields []string
+				for _, f := range verr.Fields {
+					fields = append(fields, f.Field)
+				}
+				if !slices.Equal(fields, tt.wantFields) {
+					t.Errorf("got fields %v, want %v (%v)", fields, tt.wantFields, verr)
+				}
+				if stored, _ := repo.GetByID(t.Context(), 1); stored.Version != 1 {
+					t.Errorf("payment was written: %+v", stored)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !tt.want(updated) {
+				t.Errorf("got %+v", updated)
+			}
+			if stored, _ := repo.GetByID(t.Context(), 1); !tt.want(stored) {
+				t.Errorf("got stored %+v", stored)
+			}
+		})
+	}
+
+	t.Run("stale version", func(t *testing.T) {
+		svc := NewPaymentService(newStore(t, pending).Payments(), PaymentOptions{})
+
+		_, err := svc.PatchPayment(t.Context(), 1, 3, PaymentPatch{"description": json.RawMessage(`"x"`)})
+		if !errors.Is(err, ErrVersionMismatch) {
+			t.Errorf("got error %v, want ErrVersionMismatch", err)
+		}
+	})
+}
+
 func TestPaymentService_DeletePayment(t *testing.T) {
 	t.Run("success", func(t *testing.T) {
-		repo := &mockPaymentRepository{}
-		svc := NewPaymentService(repo)
+		repo := newStore(t, repository.Payment{AmountMinor: 1000, AuthorizedMinor: 1000, Currency: "USD", Status: repository.StatusAuthorized}).Payments()
+		svc := NewPaymentService(repo, PaymentOptions{})
 
-		err := svc.DeletePayment(1)
+		err := svc.DeletePayment(t.Context(), 1, "alice")
 		if err != nil {
 			t.Fatalf("unexpected error: %v", err)
 		}
+		if _, err := repo.GetByID(t.Context(), 1); !errors.Is(err, repository.ErrNotFound) {
+			t.Errorf("got error %v, want the payment to be deleted", err)
+		}
+		transitions, err := repo.ListTransitions(t.Context(), 1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(transitions) != 1 || transitions[0].ToStatus != repository.StatusCanceled || transitions[0].Actor != "alice" {
+			t.Errorf("got transitions %+v, want a cancellation by alice", transitions)
+		}
+	})
+
+	t.Run("final status", func(t *testing.T) {
+		for _, status := range []repository.Status{repository.StatusCaptured, repository.StatusSettled, repository.StatusCanceled, repository.StatusRefunded} {
+			svc := NewPaymentService(newStore(t, repository.Payment{AmountMinor: 1000, Currency: "USD", Status: status}).Payments(), PaymentOptions{})
+
+			err := svc.DeletePayment(t.Context(), 1, "alice")
+			var terr *TransitionError
+			if !errors.As(err, &terr) {
+				t.Errorf("%s: got error %v, want *TransitionError", status, err)
+			}
+		}
 	})
 
 	t.Run("repository error", func(t *testing.T) {
-		repo := &mockPaymentRepository{deleteErr: errors.New("delete failed")}
-		svc := NewPaymentService(repo)
+		svc := NewPaymentService(brokenPayments{errors.New("delete failed")}, PaymentOptions{})
 
-		err := svc.DeletePayment(1)
+		err := svc.DeletePayment(t.Context(), 1, "alice")
 		if err == nil {
 			t.Fatal("expected error from repository")
 		}
 	})
 }
+
+func TestPaymentService_PurgePayment(t *testing.T) {
+	svc := NewPaymentService(newStore(t, repository.Payment{AmountMinor: 1000, Currency: "USD"}).Payments(), PaymentOptions{})
+	if err := svc.PurgePayment(t.Context(), 1); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("payment not deleted: got error %v, want ErrNotFound", err)
+	}
+	if err := svc.DeletePayment(t.Context(), 1, "alice"); err != nil {
+		t.Fatal(err)
+	}
+	if err := svc.PurgePayment(t.Context(), 1); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := svc.PurgePayment(t.Context(), 1); !errors.Is(err, ErrNotFound) {
+		t.Errorf("purged twice: got error %v, want ErrNotFound", err)
+	}
+
+	svc = NewPaymentService(brokenPayments{errors.New("db error")}, PaymentOptions{})
+	if err := svc.PurgePayment(t.Context(), 1); err == nil {
+		t.Fatal("expected error from repository")
+	}
+}
+
+func TestPaymentService_TransitionPayment(t *testing.T) {
+	pending := repository.Payment{AmountMinor: 1000, Currency: "USD"}
+
+	t.Run("allowed", func(t *testing.T) {
+		svc := NewPaymentService(newStore(t, pending).Payments(), PaymentOptions{})
+
+		payment, err := svc.TransitionPayment(t.Context(), 1, repository.StatusAuthorized, "3DS passed", "alice")
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if payment.Status != repository.StatusAuthorized {
+			t.Errorf("got status %q, want %q", payment.Status, repository.StatusAuthorized)
+		}
+	})
+
+	t.Run("cancel records actor", func(t *testing.T) {
+		svc := NewPaymentService(newStore(t, pending).Payments(), PaymentOptions{})
+
+		payment, err := svc.TransitionPayment(t.Context(), 1, repository.StatusCanceled, "", "alice")
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if payment.CanceledAt == nil || payment.CanceledBy != "alice" {
+			t.Errorf("cancellation not recorded: %+v", payment)
+		}
+		if payment.DeletedAt != nil {
+			t.Error("cancel must not delete the payment")
+		}
+	})
+
+	t.Run("illegal", func(t *testing.T) {
+		repo := newStore(t, pending).Payments()
+		svc := NewPaymentService(repo, PaymentOptions{})
+
+		_, err := svc.TransitionPayment(t.Context(), 1, repository.StatusSettled, "", "alice")
+		var terr *TransitionError
+		if !errors.As(err, &terr) {
+			t.Fatalf("got error %v, want *TransitionError", err)
+		}
+		if transitions, _ := repo.ListTransitions(t.Context(), 1); len(transitions) != 0 {
+			t.Error("illegal transition must not be stored")
+		}
+	})
+
+	t.Run("repository error", func(t *testing.T) {
+		svc := NewPaymentService(brokenPayments{errors.New("db error")}, PaymentOptions{})
+
+		if _, err := svc.TransitionPayment(t.Context(), 1, repository.StatusAuthorized, "", "alice"); err == nil {
+			t.Fatal("expected error from repository")
+		}
+	})
+}
+
+func TestPaymentService_ListTransitions(t *testing.T) {
+	t.Run("success", func(t *testing.T) {
+		svc := NewPaymentService(newStore(t, repository.Payment{AmountMinor: 1000, Currency: "USD"}).Payments(), PaymentOptions{})
+		if _, err := svc.Authorize(t.Context(), 1, "", "alice"); err != nil {
+			t.Fatal(err)
+		}
+
+		transitions, err := svc.ListTransitions(t.Context(), 1)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if len(transitions) != 1 {
+			t.Errorf("got %d transitions, want 1", len(transitions))
+		}
+	})
+
+	t.Run("payment not found", func(t *testing.T) {
+		svc := NewPaymentService(memory.NewStore().Payments(), PaymentOptions{})
+
+		if _, err := svc.ListTransitions(t.Context(), 1); !errors.Is(err, ErrNotFound) {
+			t.Fatalf("got error %v, want ErrNotFound", err)
+		}
+	})
+}
@@ -0,0 +1,80 @@
+package service
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/eterrni/payments-api/internal/money"
+	"github.com/eterrni/payments-api/internal/repository"
+)
+
+type RefundService struct {
+	payments repository.PaymentRepository
+	refunds  repository.RefundRepository
+}
+
+// RefundRequest refunds Amount minor units, or everything that has not been
+// refunded yet when Amount is nil.
+type RefundRequest struct {
+	Amount *int64
+	Reason string
+	Actor  string
+}
+
+func NewRefundService(payments repository.PaymentRepository, refunds repository.RefundRepository) RefundService {
+	return RefundService{payments: payments, refunds: refunds}
+}
+
+func (s *RefundService) CreateRefund(ctx context.Context, paymentID uint, req RefundRequest) (*repository.Refund, error) {
+	if req.Amount != nil && *req.Amount <= 0 {
+		return nil, &ValidationError{Fields: []FieldError{{Field: "amount", Message: "invalid refund amount"}}}
+	}
+
+	refund, _, err := s.refunds.Create(ctx, paymentID, func(p *repository.Payment, refund *repository.Refund) error {
+		return applyRefund(p, refund, req)
+	})
+	return refund, fromRepository(err, "payment", paymentID)
+}
+
+func (s *RefundService) ListRefunds(ctx context.Context, paymentID uint) ([]repository.Refund, error) {
+	if _, err := s.payments.GetByID(ctx, paymentID); err != nil {
+		return nil, fromRepository(err, "payment", paymentID)
+	}
+	refunds, err := s.refunds.ListByPayment(ctx, paymentID)
+	return refunds, fromRepository(err, "payment", paymentID)
+}
+
+// applyRefund checks req against the locked payment and records the refund
+// on it. Only the captured amount can be refunded; the payment becomes
+// refunded once all of it has been returned and partially_refunded before
+// that.
+func applyRefund(p *repository.Payment, refund *repository.Refund, req RefundRequest) error {
+	if !CanTransition(p.Status, repository.StatusRefunded) {
+		return &TransitionError{From: p.Status, To: repository.StatusRefunded}
+	}
+
+	remaining := p.CapturedMinor - p.RefundedMinor
+	amount := remaining
+	if req.Amount != nil {
+		amount = *req.Amount
+	}
+	if amount > remaining {
+		left := money.Money{Amount: remaining, Currency: p.Currency}
+		return &ValidationError{Fields: []FieldError{{
+			Field:   "amount",
+			Message: fmt.Sprintf("refund exceeds the refundable amount of %s", left),
+		}}}
+	}
+
+	refund.AmountMinor = amount
+	refund.Currency = p.Currency
+	refund.Reason = req.Reason
+	refund.CreatedBy = req.Actor
+	p.RefundedMinor += amount
+
+	to := repository.StatusPartiallyRefunded
+	if p.RefundedMinor == p.CapturedMinor {
+		to = repository.StatusRefunded
+	}
+	return transition(p, to)
+}
@@ -0,0 +1,175 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/eterrni/payments-api/internal/repository"
+	"github.com/eterrni/payments-api/internal/repository/memory"
+)
+
+type mockRefundRepository struct {
+	payment   repository.Payment
+	createErr error
+	refunds   []repository.Refund
+}
+
+func (m *mockRefundRepository) Create(ctx context.Context, paymentID uint, apply func(p *repository.Payment, refund *repository.Refund) error) (*repository.Refund, *repository.Payment, error) {
+	if m.createErr != nil {
+		return nil, nil, m.createErr
+	}
+	payment := m.payment
+	refund := repository.Refund{PaymentID: paymentID}
+	if err := apply(&payment, &refund); err != nil {
+		return nil, nil, err
+	}
+	m.payment = payment
+	m.refunds = append(m.refunds, refund)
+	return &refund, &payment, nil
+}
+
+func (m *mockRefundRepository) ListByPayment(ctx context.Context, paymentID uint) ([]repository.Refund, error) {
+	return m.refunds, nil
+}
+
+func capturedPayment() repository.Payment {
+	return repository.Payment{ID: 1, AmountMinor: 1000, AuthorizedMinor: 1000, CapturedMinor: 1000, Currency: "USD", Status: repository.StatusCaptured}
+}
+
+func TestRefundService_CreateRefund(t *testing.T) {
+	amount := func(n int64) *int64 { return &n }
+
+	t.Run("full refund", func(t *testing.T) {
+		refunds := &mockRefundRepository{payment: capturedPayment()}
+		svc := NewRefundService(memory.NewStore().Payments(), refunds)
+
+		refund, err := svc.CreateRefund(t.Context(), 1, RefundRequest{Reason: "customer request", Actor: "alice"})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if refund.AmountMinor != 1000 || refund.Currency != "USD" || refund.Reason != "customer request" || refund.CreatedBy != "alice" {
+			t.Errorf("unexpected refund %+v", refund)
+		}
+		if refunds.payment.Status != repository.StatusRefunded {
+			t.Errorf("got status %q, want %q", refunds.payment.Status, repository.StatusRefunded)
+		}
+	})
+
+	t.Run("partial refunds", func(t *testing.T) {
+		refunds := &mockRefundRepository{payment: capturedPayment()}
+		svc := NewRefundService(memory.NewStore().Payments(), refunds)
+
+		if _, err := svc.CreateRefund(t.Context(), 1, RefundRequest{Amount: amount(300)}); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if refunds.payment.Status != repository.StatusPartiallyRefunded || refunds.payment.RefundedMinor != 300 {
+			t.Fatalf("got status %q refunded %d", refunds.payment.Status, refunds.payment.RefundedMinor)
+		}
+		if _, err := svc.CreateRefund(t.Context(), 1, RefundRequest{Amount: amount(300)}); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		refund, err := svc.CreateRefund(t.Context(), 1, RefundRequest{})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if refund.AmountMinor != 400 {
+			t.Errorf("got remaining refund %d, want 400", refund.AmountMinor)
+		}
+		if refunds.payment.Status != repository.StatusRefunded {
+			t.Errorf("got status %q, want %q", refunds.payment.Status, repository.StatusRefunded)
+		}
+	})
+
+	t.Run("exceeds captured amount", func(t *testing.T) {
+		payment := capturedPayment()
+		payment.RefundedMinor = 900
+		payment.Status = repository.StatusPartiallyRefunded
+		refunds := &mockRefundRepository{payment: payment}
+		svc := NewRefundService(memory.NewStore().Payments(), refunds)
+
+		_, err := svc.CreateRefund(t.Context(), 1, RefundRequest{Amount: amount(101)})
+		var verr *ValidationError
+		if !errors.As(err, &verr) {
+			t.Fatalf("got error %v, want *ValidationError", err)
+		}
+		if refunds.payment.RefundedMinor != 900 {
+			t.Error("rejected refund changed the payment")
+		}
+	})
+
+	t.Run("limited by partial capture", func(t *testing.T) {
+		payment := capturedPayment()
+		payment.CapturedMinor = 600
+		refunds := &mockRefundRepository{payment: payment}
+		svc := NewRefundService(memory.NewStore().Payments(), refunds)
+
+		_, err := svc.CreateRefund(t.Context(), 1, RefundRequest{Amount: amount(601)})
+		var verr *ValidationError
+		if !errors.As(err, &verr) {
+			t.Fatalf("got error %v, want *ValidationError", err)
+		}
+		refund, err := svc.CreateRefund(t.Context(), 1, RefundRequest{})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if refund.AmountMinor != 600 || refunds.payment.Status != repository.StatusRefunded {
+			t.Errorf("got refund of %d and status %q, want 600 and %q", refund.AmountMinor, refunds.payment.Status, repository.StatusRefunded)
+		}
+	})
+
+	t.Run("invalid amount", func(t *testing.T) {
+		svc := NewRefundService(memory.NewStore().Payments(), &mockRefundRepository{payment: capturedPayment()})
+
+		_, err := svc.CreateRefund(t.Context(), 1, RefundRequest{Amount: amount(0)})
+		var verr *ValidationError
+		if !errors.As(err, &verr) {
+			t.Fatalf("got error %v, want *ValidationError", err)
+		}
+	})
+
+	t.Run("not refundable", func(t *testing.T) {
+		for _, status := range []repository.Status{repository.StatusPending, repository.StatusAuthorized, repository.StatusRefunded, repository.StatusCanceled} {
+			payment := capturedPayment()
+			payment.Status = status
+			svc := NewRefundService(memory.NewStore().Payments(), &mockRefundRepository{payment: payment})
+
+			_, err := svc.CreateRefund(t.Context(), 1, RefundRequest{})
+			var terr *TransitionError
+			if !errors.As(err, &terr) {
+				t.Errorf("%s: got error %v, want *TransitionError", status, err)
+			}
+		}
+	})
+
+	t.Run("repository error", func(t *testing.T) {
+		svc := NewRefundService(memory.NewStore().Payments(), &mockRefundRepository{createErr: errors.New("db error")})
+
+		if _, err := svc.CreateRefund(t.Context(), 1, RefundRequest{}); err == nil {
+			t.Fatal("expected error from repository")
+		}
+	})
+}
+
+func TestRefundService_ListRefunds(t *testing.T) {
+	t.Run("success", func(t *testing.T) {
+		refunds := &mockRefundRepository{refunds: []repository.Refund{{ID: 1, PaymentID: 1}}}
+		svc := NewRefundService(newStore(t, capturedPayment()).Payments(), refunds)
+
+		list, err := svc.ListRefunds(t.Context(), 1)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if len(list) != 1 {
+			t.Errorf("got %d refunds, want 1", len(list))
+		}
+	})
+
+	t.Run("payment not found", func(t *testing.T) {
+		svc := NewRefundService(memory.NewStore().Payments(), &mockRefundRepository{})
+
+		if _, err := svc.ListRefunds(t.Context(), 1); !errors.Is(err, ErrNotFound) {
+			t.Fatalf("got error %v, want ErrNotFound", err)
+		}
+	})
+}
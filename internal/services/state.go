@@ -0,0 +1,93 @@
+package service
+
+import (
+	"fmt"
+
+	"github.com/eterrni/payments-api/internal/repository"
+)
+
+// transitions is the payment lifecycle:
+//
+//	pending -> authorized -> captured -> settled
+//	pending, authorized -> failed | canceled
+//	authorized -> expired
+//	captured, settled, partially_refunded -> partially_refunded | refunded
+//
+// The refund statuses are only reached through refunds and expired only
+// when an authorization has not been captured in time. Statuses without
+// outgoing edges are final.
+var transitions = map[repository.Status][]repository.Status{
+	repository.StatusPending:           {repository.StatusAuthorized, repository.StatusFailed, repository.StatusCanceled},
+	repository.StatusAuthorized:        {repository.StatusCaptured, repository.StatusFailed, repository.StatusCanceled, repository.StatusExpired},
+	repository.StatusCaptured:          {repository.StatusSettled, repository.StatusPartiallyRefunded, repository.StatusRefunded},
+	repository.StatusSettled:           {repository.StatusPartiallyRefunded, repository.StatusRefunded},
+	repository.StatusPartiallyRefunded: {repository.StatusPartiallyRefunded, repository.StatusRefunded},
+}
+
+var statuses = []repository.Status{
+	repository.StatusPending,
+	repository.StatusAuthorized,
+	repository.StatusCaptured,
+	repository.StatusSettled,
+	repository.StatusFailed,
+	repository.StatusCanceled,
+	repository.StatusExpired,
+	repository.StatusPartiallyRefunded,
+	repository.StatusRefunded,
+}
+
+// TransitionError is returned when a payment cannot move from its current
+// status to the requested one. Reason, if set, explains why a move the
+// lifecycle allows was refused.
+type TransitionError struct {
+	From   repository.Status
+	To     repository.Status
+	Reason string
+}
+
+func (e *TransitionError) Error() string {
+	msg := fmt.Sprintf("cannot move payment from %s to %s", e.From, e.To)
+	if e.Reason != "" {
+		msg += ": " + e.Reason
+	}
+	return msg
+}
+
+func (e *TransitionError) Is(target error) bool {
+	return target == ErrConflict
+}
+
+func CanTransition(from, to repository.Status) bool {
+	for _, next := range transitions[from] {
+		if next == to {
+			return true
+		}
+	}
+	return false
+}
+
+func IsKnownStatus(status repository.Status) bool {
+	for _, s := range statuses {
+		if s == status {
+			return true
+		}
+	}
+	return false
+}
+
+func IsFinal(status repository.Status) bool {
+	return len(transitions[status]) == 0
+}
+
+func transition(payment *repository.Payment, to repository.Status) error {
+	if !CanTransition(payment.Status, to) {
+		return &TransitionError{From: payment.Status, To: to}
+	}
+	// An expired payment keeps the time its authorization expired; any
+	// other move releases the authorization.
+	if payment.Status == repository.StatusAuthorized && to != repository.StatusExpired {
+		payment.AuthorizationExpiresAt = nil
+	}
+	payment.Status = to
+	return nil
+}
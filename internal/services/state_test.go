@@ -0,0 +1,62 @@
+package service
+
+import (
+	"testing"
+
+	"github.com/eterrni/payments-api/internal/repository"
+)
+
+func TestCanTransition(t *testing.T) {
+	tests := []struct {
+		from, to repository.Status
+		want     bool
+	}{
+		{repository.StatusPending, repository.StatusAuthorized, true},
+		{repository.StatusPending, repository.StatusFailed, true},
+		{repository.StatusPending, repository.StatusCanceled, true},
+		{repository.StatusPending, repository.StatusCaptured, false},
+		{repository.StatusPending, repository.StatusSettled, false},
+		{repository.StatusAuthorized, repository.StatusCaptured, true},
+		{repository.StatusAuthorized, repository.StatusCanceled, true},
+		{repository.StatusAuthorized, repository.StatusPending, false},
+		{repository.StatusAuthorized, repository.StatusExpired, true},
+		{repository.StatusPending, repository.StatusExpired, false},
+		{repository.StatusExpired, repository.StatusCaptured, false},
+		{repository.StatusCaptured, repository.StatusSettled, true},
+		{repository.StatusCaptured, repository.StatusCanceled, false},
+		{repository.StatusSettled, repository.StatusFailed, false},
+		{repository.StatusFailed, repository.StatusAuthorized, false},
+		{repository.StatusCanceled, repository.StatusPending, false},
+		{repository.StatusCaptured, repository.StatusPartiallyRefunded, true},
+		{repository.StatusSettled, repository.StatusRefunded, true},
+		{repository.StatusPartiallyRefunded, repository.StatusPartiallyRefunded, true},
+		{repository.StatusPartiallyRefunded, repository.StatusRefunded, true},
+		{repository.StatusPending, repository.StatusRefunded, false},
+		{repository.StatusRefunded, repository.StatusPartiallyRefunded, false},
+	}
+	for _, tt := range tests {
+		if got := CanTransition(tt.from, tt.to); got != tt.want {
+			t.Errorf("%s -> %s: got %v, want %v", tt.from, tt.to, got, tt.want)
+		}
+	}
+}
+
+func TestIsFinal(t *testing.T) {
+	final := map[repository.Status]bool{
+		repository.StatusPending:    false,
+		repository.StatusAuthorized: false,
+		repository.StatusCaptured:   false,
+		repository.StatusSettled:    false,
+		repository.StatusFailed:     true,
+		repository.StatusCanceled:   true,
+		repository.StatusExpired:    true,
+
+		repository.StatusPartiallyRefunded: false,
+		repository.StatusRefunded:          true,
+	}
+	for status, want := range final {
+		if got := IsFinal(status); got != want {
+			t.Errorf("%s: got %v, want %v", status, got, want)
+		}
+	}
+}
@@ -0,0 +1,23 @@
+package middleware
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"strings"
+
+	"github.com/eterrni/payments-api/pkg/problem"
+)
+
+// AdminAuth only lets through requests carrying "Authorization: Bearer token".
+func AdminAuth(token string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			got := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+			if token == "" || subtle.ConstantTimeCompare([]byte(got), []byte(token)) != 1 {
+				problem.Respond(w, r, problem.Unauthorized, "")
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
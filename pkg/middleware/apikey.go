@@ -0,0 +1,83 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/eterrni/payments-api/pkg/problem"
+)
+
+// ErrInvalidKey is returned by a KeyVerifier for keys that are unknown,
+// revoked or expired.
+var ErrInvalidKey = errors.New("invalid API key")
+
+// Key is the API key a request was authenticated with.
+type Key struct {
+	ID         uint
+	MerchantID string
+	// Scopes are everything the key may do, implied scopes included.
+	Scopes []string
+}
+
+// KeyVerifier resolves the API keys requests present.
+type KeyVerifier interface {
+	VerifyKey(ctx context.Context, key string) (*Key, error)
+}
+
+type keyContextKey struct{}
+
+// KeyFromContext returns the key APIKeyAuth authenticated the request with.
+func KeyFromContext(ctx context.Context) (*Key, bool) {
+	key, ok := ctx.Value(keyContextKey{}).(*Key)
+	return key, ok
+}
+
+// APIKeyAuth only lets through requests carrying "Authorization: Bearer key"
+// with a key keys accepts, and makes the key available to KeyFromContext.
+// Other requests get 401, or 503 if the key could not be checked.
+func APIKeyAuth(keys KeyVerifier) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			got, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+			if !ok || got == "" {
+				problem.Respond(w, r, problem.Unauthorized, "")
+				return
+			}
+			key, err := keys.VerifyKey(r.Context(), got)
+			switch {
+			case errors.Is(err, ErrInvalidKey):
+				slog.Debug("Rejected API key", "method", r.Method, "uri", r.RequestURI)
+				problem.Respond(w, r, problem.Unauthorized, "")
+				return
+			case err != nil:
+				slog.Error("Could not verify API key", "error", err)
+				problem.Respond(w, r, problem.Unavailable, "")
+				return
+			}
+			next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), keyContextKey{}, key)))
+		})
+	}
+}
+
+// RequireScope only lets through requests authenticated by APIKeyAuth with a
+// key that has scope; others get 403.
+func RequireScope(scope string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			key, ok := KeyFromContext(r.Context())
+			if !ok {
+				problem.Respond(w, r, problem.Unauthorized, "")
+				return
+			}
+			if !slices.Contains(key.Scopes, scope) {
+				problem.Respond(w, r, problem.Forbidden, "API key lacks the "+scope+" scope")
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
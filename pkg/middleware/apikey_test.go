@@ -0,0 +1,75 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+type mockVerifier map[string]*Key
+
+func (m mockVerifier) VerifyKey(ctx context.Context, key string) (*Key, error) {
+	if key == "broken" {
+		return nil, errors.New("connection refused")
+	}
+	if k, ok := m[key]; ok {
+		return k, nil
+	}
+	return nil, ErrInvalidKey
+}
+
+func TestAPIKeyAuth(t *testing.T) {
+	keys := mockVerifier{
+		"reader": {ID: 1, MerchantID: "acme", Scopes: []string{"read"}},
+		"writer": {ID: 2, MerchantID: "acme", Scopes: []string{"read", "write"}},
+	}
+	var got *Key
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got, _ = KeyFromContext(r.Context())
+	})
+
+	tests := []struct {
+		name   string
+		header string
+		scope  string
+		want   int
+	}{
+		{"valid key", "Bearer reader", "read", http.StatusOK},
+		{"missing scope", "Bearer reader", "write", http.StatusForbidden},
+		{"another scope", "Bearer writer", "write", http.StatusOK},
+		{"unknown key", "Bearer guess", "read", http.StatusUnauthorized},
+		{"missing header", "", "read", http.StatusUnauthorized},
+		{"empty key", "Bearer ", "read", http.StatusUnauthorized},
+		{"basic auth", "Basic cmVhZGVy", "read", http.StatusUnauthorized},
+		{"verifier failing", "Bearer broken", "read", http.StatusServiceUnavailable},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got = nil
+			req := httptest.NewRequest(http.MethodGet, "/payments", nil)
+			if tt.header != "" {
+				req.Header.Set("Authorization", tt.header)
+			}
+			w := httptest.NewRecorder()
+
+			APIKeyAuth(keys)(RequireScope(tt.scope)(ok)).ServeHTTP(w, req)
+
+			if w.Code != tt.want {
+				t.Errorf("got status %d, want %d", w.Code, tt.want)
+			}
+			if tt.want == http.StatusOK && (got == nil || got.MerchantID != "acme") {
+				t.Errorf("got key %+v in the context", got)
+			}
+		})
+	}
+
+	t.Run("scope without a key", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		RequireScope("read")(ok).ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/payments", nil))
+		if w.Code != http.StatusUnauthorized {
+			t.Errorf("got status %d, want %d", w.Code, http.StatusUnauthorized)
+		}
+	})
+}
@@ -1,16 +1,18 @@
 package middleware
 
 import (
-	"log"
+	"log/slog"
 	"net/http"
 	"time"
+
+	"github.com/eterrni/payments-api/pkg/problem"
 )
 
 func LoggingMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		start := time.Now()
 		next.ServeHTTP(w, r)
-		log.Printf("%s %s took %s", r.Method, r.RequestURI, time.Since(start))
+		slog.Info("Request", "method", r.Method, "uri", r.RequestURI, "took", time.Since(start))
 	})
 }
 
@@ -18,7 +20,8 @@ func RecoveryMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		defer func() {
 			if err := recover(); err != nil {
-				http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+				slog.Error("Panic serving request", "method", r.Method, "uri", r.RequestURI, "panic", err)
+				problem.Respond(w, r, problem.Internal, "")
 			}
 		}()
 		next.ServeHTTP(w, r)
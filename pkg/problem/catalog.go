@@ -0,0 +1,57 @@
+package problem
+
+import "net/http"
+
+// TypePrefix prefixes the code of a kind to form its problem type URI.
+const TypePrefix = "urn:payments-api:problem:"
+
+// Kind is a catalog entry: one class of error with its own code, title and
+// HTTP status. Codes are part of the API and must not change once published.
+type Kind struct {
+	Code   string
+	Title  string
+	Status int
+}
+
+func (k Kind) URI() string {
+	return TypePrefix + k.Code
+}
+
+var (
+	InvalidBody          = Kind{"invalid_body", "Request body is invalid", http.StatusBadRequest}
+	InvalidParameter     = Kind{"invalid_parameter", "Request parameter is invalid", http.StatusBadRequest}
+	Unauthorized         = Kind{"unauthorized", "Authentication required", http.StatusUnauthorized}
+	Forbidden            = Kind{"forbidden", "Credentials do not allow this request", http.StatusForbidden}
+	NotFound             = Kind{"not_found", "Resource not found", http.StatusNotFound}
+	InvalidTransition    = Kind{"invalid_transition", "Operation not allowed in the current status", http.StatusConflict}
+	Conflict             = Kind{"conflict", "Request conflicts with the current state of the resource", http.StatusConflict}
+	IdempotencyKeyInUse  = Kind{"idempotency_key_in_use", "A request with this Idempotency-Key is still in progress", http.StatusConflict}
+	IdempotencyKeyReused = Kind{"idempotency_key_reused", "Idempotency-Key was already used with a different request", http.StatusUnprocessableEntity}
+	ValidationFailed     = Kind{"validation_failed", "Request failed validation", http.StatusUnprocessableEntity}
+	PreconditionFailed   = Kind{"precondition_failed", "Resource was modified since it was read", http.StatusPreconditionFailed}
+	PreconditionRequired = Kind{"precondition_required", "If-Match header is required", http.StatusPreconditionRequired}
+	PayloadTooLarge      = Kind{"payload_too_large", "Request body is too large", http.StatusRequestEntityTooLarge}
+	UnsupportedMediaType = Kind{"unsupported_media_type", "Content-Type is not supported", http.StatusUnsupportedMediaType}
+	Internal             = Kind{"internal_error", "Internal server error", http.StatusInternalServerError}
+	Unavailable          = Kind{"service_unavailable", "Service temporarily unavailable", http.StatusServiceUnavailable}
+)
+
+// Catalog lists every kind, e.g. for documentation.
+var Catalog = []Kind{
+	InvalidBody,
+	InvalidParameter,
+	Unauthorized,
+	Forbidden,
+	NotFound,
+	InvalidTransition,
+	Conflict,
+	IdempotencyKeyInUse,
+	IdempotencyKeyReused,
+	ValidationFailed,
+	PreconditionFailed,
+	PreconditionRequired,
+	PayloadTooLarge,
+	UnsupportedMediaType,
+	Internal,
+	Unavailable,
+}
@@ -0,0 +1,56 @@
+// Package problem writes error responses as RFC 7807 problem details
+// (application/problem+json). Every response carries a stable code from the
+// catalog so clients never have to parse the human-readable detail.
+package problem
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+const ContentType = "application/problem+json"
+
+// Problem is the body of an error response.
+type Problem struct {
+	Type     string       `json:"type"`
+	Title    string       `json:"title"`
+	Status   int          `json:"status"`
+	Detail   string       `json:"detail,omitempty"`
+	Instance string       `json:"instance,omitempty"`
+	Code     string       `json:"code"`
+	Errors   []FieldError `json:"errors,omitempty"`
+}
+
+// FieldError describes one invalid field of a request.
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// New builds the problem of kind k. detail explains this occurrence of the
+// problem and may be empty.
+func New(k Kind, detail string, fields ...FieldError) *Problem {
+	return &Problem{
+		Type:   k.URI(),
+		Title:  k.Title,
+		Status: k.Status,
+		Detail: detail,
+		Code:   k.Code,
+		Errors: fields,
+	}
+}
+
+// Write sends p. The instance defaults to the path of r when r is not nil.
+func Write(w http.ResponseWriter, r *http.Request, p *Problem) {
+	if p.Instance == "" && r != nil {
+		p.Instance = r.URL.Path
+	}
+	w.Header().Set("Content-Type", ContentType)
+	w.WriteHeader(p.Status)
+	json.NewEncoder(w).Encode(p)
+}
+
+// Respond is shorthand for Write(w, r, New(k, detail, fields...)).
+func Respond(w http.ResponseWriter, r *http.Request, k Kind, detail string, fields ...FieldError) {
+	Write(w, r, New(k, detail, fields...))
+}
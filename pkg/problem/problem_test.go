@@ -0,0 +1,83 @@
+package problem
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestRespond(t *testing.T) {
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodPost, "/payments", nil)
+
+	Respond(w, r, ValidationFailed, "invalid payment amount", FieldError{Field: "amount", Message: "invalid payment amount"})
+
+	if w.Code != http.StatusUnprocessableEntity {
+		t.Errorf("got status %d, want %d", w.Code, http.StatusUnprocessableEntity)
+	}
+	if ct := w.Header().Get("Content-Type"); ct != ContentType {
+		t.Errorf("Content-Type = %q, want %s", ct, ContentType)
+	}
+	var got map[string]interface{}
+	if err := json.NewDecoder(w.Body).Decode(&got); err != nil {
+		t.Fatalf("decode body: %v", err)
+	}
+	want := map[string]interface{}{
+		"type":     "urn:payments-api:problem:validation_failed",
+		"title":    "Request failed validation",
+		"status":   float64(422),
+		"detail":   "invalid payment amount",
+		"instance": "/payments",
+		"code":     "validation_failed",
+	}
+	for k, v := range want {
+		if got[k] != v {
+			t.Errorf("%s = %v, want %v", k, got[k], v)
+		}
+	}
+	errs, ok := got["errors"].([]interface{})
+	if !ok || len(errs) != 1 {
+		t.Fatalf("got errors %v, want one field error", got["errors"])
+	}
+}
+
+func TestWrite(t *testing.T) {
+	t.Run("optional members omitted", func(t *testing.T) {
+		w := httptest.NewRecorder()
+
+		Write(w, nil, New(NotFound, ""))
+
+		want := `{"type":"urn:payments-api:problem:not_found","title":"Resource not found","status":404,"code":"not_found"}` + "\n"
+		if w.Body.String() != want {
+			t.Errorf("got %q, want %q", w.Body.String(), want)
+		}
+	})
+
+	t.Run("explicit instance kept", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		p := New(Conflict, "")
+		p.Instance = "/payments/1/refunds/2"
+
+		Write(w, httptest.NewRequest(http.MethodGet, "/other", nil), p)
+
+		var got Problem
+		json.NewDecoder(w.Body).Decode(&got)
+		if got.Instance != "/payments/1/refunds/2" {
+			t.Errorf("got instance %q", got.Instance)
+		}
+	})
+}
+
+func TestCatalog(t *testing.T) {
+	seen := map[string]bool{}
+	for _, k := range Catalog {
+		if k.Code == "" || k.Title == "" || k.Status < 400 {
+			t.Errorf("incomplete kind %+v", k)
+		}
+		if seen[k.Code] {
+			t.Errorf("duplicate code %q", k.Code)
+		}
+		seen[k.Code] = true
+	}
+}
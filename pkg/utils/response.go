@@ -3,14 +3,44 @@ package utils
 import (
 	"encoding/json"
 	"net/http"
+
+	"github.com/eterrni/payments-api/pkg/problem"
 )
 
+// ListResponse is the envelope of every list endpoint. NextCursor is null on
+// the last page.
+type ListResponse struct {
+	Data       interface{} `json:"data"`
+	NextCursor *string     `json:"next_cursor"`
+	HasMore    bool        `json:"has_more"`
+}
+
 func RespondWithJSON(w http.ResponseWriter, statusCode int, data interface{}) {
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(statusCode)
 	json.NewEncoder(w).Encode(data)
 }
 
+func RespondWithList(w http.ResponseWriter, data interface{}, nextCursor string, hasMore bool) {
+	resp := ListResponse{Data: data, HasMore: hasMore}
+	if nextCursor != "" {
+		resp.NextCursor = &nextCursor
+	}
+	RespondWithJSON(w, http.StatusOK, resp)
+}
+
+// RespondWithError sends message as the detail of a problem+json response
+// of the first catalog kind with statusCode.
+//
+// Deprecated: Use problem.Respond, which takes the kind, and with it the
+// code, explicitly.
 func RespondWithError(w http.ResponseWriter, statusCode int, message string) {
-	RespondWithJSON(w, statusCode, map[string]string{"error": message})
+	k := problem.Kind{Code: "error", Title: http.StatusText(statusCode), Status: statusCode}
+	for _, c := range problem.Catalog {
+		if c.Status == statusCode {
+			k = c
+			break
+		}
+	}
+	problem.Respond(w, nil, k, message)
 }
@@ -5,6 +5,8 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"testing"
+
+	"github.com/eterrni/payments-api/pkg/problem"
 )
 
 func TestRespondWithJSON(t *testing.T) {
@@ -29,18 +31,56 @@ func TestRespondWithJSON(t *testing.T) {
 }
 
 func TestRespondWithError(t *testing.T) {
-	w := httptest.NewRecorder()
+	for _, tt := range []struct {
+		status int
+		code   string
+	}{
+		{http.StatusBadRequest, "invalid_body"},
+		{http.StatusTeapot, "error"},
+	} {
+		w := httptest.NewRecorder()
 
-	RespondWithError(w, http.StatusBadRequest, "invalid request")
+		RespondWithError(w, tt.status, "invalid request")
 
-	if w.Code != http.StatusBadRequest {
-		t.Errorf("got status %d, want %d", w.Code, http.StatusBadRequest)
-	}
-	var result map[string]string
-	if err := json.NewDecoder(w.Body).Decode(&result); err != nil {
-		t.Fatalf("decode body: %v", err)
-	}
-	if result["error"] != "invalid request" {
-		t.Errorf("got error %q, want invalid request", result["error"])
+		if w.Code != tt.status {
+			t.Errorf("got status %d, want %d", w.Code, tt.status)
+		}
+		if w.Header().Get("Content-Type") != problem.ContentType {
+			t.Errorf("Content-Type = %q, want %s", w.Header().Get("Content-Type"), problem.ContentType)
+		}
+		var result problem.Problem
+		if err := json.NewDecoder(w.Body).Decode(&result); err != nil {
+			t.Fatalf("decode body: %v", err)
+		}
+		if result.Detail != "invalid request" || result.Code != tt.code || result.Status != tt.status {
+			t.Errorf("got %+v, want detail invalid request and code %s", result, tt.code)
+		}
 	}
 }
+
+func TestRespondWithList(t *testing.T) {
+	t.Run("more pages", func(t *testing.T) {
+		w := httptest.NewRecorder()
+
+		RespondWithList(w, []int{1, 2}, "next", true)
+
+		var result ListResponse
+		if err := json.NewDecoder(w.Body).Decode(&result); err != nil {
+			t.Fatalf("decode body: %v", err)
+		}
+		if result.NextCursor == nil || *result.NextCursor != "next" || !result.HasMore {
+			t.Errorf("got %+v", result)
+		}
+	})
+
+	t.Run("last page", func(t *testing.T) {
+		w := httptest.NewRecorder()
+
+		RespondWithList(w, []int{}, "", false)
+
+		want := `{"data":[],"next_cursor":null,"has_more":false}` + "\n"
+		if w.Body.String() != want {
+			t.Errorf("got %q, want %q", w.Body.String(), want)
+		}
+	})
+}